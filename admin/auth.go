@@ -0,0 +1,119 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/valinurovam/garagemq/auth"
+	"github.com/valinurovam/garagemq/server"
+)
+
+// access levels of admin endpoints, each tag grants its level and all levels below
+const (
+	levelManagement = iota + 1
+	levelMonitoring
+	levelAdministrator
+)
+
+var tagLevels = map[string]int{
+	auth.TagManagement:    levelManagement,
+	auth.TagMonitoring:    levelMonitoring,
+	auth.TagAdministrator: levelAdministrator,
+}
+
+// AuthHandler checks HTTP basic auth credentials against broker users
+// and allows request only if user tags grant required access level
+type AuthHandler struct {
+	amqpServer *server.Server
+	handler    http.Handler
+	readLevel  int
+	writeLevel int
+}
+
+// NewAuthHandler returns handler which requires readLevel for GET requests and writeLevel for others
+func NewAuthHandler(amqpServer *server.Server, handler http.Handler, readLevel int, writeLevel int) http.Handler {
+	return &AuthHandler{
+		amqpServer: amqpServer,
+		handler:    handler,
+		readLevel:  readLevel,
+		writeLevel: writeLevel,
+	}
+}
+
+func (h *AuthHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userName, password, ok := req.BasicAuth()
+	var user *auth.User
+	var authz auth.Authorizer
+	if ok {
+		user, authz = h.amqpServer.AuthorizeUser(userName, password)
+	}
+	if user == nil {
+		resp.Header().Set("WWW-Authenticate", `Basic realm="GarageMQ"`)
+		JSONResponse(resp, &ErrorResponse{Error: "not authorized"}, http.StatusUnauthorized)
+		return
+	}
+
+	required := h.writeLevel
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		required = h.readLevel
+	}
+	if userLevel(user) < required {
+		JSONResponse(resp, &ErrorResponse{Error: "access refused"}, http.StatusForbidden)
+		return
+	}
+
+	ctx := context.WithValue(req.Context(), requestUserKey, &requestUser{user: user, authz: authz})
+	h.handler.ServeHTTP(resp, req.WithContext(ctx))
+}
+
+func userLevel(user *auth.User) int {
+	level := 0
+	for _, tag := range user.Tags {
+		if tagLevels[tag] > level {
+			level = tagLevels[tag]
+		}
+	}
+	return level
+}
+
+type contextKey int
+
+const requestUserKey contextKey = iota
+
+// requestUser is authenticated user of admin request with authorizer of its auth backend
+type requestUser struct {
+	user  *auth.User
+	authz auth.Authorizer
+}
+
+// getRequestUser returns user authenticated by AuthHandler
+func getRequestUser(req *http.Request) *requestUser {
+	return req.Context().Value(requestUserKey).(*requestUser)
+}
+
+// isAdministrator returns true if user could manage any vhost regardless of permissions
+func (u *requestUser) isAdministrator() bool {
+	return userLevel(u.user) >= levelAdministrator
+}
+
+// checkVhost checks if user has any access to vhost
+func (u *requestUser) checkVhost(vhost string) bool {
+	return u.isAdministrator() || u.authz.CheckVhost(u.user, vhost)
+}
+
+// checkResource checks if user has given access to exchange or queue in vhost
+func (u *requestUser) checkResource(vhost string, resourceType string, resource string, access string) bool {
+	return u.isAdministrator() || server.CheckResourceAccess(u.user, u.authz, vhost, resourceType, resource, access)
+}
+
+// checkTopic checks if user has given access to routing key of topic exchange in vhost
+func (u *requestUser) checkTopic(vhost string, exchange string, routingKey string, access string) bool {
+	return u.isAdministrator() || u.authz.CheckTopic(u.user, vhost, exchange, routingKey, access)
+}
+
+// refuseAccess responds that user has no access to resource in vhost
+func refuseAccess(resp http.ResponseWriter, vhost string, resourceType string, resource string, access string) {
+	message := fmt.Sprintf("%s access to %s '%s' in vhost '%s' refused", access, resourceType, resource, vhost)
+	JSONResponse(resp, &ErrorResponse{Error: message}, http.StatusForbidden)
+}
@@ -0,0 +1,56 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/valinurovam/garagemq/server"
+)
+
+type BackupHandler struct {
+	amqpServer *server.Server
+}
+
+type RestoreHandler struct {
+	amqpServer *server.Server
+}
+
+func NewBackupHandler(amqpServer *server.Server) http.Handler {
+	return &BackupHandler{amqpServer: amqpServer}
+}
+
+func NewRestoreHandler(amqpServer *server.Server) http.Handler {
+	return &RestoreHandler{amqpServer: amqpServer}
+}
+
+// ServeHTTP streams vhost backup archive, GET /backup?vhost=name
+func (h *BackupHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+	vhName := req.Form.Get("vhost")
+	if h.amqpServer.GetVhost(vhName) == nil {
+		JSONResponse(resp, &ErrorResponse{Error: fmt.Sprintf("vhost '%s' not found", vhName)}, http.StatusNotFound)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "application/octet-stream")
+	resp.Header().Set("Content-Disposition", "attachment; filename=vhost.backup")
+	if err := h.amqpServer.BackupVhost(vhName, resp); err != nil {
+		// headers are already sent, so client will receive broken archive
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// ServeHTTP restores vhost from archive in request body, POST /restore?vhost=name
+// vhost name from archive is used if vhost param is empty
+func (h *RestoreHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		JSONResponse(resp, &ErrorResponse{Error: "method not allowed"}, http.StatusMethodNotAllowed)
+		return
+	}
+	vhName := req.URL.Query().Get("vhost")
+	if err := h.amqpServer.RestoreVhost(vhName, req.Body); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	JSONResponse(resp, struct{}{}, http.StatusOK)
+}
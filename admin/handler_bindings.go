@@ -1,8 +1,11 @@
 package admin
 
 import (
+	"encoding/json"
 	"net/http"
 
+	"github.com/valinurovam/garagemq/auth"
+	"github.com/valinurovam/garagemq/exchange"
 	"github.com/valinurovam/garagemq/server"
 )
 
@@ -20,18 +23,37 @@ type Binding struct {
 	RoutingKey string `json:"routing_key"`
 }
 
+type BindingRequest struct {
+	Vhost      string                 `json:"vhost"`
+	Exchange   string                 `json:"exchange"`
+	Queue      string                 `json:"queue"`
+	RoutingKey string                 `json:"routing_key"`
+	Arguments  map[string]interface{} `json:"arguments"`
+}
+
 func NewBindingsHandler(amqpServer *server.Server) http.Handler {
 	return &BindingsHandler{amqpServer: amqpServer}
 }
 
 func (h *BindingsHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		h.list(resp, req)
+	case http.MethodPost, http.MethodDelete:
+		h.change(resp, req)
+	default:
+		JSONResponse(resp, &ErrorResponse{Error: "method not allowed"}, http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *BindingsHandler) list(resp http.ResponseWriter, req *http.Request) {
 	response := &BindingsResponse{}
 	req.ParseForm()
 	vhName := req.Form.Get("vhost")
 	exName := req.Form.Get("exchange")
 
 	vhost := h.amqpServer.GetVhost(vhName)
-	if vhost == nil {
+	if vhost == nil || !getRequestUser(req).checkVhost(vhName) {
 		JSONResponse(resp, response, 200)
 		return
 	}
@@ -48,10 +70,53 @@ func (h *BindingsHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request)
 			&Binding{
 				Queue:      bind.GetQueue(),
 				Exchange:   bind.GetExchange(),
-				RoutingKey: bind.GetExchange(),
+				RoutingKey: bind.GetRoutingKey(),
 			},
 		)
 	}
 
 	JSONResponse(resp, response, 200)
 }
+
+// change binds (POST) or unbinds (DELETE) queue, /bindings with BindingRequest body
+func (h *BindingsHandler) change(resp http.ResponseWriter, req *http.Request) {
+	request := &BindingRequest{}
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: "bad request: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	vhost := h.amqpServer.GetVhost(request.Vhost)
+	if vhost == nil {
+		JSONResponse(resp, &ErrorResponse{Error: server.ErrNotFound.Error()}, http.StatusNotFound)
+		return
+	}
+	// like RabbitMQ, binding requires write access to queue and read access to exchange,
+	// binding to topic exchange also requires read access to routing key
+	user := getRequestUser(req)
+	if !user.checkResource(request.Vhost, auth.ResourceQueue, request.Queue, auth.AccessWrite) {
+		refuseAccess(resp, request.Vhost, auth.ResourceQueue, request.Queue, auth.AccessWrite)
+		return
+	}
+	if !user.checkResource(request.Vhost, auth.ResourceExchange, request.Exchange, auth.AccessRead) {
+		refuseAccess(resp, request.Vhost, auth.ResourceExchange, request.Exchange, auth.AccessRead)
+		return
+	}
+	if ex := vhost.GetExchange(request.Exchange); req.Method == http.MethodPost && ex != nil && ex.ExType() == exchange.ExTypeTopic &&
+		!user.checkTopic(request.Vhost, request.Exchange, request.RoutingKey, auth.AccessRead) {
+		refuseAccess(resp, request.Vhost, "topic", request.RoutingKey, auth.AccessRead)
+		return
+	}
+
+	arguments := server.TableFromJSON(request.Arguments)
+	var err error
+	if req.Method == http.MethodPost {
+		err = vhost.BindQueue(request.Queue, request.Exchange, request.RoutingKey, arguments)
+	} else {
+		err = vhost.UnbindQueue(request.Queue, request.Exchange, request.RoutingKey, arguments)
+	}
+	if err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: err.Error()}, ErrorStatus(err))
+		return
+	}
+	JSONResponse(resp, struct{}{}, http.StatusOK)
+}
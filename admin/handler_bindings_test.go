@@ -0,0 +1,92 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/valinurovam/garagemq/auth"
+	"github.com/valinurovam/garagemq/config"
+	"github.com/valinurovam/garagemq/metrics"
+	"github.com/valinurovam/garagemq/server"
+)
+
+func getTestServer(t *testing.T) (*server.Server, func()) {
+	log.SetOutput(ioutil.Discard)
+	dbPath, err := ioutil.TempDir("", "garagemq_admin_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics.NewTrackRegistry(15, time.Second, true)
+	amqpServer := server.NewServer("localhost", "0", "amqp-rabbit", &config.Config{
+		Users: []config.User{
+			{
+				Username: "guest",
+				Password: "084e0343a0486ff05530df6c705c8bb4", // guest md5 hash
+				Tags:     []string{auth.TagAdministrator},
+			},
+			{
+				Username: "tenant",
+				Password: "084e0343a0486ff05530df6c705c8bb4", // guest md5 hash
+				Tags:     []string{auth.TagManagement},
+			},
+		},
+		Queue:      config.Queue{ShardSize: 128, MaxMessagesInRAM: 4096},
+		Db:         config.Db{DefaultPath: dbPath, Engine: "memory"},
+		Vhost:      config.Vhost{DefaultPath: "/"},
+		Security:   config.Security{PasswordCheck: "md5"},
+		Connection: config.Connection{ChannelsMax: 4096, FrameMaxSize: 65536},
+	})
+	go amqpServer.Start()
+	for amqpServer.GetStatus() != server.Running {
+		time.Sleep(time.Millisecond)
+	}
+	return amqpServer, func() {
+		amqpServer.Stop()
+		os.RemoveAll(dbPath)
+	}
+}
+
+func TestBindingsHandler_TopicPermissions(t *testing.T) {
+	amqpServer, clean := getTestServer(t)
+	defer clean()
+	vhost := amqpServer.GetVhost("/")
+	vhost.DeclareQueue("testQu", false, false, nil)
+
+	perm, _ := auth.NewTopicPermission("tenant", "/", "amq.topic", "^tenant\\.", "^tenant\\.")
+	if err := amqpServer.SetTopicPermission(perm); err != nil {
+		t.Fatal(err)
+	}
+
+	bind := func(userName string, exchange string, routingKey string) int {
+		body, _ := json.Marshal(&BindingRequest{Vhost: "/", Exchange: exchange, Queue: "testQu", RoutingKey: routingKey})
+		req := httptest.NewRequest(http.MethodPost, "/bindings", bytes.NewReader(body))
+		req.SetBasicAuth(userName, "guest")
+		resp := httptest.NewRecorder()
+		NewAuthHandler(amqpServer, NewBindingsHandler(amqpServer), levelManagement, levelManagement).ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	if code := bind("tenant", "amq.topic", "tenant.#"); code != http.StatusOK {
+		t.Errorf("Expected bind with permitted routing key, actual status %d", code)
+	}
+	if code := bind("tenant", "amq.topic", "other.#"); code != http.StatusForbidden {
+		t.Errorf("Expected bind with routing key of other tenant refused, actual status %d", code)
+	}
+	if code := bind("tenant", "amq.direct", "other"); code != http.StatusOK {
+		t.Errorf("Expected routing keys of not topic exchange are not restricted, actual status %d", code)
+	}
+	if code := bind("guest", "amq.topic", "other.#"); code != http.StatusOK {
+		t.Errorf("Expected administrator is not restricted, actual status %d", code)
+	}
+	if len(vhost.GetExchange("amq.topic").GetBindings()) != 2 {
+		t.Errorf("Expected refused binding not created")
+	}
+}
@@ -23,10 +23,20 @@ type Connection struct {
 	ChannelsCount int                `json:"channels_count"`
 	User          string             `json:"user"`
 	Protocol      string             `json:"protocol"`
+	TLS           bool               `json:"tls"`
+	PeerCert      *PeerCertificate   `json:"peer_cert,omitempty"`
 	FromClient    *metrics.TrackItem `json:"from_client"`
 	ToClient      *metrics.TrackItem `json:"to_client"`
 }
 
+// PeerCertificate describes client certificate of TLS connection
+type PeerCertificate struct {
+	Subject   string `json:"subject"`
+	Issuer    string `json:"issuer"`
+	NotBefore int64  `json:"not_before"`
+	NotAfter  int64  `json:"not_after"`
+}
+
 func NewConnectionsHandler(amqpServer *server.Server) http.Handler {
 	return &ConnectionsHandler{amqpServer: amqpServer}
 }
@@ -34,19 +44,26 @@ func NewConnectionsHandler(amqpServer *server.Server) http.Handler {
 func (h *ConnectionsHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 	response := &ConnectionsResponse{}
 	for _, conn := range h.amqpServer.GetConnections() {
-		response.Items = append(
-			response.Items,
-			&Connection{
-				ID:            int(conn.GetID()),
-				Vhost:         conn.GetVirtualHost().GetName(),
-				Addr:          conn.GetRemoteAddr().String(),
-				ChannelsCount: len(conn.GetChannels()),
-				User:          conn.GetUsername(),
-				Protocol:      h.amqpServer.GetProtoVersion(),
-				FromClient:    conn.GetMetrics().TrafficIn.Track.GetLastDiffTrackItem(),
-				ToClient:      conn.GetMetrics().TrafficOut.Track.GetLastDiffTrackItem(),
-			},
-		)
+		item := &Connection{
+			ID:            int(conn.GetID()),
+			Vhost:         conn.GetVirtualHost().GetName(),
+			Addr:          conn.GetRemoteAddr().String(),
+			ChannelsCount: len(conn.GetChannels()),
+			User:          conn.GetUsername(),
+			Protocol:      h.amqpServer.GetProtoVersion(),
+			TLS:           conn.IsTLS(),
+			FromClient:    conn.GetMetrics().TrafficIn.Track.GetLastDiffTrackItem(),
+			ToClient:      conn.GetMetrics().TrafficOut.Track.GetLastDiffTrackItem(),
+		}
+		if certs := conn.GetPeerCertificates(); len(certs) > 0 {
+			item.PeerCert = &PeerCertificate{
+				Subject:   certs[0].Subject.String(),
+				Issuer:    certs[0].Issuer.String(),
+				NotBefore: certs[0].NotBefore.Unix(),
+				NotAfter:  certs[0].NotAfter.Unix(),
+			}
+		}
+		response.Items = append(response.Items, item)
 	}
 
 	sort.Slice(
@@ -0,0 +1,41 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/valinurovam/garagemq/server"
+)
+
+type DefinitionsHandler struct {
+	amqpServer *server.Server
+}
+
+type DefinitionsImportResponse struct {
+	Warnings []string `json:"warnings"`
+}
+
+func NewDefinitionsHandler(amqpServer *server.Server) http.Handler {
+	return &DefinitionsHandler{amqpServer: amqpServer}
+}
+
+func (h *DefinitionsHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		JSONResponse(resp, h.amqpServer.ExportDefinitions(), http.StatusOK)
+	case http.MethodPost:
+		definitions := &server.Definitions{}
+		if err := json.NewDecoder(req.Body).Decode(definitions); err != nil {
+			JSONResponse(resp, &ErrorResponse{Error: "bad definitions: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		warnings, err := h.amqpServer.ImportDefinitions(definitions)
+		if err != nil {
+			JSONResponse(resp, &ErrorResponse{Error: err.Error()}, http.StatusBadRequest)
+			return
+		}
+		JSONResponse(resp, &DefinitionsImportResponse{Warnings: warnings}, http.StatusOK)
+	default:
+		JSONResponse(resp, &ErrorResponse{Error: "method not allowed"}, http.StatusMethodNotAllowed)
+	}
+}
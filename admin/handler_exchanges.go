@@ -1,9 +1,11 @@
 package admin
 
 import (
+	"encoding/json"
 	"net/http"
 	"sort"
 
+	"github.com/valinurovam/garagemq/auth"
 	"github.com/valinurovam/garagemq/metrics"
 	"github.com/valinurovam/garagemq/server"
 )
@@ -23,18 +25,45 @@ type Exchange struct {
 	Durable    bool               `json:"durable"`
 	Internal   bool               `json:"internal"`
 	AutoDelete bool               `json:"auto_delete"`
+	Policy     string             `json:"policy"`
 	MsgRateIn  *metrics.TrackItem `json:"msg_rate_in"`
 	MsgRateOut *metrics.TrackItem `json:"msg_rate_out"`
 }
 
+type ExchangeDeclareRequest struct {
+	Vhost      string `json:"vhost"`
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Durable    bool   `json:"durable"`
+	AutoDelete bool   `json:"auto_delete"`
+	Internal   bool   `json:"internal"`
+}
+
 func NewExchangesHandler(amqpServer *server.Server) http.Handler {
 	return &ExchangesHandler{amqpServer: amqpServer}
 }
 
 func (h *ExchangesHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		h.list(resp, req)
+	case http.MethodPost:
+		h.declare(resp, req)
+	case http.MethodDelete:
+		h.delete(resp, req)
+	default:
+		JSONResponse(resp, &ErrorResponse{Error: "method not allowed"}, http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *ExchangesHandler) list(resp http.ResponseWriter, req *http.Request) {
 	response := &ExchangesResponse{}
 
+	user := getRequestUser(req)
 	for vhostName, vhost := range h.amqpServer.GetVhosts() {
+		if !user.checkVhost(vhostName) {
+			continue
+		}
 		for _, exchange := range vhost.GetExchanges() {
 			name := exchange.GetName()
 			if name == "" {
@@ -49,6 +78,7 @@ func (h *ExchangesHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request
 					Internal:   exchange.IsInternal(),
 					AutoDelete: exchange.IsAutoDelete(),
 					Type:       exchange.GetTypeAlias(),
+					Policy:     exchange.GetSettings().Policy,
 					MsgRateIn:  exchange.GetMetrics().MsgIn.Track.GetLastDiffTrackItem(),
 					MsgRateOut: exchange.GetMetrics().MsgOut.Track.GetLastDiffTrackItem(),
 				},
@@ -59,3 +89,45 @@ func (h *ExchangesHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request
 	sort.Slice(response.Items, func(i, j int) bool { return response.Items[i].Name < response.Items[j].Name })
 	JSONResponse(resp, response, 200)
 }
+
+// declare creates exchange, POST /exchanges with ExchangeDeclareRequest body
+func (h *ExchangesHandler) declare(resp http.ResponseWriter, req *http.Request) {
+	request := &ExchangeDeclareRequest{}
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: "bad request: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	vhost := h.amqpServer.GetVhost(request.Vhost)
+	if vhost == nil {
+		JSONResponse(resp, &ErrorResponse{Error: server.ErrNotFound.Error()}, http.StatusNotFound)
+		return
+	}
+	if !getRequestUser(req).checkResource(request.Vhost, auth.ResourceExchange, request.Name, auth.AccessConfigure) {
+		refuseAccess(resp, request.Vhost, auth.ResourceExchange, request.Name, auth.AccessConfigure)
+		return
+	}
+	if err := vhost.DeclareExchange(request.Name, request.Type, request.Durable, request.AutoDelete, request.Internal); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: err.Error()}, ErrorStatus(err))
+		return
+	}
+	JSONResponse(resp, struct{}{}, http.StatusOK)
+}
+
+// delete removes exchange, DELETE /exchanges?vhost=vhost&name=name[&if_unused=true]
+func (h *ExchangesHandler) delete(resp http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	vhost := h.amqpServer.GetVhost(query.Get("vhost"))
+	if vhost == nil {
+		JSONResponse(resp, &ErrorResponse{Error: server.ErrNotFound.Error()}, http.StatusNotFound)
+		return
+	}
+	if !getRequestUser(req).checkResource(query.Get("vhost"), auth.ResourceExchange, query.Get("name"), auth.AccessConfigure) {
+		refuseAccess(resp, query.Get("vhost"), auth.ResourceExchange, query.Get("name"), auth.AccessConfigure)
+		return
+	}
+	if err := vhost.DeleteExchange(query.Get("name"), query.Get("if_unused") == "true"); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: err.Error()}, ErrorStatus(err))
+		return
+	}
+	JSONResponse(resp, struct{}{}, http.StatusOK)
+}
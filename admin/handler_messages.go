@@ -0,0 +1,264 @@
+package admin
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/valinurovam/garagemq/amqp"
+	"github.com/valinurovam/garagemq/auth"
+	"github.com/valinurovam/garagemq/exchange"
+	"github.com/valinurovam/garagemq/server"
+)
+
+const (
+	payloadEncodingString = "string"
+	payloadEncodingBase64 = "base64"
+
+	ackModeRequeue = "requeue"
+	ackModeConsume = "consume"
+)
+
+type PublishHandler struct {
+	amqpServer *server.Server
+}
+
+type GetMessagesHandler struct {
+	amqpServer *server.Server
+}
+
+type MessageProperties struct {
+	ContentType     string                 `json:"content_type,omitempty"`
+	ContentEncoding string                 `json:"content_encoding,omitempty"`
+	Headers         map[string]interface{} `json:"headers,omitempty"`
+	DeliveryMode    byte                   `json:"delivery_mode,omitempty"`
+	Priority        byte                   `json:"priority,omitempty"`
+	CorrelationID   string                 `json:"correlation_id,omitempty"`
+	ReplyTo         string                 `json:"reply_to,omitempty"`
+	Expiration      string                 `json:"expiration,omitempty"`
+	MessageID       string                 `json:"message_id,omitempty"`
+	Timestamp       int64                  `json:"timestamp,omitempty"`
+	Type            string                 `json:"type,omitempty"`
+	UserID          string                 `json:"user_id,omitempty"`
+	AppID           string                 `json:"app_id,omitempty"`
+}
+
+type PublishRequest struct {
+	Vhost           string             `json:"vhost"`
+	Exchange        string             `json:"exchange"`
+	RoutingKey      string             `json:"routing_key"`
+	Properties      *MessageProperties `json:"properties"`
+	Payload         string             `json:"payload"`
+	PayloadEncoding string             `json:"payload_encoding"`
+}
+
+type PublishResponse struct {
+	Routed bool `json:"routed"`
+}
+
+type GetMessagesRequest struct {
+	Vhost   string `json:"vhost"`
+	Queue   string `json:"queue"`
+	Count   int    `json:"count"`
+	AckMode string `json:"ackmode"`
+	// Encoding is "auto" to return payload as string if it is valid utf-8, or "base64"
+	Encoding string `json:"encoding"`
+}
+
+type GetMessagesResponse struct {
+	Items []*Message `json:"items"`
+}
+
+type Message struct {
+	Exchange        string             `json:"exchange"`
+	RoutingKey      string             `json:"routing_key"`
+	Properties      *MessageProperties `json:"properties"`
+	Payload         string             `json:"payload"`
+	PayloadBytes    uint64             `json:"payload_bytes"`
+	PayloadEncoding string             `json:"payload_encoding"`
+}
+
+func NewPublishHandler(amqpServer *server.Server) http.Handler {
+	return &PublishHandler{amqpServer: amqpServer}
+}
+
+func NewGetMessagesHandler(amqpServer *server.Server) http.Handler {
+	return &GetMessagesHandler{amqpServer: amqpServer}
+}
+
+// ServeHTTP publishes message into exchange, POST /exchanges/publish with PublishRequest body
+func (h *PublishHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		JSONResponse(resp, &ErrorResponse{Error: "method not allowed"}, http.StatusMethodNotAllowed)
+		return
+	}
+	request := &PublishRequest{}
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: "bad request: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	var body []byte
+	switch request.PayloadEncoding {
+	case "", payloadEncodingString:
+		body = []byte(request.Payload)
+	case payloadEncodingBase64:
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(request.Payload); err != nil {
+			JSONResponse(resp, &ErrorResponse{Error: "bad payload: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	default:
+		JSONResponse(resp, &ErrorResponse{Error: "unknown payload_encoding " + request.PayloadEncoding}, http.StatusBadRequest)
+		return
+	}
+
+	vhost := h.amqpServer.GetVhost(request.Vhost)
+	if vhost == nil {
+		JSONResponse(resp, &ErrorResponse{Error: server.ErrNotFound.Error()}, http.StatusNotFound)
+		return
+	}
+	user := getRequestUser(req)
+	if !user.checkResource(request.Vhost, auth.ResourceExchange, request.Exchange, auth.AccessWrite) {
+		refuseAccess(resp, request.Vhost, auth.ResourceExchange, request.Exchange, auth.AccessWrite)
+		return
+	}
+	if ex := vhost.GetExchange(request.Exchange); ex != nil && ex.ExType() == exchange.ExTypeTopic &&
+		!user.checkTopic(request.Vhost, request.Exchange, request.RoutingKey, auth.AccessWrite) {
+		refuseAccess(resp, request.Vhost, "topic", request.RoutingKey, auth.AccessWrite)
+		return
+	}
+	routed, err := vhost.PublishMessage(request.Exchange, request.RoutingKey, propertiesFromJSON(request.Properties), body)
+	if err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: err.Error()}, ErrorStatus(err))
+		return
+	}
+	JSONResponse(resp, &PublishResponse{Routed: routed > 0}, http.StatusOK)
+}
+
+// ServeHTTP fetches messages from queue, POST /queues/get with GetMessagesRequest body
+// With ackmode "requeue" messages are returned back into queue, with "consume" they are removed
+func (h *GetMessagesHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		JSONResponse(resp, &ErrorResponse{Error: "method not allowed"}, http.StatusMethodNotAllowed)
+		return
+	}
+	request := &GetMessagesRequest{Count: 1, AckMode: ackModeRequeue}
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: "bad request: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if request.AckMode != ackModeRequeue && request.AckMode != ackModeConsume {
+		JSONResponse(resp, &ErrorResponse{Error: "unknown ackmode " + request.AckMode}, http.StatusBadRequest)
+		return
+	}
+
+	vhost := h.amqpServer.GetVhost(request.Vhost)
+	if vhost == nil {
+		JSONResponse(resp, &ErrorResponse{Error: server.ErrNotFound.Error()}, http.StatusNotFound)
+		return
+	}
+	if !getRequestUser(req).checkResource(request.Vhost, auth.ResourceQueue, request.Queue, auth.AccessRead) {
+		refuseAccess(resp, request.Vhost, auth.ResourceQueue, request.Queue, auth.AccessRead)
+		return
+	}
+	messages, err := vhost.GetMessages(request.Queue, request.Count, request.AckMode == ackModeRequeue)
+	if err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: err.Error()}, ErrorStatus(err))
+		return
+	}
+
+	response := &GetMessagesResponse{Items: []*Message{}}
+	for _, message := range messages {
+		var body []byte
+		for _, frame := range message.Body {
+			body = append(body, frame.Payload...)
+		}
+		item := &Message{
+			Exchange:        message.Exchange,
+			RoutingKey:      message.RoutingKey,
+			Properties:      propertiesToJSON(message.Header.PropertyList),
+			PayloadBytes:    message.BodySize,
+			PayloadEncoding: payloadEncodingString,
+			Payload:         string(body),
+		}
+		if request.Encoding == payloadEncodingBase64 || !utf8.Valid(body) {
+			item.PayloadEncoding = payloadEncodingBase64
+			item.Payload = base64.StdEncoding.EncodeToString(body)
+		}
+		response.Items = append(response.Items, item)
+	}
+	JSONResponse(resp, response, http.StatusOK)
+}
+
+func propertiesFromJSON(props *MessageProperties) *amqp.BasicPropertyList {
+	properties := &amqp.BasicPropertyList{}
+	if props == nil {
+		return properties
+	}
+	setString := func(dst **string, value string) {
+		if value != "" {
+			*dst = &value
+		}
+	}
+	setString(&properties.ContentType, props.ContentType)
+	setString(&properties.ContentEncoding, props.ContentEncoding)
+	setString(&properties.CorrelationID, props.CorrelationID)
+	setString(&properties.ReplyTo, props.ReplyTo)
+	setString(&properties.Expiration, props.Expiration)
+	setString(&properties.MessageID, props.MessageID)
+	setString(&properties.Type, props.Type)
+	setString(&properties.UserID, props.UserID)
+	setString(&properties.AppID, props.AppID)
+	if props.Headers != nil {
+		properties.Headers = server.TableFromJSON(props.Headers)
+	}
+	if props.DeliveryMode != 0 {
+		properties.DeliveryMode = &props.DeliveryMode
+	}
+	if props.Priority != 0 {
+		properties.Priority = &props.Priority
+	}
+	if props.Timestamp != 0 {
+		timestamp := time.Unix(props.Timestamp, 0)
+		properties.Timestamp = &timestamp
+	}
+	return properties
+}
+
+func propertiesToJSON(properties *amqp.BasicPropertyList) *MessageProperties {
+	props := &MessageProperties{}
+	if properties == nil {
+		return props
+	}
+	getString := func(value *string) string {
+		if value == nil {
+			return ""
+		}
+		return *value
+	}
+	props.ContentType = getString(properties.ContentType)
+	props.ContentEncoding = getString(properties.ContentEncoding)
+	props.CorrelationID = getString(properties.CorrelationID)
+	props.ReplyTo = getString(properties.ReplyTo)
+	props.Expiration = getString(properties.Expiration)
+	props.MessageID = getString(properties.MessageID)
+	props.Type = getString(properties.Type)
+	props.UserID = getString(properties.UserID)
+	props.AppID = getString(properties.AppID)
+	if properties.Headers != nil {
+		props.Headers = server.TableToJSON(properties.Headers)
+	}
+	if properties.DeliveryMode != nil {
+		props.DeliveryMode = *properties.DeliveryMode
+	}
+	if properties.Priority != nil {
+		props.Priority = *properties.Priority
+	}
+	if properties.Timestamp != nil {
+		props.Timestamp = properties.Timestamp.Unix()
+	}
+	return props
+}
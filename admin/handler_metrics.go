@@ -0,0 +1,27 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/valinurovam/garagemq/metrics"
+	"github.com/valinurovam/garagemq/server"
+)
+
+type MetricsHandler struct {
+	amqpServer *server.Server
+}
+
+func NewMetricsHandler(amqpServer *server.Server) http.Handler {
+	return &MetricsHandler{amqpServer: amqpServer}
+}
+
+// ServeHTTP writes all server, exchange, queue, connection and channel counters in Prometheus text format
+func (h *MetricsHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		JSONResponse(resp, &ErrorResponse{Error: "method not allowed"}, http.StatusMethodNotAllowed)
+		return
+	}
+	resp.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	resp.WriteHeader(http.StatusOK)
+	metrics.WritePrometheus(resp)
+}
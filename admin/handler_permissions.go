@@ -0,0 +1,180 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/valinurovam/garagemq/auth"
+	"github.com/valinurovam/garagemq/server"
+)
+
+type PermissionsHandler struct {
+	amqpServer *server.Server
+}
+
+type PermissionsResponse struct {
+	Items []*Permission `json:"items"`
+}
+
+// Permission is user access to vhost resources, each kind of access is regexp
+type Permission struct {
+	User      string `json:"user"`
+	Vhost     string `json:"vhost"`
+	Configure string `json:"configure"`
+	Write     string `json:"write"`
+	Read      string `json:"read"`
+}
+
+func NewPermissionsHandler(amqpServer *server.Server) http.Handler {
+	return &PermissionsHandler{amqpServer: amqpServer}
+}
+
+func (h *PermissionsHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		h.list(resp)
+	case http.MethodPost:
+		h.set(resp, req)
+	case http.MethodDelete:
+		h.delete(resp, req)
+	default:
+		JSONResponse(resp, &ErrorResponse{Error: "method not allowed"}, http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *PermissionsHandler) list(resp http.ResponseWriter) {
+	response := &PermissionsResponse{Items: []*Permission{}}
+	for _, perm := range h.amqpServer.GetPermissions() {
+		response.Items = append(response.Items, &Permission{
+			User:      perm.Username,
+			Vhost:     perm.Vhost,
+			Configure: perm.Configure,
+			Write:     perm.Write,
+			Read:      perm.Read,
+		})
+	}
+
+	sort.Slice(response.Items, func(i, j int) bool {
+		a, b := response.Items[i], response.Items[j]
+		return a.Vhost+"/"+a.User < b.Vhost+"/"+b.User
+	})
+	JSONResponse(resp, response, http.StatusOK)
+}
+
+// set creates or replaces user permission on vhost, POST /permissions with Permission body
+func (h *PermissionsHandler) set(resp http.ResponseWriter, req *http.Request) {
+	request := &Permission{}
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: "bad request: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	perm, err := auth.NewPermission(request.User, request.Vhost, request.Configure, request.Write, request.Read)
+	if err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: "bad pattern: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if err := h.amqpServer.SetPermission(perm); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: err.Error()}, ErrorStatus(err))
+		return
+	}
+	JSONResponse(resp, struct{}{}, http.StatusOK)
+}
+
+// delete removes user permission on vhost, DELETE /permissions?user=user&vhost=vhost
+func (h *PermissionsHandler) delete(resp http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	if err := h.amqpServer.DeletePermission(query.Get("user"), query.Get("vhost")); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: err.Error()}, ErrorStatus(err))
+		return
+	}
+	JSONResponse(resp, struct{}{}, http.StatusOK)
+}
+
+type TopicPermissionsHandler struct {
+	amqpServer *server.Server
+}
+
+type TopicPermissionsResponse struct {
+	Items []*TopicPermission `json:"items"`
+}
+
+// TopicPermission restricts routing keys of topic exchange, patterns could reference {username} and {vhost}
+type TopicPermission struct {
+	User     string `json:"user"`
+	Vhost    string `json:"vhost"`
+	Exchange string `json:"exchange"`
+	Write    string `json:"write"`
+	Read     string `json:"read"`
+}
+
+func NewTopicPermissionsHandler(amqpServer *server.Server) http.Handler {
+	return &TopicPermissionsHandler{amqpServer: amqpServer}
+}
+
+func (h *TopicPermissionsHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		h.list(resp)
+	case http.MethodPost:
+		h.set(resp, req)
+	case http.MethodDelete:
+		h.delete(resp, req)
+	default:
+		JSONResponse(resp, &ErrorResponse{Error: "method not allowed"}, http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *TopicPermissionsHandler) list(resp http.ResponseWriter) {
+	response := &TopicPermissionsResponse{Items: []*TopicPermission{}}
+	for _, perm := range h.amqpServer.GetTopicPermissions() {
+		response.Items = append(response.Items, &TopicPermission{
+			User:     perm.Username,
+			Vhost:    perm.Vhost,
+			Exchange: perm.Exchange,
+			Write:    perm.Write,
+			Read:     perm.Read,
+		})
+	}
+
+	sort.Slice(response.Items, func(i, j int) bool {
+		a, b := response.Items[i], response.Items[j]
+		return a.Vhost+"/"+a.User+"/"+a.Exchange < b.Vhost+"/"+b.User+"/"+b.Exchange
+	})
+	JSONResponse(resp, response, http.StatusOK)
+}
+
+// set creates or replaces user topic permission on exchange, POST /topic-permissions with TopicPermission body
+func (h *TopicPermissionsHandler) set(resp http.ResponseWriter, req *http.Request) {
+	request := &TopicPermission{}
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: "bad request: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if request.Exchange == "" {
+		JSONResponse(resp, &ErrorResponse{Error: "exchange name is required"}, http.StatusBadRequest)
+		return
+	}
+
+	perm, err := auth.NewTopicPermission(request.User, request.Vhost, request.Exchange, request.Write, request.Read)
+	if err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: "bad pattern: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if err := h.amqpServer.SetTopicPermission(perm); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: err.Error()}, ErrorStatus(err))
+		return
+	}
+	JSONResponse(resp, struct{}{}, http.StatusOK)
+}
+
+// delete removes user topic permission, DELETE /topic-permissions?user=user&vhost=vhost&exchange=exchange
+func (h *TopicPermissionsHandler) delete(resp http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	if err := h.amqpServer.DeleteTopicPermission(query.Get("user"), query.Get("vhost"), query.Get("exchange")); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: err.Error()}, ErrorStatus(err))
+		return
+	}
+	JSONResponse(resp, struct{}{}, http.StatusOK)
+}
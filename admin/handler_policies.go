@@ -0,0 +1,89 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/valinurovam/garagemq/policy"
+	"github.com/valinurovam/garagemq/server"
+)
+
+type PoliciesHandler struct {
+	amqpServer *server.Server
+}
+
+type PoliciesResponse struct {
+	Items []*Policy `json:"items"`
+}
+
+// Policy applies definition to queues and exchanges of vhost which names match pattern
+type Policy struct {
+	Vhost      string                 `json:"vhost"`
+	Name       string                 `json:"name"`
+	Pattern    string                 `json:"pattern"`
+	ApplyTo    string                 `json:"apply_to"`
+	Priority   int32                  `json:"priority"`
+	Definition map[string]interface{} `json:"definition"`
+}
+
+func NewPoliciesHandler(amqpServer *server.Server) http.Handler {
+	return &PoliciesHandler{amqpServer: amqpServer}
+}
+
+func (h *PoliciesHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		h.list(resp)
+	case http.MethodPost:
+		h.set(resp, req)
+	case http.MethodDelete:
+		h.delete(resp, req)
+	default:
+		JSONResponse(resp, &ErrorResponse{Error: "method not allowed"}, http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *PoliciesHandler) list(resp http.ResponseWriter) {
+	response := &PoliciesResponse{Items: []*Policy{}}
+	for _, p := range h.amqpServer.GetPolicies() {
+		response.Items = append(response.Items, &Policy{
+			Vhost:      p.Vhost,
+			Name:       p.Name,
+			Pattern:    p.Pattern,
+			ApplyTo:    p.ApplyTo,
+			Priority:   p.Priority,
+			Definition: server.TableToJSON(p.Definition),
+		})
+	}
+	JSONResponse(resp, response, http.StatusOK)
+}
+
+// set creates or replaces policy, POST /policies with Policy body
+func (h *PoliciesHandler) set(resp http.ResponseWriter, req *http.Request) {
+	request := &Policy{}
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: "bad request: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	p, err := policy.NewPolicy(request.Vhost, request.Name, request.Pattern, request.ApplyTo, request.Priority, server.TableFromJSON(request.Definition))
+	if err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if err := h.amqpServer.SetPolicy(p); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: err.Error()}, ErrorStatus(err))
+		return
+	}
+	JSONResponse(resp, struct{}{}, http.StatusOK)
+}
+
+// delete removes policy, DELETE /policies?vhost=vhost&name=name
+func (h *PoliciesHandler) delete(resp http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	if err := h.amqpServer.DeletePolicy(query.Get("vhost"), query.Get("name")); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: err.Error()}, ErrorStatus(err))
+		return
+	}
+	JSONResponse(resp, struct{}{}, http.StatusOK)
+}
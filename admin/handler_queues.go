@@ -1,9 +1,11 @@
 package admin
 
 import (
+	"encoding/json"
 	"net/http"
 	"sort"
 
+	"github.com/valinurovam/garagemq/auth"
 	"github.com/valinurovam/garagemq/metrics"
 	"github.com/valinurovam/garagemq/server"
 )
@@ -22,17 +24,59 @@ type Queue struct {
 	Durable    bool   `json:"durable"`
 	AutoDelete bool   `json:"auto_delete"`
 	Exclusive  bool   `json:"exclusive"`
+	Policy     string `json:"policy"`
 
 	Counters map[string]*metrics.TrackItem `json:"counters"`
 }
 
+type QueueDeclareRequest struct {
+	Vhost      string                 `json:"vhost"`
+	Name       string                 `json:"name"`
+	Durable    bool                   `json:"durable"`
+	AutoDelete bool                   `json:"auto_delete"`
+	Arguments  map[string]interface{} `json:"arguments"`
+}
+
+type QueueDeleteResponse struct {
+	MessageCount uint64 `json:"message_count"`
+}
+
+type QueuePurgeHandler struct {
+	amqpServer *server.Server
+}
+
+type QueuePurgeResponse struct {
+	MessageCount uint64 `json:"message_count"`
+}
+
 func NewQueuesHandler(amqpServer *server.Server) http.Handler {
 	return &QueuesHandler{amqpServer: amqpServer}
 }
 
+func NewQueuePurgeHandler(amqpServer *server.Server) http.Handler {
+	return &QueuePurgeHandler{amqpServer: amqpServer}
+}
+
 func (h *QueuesHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		h.list(resp, req)
+	case http.MethodPost:
+		h.declare(resp, req)
+	case http.MethodDelete:
+		h.delete(resp, req)
+	default:
+		JSONResponse(resp, &ErrorResponse{Error: "method not allowed"}, http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *QueuesHandler) list(resp http.ResponseWriter, req *http.Request) {
 	response := &QueuesResponse{}
+	user := getRequestUser(req)
 	for vhostName, vhost := range h.amqpServer.GetVhosts() {
+		if !user.checkVhost(vhostName) {
+			continue
+		}
 		for _, queue := range vhost.GetQueues() {
 			ready := queue.GetMetrics().Ready.Track.GetLastTrackItem()
 			total := queue.GetMetrics().Total.Track.GetLastTrackItem()
@@ -51,6 +95,7 @@ func (h *QueuesHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 					Durable:    queue.IsDurable(),
 					AutoDelete: queue.IsAutoDelete(),
 					Exclusive:  queue.IsExclusive(),
+					Policy:     queue.GetSettings().Policy,
 					Counters: map[string]*metrics.TrackItem{
 						"ready":   ready,
 						"total":   total,
@@ -75,3 +120,71 @@ func (h *QueuesHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 
 	JSONResponse(resp, response, 200)
 }
+
+// declare creates queue, POST /queues with QueueDeclareRequest body
+func (h *QueuesHandler) declare(resp http.ResponseWriter, req *http.Request) {
+	request := &QueueDeclareRequest{}
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: "bad request: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	vhost := h.amqpServer.GetVhost(request.Vhost)
+	if vhost == nil {
+		JSONResponse(resp, &ErrorResponse{Error: server.ErrNotFound.Error()}, http.StatusNotFound)
+		return
+	}
+	if !getRequestUser(req).checkResource(request.Vhost, auth.ResourceQueue, request.Name, auth.AccessConfigure) {
+		refuseAccess(resp, request.Vhost, auth.ResourceQueue, request.Name, auth.AccessConfigure)
+		return
+	}
+	err := vhost.DeclareQueue(request.Name, request.Durable, request.AutoDelete, server.TableFromJSON(request.Arguments))
+	if err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: err.Error()}, ErrorStatus(err))
+		return
+	}
+	JSONResponse(resp, struct{}{}, http.StatusOK)
+}
+
+// delete removes queue, DELETE /queues?vhost=vhost&name=name[&if_unused=true][&if_empty=true]
+func (h *QueuesHandler) delete(resp http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	vhost := h.amqpServer.GetVhost(query.Get("vhost"))
+	if vhost == nil {
+		JSONResponse(resp, &ErrorResponse{Error: server.ErrNotFound.Error()}, http.StatusNotFound)
+		return
+	}
+	if !getRequestUser(req).checkResource(query.Get("vhost"), auth.ResourceQueue, query.Get("name"), auth.AccessConfigure) {
+		refuseAccess(resp, query.Get("vhost"), auth.ResourceQueue, query.Get("name"), auth.AccessConfigure)
+		return
+	}
+	length, err := vhost.DeleteQueue(query.Get("name"), query.Get("if_unused") == "true", query.Get("if_empty") == "true")
+	if err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: err.Error()}, ErrorStatus(err))
+		return
+	}
+	JSONResponse(resp, &QueueDeleteResponse{MessageCount: length}, http.StatusOK)
+}
+
+// ServeHTTP removes all ready messages from queue, POST /queues/purge?vhost=vhost&name=name
+func (h *QueuePurgeHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		JSONResponse(resp, &ErrorResponse{Error: "method not allowed"}, http.StatusMethodNotAllowed)
+		return
+	}
+	query := req.URL.Query()
+	vhost := h.amqpServer.GetVhost(query.Get("vhost"))
+	if vhost == nil {
+		JSONResponse(resp, &ErrorResponse{Error: server.ErrNotFound.Error()}, http.StatusNotFound)
+		return
+	}
+	if !getRequestUser(req).checkResource(query.Get("vhost"), auth.ResourceQueue, query.Get("name"), auth.AccessRead) {
+		refuseAccess(resp, query.Get("vhost"), auth.ResourceQueue, query.Get("name"), auth.AccessRead)
+		return
+	}
+	length, err := vhost.PurgeQueue(query.Get("name"))
+	if err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: err.Error()}, ErrorStatus(err))
+		return
+	}
+	JSONResponse(resp, &QueuePurgeResponse{MessageCount: length}, http.StatusOK)
+}
@@ -0,0 +1,119 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/valinurovam/garagemq/auth"
+	"github.com/valinurovam/garagemq/server"
+)
+
+type UsersHandler struct {
+	amqpServer *server.Server
+}
+
+type UsersResponse struct {
+	Items []*User `json:"items"`
+}
+
+type User struct {
+	Name             string   `json:"name"`
+	HashingAlgorithm string   `json:"hashing_algorithm"`
+	Tags             []string `json:"tags"`
+}
+
+// UserRequest creates user with raw password or with already hashed one
+type UserRequest struct {
+	Name             string   `json:"name"`
+	Password         string   `json:"password"`
+	PasswordHash     string   `json:"password_hash"`
+	HashingAlgorithm string   `json:"hashing_algorithm"`
+	Tags             []string `json:"tags"`
+}
+
+func NewUsersHandler(amqpServer *server.Server) http.Handler {
+	return &UsersHandler{amqpServer: amqpServer}
+}
+
+func (h *UsersHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		h.list(resp)
+	case http.MethodPost:
+		h.add(resp, req)
+	case http.MethodDelete:
+		h.delete(resp, req)
+	default:
+		JSONResponse(resp, &ErrorResponse{Error: "method not allowed"}, http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *UsersHandler) list(resp http.ResponseWriter) {
+	response := &UsersResponse{Items: []*User{}}
+	for _, user := range h.amqpServer.GetUsers() {
+		response.Items = append(response.Items, &User{
+			Name:             user.Username,
+			HashingAlgorithm: user.Algorithm,
+			Tags:             user.Tags,
+		})
+	}
+
+	sort.Slice(response.Items, func(i, j int) bool { return response.Items[i].Name < response.Items[j].Name })
+	JSONResponse(resp, response, http.StatusOK)
+}
+
+// add creates or replaces user, POST /users with UserRequest body
+// Raw password is hashed with hashing_algorithm or algorithm from security config
+func (h *UsersHandler) add(resp http.ResponseWriter, req *http.Request) {
+	request := &UserRequest{}
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: "bad request: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if request.Name == "" {
+		JSONResponse(resp, &ErrorResponse{Error: "user name is required"}, http.StatusBadRequest)
+		return
+	}
+
+	user := &auth.User{
+		Username:     request.Name,
+		PasswordHash: request.PasswordHash,
+		Algorithm:    request.HashingAlgorithm,
+		Tags:         request.Tags,
+	}
+	if request.Password != "" && user.Algorithm == "" {
+		user.Algorithm = h.amqpServer.GetConfig().Security.PasswordCheck
+	}
+	if err := auth.ValidateAlgorithm(user.Algorithm); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if request.Password != "" {
+		hash, err := auth.HashPassword(request.Password, user.Algorithm)
+		if err != nil {
+			JSONResponse(resp, &ErrorResponse{Error: err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		user.PasswordHash = hash
+	}
+	if user.PasswordHash == "" {
+		JSONResponse(resp, &ErrorResponse{Error: "password or password_hash is required"}, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.amqpServer.AddUser(user); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	JSONResponse(resp, struct{}{}, http.StatusOK)
+}
+
+// delete removes user and closes its connections, DELETE /users?name=name
+func (h *UsersHandler) delete(resp http.ResponseWriter, req *http.Request) {
+	if err := h.amqpServer.DeleteUser(req.URL.Query().Get("name")); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: err.Error()}, ErrorStatus(err))
+		return
+	}
+	JSONResponse(resp, struct{}{}, http.StatusOK)
+}
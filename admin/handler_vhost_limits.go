@@ -0,0 +1,97 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/valinurovam/garagemq/limits"
+	"github.com/valinurovam/garagemq/server"
+)
+
+type VhostLimitsHandler struct {
+	amqpServer *server.Server
+}
+
+type VhostLimitsResponse struct {
+	Items []*VhostLimits `json:"items"`
+}
+
+// VhostLimits restricts resources of vhost, zero or missing limit means no limit
+type VhostLimits struct {
+	Vhost          string `json:"vhost"`
+	MaxConnections uint64 `json:"max_connections"`
+	MaxChannels    uint64 `json:"max_channels"`
+	MaxQueues      uint64 `json:"max_queues"`
+	MaxExchanges   uint64 `json:"max_exchanges"`
+	MaxMessages    uint64 `json:"max_messages"`
+	MaxBytes       uint64 `json:"max_bytes"`
+}
+
+func NewVhostLimitsHandler(amqpServer *server.Server) http.Handler {
+	return &VhostLimitsHandler{amqpServer: amqpServer}
+}
+
+func (h *VhostLimitsHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		h.list(resp)
+	case http.MethodPost:
+		h.set(resp, req)
+	case http.MethodDelete:
+		h.delete(resp, req)
+	default:
+		JSONResponse(resp, &ErrorResponse{Error: "method not allowed"}, http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *VhostLimitsHandler) list(resp http.ResponseWriter) {
+	response := &VhostLimitsResponse{Items: []*VhostLimits{}}
+	for _, vhostLimits := range h.amqpServer.GetVhostLimits() {
+		response.Items = append(response.Items, &VhostLimits{
+			Vhost:          vhostLimits.Vhost,
+			MaxConnections: vhostLimits.MaxConnections,
+			MaxChannels:    vhostLimits.MaxChannels,
+			MaxQueues:      vhostLimits.MaxQueues,
+			MaxExchanges:   vhostLimits.MaxExchanges,
+			MaxMessages:    vhostLimits.MaxMessages,
+			MaxBytes:       vhostLimits.MaxBytes,
+		})
+	}
+
+	sort.Slice(response.Items, func(i, j int) bool { return response.Items[i].Vhost < response.Items[j].Vhost })
+	JSONResponse(resp, response, http.StatusOK)
+}
+
+// set replaces all limits of vhost, POST /vhost-limits with VhostLimits body
+func (h *VhostLimitsHandler) set(resp http.ResponseWriter, req *http.Request) {
+	request := &VhostLimits{}
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: "bad request: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	err := h.amqpServer.SetVhostLimits(&limits.VhostLimits{
+		Vhost:          request.Vhost,
+		MaxConnections: request.MaxConnections,
+		MaxChannels:    request.MaxChannels,
+		MaxQueues:      request.MaxQueues,
+		MaxExchanges:   request.MaxExchanges,
+		MaxMessages:    request.MaxMessages,
+		MaxBytes:       request.MaxBytes,
+	})
+	if err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: err.Error()}, ErrorStatus(err))
+		return
+	}
+	JSONResponse(resp, struct{}{}, http.StatusOK)
+}
+
+// delete removes all limits of vhost, DELETE /vhost-limits?vhost=vhost
+func (h *VhostLimitsHandler) delete(resp http.ResponseWriter, req *http.Request) {
+	if err := h.amqpServer.ClearVhostLimits(req.URL.Query().Get("vhost")); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: err.Error()}, ErrorStatus(err))
+		return
+	}
+	JSONResponse(resp, struct{}{}, http.StatusOK)
+}
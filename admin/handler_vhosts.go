@@ -0,0 +1,92 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/valinurovam/garagemq/auth"
+	"github.com/valinurovam/garagemq/server"
+)
+
+type VhostsHandler struct {
+	amqpServer *server.Server
+}
+
+type VhostsResponse struct {
+	Items []*Vhost `json:"items"`
+}
+
+type Vhost struct {
+	Name string `json:"name"`
+}
+
+type VhostDeclareRequest struct {
+	Name string `json:"name"`
+}
+
+func NewVhostsHandler(amqpServer *server.Server) http.Handler {
+	return &VhostsHandler{amqpServer: amqpServer}
+}
+
+func (h *VhostsHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		h.list(resp, req)
+	case http.MethodPost:
+		h.declare(resp, req)
+	case http.MethodDelete:
+		h.delete(resp, req)
+	default:
+		JSONResponse(resp, &ErrorResponse{Error: "method not allowed"}, http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *VhostsHandler) list(resp http.ResponseWriter, req *http.Request) {
+	response := &VhostsResponse{}
+	user := getRequestUser(req)
+	for vhostName := range h.amqpServer.GetVhosts() {
+		if !user.checkVhost(vhostName) {
+			continue
+		}
+		response.Items = append(response.Items, &Vhost{Name: vhostName})
+	}
+
+	sort.Slice(response.Items, func(i, j int) bool { return response.Items[i].Name < response.Items[j].Name })
+	JSONResponse(resp, response, http.StatusOK)
+}
+
+// declare creates vhost, POST /vhosts with VhostDeclareRequest body
+func (h *VhostsHandler) declare(resp http.ResponseWriter, req *http.Request) {
+	request := &VhostDeclareRequest{}
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: "bad request: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if h.amqpServer.GetVhost(request.Name) != nil {
+		JSONResponse(resp, struct{}{}, http.StatusOK)
+		return
+	}
+	if _, err := h.amqpServer.AddVhost(request.Name); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	// like RabbitMQ, user who creates vhost gets full access to it
+	userName, _, _ := req.BasicAuth()
+	perm, _ := auth.NewPermission(userName, request.Name, auth.FullAccess, auth.FullAccess, auth.FullAccess)
+	if err := h.amqpServer.SetPermission(perm); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	JSONResponse(resp, struct{}{}, http.StatusOK)
+}
+
+// delete removes vhost with all its data, DELETE /vhosts?name=name
+func (h *VhostsHandler) delete(resp http.ResponseWriter, req *http.Request) {
+	if err := h.amqpServer.DeleteVhost(req.URL.Query().Get("name")); err != nil {
+		JSONResponse(resp, &ErrorResponse{Error: err.Error()}, ErrorStatus(err))
+		return
+	}
+	JSONResponse(resp, struct{}{}, http.StatusOK)
+}
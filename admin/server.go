@@ -12,17 +12,37 @@ type AdminServer struct {
 }
 
 func NewAdminServer(amqpServer *server.Server, host string, port string) *AdminServer {
-	http.Handle("/", http.FileServer(http.Dir("admin-frontend/build")))
-	http.Handle("/overview", NewOverviewHandler(amqpServer))
-	http.Handle("/exchanges", NewExchangesHandler(amqpServer))
-	http.Handle("/queues", NewQueuesHandler(amqpServer))
-	http.Handle("/connections", NewConnectionsHandler(amqpServer))
-	http.Handle("/bindings", NewBindingsHandler(amqpServer))
-	http.Handle("/channels", NewChannelsHandler(amqpServer))
+	// own mux, so handlers registered on http.DefaultServeMux (pprof for example) are not exposed
+	mux := http.NewServeMux()
+	handle := func(pattern string, handler http.Handler, readLevel int, writeLevel int) {
+		mux.Handle(pattern, NewAuthHandler(amqpServer, handler, readLevel, writeLevel))
+	}
+
+	handle("/", http.FileServer(http.Dir("admin-frontend/build")), levelManagement, levelAdministrator)
+	handle("/overview", NewOverviewHandler(amqpServer), levelManagement, levelAdministrator)
+	handle("/vhosts", NewVhostsHandler(amqpServer), levelManagement, levelAdministrator)
+	handle("/users", NewUsersHandler(amqpServer), levelAdministrator, levelAdministrator)
+	handle("/permissions", NewPermissionsHandler(amqpServer), levelAdministrator, levelAdministrator)
+	handle("/topic-permissions", NewTopicPermissionsHandler(amqpServer), levelAdministrator, levelAdministrator)
+	handle("/vhost-limits", NewVhostLimitsHandler(amqpServer), levelAdministrator, levelAdministrator)
+	handle("/policies", NewPoliciesHandler(amqpServer), levelAdministrator, levelAdministrator)
+	handle("/exchanges", NewExchangesHandler(amqpServer), levelManagement, levelManagement)
+	handle("/exchanges/publish", NewPublishHandler(amqpServer), levelManagement, levelManagement)
+	handle("/queues", NewQueuesHandler(amqpServer), levelManagement, levelManagement)
+	handle("/queues/purge", NewQueuePurgeHandler(amqpServer), levelManagement, levelManagement)
+	handle("/queues/get", NewGetMessagesHandler(amqpServer), levelManagement, levelManagement)
+	handle("/bindings", NewBindingsHandler(amqpServer), levelManagement, levelManagement)
+	handle("/connections", NewConnectionsHandler(amqpServer), levelMonitoring, levelAdministrator)
+	handle("/channels", NewChannelsHandler(amqpServer), levelMonitoring, levelAdministrator)
+	handle("/backup", NewBackupHandler(amqpServer), levelAdministrator, levelAdministrator)
+	handle("/restore", NewRestoreHandler(amqpServer), levelAdministrator, levelAdministrator)
+	handle("/api/definitions", NewDefinitionsHandler(amqpServer), levelAdministrator, levelAdministrator)
+	handle("/metrics", NewMetricsHandler(amqpServer), levelMonitoring, levelAdministrator)
 
 	adminServer := &AdminServer{}
 	adminServer.s = &http.Server{
-		Addr: fmt.Sprintf("%s:%s", host, port),
+		Addr:    fmt.Sprintf("%s:%s", host, port),
+		Handler: mux,
 	}
 
 	return adminServer
@@ -3,6 +3,8 @@ package admin
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/valinurovam/garagemq/server"
 )
 
 func JSONResponse(w http.ResponseWriter, data interface{}, code int) (int, error) {
@@ -18,3 +20,19 @@ func JSONResponse(w http.ResponseWriter, data interface{}, code int) (int, error
 
 	return w.Write(body)
 }
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// ErrorStatus returns http status code for error of management operation
+func ErrorStatus(err error) int {
+	switch err {
+	case server.ErrNotFound:
+		return http.StatusNotFound
+	case server.ErrAccessRefused:
+		return http.StatusForbidden
+	default:
+		return http.StatusBadRequest
+	}
+}
@@ -797,6 +797,109 @@ func (method *ConnectionUnblocked) Write(writer io.Writer, protoVersion string)
 	return
 }
 
+// ConnectionUpdateSecret This method updates the secret used to authenticate this connection.
+// It is used when secrets have an expiration date and need to be renewed, like OAuth 2 tokens.
+type ConnectionUpdateSecret struct {
+	NewSecret []byte
+	Reason    string
+}
+
+// Name returns method name as string, usefully for logging
+func (method *ConnectionUpdateSecret) Name() string {
+	return "ConnectionUpdateSecret"
+}
+
+// FrameType returns method frame type
+func (method *ConnectionUpdateSecret) FrameType() byte {
+	return 1
+}
+
+// ClassIdentifier returns method classID
+func (method *ConnectionUpdateSecret) ClassIdentifier() uint16 {
+	return 10
+}
+
+// MethodIdentifier returns method methodID
+func (method *ConnectionUpdateSecret) MethodIdentifier() uint16 {
+	return 70
+}
+
+// Sync is method should me sent synchronous
+func (method *ConnectionUpdateSecret) Sync() bool {
+	return true
+}
+
+// Read method from io reader
+func (method *ConnectionUpdateSecret) Read(reader io.Reader, protoVersion string) (err error) {
+
+	method.NewSecret, err = ReadLongstr(reader)
+	if err != nil {
+		return err
+	}
+
+	method.Reason, err = ReadShortstr(reader)
+	if err != nil {
+		return err
+	}
+
+	return
+}
+
+// Write method from io reader
+func (method *ConnectionUpdateSecret) Write(writer io.Writer, protoVersion string) (err error) {
+
+	if err = WriteLongstr(writer, method.NewSecret); err != nil {
+		return err
+	}
+
+	if err = WriteShortstr(writer, method.Reason); err != nil {
+		return err
+	}
+
+	return
+}
+
+// ConnectionUpdateSecretOk This method confirms the update of the secret.
+type ConnectionUpdateSecretOk struct {
+}
+
+// Name returns method name as string, usefully for logging
+func (method *ConnectionUpdateSecretOk) Name() string {
+	return "ConnectionUpdateSecretOk"
+}
+
+// FrameType returns method frame type
+func (method *ConnectionUpdateSecretOk) FrameType() byte {
+	return 1
+}
+
+// ClassIdentifier returns method classID
+func (method *ConnectionUpdateSecretOk) ClassIdentifier() uint16 {
+	return 10
+}
+
+// MethodIdentifier returns method methodID
+func (method *ConnectionUpdateSecretOk) MethodIdentifier() uint16 {
+	return 71
+}
+
+// Sync is method should me sent synchronous
+func (method *ConnectionUpdateSecretOk) Sync() bool {
+	return true
+}
+
+// Read method from io reader
+func (method *ConnectionUpdateSecretOk) Read(reader io.Reader, protoVersion string) (err error) {
+
+	return
+}
+
+// Write method from io reader
+func (method *ConnectionUpdateSecretOk) Write(writer io.Writer, protoVersion string) (err error) {
+
+	return
+}
+
 // Channel methods
 
 // ChannelOpen This method opens a channel to the server.
@@ -4552,6 +4655,18 @@ func ReadMethod(reader io.Reader, protoVersion string) (Method, error) {
 				return nil, err
 			}
 			return method, nil
+		case 70:
+			var method = &ConnectionUpdateSecret{}
+			if err := method.Read(reader, protoVersion); err != nil {
+				return nil, err
+			}
+			return method, nil
+		case 71:
+			var method = &ConnectionUpdateSecretOk{}
+			if err := method.Read(reader, protoVersion); err != nil {
+				return nil, err
+			}
+			return method, nil
 		}
 	case 20:
 		switch methodID {
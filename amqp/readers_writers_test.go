@@ -313,3 +313,47 @@ func TestReadWriteTable(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestReadWriteTable_Proto091Values(t *testing.T) {
+	now := time.Unix(time.Now().Unix(), 0)
+	table := Table{
+		"string":     "string",
+		"byte_array": []byte("array"),
+		"time":       now,
+		"array":      []interface{}{"string", int32(32)},
+		"table":      Table{"nested": "value"},
+	}
+
+	wr := bytes.NewBuffer(make([]byte, 0))
+	if err := WriteTable(wr, &table, Proto091); err != nil {
+		t.Fatal(err)
+	}
+	data := wr.Bytes()
+
+	read, err := ReadTable(bytes.NewReader(data), Proto091)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (*read)["string"] != "string" {
+		t.Errorf("Expected string value, actual %v", (*read)["string"])
+	}
+	if value, ok := (*read)["byte_array"].([]byte); !ok || string(value) != "array" {
+		t.Errorf("Expected long string value, actual %v", (*read)["byte_array"])
+	}
+	if value, ok := (*read)["time"].(time.Time); !ok || !value.Equal(now) {
+		t.Errorf("Expected timestamp value, actual %v", (*read)["time"])
+	}
+	if value, ok := (*read)["array"].([]interface{}); !ok || len(value) != 2 || value[0] != "string" || value[1] != int32(32) {
+		t.Errorf("Expected array value, actual %v", (*read)["array"])
+	}
+	if value, ok := (*read)["table"].(*Table); !ok || (*value)["nested"] != "value" {
+		t.Errorf("Expected table value, actual %v", (*read)["table"])
+	}
+
+	// each truncated table should fail instead of returning empty values
+	for size := 4; size < len(data); size++ {
+		if _, err := ReadTable(bytes.NewReader(data[:size]), Proto091); err == nil {
+			t.Fatalf("Expected error on table truncated to %d of %d bytes", size, len(data))
+		}
+	}
+}
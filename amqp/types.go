@@ -63,6 +63,9 @@ type Message struct {
 	ConfirmMeta   *ConfirmMeta
 	Header        *ContentHeader
 	Body          []*Frame
+	// QueuedAt is time message was pushed into the first queue
+	// It is persisted in queue reference, so messages loaded from storage keep their age
+	QueuedAt time.Time
 }
 
 // when server restart we can't start again count messages from 0
@@ -3,20 +3,136 @@ package auth
 import (
 	"bytes"
 	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"hash"
+	"time"
 
+	"github.com/valinurovam/garagemq/amqp"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // SaslPlain method
 const SaslPlain = "PLAIN"
 
+// User tags grant access to admin server
+const (
+	TagAdministrator = "administrator"
+	TagMonitoring    = "monitoring"
+	TagManagement    = "management"
+)
+
+// Password hashing algorithms
+// MD5 is unsalted and deprecated, SHA-256 and SHA-512 are salted in RabbitMQ format
+const (
+	HashMD5    = "md5"
+	HashBcrypt = "bcrypt"
+	HashSHA256 = "sha256"
+	HashSHA512 = "sha512"
+)
+
+// rabbitSaltSize is size of random salt prepended to RabbitMQ password hash
+const rabbitSaltSize = 4
+
+// User represents broker user with password hash and tags
+type User struct {
+	Username     string
+	PasswordHash string
+	Algorithm    string
+	Tags         []string
+
+	// token is set for users authenticated by JWT, it is never stored
+	token *Token
+}
+
+// ExpiresAt returns time when user credentials expire, zero time if they do not expire
+func (user *User) ExpiresAt() time.Time {
+	if user.token == nil {
+		return time.Time{}
+	}
+	return user.token.ExpiresAt
+}
+
+// CheckPassword checks given password with user password hash
+func (user *User) CheckPassword(password string) bool {
+	return CheckPasswordHash(password, user.PasswordHash, user.Algorithm)
+}
+
+// Marshal returns raw representation of user to store into storage
+func (user *User) Marshal() (data []byte, err error) {
+	buf := bytes.NewBuffer(make([]byte, 0))
+	if err = amqp.WriteShortstr(buf, user.Username); err != nil {
+		return nil, err
+	}
+	if err = amqp.WriteLongstr(buf, []byte(user.PasswordHash)); err != nil {
+		return nil, err
+	}
+	if err = amqp.WriteShortstr(buf, user.Algorithm); err != nil {
+		return nil, err
+	}
+	if err = amqp.WriteOctet(buf, byte(len(user.Tags))); err != nil {
+		return nil, err
+	}
+	for _, tag := range user.Tags {
+		if err = amqp.WriteShortstr(buf, tag); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal restore user from storage
+func (user *User) Unmarshal(data []byte) (err error) {
+	buf := bytes.NewReader(data)
+	if user.Username, err = amqp.ReadShortstr(buf); err != nil {
+		return err
+	}
+	var hash []byte
+	if hash, err = amqp.ReadLongstr(buf); err != nil {
+		return err
+	}
+	user.PasswordHash = string(hash)
+	if user.Algorithm, err = amqp.ReadShortstr(buf); err != nil {
+		return err
+	}
+	var count byte
+	if count, err = amqp.ReadOctet(buf); err != nil {
+		return err
+	}
+	user.Tags = nil
+	for i := byte(0); i < count; i++ {
+		var tag string
+		if tag, err = amqp.ReadShortstr(buf); err != nil {
+			return err
+		}
+		user.Tags = append(user.Tags, tag)
+	}
+	return nil
+}
+
+// HasTag checks if user has given tag
+func (user *User) HasTag(tag string) bool {
+	for _, userTag := range user.Tags {
+		if userTag == tag {
+			return true
+		}
+	}
+	return false
+}
+
 // SaslData represents standard SASL properties
 type SaslData struct {
 	Identity string
 	Username string
 	Password string
+	// Trusted is set if user identity is verified by mechanism itself and password is not checked
+	Trusted bool
 }
 
 // ParsePlain check and parse SASL-raw data and return SaslData structure
@@ -34,27 +150,67 @@ func ParsePlain(response []byte) (SaslData, error) {
 	return saslData, nil
 }
 
-// HashPassword hash raw password and return hash for check
-func HashPassword(password string, isMd5 bool) (string, error) {
-	if isMd5 {
+// ValidateAlgorithm checks if password hashing algorithm is supported
+func ValidateAlgorithm(algorithm string) error {
+	switch algorithm {
+	case HashMD5, HashBcrypt, HashSHA256, HashSHA512:
+		return nil
+	}
+	return fmt.Errorf("unknown password hashing algorithm '%s'", algorithm)
+}
+
+// HashPassword hash raw password with given algorithm and return hash for check
+func HashPassword(password string, algorithm string) (string, error) {
+	switch algorithm {
+	case HashMD5:
 		h := md5.New()
 		// digest.Write never return any error, so skip error ckeck
 		h.Write([]byte(password))
 		return hex.EncodeToString(h.Sum(nil)), nil
+	case HashBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		return string(hash), err
+	case HashSHA256, HashSHA512:
+		salt := make([]byte, rabbitSaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		return rabbitHash(password, salt, algorithm), nil
 	}
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(hash), err
+	return "", ValidateAlgorithm(algorithm)
 }
 
 // CheckPasswordHash check given password and hash
-func CheckPasswordHash(password, hash string, isMd5 bool) bool {
-	if isMd5 {
+func CheckPasswordHash(password, hash string, algorithm string) bool {
+	switch algorithm {
+	case HashMD5:
 		h := md5.New()
 		// digest.Write never return any error, so skip error ckeck
 		h.Write([]byte(password))
-
 		return hash == hex.EncodeToString(h.Sum(nil))
+	case HashBcrypt:
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		return err == nil
+	case HashSHA256, HashSHA512:
+		raw, err := base64.StdEncoding.DecodeString(hash)
+		if err != nil || len(raw) <= rabbitSaltSize {
+			return false
+		}
+		expected := rabbitHash(password, raw[:rabbitSaltSize], algorithm)
+		return subtle.ConstantTimeCompare([]byte(hash), []byte(expected)) == 1
+	}
+	return false
+}
+
+// rabbitHash returns RabbitMQ password hash - base64 of salt followed by digest of salt and password
+func rabbitHash(password string, salt []byte, algorithm string) string {
+	var h hash.Hash
+	if algorithm == HashSHA512 {
+		h = sha512.New()
+	} else {
+		h = sha256.New()
 	}
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+	h.Write(salt)
+	h.Write([]byte(password))
+	return base64.StdEncoding.EncodeToString(h.Sum(append([]byte{}, salt...)))
 }
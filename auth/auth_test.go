@@ -32,32 +32,86 @@ func TestParsePlain_Failed_WrongFormat(t *testing.T) {
 
 func TestCheckPasswordHash_Bcrypt(t *testing.T) {
 	password := "tEsTpAsSwOrD123"
-	hash, err := HashPassword(password, false)
+	hash, err := HashPassword(password, HashBcrypt)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if !CheckPasswordHash(password, hash, false) {
+	if !CheckPasswordHash(password, hash, HashBcrypt) {
 		t.Fatal("Expected true on check password")
 	}
 
-	if CheckPasswordHash("tEsTpAsSwOrD", hash, false) {
+	if CheckPasswordHash("tEsTpAsSwOrD", hash, HashBcrypt) {
 		t.Fatal("Expected false on check password")
 	}
 }
 
 func TestCheckPasswordHash_MD5(t *testing.T) {
 	password := "tEsTpAsSwOrD123"
-	hash, err := HashPassword(password, true)
+	hash, err := HashPassword(password, HashMD5)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if !CheckPasswordHash(password, hash, true) {
+	if !CheckPasswordHash(password, hash, HashMD5) {
 		t.Fatal("Expected true on check password")
 	}
 
-	if CheckPasswordHash("tEsTpAsSwOrD", hash, true) {
+	if CheckPasswordHash("tEsTpAsSwOrD", hash, HashMD5) {
 		t.Fatal("Expected false on check password")
 	}
 }
+
+func TestCheckPasswordHash_SHA(t *testing.T) {
+	// example from RabbitMQ documentation, salt is 908DC60A
+	if !CheckPasswordHash("test12", "kI3GCqW5JLMJa4iX1lo7X4D6XbYqlLgxIs30+P6tENUV2POR", HashSHA256) {
+		t.Error("Expected RabbitMQ hash checked")
+	}
+
+	password := "tEsTpAsSwOrD123"
+	for _, algorithm := range []string{HashSHA256, HashSHA512} {
+		hash, err := HashPassword(password, algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !CheckPasswordHash(password, hash, algorithm) {
+			t.Errorf("Expected true on check %s password", algorithm)
+		}
+		if CheckPasswordHash("tEsTpAsSwOrD", hash, algorithm) {
+			t.Errorf("Expected false on check %s password", algorithm)
+		}
+		if other, _ := HashPassword(password, algorithm); other == hash {
+			t.Errorf("Expected %s hashes salted", algorithm)
+		}
+	}
+	if CheckPasswordHash("test12", "kI3GCqW5JLMJa4iX1lo7X4D6XbYqlLgxIs30+P6tENUV2POR", HashSHA512) {
+		t.Error("Expected false on check with other algorithm")
+	}
+
+	if _, err := HashPassword(password, "sha1"); err == nil {
+		t.Error("Expected error on unknown algorithm")
+	}
+}
+
+func TestUser_Marshal(t *testing.T) {
+	hash, _ := HashPassword("secret", HashMD5)
+	user := &User{Username: "test", PasswordHash: hash, Algorithm: HashMD5, Tags: []string{TagAdministrator, TagMonitoring}}
+	data, err := user.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := &User{}
+	if err = restored.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Username != user.Username || restored.Algorithm != HashMD5 || len(restored.Tags) != 2 {
+		t.Fatalf("Unexpected restored user %v", restored)
+	}
+	if !restored.CheckPassword("secret") || restored.CheckPassword("wrong") {
+		t.Error("Expected password checked with restored hash")
+	}
+	if !restored.HasTag(TagMonitoring) || restored.HasTag(TagManagement) {
+		t.Error("Expected restored tags")
+	}
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"errors"
+)
+
+// Backend names which could be used in config
+const (
+	BackendInternal = "internal"
+	BackendHtpasswd = "htpasswd"
+	BackendHTTP     = "http"
+	BackendJWT      = "jwt"
+)
+
+// Resource types of vhost resources
+const (
+	ResourceExchange = "exchange"
+	ResourceQueue    = "queue"
+)
+
+// ErrRefused returned by backend if user is unknown or credentials are wrong
+var ErrRefused = errors.New("login refused")
+
+// Authenticator checks user credentials
+type Authenticator interface {
+	// Authenticate returns user for credentials or ErrRefused
+	// Password is not checked if credentials are trusted, user only has to exist
+	Authenticate(saslData SaslData) (*User, error)
+}
+
+// Authorizer checks user access to vhosts, their resources and topics
+type Authorizer interface {
+	// CheckVhost checks if user could open connection to vhost
+	CheckVhost(user *User, vhost string) bool
+	// CheckResource checks if user has configure, write or read access to exchange or queue
+	CheckResource(user *User, vhost string, resourceType string, resource string, access string) bool
+	// CheckTopic checks if user has write or read access to routing key of topic exchange
+	CheckTopic(user *User, vhost string, exchange string, routingKey string, access string) bool
+}
+
+// Backend authenticates users and authorizes their access
+type Backend interface {
+	Authenticator
+	Authorizer
+}
+
+type chainLink struct {
+	authn Authenticator
+	authz Authorizer
+}
+
+// Chain tries authenticators in order until one of them accepts credentials,
+// user access is checked by authorizer paired with that authenticator
+type Chain struct {
+	links []chainLink
+}
+
+// NewChain returns empty chain
+func NewChain() *Chain {
+	return &Chain{}
+}
+
+// Add appends authenticator with authorizer of authenticated users into chain
+func (chain *Chain) Add(authn Authenticator, authz Authorizer) {
+	chain.links = append(chain.links, chainLink{authn: authn, authz: authz})
+}
+
+// Authenticate returns user and its authorizer from the first authenticator which accepts credentials
+// If no one accepts, the last error is returned
+func (chain *Chain) Authenticate(saslData SaslData) (*User, Authorizer, error) {
+	err := ErrRefused
+	for _, link := range chain.links {
+		var user *User
+		if user, err = link.authn.Authenticate(saslData); err == nil {
+			return user, link.authz, nil
+		}
+	}
+	return nil, nil, err
+}
@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type testBackend struct {
+	users map[string]string
+	err   error
+}
+
+func (backend *testBackend) Authenticate(saslData SaslData) (*User, error) {
+	if backend.err != nil {
+		return nil, backend.err
+	}
+	if password, ok := backend.users[saslData.Username]; ok && password == saslData.Password {
+		return &User{Username: saslData.Username}, nil
+	}
+	return nil, ErrRefused
+}
+
+func (backend *testBackend) CheckVhost(user *User, vhost string) bool {
+	return true
+}
+
+func (backend *testBackend) CheckResource(user *User, vhost string, resourceType string, resource string, access string) bool {
+	return true
+}
+
+func (backend *testBackend) CheckTopic(user *User, vhost string, exchange string, routingKey string, access string) bool {
+	return true
+}
+
+func TestChain_Authenticate(t *testing.T) {
+	failing := &testBackend{err: errors.New("backend is down")}
+	first := &testBackend{users: map[string]string{"user1": "pass1"}}
+	second := &testBackend{users: map[string]string{"user1": "other", "user2": "pass2"}}
+	chain := NewChain()
+	chain.Add(failing, failing)
+	chain.Add(first, first)
+	chain.Add(second, second)
+
+	if user, authz, err := chain.Authenticate(SaslData{Username: "user1", Password: "pass1"}); err != nil || user.Username != "user1" || authz != first {
+		t.Errorf("Expected user authenticated by first backend, actual %v %v", user, err)
+	}
+	if _, authz, err := chain.Authenticate(SaslData{Username: "user1", Password: "other"}); err != nil || authz != second {
+		t.Errorf("Expected fallback to second backend, actual %v", err)
+	}
+	if _, _, err := chain.Authenticate(SaslData{Username: "user2", Password: "wrong"}); err != ErrRefused {
+		t.Errorf("Expected refused, actual %v", err)
+	}
+	if _, _, err := NewChain().Authenticate(SaslData{Username: "user1"}); err != ErrRefused {
+		t.Errorf("Expected refused by empty chain, actual %v", err)
+	}
+}
+
+func TestHtpasswdBackend_Authenticate(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "garagemq_htpasswd")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "users.htpasswd")
+
+	bcryptHash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	sum := sha1.Sum([]byte("secret"))
+	shaHash := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	ioutil.WriteFile(path, []byte("# users\nbcrypt:"+string(bcryptHash)+"\nsha:"+shaHash+"\n"), 0600)
+
+	backend, err := NewHtpasswdBackend(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"bcrypt", "sha"} {
+		if _, err := backend.Authenticate(SaslData{Username: name, Password: "secret"}); err != nil {
+			t.Errorf("Expected %s user authenticated, actual %v", name, err)
+		}
+		if _, err := backend.Authenticate(SaslData{Username: name, Password: "wrong"}); err != ErrRefused {
+			t.Errorf("Expected %s user refused on wrong password, actual %v", name, err)
+		}
+	}
+
+	// file is reloaded on change
+	ioutil.WriteFile(path, []byte("new:"+shaHash+"\n"), 0600)
+	os.Chtimes(path, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	if _, err := backend.Authenticate(SaslData{Username: "new", Password: "secret"}); err != nil {
+		t.Errorf("Expected user from changed file authenticated, actual %v", err)
+	}
+	if _, err := backend.Authenticate(SaslData{Username: "sha", Password: "secret"}); err != ErrRefused {
+		t.Errorf("Expected removed user refused, actual %v", err)
+	}
+
+	ioutil.WriteFile(path, []byte("md5:$apr1$abc\n"), 0600)
+	if _, err := NewHtpasswdBackend(path); err == nil {
+		t.Error("Expected error on unsupported hash")
+	}
+}
+
+func TestHTTPBackend(t *testing.T) {
+	stub := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		req.ParseForm()
+		allow := false
+		switch req.URL.Path {
+		case "/user":
+			if req.Form.Get("username") == "user" && req.Form.Get("password") == "secret" {
+				resp.Write([]byte("allow management monitoring"))
+				return
+			}
+		case "/vhost":
+			allow = req.Form.Get("vhost") == "/"
+		case "/resource":
+			allow = req.Form.Get("resource") == ResourceQueue && req.Form.Get("name") == "user.queue" && req.Form.Get("permission") == AccessRead
+		case "/topic":
+			allow = req.Form.Get("name") == "amq.topic" && req.Form.Get("routing_key") == "user.key"
+		}
+		if allow {
+			resp.Write([]byte("allow"))
+		} else {
+			resp.Write([]byte("deny"))
+		}
+	}))
+	defer stub.Close()
+
+	for _, method := range []string{"GET", "POST"} {
+		backend, err := NewHTTPBackend(method, stub.URL+"/user", stub.URL+"/vhost", stub.URL+"/resource", stub.URL+"/topic")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		user, err := backend.Authenticate(SaslData{Username: "user", Password: "secret"})
+		if err != nil || !user.HasTag(TagManagement) || !user.HasTag(TagMonitoring) {
+			t.Fatalf("Expected user authenticated with tags, actual %v %v", user, err)
+		}
+		if _, err := backend.Authenticate(SaslData{Username: "user", Password: "wrong"}); err != ErrRefused {
+			t.Errorf("Expected refused, actual %v", err)
+		}
+		if !backend.CheckVhost(user, "/") || backend.CheckVhost(user, "other") {
+			t.Error("Expected vhost access by callback")
+		}
+		if !backend.CheckResource(user, "/", ResourceQueue, "user.queue", AccessRead) || backend.CheckResource(user, "/", ResourceQueue, "user.queue", AccessWrite) {
+			t.Error("Expected resource access by callback")
+		}
+		if !backend.CheckTopic(user, "/", "amq.topic", "user.key", AccessWrite) || backend.CheckTopic(user, "/", "amq.topic", "other.key", AccessWrite) {
+			t.Error("Expected topic access by callback")
+		}
+	}
+
+	var calls int32
+	counting := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		resp.Write([]byte("allow"))
+	}))
+	defer counting.Close()
+	backend, _ := NewHTTPBackend("", stub.URL+"/user", "", counting.URL, "")
+	backend.CacheTTL = 50 * time.Millisecond
+	user := &User{Username: "user"}
+	for i := 0; i < 10; i++ {
+		backend.CheckResource(user, "/", ResourceExchange, "ex", AccessWrite)
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("Expected decision cached, actual %d calls", atomic.LoadInt32(&calls))
+	}
+	backend.CheckResource(user, "/", ResourceExchange, "other", AccessWrite)
+	time.Sleep(60 * time.Millisecond)
+	backend.CheckResource(user, "/", ResourceExchange, "ex", AccessWrite)
+	if atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("Expected callback for other resource and after TTL, actual %d calls", atomic.LoadInt32(&calls))
+	}
+
+	backend, _ = NewHTTPBackend("", "http://127.0.0.1:0/user", "", "", "")
+	if _, err := backend.Authenticate(SaslData{Username: "user", Password: "secret"}); err == nil || err == ErrRefused {
+		t.Errorf("Expected connection error, actual %v", err)
+	}
+	if !backend.CheckVhost(&User{Username: "user"}, "/") {
+		t.Error("Expected access allowed without callback")
+	}
+	if _, err := NewHTTPBackend("PUT", stub.URL, "", "", ""); err == nil {
+		t.Error("Expected error on unsupported method")
+	}
+}
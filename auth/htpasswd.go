@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const htpasswdSHAPrefix = "{SHA}"
+
+// HtpasswdBackend authenticates users from htpasswd-style file with "name:hash" lines
+// bcrypt and {SHA} hashes are supported, file is reloaded on change
+// It does not authorize access, so it should be paired with another authorizer
+type HtpasswdBackend struct {
+	path    string
+	lock    sync.RWMutex
+	modTime time.Time
+	hashes  map[string]string
+}
+
+// NewHtpasswdBackend returns backend with users loaded from file
+func NewHtpasswdBackend(path string) (*HtpasswdBackend, error) {
+	backend := &HtpasswdBackend{path: path}
+	if err := backend.load(); err != nil {
+		return nil, err
+	}
+	return backend, nil
+}
+
+// load reads file if it is changed since last load
+func (backend *HtpasswdBackend) load() error {
+	info, err := os.Stat(backend.path)
+	if err != nil {
+		return err
+	}
+	backend.lock.RLock()
+	changed := !info.ModTime().Equal(backend.modTime)
+	backend.lock.RUnlock()
+	if !changed {
+		return nil
+	}
+
+	file, err := os.Open(backend.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hashes := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return fmt.Errorf("bad htpasswd line %d", lineNum)
+		}
+		if !strings.HasPrefix(parts[1], "$2") && !strings.HasPrefix(parts[1], htpasswdSHAPrefix) {
+			return fmt.Errorf("unsupported hash of user '%s', only bcrypt and {SHA} are supported", parts[0])
+		}
+		hashes[parts[0]] = parts[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	backend.lock.Lock()
+	backend.hashes = hashes
+	backend.modTime = info.ModTime()
+	backend.lock.Unlock()
+	return nil
+}
+
+// Authenticate checks password with hash from file
+// On reload error users loaded before are kept
+func (backend *HtpasswdBackend) Authenticate(saslData SaslData) (*User, error) {
+	reloadErr := backend.load()
+
+	backend.lock.RLock()
+	hash, ok := backend.hashes[saslData.Username]
+	backend.lock.RUnlock()
+	if !ok {
+		if reloadErr != nil {
+			return nil, reloadErr
+		}
+		return nil, ErrRefused
+	}
+	if !saslData.Trusted && !checkHtpasswdHash(saslData.Password, hash) {
+		return nil, ErrRefused
+	}
+	return &User{Username: saslData.Username}, nil
+}
+
+func checkHtpasswdHash(password string, hash string) bool {
+	if strings.HasPrefix(hash, htpasswdSHAPrefix) {
+		sum := sha1.Sum([]byte(password))
+		expected := htpasswdSHAPrefix + base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(expected), []byte(hash)) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
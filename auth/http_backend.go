@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	httpBackendTimeout = 5 * time.Second
+	// httpBackendCacheTTL is how long authorization decisions are reused,
+	// so publishing does not call resource and topic callbacks on each message
+	httpBackendCacheTTL = time.Second
+)
+
+// HTTPBackend authenticates and authorizes users by callbacks of external HTTP service
+// in the same way as RabbitMQ HTTP backend: each callback responds "allow" or "deny",
+// user callback could add user tags after "allow". Empty authorization callback URL allows any access
+type HTTPBackend struct {
+	UserURL     string
+	VhostURL    string
+	ResourceURL string
+	TopicURL    string
+	// Method is GET or POST, params are sent in query or form accordingly
+	Method string
+	// CacheTTL is how long authorization decisions are cached, zero disables cache
+	CacheTTL time.Duration
+
+	client     *http.Client
+	cacheLock  sync.Mutex
+	cache      map[string]httpDecision
+	cacheSweep time.Time
+}
+
+// httpDecision is cached decision of authorization callback
+type httpDecision struct {
+	allowed bool
+	expires time.Time
+}
+
+// NewHTTPBackend returns backend which calls given callbacks
+func NewHTTPBackend(method string, userURL string, vhostURL string, resourceURL string, topicURL string) (*HTTPBackend, error) {
+	method = strings.ToUpper(method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	if method != http.MethodGet && method != http.MethodPost {
+		return nil, fmt.Errorf("unsupported HTTP backend method '%s'", method)
+	}
+	if userURL == "" {
+		return nil, fmt.Errorf("HTTP backend user URL is required")
+	}
+	return &HTTPBackend{
+		UserURL:     userURL,
+		VhostURL:    vhostURL,
+		ResourceURL: resourceURL,
+		TopicURL:    topicURL,
+		Method:      method,
+		CacheTTL:    httpBackendCacheTTL,
+		client:      &http.Client{Timeout: httpBackendTimeout},
+		cache:       make(map[string]httpDecision),
+	}, nil
+}
+
+// call requests callback and returns words of response, the first one is decision
+func (backend *HTTPBackend) call(callbackURL string, params url.Values) ([]string, error) {
+	var resp *http.Response
+	var err error
+	if backend.Method == http.MethodPost {
+		resp, err = backend.client.PostForm(callbackURL, params)
+	} else {
+		separator := "?"
+		if strings.Contains(callbackURL, "?") {
+			separator = "&"
+		}
+		resp, err = backend.client.Get(callbackURL + separator + params.Encode())
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP backend responded %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(body)), nil
+}
+
+// allowed checks if callback allows access, any error denies it
+// Decisions are cached for CacheTTL, errors are not cached so callback is retried on the next check
+func (backend *HTTPBackend) allowed(callbackURL string, params url.Values) bool {
+	if callbackURL == "" {
+		return true
+	}
+	key := callbackURL + "?" + params.Encode()
+	if allowed, ok := backend.getDecision(key); ok {
+		return allowed
+	}
+	words, err := backend.call(callbackURL, params)
+	if err != nil {
+		return false
+	}
+	allowed := len(words) > 0 && strings.ToLower(words[0]) == "allow"
+	backend.setDecision(key, allowed)
+	return allowed
+}
+
+func (backend *HTTPBackend) getDecision(key string) (allowed bool, ok bool) {
+	backend.cacheLock.Lock()
+	defer backend.cacheLock.Unlock()
+	decision, ok := backend.cache[key]
+	if !ok || time.Now().After(decision.expires) {
+		return false, false
+	}
+	return decision.allowed, true
+}
+
+func (backend *HTTPBackend) setDecision(key string, allowed bool) {
+	if backend.CacheTTL <= 0 {
+		return
+	}
+	backend.cacheLock.Lock()
+	defer backend.cacheLock.Unlock()
+	now := time.Now()
+	// expired decisions are removed once per TTL, so cache does not grow with unique resources
+	if now.After(backend.cacheSweep) {
+		for cachedKey, decision := range backend.cache {
+			if now.After(decision.expires) {
+				delete(backend.cache, cachedKey)
+			}
+		}
+		backend.cacheSweep = now.Add(backend.CacheTTL)
+	}
+	backend.cache[key] = httpDecision{allowed: allowed, expires: now.Add(backend.CacheTTL)}
+}
+
+// Authenticate calls user callback with username and password, tags are taken from response
+func (backend *HTTPBackend) Authenticate(saslData SaslData) (*User, error) {
+	params := url.Values{"username": {saslData.Username}}
+	if !saslData.Trusted {
+		params.Set("password", saslData.Password)
+	}
+	words, err := backend.call(backend.UserURL, params)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 || strings.ToLower(words[0]) != "allow" {
+		return nil, ErrRefused
+	}
+	return &User{Username: saslData.Username, Tags: words[1:]}, nil
+}
+
+// CheckVhost calls vhost callback with username and vhost
+func (backend *HTTPBackend) CheckVhost(user *User, vhost string) bool {
+	return backend.allowed(backend.VhostURL, url.Values{
+		"username": {user.Username},
+		"vhost":    {vhost},
+	})
+}
+
+// CheckResource calls resource callback with username, vhost, resource type, name and permission
+func (backend *HTTPBackend) CheckResource(user *User, vhost string, resourceType string, resource string, access string) bool {
+	return backend.allowed(backend.ResourceURL, url.Values{
+		"username":   {user.Username},
+		"vhost":      {vhost},
+		"resource":   {resourceType},
+		"name":       {resource},
+		"permission": {access},
+	})
+}
+
+// CheckTopic calls topic callback with username, vhost, exchange name, permission and routing key
+func (backend *HTTPBackend) CheckTopic(user *User, vhost string, exchange string, routingKey string, access string) bool {
+	return backend.allowed(backend.TopicURL, url.Values{
+		"username":    {user.Username},
+		"vhost":       {vhost},
+		"resource":    {"topic"},
+		"name":        {exchange},
+		"permission":  {access},
+		"routing_key": {routingKey},
+	})
+}
@@ -0,0 +1,434 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	// hash functions used by signing algorithms
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// Scope actions in addition to kinds of access
+const scopeTag = "tag"
+
+// Token is verified JWT of user
+type Token struct {
+	Subject   string
+	ExpiresAt time.Time
+	Tags      []string
+
+	scopes []*tokenScope
+}
+
+// tokenScope grants access to resources matching vhost, name and optional routing key wildcards
+// Scope is written in RabbitMQ way "<resource server id>.<access>:<vhost>/<name>[/<routing key>]"
+type tokenScope struct {
+	access     string
+	vhost      *regexp.Regexp
+	name       *regexp.Regexp
+	routingKey *regexp.Regexp
+}
+
+func (scope *tokenScope) match(access string, vhost string, name string) bool {
+	return scope.access == access && scope.vhost.MatchString(vhost) && scope.name.MatchString(name)
+}
+
+// wildcard compiles scope part where '*' matches any string, part could be url-encoded like %2F for vhost "/"
+func wildcard(pattern string) (*regexp.Regexp, error) {
+	pattern, err := url.PathUnescape(pattern)
+	if err != nil {
+		return nil, err
+	}
+	quoted := strings.Replace(regexp.QuoteMeta(pattern), `\*`, ".*", -1)
+	return regexp.Compile("^" + quoted + "$")
+}
+
+func parseScope(access string, resource string) (*tokenScope, error) {
+	parts := strings.Split(resource, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, fmt.Errorf("invalid scope resource '%s'", resource)
+	}
+	scope := &tokenScope{access: access}
+	var err error
+	if scope.vhost, err = wildcard(parts[0]); err != nil {
+		return nil, err
+	}
+	if scope.name, err = wildcard(parts[1]); err != nil {
+		return nil, err
+	}
+	if len(parts) == 3 {
+		if scope.routingKey, err = wildcard(parts[2]); err != nil {
+			return nil, err
+		}
+	}
+	return scope, nil
+}
+
+// jwtKey is verification key, []byte for HMAC, *rsa.PublicKey or *ecdsa.PublicKey
+type jwtKey struct {
+	id  string
+	key interface{}
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Subject   string      `json:"sub"`
+	ExpiresAt *float64    `json:"exp"`
+	NotBefore *float64    `json:"nbf"`
+	Audience  interface{} `json:"aud"`
+	Scope     interface{} `json:"scope"`
+}
+
+// JWTBackend authenticates users by JWT passed as password and authorizes them by token scopes
+// Tokens are verified with HMAC secret or RSA and ECDSA public keys
+type JWTBackend struct {
+	// ResourceServerID is expected token audience and prefix of scopes, scopes with other prefixes are ignored
+	ResourceServerID string
+
+	keys []jwtKey
+}
+
+// NewJWTBackend returns backend which verifies tokens with HMAC secret and keys from JWKS file
+func NewJWTBackend(resourceServerID string, hmacKey string, jwksFile string) (*JWTBackend, error) {
+	backend := &JWTBackend{ResourceServerID: resourceServerID}
+	if hmacKey != "" {
+		backend.keys = append(backend.keys, jwtKey{key: []byte(hmacKey)})
+	}
+	if jwksFile != "" {
+		keys, err := readJWKS(jwksFile)
+		if err != nil {
+			return nil, err
+		}
+		backend.keys = append(backend.keys, keys...)
+	}
+	if len(backend.keys) == 0 {
+		return nil, errors.New("JWT backend requires HMAC key or JWKS file")
+	}
+	return backend, nil
+}
+
+// IsJWT checks if secret looks like compact serialized JWT
+func IsJWT(secret string) bool {
+	return strings.Count(secret, ".") == 2
+}
+
+// ParseToken verifies token signature and claims and returns token with scopes of resource server
+func (backend *JWTBackend) ParseToken(raw string) (*Token, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	header := &jwtHeader{}
+	if err := decodeSegment(parts[0], header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+
+	verified := false
+	for _, key := range backend.keys {
+		if key.id != "" && header.KeyID != "" && key.id != header.KeyID {
+			continue
+		}
+		if verifySignature(header.Algorithm, key.key, []byte(parts[0]+"."+parts[1]), signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, fmt.Errorf("token signature with '%s' is not verified", header.Algorithm)
+	}
+
+	claims := &jwtClaims{}
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return nil, err
+	}
+	return backend.validate(claims)
+}
+
+func (backend *JWTBackend) validate(claims *jwtClaims) (*Token, error) {
+	now := time.Now()
+	if claims.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+	if claims.ExpiresAt == nil {
+		return nil, errors.New("token has no expiration time")
+	}
+	token := &Token{Subject: claims.Subject, ExpiresAt: unixTime(*claims.ExpiresAt)}
+	if !now.Before(token.ExpiresAt) {
+		return nil, errors.New("token expired")
+	}
+	if claims.NotBefore != nil && now.Before(unixTime(*claims.NotBefore)) {
+		return nil, errors.New("token is not valid yet")
+	}
+
+	prefix := ""
+	if backend.ResourceServerID != "" {
+		if !contains(stringList(claims.Audience), backend.ResourceServerID) {
+			return nil, fmt.Errorf("token audience is not '%s'", backend.ResourceServerID)
+		}
+		prefix = backend.ResourceServerID + "."
+	}
+
+	for _, value := range stringList(claims.Scope) {
+		if !strings.HasPrefix(value, prefix) {
+			continue
+		}
+		value = strings.TrimPrefix(value, prefix)
+		separator := strings.Index(value, ":")
+		if separator < 0 {
+			continue
+		}
+		access, resource := value[:separator], value[separator+1:]
+		switch access {
+		case scopeTag:
+			token.Tags = append(token.Tags, resource)
+		case AccessConfigure, AccessWrite, AccessRead:
+			scope, err := parseScope(access, resource)
+			if err != nil {
+				return nil, err
+			}
+			token.scopes = append(token.scopes, scope)
+		}
+	}
+	return token, nil
+}
+
+// Authenticate verifies token passed as password, user name is taken from token subject
+// Credentials which are not JWT are refused, so the next backend in chain could check them
+func (backend *JWTBackend) Authenticate(saslData SaslData) (*User, error) {
+	if !IsJWT(saslData.Password) {
+		return nil, ErrRefused
+	}
+	token, err := backend.ParseToken(saslData.Password)
+	if err != nil {
+		return nil, err
+	}
+	return &User{Username: token.Subject, Tags: token.Tags, token: token}, nil
+}
+
+// CheckVhost checks if token has any scope on vhost
+func (backend *JWTBackend) CheckVhost(user *User, vhost string) bool {
+	if user.token == nil {
+		return false
+	}
+	for _, scope := range user.token.scopes {
+		if scope.vhost.MatchString(vhost) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckResource checks if token has scope with access to resource
+func (backend *JWTBackend) CheckResource(user *User, vhost string, resourceType string, resource string, access string) bool {
+	if user.token == nil {
+		return false
+	}
+	for _, scope := range user.token.scopes {
+		if scope.match(access, vhost, resource) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckTopic checks if token has scope with access to exchange and routing key
+// Scope without routing key part grants access to any routing key
+func (backend *JWTBackend) CheckTopic(user *User, vhost string, exchange string, routingKey string, access string) bool {
+	if user.token == nil {
+		return false
+	}
+	for _, scope := range user.token.scopes {
+		if scope.match(access, vhost, exchange) && (scope.routingKey == nil || scope.routingKey.MatchString(routingKey)) {
+			return true
+		}
+	}
+	return false
+}
+
+func verifySignature(algorithm string, key interface{}, input []byte, signature []byte) bool {
+	if len(algorithm) != 5 {
+		return false
+	}
+	var hash crypto.Hash
+	switch algorithm[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return false
+	}
+
+	switch key := key.(type) {
+	case []byte:
+		if !strings.HasPrefix(algorithm, "HS") {
+			return false
+		}
+		mac := hmac.New(hash.New, key)
+		mac.Write(input)
+		return hmac.Equal(mac.Sum(nil), signature)
+	case *rsa.PublicKey:
+		hasher := hash.New()
+		hasher.Write(input)
+		switch {
+		case strings.HasPrefix(algorithm, "RS"):
+			return rsa.VerifyPKCS1v15(key, hash, hasher.Sum(nil), signature) == nil
+		case strings.HasPrefix(algorithm, "PS"):
+			return rsa.VerifyPSS(key, hash, hasher.Sum(nil), signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		}
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(algorithm, "ES") || len(signature) != 2*size {
+			return false
+		}
+		hasher := hash.New()
+		hasher.Write(input)
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(key, hasher.Sum(nil), r, s)
+	}
+	return false
+}
+
+type jwk struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Curve   string `json:"crv"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+	K       string `json:"k"`
+}
+
+// readJWKS reads RSA, EC and symmetric (oct) keys from JSON Web Key Set file
+func readJWKS(path string) ([]jwtKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	if err = json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make([]jwtKey, 0, len(set.Keys))
+	for _, key := range set.Keys {
+		var parsed interface{}
+		switch key.KeyType {
+		case "RSA":
+			n, err := decodeBigInt(key.N)
+			if err != nil {
+				return nil, err
+			}
+			e, err := decodeBigInt(key.E)
+			if err != nil {
+				return nil, err
+			}
+			parsed = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch key.Curve {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				return nil, fmt.Errorf("unsupported curve '%s' of key '%s'", key.Curve, key.KeyID)
+			}
+			x, err := decodeBigInt(key.X)
+			if err != nil {
+				return nil, err
+			}
+			y, err := decodeBigInt(key.Y)
+			if err != nil {
+				return nil, err
+			}
+			parsed = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(key.K)
+			if err != nil {
+				return nil, err
+			}
+			parsed = secret
+		default:
+			return nil, fmt.Errorf("unsupported type '%s' of key '%s'", key.KeyType, key.KeyID)
+		}
+		keys = append(keys, jwtKey{id: key.KeyID, key: parsed})
+	}
+	return keys, nil
+}
+
+func decodeSegment(segment string, value interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+func unixTime(seconds float64) time.Time {
+	return time.Unix(int64(seconds), 0)
+}
+
+// stringList returns claim which could be string of space separated values or array of strings
+func stringList(claim interface{}) []string {
+	switch claim := claim.(type) {
+	case string:
+		return strings.Fields(claim)
+	case []interface{}:
+		list := make([]string, 0, len(claim))
+		for _, value := range claim {
+			if str, ok := value.(string); ok {
+				list = append(list, str)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signToken returns compact JWT signed by HMAC secret, RSA or ECDSA private key
+func signToken(t *testing.T, algorithm string, keyID string, key interface{}, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": algorithm, "typ": "JWT", "kid": keyID})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	hash := crypto.SHA256
+	hasher := hash.New()
+	hasher.Write([]byte(input))
+	var signature []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(hash.New, key)
+		mac.Write([]byte(input))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		signature, _ = rsa.SignPKCS1v15(rand.Reader, key, hash, hasher.Sum(nil))
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, hasher.Sum(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = append(padBytes(r, 32), padBytes(s, 32)...)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func padBytes(value *big.Int, size int) []byte {
+	data := value.Bytes()
+	return append(make([]byte, size-len(data)), data...)
+}
+
+func tokenClaims(scope ...string) map[string]interface{} {
+	return map[string]interface{}{
+		"sub":   "jwtuser",
+		"aud":   []string{"garagemq"},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": strings.Join(scope, " "),
+	}
+}
+
+func TestJWTBackend_HMAC(t *testing.T) {
+	secret := []byte("secret")
+	backend, err := NewJWTBackend("garagemq", string(secret), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := signToken(t, "HS256", "", secret, tokenClaims(
+		"garagemq.configure:%2F/user.*",
+		"garagemq.write:%2F/amq.topic/user.*",
+		"garagemq.read:%2F/*",
+		"garagemq.tag:management",
+		"other.write:*/*",
+	))
+	user, err := backend.Authenticate(SaslData{Password: token})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "jwtuser" || !user.HasTag(TagManagement) || user.ExpiresAt().IsZero() {
+		t.Errorf("Expected user from token claims, actual %+v", user)
+	}
+
+	if !backend.CheckVhost(user, "/") || backend.CheckVhost(user, "other") {
+		t.Error("Expected access to vhost of scopes only")
+	}
+	checks := []struct {
+		access   string
+		resource string
+		expected bool
+	}{
+		{AccessConfigure, "user.queue", true},
+		{AccessConfigure, "queue", false},
+		{AccessRead, "queue", true},
+		{AccessWrite, "amq.topic", true},
+		{AccessWrite, "amq.direct", false},
+	}
+	for _, check := range checks {
+		if backend.CheckResource(user, "/", ResourceQueue, check.resource, check.access) != check.expected {
+			t.Errorf("Expected %s access to %s is %v", check.access, check.resource, check.expected)
+		}
+	}
+	if !backend.CheckTopic(user, "/", "amq.topic", "user.key", AccessWrite) || backend.CheckTopic(user, "/", "amq.topic", "other.key", AccessWrite) {
+		t.Error("Expected write access to routing keys of scope")
+	}
+	if !backend.CheckTopic(user, "/", "amq.topic", "any.key", AccessRead) {
+		t.Error("Expected read access to any routing key by scope without routing key")
+	}
+	if backend.CheckVhost(&User{Username: "jwtuser"}, "/") {
+		t.Error("Expected no access for user without token")
+	}
+
+	if _, err := backend.Authenticate(SaslData{Password: "guest"}); err != ErrRefused {
+		t.Errorf("Expected refused on non-JWT password, actual %v", err)
+	}
+	if _, err := backend.Authenticate(SaslData{Password: signToken(t, "HS256", "", []byte("wrong"), tokenClaims())}); err == nil {
+		t.Error("Expected error on wrong signature")
+	}
+}
+
+func TestJWTBackend_Claims(t *testing.T) {
+	secret := []byte("secret")
+	backend, _ := NewJWTBackend("garagemq", string(secret), "")
+
+	expired := tokenClaims()
+	expired["exp"] = time.Now().Add(-time.Minute).Unix()
+	notYet := tokenClaims()
+	notYet["nbf"] = time.Now().Add(time.Hour).Unix()
+	otherAudience := tokenClaims()
+	otherAudience["aud"] = "other"
+	noExpiration := tokenClaims()
+	delete(noExpiration, "exp")
+	noSubject := tokenClaims()
+	delete(noSubject, "sub")
+
+	for name, claims := range map[string]map[string]interface{}{
+		"expired":        expired,
+		"not yet valid":  notYet,
+		"other audience": otherAudience,
+		"no expiration":  noExpiration,
+		"no subject":     noSubject,
+	} {
+		if _, err := backend.ParseToken(signToken(t, "HS256", "", secret, claims)); err == nil {
+			t.Errorf("Expected error on %s token", name)
+		}
+	}
+
+	if _, err := NewJWTBackend("garagemq", "", ""); err == nil {
+		t.Error("Expected error without keys")
+	}
+}
+
+func TestJWTBackend_JWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	encode := func(value *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(value.Bytes())
+	}
+	jwks, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "n": encode(rsaKey.N), "e": encode(big.NewInt(int64(rsaKey.E)))},
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encode(ecKey.X), "y": encode(ecKey.Y)},
+			{"kty": "oct", "kid": "oct", "k": base64.RawURLEncoding.EncodeToString([]byte("secret"))},
+		},
+	})
+	file, _ := ioutil.TempFile("", "garagemq_jwks")
+	file.Write(jwks)
+	file.Close()
+	defer os.Remove(file.Name())
+
+	backend, err := NewJWTBackend("", "", file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := tokenClaims("read:*/*")
+	for _, token := range []string{
+		signToken(t, "RS256", "rsa", rsaKey, claims),
+		signToken(t, "ES256", "ec", ecKey, claims),
+		signToken(t, "HS256", "oct", []byte("secret"), claims),
+	} {
+		user, err := backend.Authenticate(SaslData{Password: token})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !backend.CheckResource(user, "any", ResourceQueue, "queue", AccessRead) {
+			t.Error("Expected read access by scope without resource server prefix")
+		}
+	}
+
+	// public key must not be used as HMAC secret
+	publicKey := []byte(encode(rsaKey.N))
+	if _, err := backend.ParseToken(signToken(t, "HS256", "rsa", publicKey, claims)); err == nil {
+		t.Error("Expected error on HMAC token with RSA key id")
+	}
+	if _, err := backend.ParseToken(signToken(t, "RS256", "ec", rsaKey, claims)); err == nil {
+		t.Error("Expected error on token signed by other key")
+	}
+}
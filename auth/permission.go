@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/valinurovam/garagemq/amqp"
+)
+
+// Kinds of access to vhost resources
+const (
+	AccessConfigure = "configure"
+	AccessWrite     = "write"
+	AccessRead      = "read"
+)
+
+// FullAccess is permission pattern which grants access to any resource
+const FullAccess = ".*"
+
+// Permission represents user access to vhost resources in RabbitMQ way
+// Each kind of access is regexp which resource name should match
+// Empty pattern denies access to any resource
+type Permission struct {
+	Username  string
+	Vhost     string
+	Configure string
+	Write     string
+	Read      string
+
+	configure *regexp.Regexp
+	write     *regexp.Regexp
+	read      *regexp.Regexp
+}
+
+// NewPermission returns permission with compiled patterns
+func NewPermission(userName string, vhost string, configure string, write string, read string) (*Permission, error) {
+	perm := &Permission{
+		Username:  userName,
+		Vhost:     vhost,
+		Configure: configure,
+		Write:     write,
+		Read:      read,
+	}
+	if err := perm.compile(); err != nil {
+		return nil, err
+	}
+	return perm, nil
+}
+
+func (perm *Permission) compile() (err error) {
+	if perm.configure, err = compilePattern(perm.Configure); err != nil {
+		return err
+	}
+	if perm.write, err = compilePattern(perm.Write); err != nil {
+		return err
+	}
+	perm.read, err = compilePattern(perm.Read)
+	return err
+}
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile(pattern)
+}
+
+// Check checks if permission grants given kind of access to resource
+func (perm *Permission) Check(access string, resource string) bool {
+	var pattern *regexp.Regexp
+	switch access {
+	case AccessConfigure:
+		pattern = perm.configure
+	case AccessWrite:
+		pattern = perm.write
+	case AccessRead:
+		pattern = perm.read
+	}
+	return pattern != nil && pattern.MatchString(resource)
+}
+
+// Marshal returns raw representation of permission to store into storage
+func (perm *Permission) Marshal() (data []byte, err error) {
+	buf := bytes.NewBuffer(make([]byte, 0))
+	for _, value := range []string{perm.Username, perm.Vhost} {
+		if err = amqp.WriteShortstr(buf, value); err != nil {
+			return nil, err
+		}
+	}
+	for _, value := range []string{perm.Configure, perm.Write, perm.Read} {
+		if err = amqp.WriteLongstr(buf, []byte(value)); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal restore permission from storage
+func (perm *Permission) Unmarshal(data []byte) (err error) {
+	buf := bytes.NewReader(data)
+	if perm.Username, err = amqp.ReadShortstr(buf); err != nil {
+		return err
+	}
+	if perm.Vhost, err = amqp.ReadShortstr(buf); err != nil {
+		return err
+	}
+	for _, value := range []*string{&perm.Configure, &perm.Write, &perm.Read} {
+		var pattern []byte
+		if pattern, err = amqp.ReadLongstr(buf); err != nil {
+			return err
+		}
+		*value = string(pattern)
+	}
+	return perm.compile()
+}
+
+// Variables which could be used in topic permission patterns
+const (
+	varUsername = "{username}"
+	varVhost    = "{vhost}"
+)
+
+// TopicPermission restricts routing keys user could publish with (write) or bind with (read)
+// on topic exchange of vhost. Patterns could reference {username} and {vhost} variables
+type TopicPermission struct {
+	Username string
+	Vhost    string
+	Exchange string
+	Write    string
+	Read     string
+
+	write *regexp.Regexp
+	read  *regexp.Regexp
+}
+
+// NewTopicPermission returns topic permission with expanded and compiled patterns
+func NewTopicPermission(userName string, vhost string, exchange string, write string, read string) (*TopicPermission, error) {
+	perm := &TopicPermission{
+		Username: userName,
+		Vhost:    vhost,
+		Exchange: exchange,
+		Write:    write,
+		Read:     read,
+	}
+	if err := perm.compile(); err != nil {
+		return nil, err
+	}
+	return perm, nil
+}
+
+func (perm *TopicPermission) compile() (err error) {
+	if perm.write, err = compilePattern(perm.expand(perm.Write)); err != nil {
+		return err
+	}
+	perm.read, err = compilePattern(perm.expand(perm.Read))
+	return err
+}
+
+// expand replaces variables in pattern with quoted values, so user name could not inject regexp
+func (perm *TopicPermission) expand(pattern string) string {
+	return strings.NewReplacer(
+		varUsername, regexp.QuoteMeta(perm.Username),
+		varVhost, regexp.QuoteMeta(perm.Vhost),
+	).Replace(pattern)
+}
+
+// Check checks if topic permission grants write or read access to routing key
+func (perm *TopicPermission) Check(access string, routingKey string) bool {
+	var pattern *regexp.Regexp
+	switch access {
+	case AccessWrite:
+		pattern = perm.write
+	case AccessRead:
+		pattern = perm.read
+	}
+	return pattern != nil && pattern.MatchString(routingKey)
+}
+
+// Marshal returns raw representation of topic permission to store into storage
+func (perm *TopicPermission) Marshal() (data []byte, err error) {
+	buf := bytes.NewBuffer(make([]byte, 0))
+	for _, value := range []string{perm.Username, perm.Vhost, perm.Exchange} {
+		if err = amqp.WriteShortstr(buf, value); err != nil {
+			return nil, err
+		}
+	}
+	for _, value := range []string{perm.Write, perm.Read} {
+		if err = amqp.WriteLongstr(buf, []byte(value)); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal restore topic permission from storage
+func (perm *TopicPermission) Unmarshal(data []byte) (err error) {
+	buf := bytes.NewReader(data)
+	for _, value := range []*string{&perm.Username, &perm.Vhost, &perm.Exchange} {
+		if *value, err = amqp.ReadShortstr(buf); err != nil {
+			return err
+		}
+	}
+	for _, value := range []*string{&perm.Write, &perm.Read} {
+		var pattern []byte
+		if pattern, err = amqp.ReadLongstr(buf); err != nil {
+			return err
+		}
+		*value = string(pattern)
+	}
+	return perm.compile()
+}
@@ -0,0 +1,75 @@
+package auth
+
+import "testing"
+
+func TestPermission_Check(t *testing.T) {
+	perm, err := NewPermission("user", "/", "^user\\.", "", FullAccess)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !perm.Check(AccessConfigure, "user.queue") || perm.Check(AccessConfigure, "other.queue") {
+		t.Error("Expected configure access by pattern")
+	}
+	if perm.Check(AccessWrite, "user.queue") {
+		t.Error("Expected empty pattern denies access")
+	}
+	if !perm.Check(AccessRead, "") || !perm.Check(AccessRead, "any") {
+		t.Error("Expected full read access")
+	}
+	if perm.Check("unknown", "user.queue") {
+		t.Error("Expected unknown access denied")
+	}
+
+	if _, err := NewPermission("user", "/", "(", "", ""); err == nil {
+		t.Error("Expected error on bad pattern")
+	}
+}
+
+func TestPermission_MarshalUnmarshal(t *testing.T) {
+	perm, _ := NewPermission("user", "/", "^user\\.", "", FullAccess)
+	data, err := perm.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := &Permission{}
+	if err := restored.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Username != "user" || restored.Vhost != "/" || restored.Configure != perm.Configure || restored.Write != "" || restored.Read != FullAccess {
+		t.Errorf("Expected same permission, actual %+v", restored)
+	}
+	if !restored.Check(AccessConfigure, "user.queue") {
+		t.Error("Expected restored permission patterns compiled")
+	}
+}
+
+func TestTopicPermission_Check(t *testing.T) {
+	perm, err := NewTopicPermission("dev.1", "/", "amq.topic", "^devices\\.{username}\\.", "^devices\\.{username}\\.|^{vhost}$")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !perm.Check(AccessWrite, "devices.dev.1.temp") || perm.Check(AccessWrite, "devices.dev.2.temp") {
+		t.Error("Expected write access by pattern with user name")
+	}
+	if perm.Check(AccessWrite, "devices.devX1.temp") {
+		t.Error("Expected user name is quoted in pattern")
+	}
+	if !perm.Check(AccessRead, "/") {
+		t.Error("Expected read access by pattern with vhost")
+	}
+	if perm.Check(AccessConfigure, "devices.dev.1.temp") {
+		t.Error("Expected configure access is not checked by topic permission")
+	}
+
+	data, _ := perm.Marshal()
+	restored := &TopicPermission{}
+	if err := restored.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Exchange != "amq.topic" || restored.Write != perm.Write || !restored.Check(AccessWrite, "devices.dev.1.temp") {
+		t.Errorf("Expected same topic permission, actual %+v", restored)
+	}
+}
@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/valinurovam/garagemq/amqp"
+)
+
+// SASL mechanisms supported out of the box
+const (
+	SaslAMQPlain = "AMQPLAIN"
+	SaslExternal = "EXTERNAL"
+)
+
+// SaslContext holds connection properties which mechanism could rely on
+type SaslContext struct {
+	// PeerCertificates are verified client certificates of TLS connection
+	PeerCertificates []*x509.Certificate
+}
+
+// Mechanism parses SASL response from connection.start-ok
+type Mechanism interface {
+	// Name returns mechanism name offered in connection.start
+	Name() string
+	// Available checks if mechanism could be used by connection
+	Available(ctx *SaslContext) bool
+	// Parse returns credentials from client response
+	Parse(response []byte, ctx *SaslContext) (SaslData, error)
+}
+
+var (
+	mechanismsLock sync.RWMutex
+	mechanisms     = make(map[string]Mechanism)
+)
+
+func init() {
+	RegisterMechanism(&plainMechanism{})
+	RegisterMechanism(&amqPlainMechanism{})
+	RegisterMechanism(&externalMechanism{})
+}
+
+// RegisterMechanism adds mechanism into registry or replace registered one with the same name
+func RegisterMechanism(mechanism Mechanism) {
+	mechanismsLock.Lock()
+	defer mechanismsLock.Unlock()
+	mechanisms[mechanism.Name()] = mechanism
+}
+
+// GetMechanism returns registered mechanism by name or nil
+func GetMechanism(name string) Mechanism {
+	mechanismsLock.RLock()
+	defer mechanismsLock.RUnlock()
+	return mechanisms[name]
+}
+
+// AvailableMechanisms returns names of enabled mechanisms which could be used by connection, in order of enabled
+func AvailableMechanisms(enabled []string, ctx *SaslContext) []string {
+	var names []string
+	for _, name := range enabled {
+		if mechanism := GetMechanism(name); mechanism != nil && mechanism.Available(ctx) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+type plainMechanism struct{}
+
+func (m *plainMechanism) Name() string {
+	return SaslPlain
+}
+
+func (m *plainMechanism) Available(ctx *SaslContext) bool {
+	return true
+}
+
+func (m *plainMechanism) Parse(response []byte, ctx *SaslContext) (SaslData, error) {
+	return ParsePlain(response)
+}
+
+// amqPlainMechanism parses LOGIN and PASSWORD from field table without length prefix
+type amqPlainMechanism struct{}
+
+func (m *amqPlainMechanism) Name() string {
+	return SaslAMQPlain
+}
+
+func (m *amqPlainMechanism) Available(ctx *SaslContext) bool {
+	return true
+}
+
+func (m *amqPlainMechanism) Parse(response []byte, ctx *SaslContext) (SaslData, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, len(response)+4))
+	binary.Write(buf, binary.BigEndian, uint32(len(response)))
+	buf.Write(response)
+	table, err := amqp.ReadTable(buf, amqp.ProtoRabbit)
+	if err != nil {
+		return SaslData{}, errors.New("Unable to parse AMQPLAIN SASL response: " + err.Error())
+	}
+
+	saslData := SaslData{}
+	var ok bool
+	if saslData.Username, ok = tableString(table, "LOGIN"); !ok {
+		return SaslData{}, errors.New("Unable to parse AMQPLAIN SASL response: LOGIN is required")
+	}
+	if saslData.Password, ok = tableString(table, "PASSWORD"); !ok {
+		return SaslData{}, errors.New("Unable to parse AMQPLAIN SASL response: PASSWORD is required")
+	}
+	return saslData, nil
+}
+
+func tableString(table *amqp.Table, key string) (string, bool) {
+	switch value := (*table)[key].(type) {
+	case string:
+		return value, true
+	case []byte:
+		return string(value), true
+	}
+	return "", false
+}
+
+// externalMechanism takes identity from TLS client certificate
+// Subject common name is used, or the first DNS or email SAN if common name is empty
+type externalMechanism struct{}
+
+func (m *externalMechanism) Name() string {
+	return SaslExternal
+}
+
+func (m *externalMechanism) Available(ctx *SaslContext) bool {
+	return ctx != nil && len(ctx.PeerCertificates) > 0
+}
+
+func (m *externalMechanism) Parse(response []byte, ctx *SaslContext) (SaslData, error) {
+	if !m.Available(ctx) {
+		return SaslData{}, errors.New("EXTERNAL SASL requires TLS client certificate")
+	}
+	identity := CertificateIdentity(ctx.PeerCertificates[0])
+	if identity == "" {
+		return SaslData{}, errors.New("Unable to get identity from client certificate")
+	}
+	// response could contain authorization identity, which must be the same as certificate one
+	if len(response) > 0 && string(response) != identity {
+		return SaslData{}, fmt.Errorf("Identity '%s' does not match client certificate", response)
+	}
+	return SaslData{Identity: identity, Username: identity, Trusted: true}, nil
+}
+
+// CertificateIdentity returns user name from certificate subject or SAN
+func CertificateIdentity(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	if len(cert.EmailAddresses) > 0 {
+		return cert.EmailAddresses[0]
+	}
+	return ""
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/valinurovam/garagemq/amqp"
+)
+
+func TestAMQPlainMechanism_Parse(t *testing.T) {
+	buf := bytes.NewBuffer(make([]byte, 0))
+	amqp.WriteTable(buf, &amqp.Table{"LOGIN": "testu", "PASSWORD": "testp"}, amqp.ProtoRabbit)
+
+	sasl, err := GetMechanism(SaslAMQPlain).Parse(buf.Bytes()[4:], &SaslContext{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sasl.Username != "testu" || sasl.Password != "testp" || sasl.Trusted {
+		t.Errorf("Unexpected credentials %+v", sasl)
+	}
+
+	if _, err := GetMechanism(SaslAMQPlain).Parse([]byte("LOGIN:testuPASSWORD:testp"), &SaslContext{}); err == nil {
+		t.Error("Expected parse error, actual nil")
+	}
+}
+
+func TestExternalMechanism_Parse(t *testing.T) {
+	mechanism := GetMechanism(SaslExternal)
+	if mechanism.Available(&SaslContext{}) {
+		t.Error("Expected EXTERNAL is not available without client certificate")
+	}
+	if _, err := mechanism.Parse(nil, &SaslContext{}); err == nil {
+		t.Error("Expected error without client certificate")
+	}
+
+	ctx := &SaslContext{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "device1"}}}}
+	sasl, err := mechanism.Parse(nil, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sasl.Username != "device1" || !sasl.Trusted {
+		t.Errorf("Expected trusted identity from certificate, actual %+v", sasl)
+	}
+	if _, err := mechanism.Parse([]byte("other"), ctx); err == nil {
+		t.Error("Expected error on identity which does not match certificate")
+	}
+
+	ctx.PeerCertificates[0] = &x509.Certificate{DNSNames: []string{"device2.example.com"}}
+	if sasl, _ := mechanism.Parse(nil, ctx); sasl.Username != "device2.example.com" {
+		t.Errorf("Expected identity from SAN, actual %s", sasl.Username)
+	}
+}
+
+func TestAvailableMechanisms(t *testing.T) {
+	mechanisms := AvailableMechanisms([]string{SaslExternal, SaslAMQPlain, "UNKNOWN", SaslPlain}, &SaslContext{})
+	if len(mechanisms) != 2 || mechanisms[0] != SaslAMQPlain || mechanisms[1] != SaslPlain {
+		t.Errorf("Expected registered and available mechanisms in order, actual %v", mechanisms)
+	}
+}
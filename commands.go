@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/valinurovam/garagemq/admin"
+	"github.com/valinurovam/garagemq/auth"
+	"github.com/valinurovam/garagemq/config"
+)
+
+// runCommand exits after command with proper status
+func runCommand(err error) {
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// adminURL returns url of running admin server method
+func adminURL(cfg *config.Config, method string, query url.Values) string {
+	return fmt.Sprintf("http://%s:%s/%s?%s", cfg.Admin.IP, cfg.Admin.Port, method, query.Encode())
+}
+
+// adminRequest sends request to running admin server with credentials from --user and --password flags
+func adminRequest(method string, url string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(viper.GetString("user"), viper.GetString("password"))
+	return http.DefaultClient.Do(req)
+}
+
+// backupVhost downloads vhost backup archive from running server
+func backupVhost(cfg *config.Config, vhost string, path string) error {
+	if path == "" {
+		return errors.New("backup file is not specified")
+	}
+	resp, err := adminRequest(http.MethodGet, adminURL(cfg, "backup", url.Values{"vhost": {vhost}}), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readAdminError(resp)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(file, resp.Body); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// restoreVhost uploads vhost backup archive into running server
+func restoreVhost(cfg *config.Config, vhost string, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	resp, err := adminRequest(http.MethodPost, adminURL(cfg, "restore", url.Values{"vhost": {vhost}}), file)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readAdminError(resp)
+	}
+	return nil
+}
+
+// addUser creates user or changes password and tags of existing one on running server
+func addUser(cfg *config.Config, name string, password string, tags string, algorithm string) error {
+	if name == "" || password == "" {
+		return errors.New("user name and password are required")
+	}
+	request := map[string]interface{}{
+		"name":              name,
+		"password":          password,
+		"hashing_algorithm": algorithm,
+		"tags":              splitTags(tags),
+	}
+	body, _ := json.Marshal(request)
+	resp, err := adminRequest(http.MethodPost, adminURL(cfg, "users", nil), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readAdminError(resp)
+	}
+	return nil
+}
+
+// addVhost creates vhost on running server, admin user gets full access to it
+func addVhost(cfg *config.Config, name string) error {
+	if name == "" {
+		return errors.New("vhost name is required")
+	}
+	body, _ := json.Marshal(&admin.VhostDeclareRequest{Name: name})
+	resp, err := adminRequest(http.MethodPost, adminURL(cfg, "vhosts", nil), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readAdminError(resp)
+	}
+	return nil
+}
+
+// deleteVhost removes vhost with all its data on running server
+func deleteVhost(cfg *config.Config, name string) error {
+	if name == "" {
+		return errors.New("vhost name is required")
+	}
+	resp, err := adminRequest(http.MethodDelete, adminURL(cfg, "vhosts", url.Values{"name": {name}}), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readAdminError(resp)
+	}
+	return nil
+}
+
+// listVhosts prints vhosts of running server
+func listVhosts(cfg *config.Config) error {
+	resp, err := adminRequest(http.MethodGet, adminURL(cfg, "vhosts", nil), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readAdminError(resp)
+	}
+
+	response := &admin.VhostsResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return err
+	}
+	for _, vhost := range response.Items {
+		fmt.Println(vhost.Name)
+	}
+	return nil
+}
+
+// hashPassword prints password hash for users in config file
+// Algorithm is taken from security config if it is not set
+func hashPassword(cfg *config.Config, password string, algorithm string) error {
+	if password == "" {
+		return errors.New("password is required")
+	}
+	if algorithm == "" {
+		algorithm = cfg.Security.PasswordCheck
+	}
+	hash, err := auth.HashPassword(password, algorithm)
+	if err != nil {
+		return err
+	}
+	fmt.Println(hash)
+	return nil
+}
+
+// deleteUser removes user on running server
+func deleteUser(cfg *config.Config, name string) error {
+	resp, err := adminRequest(http.MethodDelete, adminURL(cfg, "users", url.Values{"name": {name}}), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readAdminError(resp)
+	}
+	return nil
+}
+
+// listUsers prints users of running server
+func listUsers(cfg *config.Config) error {
+	resp, err := adminRequest(http.MethodGet, adminURL(cfg, "users", nil), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readAdminError(resp)
+	}
+
+	response := &admin.UsersResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return err
+	}
+	for _, user := range response.Items {
+		fmt.Printf("%s\t[%s]\n", user.Name, strings.Join(user.Tags, ", "))
+	}
+	return nil
+}
+
+// setPermissions sets user permission on vhost of running server
+func setPermissions(cfg *config.Config, vhost string, user string, configure string, write string, read string) error {
+	if user == "" {
+		return errors.New("user name is required")
+	}
+	request := &admin.Permission{
+		User:      user,
+		Vhost:     permissionsVhost(vhost),
+		Configure: configure,
+		Write:     write,
+		Read:      read,
+	}
+	body, _ := json.Marshal(request)
+	resp, err := adminRequest(http.MethodPost, adminURL(cfg, "permissions", nil), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readAdminError(resp)
+	}
+	return nil
+}
+
+// clearPermissions removes user permission on vhost of running server
+func clearPermissions(cfg *config.Config, vhost string, user string) error {
+	query := url.Values{"user": {user}, "vhost": {permissionsVhost(vhost)}}
+	resp, err := adminRequest(http.MethodDelete, adminURL(cfg, "permissions", query), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readAdminError(resp)
+	}
+	return nil
+}
+
+// listPermissions prints permissions of running server
+func listPermissions(cfg *config.Config) error {
+	resp, err := adminRequest(http.MethodGet, adminURL(cfg, "permissions", nil), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readAdminError(resp)
+	}
+
+	response := &admin.PermissionsResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return err
+	}
+	for _, perm := range response.Items {
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\n", perm.Vhost, perm.User, perm.Configure, perm.Write, perm.Read)
+	}
+	return nil
+}
+
+// setTopicPermissions sets user topic permission on vhost exchange of running server
+func setTopicPermissions(cfg *config.Config, vhost string, user string, exchange string, write string, read string) error {
+	if user == "" || exchange == "" {
+		return errors.New("user and exchange names are required")
+	}
+	request := &admin.TopicPermission{
+		User:     user,
+		Vhost:    permissionsVhost(vhost),
+		Exchange: exchange,
+		Write:    write,
+		Read:     read,
+	}
+	body, _ := json.Marshal(request)
+	resp, err := adminRequest(http.MethodPost, adminURL(cfg, "topic-permissions", nil), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readAdminError(resp)
+	}
+	return nil
+}
+
+// clearTopicPermissions removes user topic permission on vhost exchange of running server
+func clearTopicPermissions(cfg *config.Config, vhost string, user string, exchange string) error {
+	query := url.Values{"user": {user}, "vhost": {permissionsVhost(vhost)}, "exchange": {exchange}}
+	resp, err := adminRequest(http.MethodDelete, adminURL(cfg, "topic-permissions", query), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readAdminError(resp)
+	}
+	return nil
+}
+
+// listTopicPermissions prints topic permissions of running server
+func listTopicPermissions(cfg *config.Config) error {
+	resp, err := adminRequest(http.MethodGet, adminURL(cfg, "topic-permissions", nil), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readAdminError(resp)
+	}
+
+	response := &admin.TopicPermissionsResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return err
+	}
+	for _, perm := range response.Items {
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\n", perm.Vhost, perm.User, perm.Exchange, perm.Write, perm.Read)
+	}
+	return nil
+}
+
+// setVhostLimits replaces limits of vhost of running server with limits from JSON object
+// like {"max_connections": 10, "max_queues": 100}
+func setVhostLimits(cfg *config.Config, vhost string, definition string) error {
+	if definition == "" {
+		return errors.New("limits definition is required")
+	}
+	request := &admin.VhostLimits{}
+	decoder := json.NewDecoder(strings.NewReader(definition))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(request); err != nil {
+		return fmt.Errorf("bad limits definition: %s", err)
+	}
+	request.Vhost = permissionsVhost(vhost)
+
+	body, _ := json.Marshal(request)
+	resp, err := adminRequest(http.MethodPost, adminURL(cfg, "vhost-limits", nil), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readAdminError(resp)
+	}
+	return nil
+}
+
+// clearVhostLimits removes all limits of vhost of running server
+func clearVhostLimits(cfg *config.Config, vhost string) error {
+	query := url.Values{"vhost": {permissionsVhost(vhost)}}
+	resp, err := adminRequest(http.MethodDelete, adminURL(cfg, "vhost-limits", query), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readAdminError(resp)
+	}
+	return nil
+}
+
+// listVhostLimits prints limits of vhosts of running server
+func listVhostLimits(cfg *config.Config) error {
+	resp, err := adminRequest(http.MethodGet, adminURL(cfg, "vhost-limits", nil), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readAdminError(resp)
+	}
+
+	response := &admin.VhostLimitsResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return err
+	}
+	for _, vhostLimits := range response.Items {
+		definition, _ := json.Marshal(vhostLimits)
+		fmt.Printf("%s\t%s\n", vhostLimits.Vhost, definition)
+	}
+	return nil
+}
+
+// setPolicy creates or replaces policy of vhost of running server
+func setPolicy(cfg *config.Config, vhost string, name string, pattern string, definition string, applyTo string, priority int) error {
+	if name == "" || definition == "" {
+		return errors.New("policy name, pattern and definition are required")
+	}
+	request := &admin.Policy{
+		Vhost:    permissionsVhost(vhost),
+		Name:     name,
+		Pattern:  pattern,
+		ApplyTo:  applyTo,
+		Priority: int32(priority),
+	}
+	if err := json.Unmarshal([]byte(definition), &request.Definition); err != nil {
+		return fmt.Errorf("bad policy definition: %s", err)
+	}
+
+	body, _ := json.Marshal(request)
+	resp, err := adminRequest(http.MethodPost, adminURL(cfg, "policies", nil), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readAdminError(resp)
+	}
+	return nil
+}
+
+// clearPolicy removes policy of vhost of running server
+func clearPolicy(cfg *config.Config, vhost string, name string) error {
+	query := url.Values{"vhost": {permissionsVhost(vhost)}, "name": {name}}
+	resp, err := adminRequest(http.MethodDelete, adminURL(cfg, "policies", query), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readAdminError(resp)
+	}
+	return nil
+}
+
+// listPolicies prints policies of all vhosts of running server
+func listPolicies(cfg *config.Config) error {
+	resp, err := adminRequest(http.MethodGet, adminURL(cfg, "policies", nil), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readAdminError(resp)
+	}
+
+	response := &admin.PoliciesResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return err
+	}
+	for _, p := range response.Items {
+		definition, _ := json.Marshal(p.Definition)
+		fmt.Printf("%s\t%s\t%s\t%s\t%d\t%s\n", p.Vhost, p.Name, p.Pattern, p.ApplyTo, p.Priority, definition)
+	}
+	return nil
+}
+
+// permissionsVhost returns default vhost if vhost is not set, like rabbitmqctl does
+func permissionsVhost(vhost string) string {
+	if vhost == "" {
+		return "/"
+	}
+	return vhost
+}
+
+func splitTags(tags string) []string {
+	result := []string{}
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+func readAdminError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(resp.Body)
+	return fmt.Errorf("admin server responded %s: %s", resp.Status, body)
+}
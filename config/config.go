@@ -11,18 +11,25 @@ type Config struct {
 	Proto      string
 	Users      []User
 	TCP        TCPConfig
+	TLS        TLSConfig `yaml:"tls"`
 	Queue      Queue
 	Db         Db
 	Vhost      Vhost
 	Security   Security
+	Auth       Auth
 	Connection Connection
 	Admin      AdminConfig
+	// Definitions is path to JSON or YAML definitions file applied on server start
+	Definitions string
 }
 
 // User for auth check
 type User struct {
 	Username string
 	Password string
+	// Algorithm of password hash, security.passwordCheck if empty
+	Algorithm string
+	Tags      []string
 }
 
 // TCPConfig represents properties for tune network connections
@@ -34,6 +41,24 @@ type TCPConfig struct {
 	WriteBufSize int `yaml:"writeBufSize"`
 }
 
+// TLSConfig represents properties for TLS listener (amqps)
+// Socket options of TLS connections are taken from TCPConfig
+type TLSConfig struct {
+	Enabled  bool
+	IP       string `yaml:"ip"`
+	Port     string
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+	// CAFile is PEM bundle to verify client certificates
+	CAFile string `yaml:"caFile"`
+	// MinVersion is minimal TLS version (1.0, 1.1, 1.2 or 1.3)
+	MinVersion string `yaml:"minVersion"`
+	// CipherSuites are names of allowed cipher suites, Go defaults are used if empty
+	CipherSuites []string `yaml:"cipherSuites"`
+	// ClientAuth is client certificate verification mode (none, optional or required)
+	ClientAuth string `yaml:"clientAuth"`
+}
+
 // AdminConfig represents properties for admin server
 type AdminConfig struct {
 	IP   string `yaml:"ip"`
@@ -60,6 +85,48 @@ type Vhost struct {
 // Security settings
 type Security struct {
 	PasswordCheck string `yaml:"passwordCheck"`
+	// Mechanisms are SASL mechanisms offered to clients, EXTERNAL is offered only for TLS connections with client certificate
+	Mechanisms []string `yaml:"mechanisms"`
+}
+
+// Auth settings of authentication and authorization backends
+type Auth struct {
+	// Backends are tried in order until one of them authenticates user
+	Backends []AuthBackend
+	Htpasswd HtpasswdAuth
+	HTTP     HTTPAuth `yaml:"http"`
+	JWT      JWTAuth  `yaml:"jwt"`
+}
+
+// AuthBackend pairs authentication backend with backend which authorizes authenticated users
+// Authz is the same as Authn if empty
+type AuthBackend struct {
+	Authn string
+	Authz string
+}
+
+// HtpasswdAuth settings of htpasswd backend
+type HtpasswdAuth struct {
+	File string
+}
+
+// HTTPAuth settings of HTTP backend
+type HTTPAuth struct {
+	Method      string
+	UserURL     string `yaml:"userUrl"`
+	VhostURL    string `yaml:"vhostUrl"`
+	ResourceURL string `yaml:"resourceUrl"`
+	TopicURL    string `yaml:"topicUrl"`
+}
+
+// JWTAuth settings of JWT backend
+type JWTAuth struct {
+	// ResourceServerID is expected token audience and prefix of token scopes
+	ResourceServerID string `yaml:"resourceServerId"`
+	// HMACKey is secret of HS256, HS384 and HS512 signed tokens
+	HMACKey string `yaml:"hmacKey"`
+	// JWKSFile is JSON Web Key Set with public keys of RSA and ECDSA signed tokens
+	JWKSFile string `yaml:"jwksFile"`
 }
 
 // Connection settings for AMQP-connection
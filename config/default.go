@@ -1,8 +1,11 @@
 package config
 
+// Db engines, which could be set in Db.Engine
 const (
-	dbBuntDB = "buntdb"
-	dbBadger = "badger"
+	DbEngineBadger     = "badger"
+	DbEngineBuntDB     = "buntdb"
+	DbEngineSegmentLog = "segmentlog"
+	DbEngineMemory     = "memory"
 )
 
 func defaultConfig() *Config {
@@ -12,6 +15,7 @@ func defaultConfig() *Config {
 			{
 				Username: "guest",
 				Password: "084e0343a0486ff05530df6c705c8bb4", // guest md5 hash
+				Tags:     []string{"administrator"},
 			},
 		},
 		TCP: TCPConfig{
@@ -21,6 +25,13 @@ func defaultConfig() *Config {
 			ReadBufSize:  128 << 10, // 128Kb
 			WriteBufSize: 128 << 10, // 128Kb
 		},
+		TLS: TLSConfig{
+			Enabled:    false,
+			IP:         "0.0.0.0",
+			Port:       "5671",
+			MinVersion: "1.2",
+			ClientAuth: "none",
+		},
 		Admin: AdminConfig{
 			IP:   "0.0.0.0",
 			Port: "15672",
@@ -31,13 +42,17 @@ func defaultConfig() *Config {
 		},
 		Db: Db{
 			DefaultPath: "db",
-			Engine:      dbBadger,
+			Engine:      DbEngineBadger,
 		},
 		Vhost: Vhost{
 			DefaultPath: "/",
 		},
 		Security: Security{
 			PasswordCheck: "md5",
+			Mechanisms:    []string{"PLAIN", "AMQPLAIN"},
+		},
+		Auth: Auth{
+			Backends: []AuthBackend{{Authn: "internal"}},
 		},
 		Connection: Connection{
 			ChannelsMax:  4096,
@@ -8,6 +8,7 @@ import (
 
 	"github.com/valinurovam/garagemq/amqp"
 	"github.com/valinurovam/garagemq/interfaces"
+	"github.com/valinurovam/garagemq/metrics"
 	"github.com/valinurovam/garagemq/qos"
 	"github.com/valinurovam/garagemq/queue"
 )
@@ -20,6 +21,12 @@ const (
 
 var cid uint64
 
+// MetricsState represents current metrics states for consumer
+type MetricsState struct {
+	// AckLatency is time between delivery of messages and their acknowledgement
+	AckLatency *metrics.Histogram
+}
+
 // Consumer implements AMQP consumer
 type Consumer struct {
 	ID          uint64
@@ -32,6 +39,7 @@ type Consumer struct {
 	status      int
 	qos         []*qos.AmqpQos
 	consume     chan struct{}
+	metrics     *MetricsState
 }
 
 // NewConsumer returns new instance of Consumer
@@ -49,6 +57,9 @@ func NewConsumer(queueName string, consumerTag string, noAck bool, channel inter
 		queue:       queue,
 		qos:         qos,
 		consume:     make(chan struct{}, 1),
+		metrics: &MetricsState{
+			AckLatency: metrics.NewHistogram(metrics.LatencyBuckets),
+		},
 	}
 }
 
@@ -185,3 +196,13 @@ func (consumer *Consumer) Tag() string {
 func (consumer *Consumer) Qos() []*qos.AmqpQos {
 	return consumer.qos
 }
+
+// SetMetrics set external metrics, it should be called before consumer is started
+func (consumer *Consumer) SetMetrics(m *MetricsState) {
+	consumer.metrics = m
+}
+
+// GetMetrics returns metrics
+func (consumer *Consumer) GetMetrics() *MetricsState {
+	return consumer.metrics
+}
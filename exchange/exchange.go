@@ -36,6 +36,17 @@ var exchangeTypeAliasIDMap = map[string]byte{
 type MetricsState struct {
 	MsgIn  *metrics.TrackCounter
 	MsgOut *metrics.TrackCounter
+
+	// BodySize is size of published messages bodies
+	BodySize *metrics.Histogram
+}
+
+// Settings are exchange features set by policy
+type Settings struct {
+	// Policy is name of policy applied to exchange
+	Policy string
+	// AlternateExchange receives messages exchange could not route
+	AlternateExchange string
 }
 
 // Exchange implements AMQP-exchange
@@ -46,9 +57,13 @@ type Exchange struct {
 	autoDelete bool
 	internal   bool
 	system     bool
-	bindLock   sync.Mutex
+	bindLock   sync.RWMutex
 	bindings   []*binding.Binding
-	metrics    *MetricsState
+	// directIndex maps routing key to bindings for direct exchanges
+	directIndex  map[string][]*binding.Binding
+	metrics      *MetricsState
+	settingsLock sync.RWMutex
+	settings     Settings
 }
 
 // NewExchange returns new instance of Exchange
@@ -63,6 +78,8 @@ func NewExchange(name string, exType byte, durable bool, autoDelete bool, intern
 		metrics: &MetricsState{
 			MsgIn:  metrics.NewTrackCounter(0, true),
 			MsgOut: metrics.NewTrackCounter(0, true),
+
+			BodySize: metrics.NewHistogram(metrics.SizeBuckets),
 		},
 	}
 }
@@ -105,6 +122,7 @@ func (ex *Exchange) AppendBinding(newBind *binding.Binding) {
 		}
 	}
 	ex.bindings = append(ex.bindings, newBind)
+	ex.indexBinding(newBind)
 }
 
 // RemoveBinding remove binding
@@ -114,6 +132,7 @@ func (ex *Exchange) RemoveBinding(rmBind *binding.Binding) {
 	for i, bind := range ex.bindings {
 		if bind.Equal(rmBind) {
 			ex.bindings = append(ex.bindings[:i], ex.bindings[i+1:]...)
+			ex.unindexBinding(bind)
 			return
 		}
 	}
@@ -130,6 +149,7 @@ func (ex *Exchange) RemoveQueueBindings(queueName string) []*binding.Binding {
 			newBindings = append(newBindings, bind)
 		} else {
 			removedBindings = append(removedBindings, bind)
+			ex.unindexBinding(bind)
 		}
 	}
 
@@ -137,6 +157,37 @@ func (ex *Exchange) RemoveQueueBindings(queueName string) []*binding.Binding {
 	return removedBindings
 }
 
+// indexBinding put binding into routing key index, should be called under bindLock
+func (ex *Exchange) indexBinding(bind *binding.Binding) {
+	if ex.exType != ExTypeDirect {
+		return
+	}
+	if ex.directIndex == nil {
+		ex.directIndex = make(map[string][]*binding.Binding)
+	}
+	ex.directIndex[bind.GetRoutingKey()] = append(ex.directIndex[bind.GetRoutingKey()], bind)
+}
+
+// unindexBinding remove binding from routing key index, should be called under bindLock
+func (ex *Exchange) unindexBinding(bind *binding.Binding) {
+	if ex.exType != ExTypeDirect || ex.directIndex == nil {
+		return
+	}
+	routingKey := bind.GetRoutingKey()
+	indexed := ex.directIndex[routingKey]
+	for i, iBind := range indexed {
+		if iBind == bind {
+			indexed = append(indexed[:i:i], indexed[i+1:]...)
+			break
+		}
+	}
+	if len(indexed) == 0 {
+		delete(ex.directIndex, routingKey)
+	} else {
+		ex.directIndex[routingKey] = indexed
+	}
+}
+
 // GetMatchedQueues returns queues matched for message routing key
 func (ex *Exchange) GetMatchedQueues(message *amqp.Message) (matchedQueues map[string]bool) {
 	// @spec-note
@@ -145,12 +196,13 @@ func (ex *Exchange) GetMatchedQueues(message *amqp.Message) (matchedQueues map[s
 
 	// TODO implement "headers" exchange
 	matchedQueues = make(map[string]bool)
+	ex.bindLock.RLock()
+	defer ex.bindLock.RUnlock()
 	switch ex.exType {
 	case ExTypeDirect:
-		for _, bind := range ex.bindings {
+		for _, bind := range ex.directIndex[message.RoutingKey] {
 			if bind.MatchDirect(message.Exchange, message.RoutingKey) {
 				matchedQueues[bind.GetQueue()] = true
-				return
 			}
 		}
 	case ExTypeFanout:
@@ -287,3 +339,17 @@ func (ex *Exchange) SetMetrics(m *MetricsState) {
 func (ex *Exchange) GetMetrics() *MetricsState {
 	return ex.metrics
 }
+
+// SetSettings replaces exchange settings
+func (ex *Exchange) SetSettings(settings Settings) {
+	ex.settingsLock.Lock()
+	defer ex.settingsLock.Unlock()
+	ex.settings = settings
+}
+
+// GetSettings returns current exchange settings
+func (ex *Exchange) GetSettings() Settings {
+	ex.settingsLock.RLock()
+	defer ex.settingsLock.RUnlock()
+	return ex.settings
+}
@@ -169,6 +169,62 @@ func TestExchange_GetMatchedQueues_Direct(t *testing.T) {
 	}
 }
 
+func TestExchange_GetMatchedQueues_Direct_Multiple(t *testing.T) {
+	e := NewExchange("test", ExTypeDirect, false, false, false, false)
+
+	b1, err := binding.NewBinding("test_q1", "test", "test_rk", &amqp.Table{}, false)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+
+	b2, err := binding.NewBinding("test_q2", "test", "test_rk", &amqp.Table{}, false)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+
+	b3, err := binding.NewBinding("test_q3", "test", "test_rk_other", &amqp.Table{}, false)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+
+	e.AppendBinding(b1)
+	e.AppendBinding(b2)
+	e.AppendBinding(b3)
+
+	message := &amqp.Message{
+		Exchange:   "test",
+		RoutingKey: "test_rk",
+	}
+
+	matched := e.GetMatchedQueues(message)
+	if len(matched) != 2 || !matched["test_q1"] || !matched["test_q2"] {
+		t.Fatalf("Expected test_q1 and test_q2 matched, actual %v", matched)
+	}
+
+	e.RemoveBinding(b1)
+	matched = e.GetMatchedQueues(message)
+	if len(matched) != 1 || !matched["test_q2"] {
+		t.Fatalf("Expected only test_q2 matched after RemoveBinding, actual %v", matched)
+	}
+
+	e.RemoveQueueBindings("test_q2")
+	matched = e.GetMatchedQueues(message)
+	if len(matched) != 0 {
+		t.Fatalf("Expected no matches after RemoveQueueBindings, actual %v", matched)
+	}
+
+	matched = e.GetMatchedQueues(&amqp.Message{
+		Exchange:   "test",
+		RoutingKey: "test_rk_other",
+	})
+	if len(matched) != 1 || !matched["test_q3"] {
+		t.Fatalf("Expected test_q3 matched, actual %v", matched)
+	}
+}
+
 func TestExchange_GetMatchedQueues_Fanout(t *testing.T) {
 	e := &Exchange{
 		Name:       "test",
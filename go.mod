@@ -3,12 +3,13 @@ module github.com/valinurovam/garagemq
 go 1.12
 
 require (
+	github.com/coreos/go-systemd v0.0.0-20190321100706-95778dfbb74e
 	github.com/dgraph-io/badger v1.6.0
 	github.com/sirupsen/logrus v1.4.2
 	github.com/spf13/pflag v1.0.3
 	github.com/spf13/viper v1.4.0
 	github.com/streadway/amqp v0.0.0-20190404075320-75d898a42a94
-	github.com/tidwall/btree v0.0.0-20170113224114-9876f1454cf0 // indirect
+	github.com/tidwall/btree v0.0.0-20170113224114-9876f1454cf0
 	github.com/tidwall/buntdb v1.1.0
 	github.com/tidwall/gjson v1.3.0 // indirect
 	github.com/tidwall/grect v0.0.0-20161006141115-ba9a043346eb // indirect
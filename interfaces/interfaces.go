@@ -40,7 +40,7 @@ type DbStorage interface {
 	Iterate(fn func(key []byte, value []byte))
 	IterateByPrefix(prefix []byte, limit uint64, fn func(key []byte, value []byte)) uint64
 	IterateByPrefixFrom(prefix []byte, from []byte, limit uint64, fn func(key []byte, value []byte)) uint64
-	DeleteByPrefix(prefix []byte)
+	DeleteByPrefix(prefix []byte) error
 	KeysByPrefixCount(prefix []byte) uint64
 	ProcessBatch(batch []*Operation) (err error)
 	Close() error
@@ -54,4 +54,5 @@ type MsgStorage interface {
 	Update(message *amqp.Message, queue string) error
 	IterateByQueueFromMsgID(queue string, msgID uint64, limit uint64, fn func(message *amqp.Message)) uint64
 	GetQueueLength(queue string) uint64
+	GetQueueBytes(queue string, msgID uint64) uint64
 }
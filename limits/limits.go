@@ -0,0 +1,67 @@
+package limits
+
+import (
+	"bytes"
+
+	"github.com/valinurovam/garagemq/amqp"
+)
+
+// VhostLimits restricts resources clients could allocate inside virtual host
+// Zero value of any limit means there is no such limit
+type VhostLimits struct {
+	Vhost string
+	// MaxConnections is max count of connections opened to vhost
+	MaxConnections uint64
+	// MaxChannels is max count of channels opened by each connection to vhost
+	MaxChannels uint64
+	// MaxQueues is max count of queues in vhost
+	MaxQueues uint64
+	// MaxExchanges is max count of exchanges in vhost, system exchanges are not counted
+	MaxExchanges uint64
+	// MaxMessages is max count of ready messages in all queues of vhost
+	MaxMessages uint64
+	// MaxBytes is max total body size of ready messages in all queues of vhost
+	MaxBytes uint64
+}
+
+// IsEmpty returns true if no limit is set
+func (l *VhostLimits) IsEmpty() bool {
+	for _, value := range l.values() {
+		if *value > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *VhostLimits) values() []*uint64 {
+	return []*uint64{&l.MaxConnections, &l.MaxChannels, &l.MaxQueues, &l.MaxExchanges, &l.MaxMessages, &l.MaxBytes}
+}
+
+// Marshal returns raw representation of limits to store into storage
+func (l *VhostLimits) Marshal() (data []byte, err error) {
+	buf := bytes.NewBuffer(make([]byte, 0))
+	if err = amqp.WriteShortstr(buf, l.Vhost); err != nil {
+		return nil, err
+	}
+	for _, value := range l.values() {
+		if err = amqp.WriteLonglong(buf, *value); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal restore limits from storage
+func (l *VhostLimits) Unmarshal(data []byte) (err error) {
+	buf := bytes.NewReader(data)
+	if l.Vhost, err = amqp.ReadShortstr(buf); err != nil {
+		return err
+	}
+	for _, value := range l.values() {
+		if *value, err = amqp.ReadLonglong(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package limits
+
+import (
+	"testing"
+)
+
+func TestVhostLimits_Marshal(t *testing.T) {
+	l := &VhostLimits{
+		Vhost:          "tenant",
+		MaxConnections: 1,
+		MaxChannels:    2,
+		MaxQueues:      3,
+		MaxExchanges:   4,
+		MaxMessages:    5,
+		MaxBytes:       6,
+	}
+	data, err := l.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := &VhostLimits{}
+	if err := restored.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if *restored != *l {
+		t.Fatalf("Expected %+v, actual %+v", l, restored)
+	}
+
+	if err := restored.Unmarshal(data[:len(data)-1]); err == nil {
+		t.Fatal("Expected error on truncated data")
+	}
+}
+
+func TestVhostLimits_IsEmpty(t *testing.T) {
+	l := &VhostLimits{Vhost: "tenant"}
+	if !l.IsEmpty() {
+		t.Fatal("Expected empty limits")
+	}
+	l.MaxBytes = 1
+	if l.IsEmpty() {
+		t.Fatal("Expected not empty limits")
+	}
+}
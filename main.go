@@ -38,6 +38,17 @@ func init() {
 	flag.Bool("hprof", false, "Starts server with hprof profiler.")
 	flag.String("hprof-host", "0.0.0.0", "hprof profiler host.")
 	flag.String("hprof-port", "8080", "hprof profiler port.")
+	flag.String("from", "", "Source db engine for migrate-storage command.")
+	flag.String("to", "", "Destination db engine for migrate-storage command.")
+	flag.Bool("dry-run", false, "Only show pending storage schema migrations for migrate-schema command.")
+	flag.String("vhost", "", "Virtual host for backup-vhost, restore-vhost, permissions, vhost limits and policies commands.")
+	flag.String("file", "", "Archive file for backup-vhost and restore-vhost commands.")
+	flag.String("tags", "", "Comma separated user tags for add-user command.")
+	flag.String("algorithm", "", "Password hashing algorithm (md5, bcrypt, sha256 or sha512) for add-user and hash-password commands.")
+	flag.String("user", "", "Admin server user for commands using running server.")
+	flag.String("password", "", "Admin server password for commands using running server.")
+	flag.String("apply-to", "all", "Kind of resources policy is applied to (queues, exchanges or all) for set-policy command.")
+	flag.Int("priority", 0, "Policy priority for set-policy command.")
 
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
 	pflag.Parse()
@@ -62,6 +73,78 @@ func main() {
 		cfg, _ = config.CreateDefault()
 	}
 
+	switch pflag.Arg(0) {
+	case "migrate-storage":
+		// migrate-storage --from badger --to buntdb
+		runCommand(server.MigrateStorage(cfg, viper.GetString("from"), viper.GetString("to")))
+	case "migrate-schema":
+		// migrate-schema [--dry-run]
+		runCommand(server.MigrateSchema(cfg, viper.GetBool("dry-run")))
+	case "backup-vhost":
+		// backup-vhost --vhost / --file vhost.backup --user guest --password guest
+		runCommand(backupVhost(cfg, viper.GetString("vhost"), viper.GetString("file")))
+	case "restore-vhost":
+		// restore-vhost --vhost / --file vhost.backup --user guest --password guest
+		runCommand(restoreVhost(cfg, viper.GetString("vhost"), viper.GetString("file")))
+	case "add-vhost":
+		// add-vhost name --user guest --password guest
+		runCommand(addVhost(cfg, pflag.Arg(1)))
+	case "delete-vhost":
+		// delete-vhost name --user guest --password guest
+		runCommand(deleteVhost(cfg, pflag.Arg(1)))
+	case "list-vhosts":
+		// list-vhosts --user guest --password guest
+		runCommand(listVhosts(cfg))
+	case "add-user":
+		// add-user name password --tags administrator [--algorithm sha256] --user guest --password guest
+		runCommand(addUser(cfg, pflag.Arg(1), pflag.Arg(2), viper.GetString("tags"), viper.GetString("algorithm")))
+	case "hash-password":
+		// hash-password password [--algorithm sha256]
+		runCommand(hashPassword(cfg, pflag.Arg(1), viper.GetString("algorithm")))
+	case "delete-user":
+		// delete-user name --user guest --password guest
+		runCommand(deleteUser(cfg, pflag.Arg(1)))
+	case "list-users":
+		// list-users --user guest --password guest
+		runCommand(listUsers(cfg))
+	case "set-permissions":
+		// set-permissions user configure write read --vhost / --user guest --password guest
+		runCommand(setPermissions(cfg, viper.GetString("vhost"), pflag.Arg(1), pflag.Arg(2), pflag.Arg(3), pflag.Arg(4)))
+	case "clear-permissions":
+		// clear-permissions user --vhost / --user guest --password guest
+		runCommand(clearPermissions(cfg, viper.GetString("vhost"), pflag.Arg(1)))
+	case "list-permissions":
+		// list-permissions --user guest --password guest
+		runCommand(listPermissions(cfg))
+	case "set-topic-permissions":
+		// set-topic-permissions user exchange write read --vhost / --user guest --password guest
+		runCommand(setTopicPermissions(cfg, viper.GetString("vhost"), pflag.Arg(1), pflag.Arg(2), pflag.Arg(3), pflag.Arg(4)))
+	case "clear-topic-permissions":
+		// clear-topic-permissions user exchange --vhost / --user guest --password guest
+		runCommand(clearTopicPermissions(cfg, viper.GetString("vhost"), pflag.Arg(1), pflag.Arg(2)))
+	case "list-topic-permissions":
+		// list-topic-permissions --user guest --password guest
+		runCommand(listTopicPermissions(cfg))
+	case "set-vhost-limits":
+		// set-vhost-limits '{"max_connections": 10, "max_queues": 100}' --vhost / --user guest --password guest
+		runCommand(setVhostLimits(cfg, viper.GetString("vhost"), pflag.Arg(1)))
+	case "clear-vhost-limits":
+		// clear-vhost-limits --vhost / --user guest --password guest
+		runCommand(clearVhostLimits(cfg, viper.GetString("vhost")))
+	case "list-vhost-limits":
+		// list-vhost-limits --user guest --password guest
+		runCommand(listVhostLimits(cfg))
+	case "set-policy":
+		// set-policy name '^orders\.' '{"max-length": 1000}' --vhost / --apply-to queues --priority 1 --user guest --password guest
+		runCommand(setPolicy(cfg, viper.GetString("vhost"), pflag.Arg(1), pflag.Arg(2), pflag.Arg(3), viper.GetString("apply-to"), viper.GetInt("priority")))
+	case "clear-policy":
+		// clear-policy name --vhost / --user guest --password guest
+		runCommand(clearPolicy(cfg, viper.GetString("vhost"), pflag.Arg(1)))
+	case "list-policies":
+		// list-policies --user guest --password guest
+		runCommand(listPolicies(cfg))
+	}
+
 	if viper.GetBool("hprof") {
 		// for hprof debugging
 		go http.ListenAndServe(fmt.Sprintf("%s:%s", viper.GetString("hprof-host"), viper.GetString("hprof-port")), nil)
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Default bucket bounds of histograms
+var (
+	// LatencyBuckets are bounds in seconds from half millisecond to one minute
+	LatencyBuckets = []float64{.0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+	// SizeBuckets are bounds in bytes from 64 bytes to 16 megabytes
+	SizeBuckets = []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304, 16777216}
+	// CountBuckets are bounds for count of items, like operations in storage batch
+	CountBuckets = []float64{1, 10, 50, 100, 500, 1000, 5000, 10000, 50000}
+)
+
+// Histogram counts observed values into buckets by upper bounds, like Prometheus histogram does
+type Histogram struct {
+	bounds []float64
+	// counts has one more bucket for values greater than the last bound
+	counts  []uint64
+	count   uint64
+	sumBits uint64
+}
+
+// NewHistogram returns new Histogram with given sorted bucket bounds
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// Observe adds value into histogram
+func (h *Histogram) Observe(value float64) {
+	atomic.AddUint64(&h.counts[sort.SearchFloat64s(h.bounds, value)], 1)
+	atomic.AddUint64(&h.count, 1)
+	for {
+		oldBits := atomic.LoadUint64(&h.sumBits)
+		newBits := math.Float64bits(math.Float64frombits(oldBits) + value)
+		if atomic.CompareAndSwapUint64(&h.sumBits, oldBits, newBits) {
+			return
+		}
+	}
+}
+
+// ObserveDuration adds duration in seconds into histogram
+func (h *Histogram) ObserveDuration(d time.Duration) {
+	h.Observe(d.Seconds())
+}
+
+// ObserveSince adds duration in seconds passed since given time into histogram
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.ObserveDuration(time.Since(start))
+}
+
+// Bounds returns bucket bounds of histogram
+func (h *Histogram) Bounds() []float64 {
+	return h.bounds
+}
+
+// Snapshot returns cumulative count of values less or equal each bound, count and sum of all values
+// Values are read without lock, so snapshot taken while observing could be slightly inconsistent
+func (h *Histogram) Snapshot() (cumulative []uint64, count uint64, sum float64) {
+	cumulative = make([]uint64, len(h.bounds))
+	var total uint64
+	for i := range h.bounds {
+		total += atomic.LoadUint64(&h.counts[i])
+		cumulative[i] = total
+	}
+	return cumulative, atomic.LoadUint64(&h.count), math.Float64frombits(atomic.LoadUint64(&h.sumBits))
+}
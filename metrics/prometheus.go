@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// prometheusPrefix is namespace of all exported metrics
+const prometheusPrefix = "garagemq_"
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+type prometheusSample struct {
+	labels    []Label
+	value     int64
+	histogram *Histogram
+}
+
+type prometheusFamily struct {
+	name       string
+	metricType string
+	samples    []*prometheusSample
+}
+
+// WritePrometheus writes current values of all registered counters in Prometheus text exposition format
+// Counter name like "queue.ready" becomes metric name "garagemq_queue_ready", counters which only grow get "_total" suffix
+// Histograms are written as cumulative "_bucket" series with "le" label, "_sum" and "_count"
+func WritePrometheus(writer io.Writer) error {
+	if r == nil {
+		return nil
+	}
+	families := r.prometheusFamilies()
+
+	buf := bufio.NewWriter(writer)
+	for _, family := range families {
+		fmt.Fprintf(buf, "# TYPE %s %s\n", family.name, family.metricType)
+		for _, sample := range family.samples {
+			if sample.histogram == nil {
+				fmt.Fprintf(buf, "%s%s %d\n", family.name, prometheusLabels(sample.labels), sample.value)
+				continue
+			}
+			writePrometheusHistogram(buf, family.name, sample)
+		}
+	}
+	return buf.Flush()
+}
+
+func writePrometheusHistogram(buf *bufio.Writer, name string, sample *prometheusSample) {
+	// copy labels on append, cause they are shared with registry
+	bucketLabels := func(le string) string {
+		return prometheusLabels(append(sample.labels[:len(sample.labels):len(sample.labels)], Label{"le", le}))
+	}
+	cumulative, count, sum := sample.histogram.Snapshot()
+	for i, bound := range sample.histogram.Bounds() {
+		fmt.Fprintf(buf, "%s_bucket%s %d\n", name, bucketLabels(strconv.FormatFloat(bound, 'g', -1, 64)), cumulative[i])
+	}
+	fmt.Fprintf(buf, "%s_bucket%s %d\n", name, bucketLabels("+Inf"), count)
+	labels := prometheusLabels(sample.labels)
+	fmt.Fprintf(buf, "%s_sum%s %s\n", name, labels, strconv.FormatFloat(sum, 'g', -1, 64))
+	fmt.Fprintf(buf, "%s_count%s %d\n", name, labels, count)
+}
+
+// prometheusFamilies groups counters by metric name, families and their samples are sorted to make output stable
+func (r *TrackRegistry) prometheusFamilies() []*prometheusFamily {
+	r.cntLock.Lock()
+	byName := make(map[string]*prometheusFamily)
+	for key, desc := range r.descs {
+		name := prometheusPrefix + strings.Replace(desc.name, ".", "_", -1)
+		metricType := "counter"
+		sample := &prometheusSample{labels: desc.labels}
+		switch {
+		case desc.histogram:
+			metricType = "histogram"
+			sample.histogram = r.Histograms[key]
+		case desc.gauge:
+			metricType = "gauge"
+			sample.value = r.Counters[key].Counter.Count()
+		default:
+			name += "_total"
+			sample.value = r.Counters[key].Counter.Count()
+		}
+		family, ok := byName[name]
+		if !ok {
+			family = &prometheusFamily{name: name, metricType: metricType}
+			byName[name] = family
+		}
+		family.samples = append(family.samples, sample)
+	}
+	r.cntLock.Unlock()
+
+	families := make([]*prometheusFamily, 0, len(byName))
+	for _, family := range byName {
+		sort.Slice(family.samples, func(i, j int) bool {
+			return prometheusLabels(family.samples[i].labels) < prometheusLabels(family.samples[j].labels)
+		})
+		families = append(families, family)
+	}
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].name < families[j].name
+	})
+	return families
+}
+
+func prometheusLabels(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(labels))
+	for i, label := range labels {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, label.Name, labelValueEscaper.Replace(label.Value))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
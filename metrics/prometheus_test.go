@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	NewTrackRegistry(15, time.Hour, false)
+	defer Destroy()
+
+	AddCounter("server.publish").Counter.Inc(3)
+	AddGauge("queue.ready", Label{"vhost", "/"}, Label{"queue", "b"}).Counter.Inc(2)
+	AddGauge("queue.ready", Label{"vhost", "/"}, Label{"queue", `a"q`}).Counter.Inc(1)
+	AddGauge("queue.ready", Label{"vhost", "other"}, Label{"queue", "b"})
+
+	buf := &bytes.Buffer{}
+	if err := WritePrometheus(buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# TYPE garagemq_queue_ready gauge
+garagemq_queue_ready{vhost="/",queue="a\"q"} 1
+garagemq_queue_ready{vhost="/",queue="b"} 2
+garagemq_queue_ready{vhost="other",queue="b"} 0
+# TYPE garagemq_server_publish_total counter
+garagemq_server_publish_total 3
+`
+	if buf.String() != expected {
+		t.Fatalf("Expected:\n%s\nActual:\n%s", expected, buf.String())
+	}
+
+	RemoveCounters("queue", Label{"vhost", "/"})
+	if GetCounter("queue.ready", Label{"vhost", "/"}, Label{"queue", "b"}) != nil {
+		t.Error("Expected counters of vhost removed")
+	}
+	if GetCounter("queue.ready", Label{"vhost", "other"}, Label{"queue", "b"}) == nil {
+		t.Error("Expected counters of other vhost kept")
+	}
+}
+
+func TestWritePrometheus_Histogram(t *testing.T) {
+	NewTrackRegistry(15, time.Hour, false)
+	defer Destroy()
+
+	h := AddHistogram("queue.deliver_latency_seconds", []float64{.1, 1}, Label{"queue", "q"})
+	h.Observe(.05)
+	h.Observe(.5)
+	h.Observe(.1)
+	h.ObserveDuration(2 * time.Second)
+
+	buf := &bytes.Buffer{}
+	if err := WritePrometheus(buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# TYPE garagemq_queue_deliver_latency_seconds histogram
+garagemq_queue_deliver_latency_seconds_bucket{queue="q",le="0.1"} 2
+garagemq_queue_deliver_latency_seconds_bucket{queue="q",le="1"} 3
+garagemq_queue_deliver_latency_seconds_bucket{queue="q",le="+Inf"} 4
+garagemq_queue_deliver_latency_seconds_sum{queue="q"} 2.65
+garagemq_queue_deliver_latency_seconds_count{queue="q"} 4
+`
+	if buf.String() != expected {
+		t.Fatalf("Expected:\n%s\nActual:\n%s", expected, buf.String())
+	}
+
+	RemoveCounters("queue", Label{"queue", "q"})
+	if GetHistogram("queue.deliver_latency_seconds", Label{"queue", "q"}) != nil {
+		t.Error("Expected histogram of queue removed")
+	}
+}
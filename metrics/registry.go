@@ -1,6 +1,8 @@
 package metrics
 
 import (
+	"fmt"
+	"strings"
 	"sync"
 	"time"
 )
@@ -11,17 +13,35 @@ var r *TrackRegistry
 type TrackRegistry struct {
 	cntLock     sync.Mutex
 	Counters    map[string]*TrackCounter
+	Histograms  map[string]*Histogram
+	descs       map[string]*counterDesc
 	trackLength int
 	trackTick   *time.Ticker
 	isNil       bool
 }
 
+// Label is a name of entity counter belongs to, like vhost or queue name
+type Label struct {
+	Name  string
+	Value string
+}
+
+// counterDesc describes registered counter for export
+type counterDesc struct {
+	name      string
+	labels    []Label
+	gauge     bool
+	histogram bool
+}
+
 // NewTrackRegistry returns new TrackRegistry
 // Each counter will be tracked every d duration
 // Each counter track length will be trackLength items
 func NewTrackRegistry(trackLength int, d time.Duration, isNil bool) {
 	r = &TrackRegistry{
 		Counters:    make(map[string]*TrackCounter),
+		Histograms:  make(map[string]*Histogram),
+		descs:       make(map[string]*counterDesc),
 		trackLength: trackLength,
 		trackTick:   time.NewTicker(d),
 		isNil:       isNil,
@@ -37,20 +57,100 @@ func Destroy() {
 	r = nil
 }
 
-// AddCounter add counter into registry andd return it
-// TODO check if already exists
-func AddCounter(name string) *TrackCounter {
+// AddCounter add counter which only grows, like count of published messages, into registry and return it
+// Counter with the same name and labels is replaced
+func AddCounter(name string, labels ...Label) *TrackCounter {
+	return r.add(&counterDesc{name: name, labels: labels})
+}
+
+// AddGauge add counter which could go up and down, like count of ready messages, into registry and return it
+// Counter with the same name and labels is replaced
+func AddGauge(name string, labels ...Label) *TrackCounter {
+	return r.add(&counterDesc{name: name, labels: labels, gauge: true})
+}
+
+func (r *TrackRegistry) add(desc *counterDesc) *TrackCounter {
 	r.cntLock.Lock()
 	defer r.cntLock.Unlock()
 
+	key := counterKey(desc.name, desc.labels)
 	c := NewTrackCounter(r.trackLength, r.isNil)
-	r.Counters[name] = c
+	r.Counters[key] = c
+	r.descs[key] = desc
 	return c
 }
 
-// GetCounter returns counter by name
-func GetCounter(name string) *TrackCounter {
-	return r.Counters[name]
+// AddHistogram add histogram with given bucket bounds, like latency of delivery, into registry and return it
+// Histogram with the same name and labels is replaced
+func AddHistogram(name string, bounds []float64, labels ...Label) *Histogram {
+	r.cntLock.Lock()
+	defer r.cntLock.Unlock()
+
+	key := counterKey(name, labels)
+	h := NewHistogram(bounds)
+	r.Histograms[key] = h
+	r.descs[key] = &counterDesc{name: name, labels: labels, histogram: true}
+	return h
+}
+
+// RemoveCounters removes counters and histograms of entity, like "queue", which have all given labels
+// It should be called when entity is deleted, so its counters are not exported anymore
+func RemoveCounters(entity string, labels ...Label) {
+	// connections could be closed after registry is destroyed or replaced on server stop,
+	// so registry is read once and the same registry is locked and unlocked
+	registry := r
+	if registry == nil {
+		return
+	}
+	registry.cntLock.Lock()
+	defer registry.cntLock.Unlock()
+
+	for key, desc := range registry.descs {
+		if strings.HasPrefix(desc.name, entity+".") && hasLabels(desc.labels, labels) {
+			delete(registry.Counters, key)
+			delete(registry.Histograms, key)
+			delete(registry.descs, key)
+		}
+	}
+}
+
+// GetCounter returns counter by name and labels
+func GetCounter(name string, labels ...Label) *TrackCounter {
+	r.cntLock.Lock()
+	defer r.cntLock.Unlock()
+	return r.Counters[counterKey(name, labels)]
+}
+
+// GetHistogram returns histogram by name and labels
+func GetHistogram(name string, labels ...Label) *Histogram {
+	r.cntLock.Lock()
+	defer r.cntLock.Unlock()
+	return r.Histograms[counterKey(name, labels)]
+}
+
+// counterKey returns unique key of counter, label values are quoted, cause entity names could contain any chars
+func counterKey(name string, labels []Label) string {
+	key := name
+	for _, label := range labels {
+		key += fmt.Sprintf(",%s=%q", label.Name, label.Value)
+	}
+	return key
+}
+
+func hasLabels(labels []Label, required []Label) bool {
+	for _, req := range required {
+		found := false
+		for _, label := range labels {
+			if label == req {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
 }
 
 func (r *TrackRegistry) trackMetrics() {
@@ -1,6 +1,7 @@
 package msgstorage
 
 import (
+	"encoding/binary"
 	"strconv"
 	"strings"
 	"sync"
@@ -8,23 +9,45 @@ import (
 
 	"github.com/valinurovam/garagemq/amqp"
 	"github.com/valinurovam/garagemq/interfaces"
+	"github.com/valinurovam/garagemq/metrics"
 )
 
+const refPrefix = "msg."
+const bodyPrefix = "body."
+
+// MetricsState represents current metrics states for message storage
+type MetricsState struct {
+	// PersistDuration is time of writing batch into db
+	PersistDuration *metrics.Histogram
+	// PersistBatchSize is count of operations in batch
+	PersistBatchSize *metrics.Histogram
+}
+
 // MsgStorage represents storage for store all durable messages
 // All operations (add, update and delete) store into little queues and
 // periodically persist every 20ms
 // If storage in confirm-mode - in every persisted message storage send confirm to vhost
+//
+// Message body stored only once per storage under "body.<id>" key, each queue
+// store only lightweight reference "msg.<queue>.<id>" to it. Storage count references
+// for each message and delete body when the last reference is deleted
+//
+// Body is never changed after it is stored, state of message which differs between queues,
+// like delivery count and time message was queued at, is stored in reference
 type MsgStorage struct {
 	db            interfaces.DbStorage
 	persistLock   sync.Mutex
 	add           map[string]*amqp.Message
 	update        map[string]*amqp.Message
 	del           map[string]*amqp.Message
+	refLock       sync.Mutex
+	refs          map[uint64]uint32
 	protoVersion  string
 	closeCh       chan bool
 	confirmSyncCh chan *amqp.Message
 	confirmMode   bool
 	writeCh       chan struct{}
+	metrics       *MetricsState
 }
 
 // NewMsgStorage returns new instance of message storage
@@ -32,15 +55,34 @@ func NewMsgStorage(db interfaces.DbStorage, protoVersion string) *MsgStorage {
 	msgStorage := &MsgStorage{
 		db:            db,
 		protoVersion:  protoVersion,
+		refs:          make(map[uint64]uint32),
 		closeCh:       make(chan bool),
 		confirmSyncCh: make(chan *amqp.Message, 4096),
 		writeCh:       make(chan struct{}, 5),
+		metrics: &MetricsState{
+			PersistDuration:  metrics.NewHistogram(metrics.LatencyBuckets),
+			PersistBatchSize: metrics.NewHistogram(metrics.CountBuckets),
+		},
 	}
 	msgStorage.cleanPersistQueue()
+	msgStorage.loadRefs()
 	go msgStorage.periodicPersist()
 	return msgStorage
 }
 
+// loadRefs restore reference counters from stored references
+func (storage *MsgStorage) loadRefs() {
+	storage.db.IterateByPrefix(
+		[]byte(refPrefix),
+		0,
+		func(key []byte, value []byte) {
+			if id, ok := getIDFromKey(string(key)); ok {
+				storage.refs[id]++
+			}
+		},
+	)
+}
+
 func (storage *MsgStorage) cleanPersistQueue() {
 	storage.add = make(map[string]*amqp.Message)
 	storage.update = make(map[string]*amqp.Message)
@@ -50,18 +92,15 @@ func (storage *MsgStorage) cleanPersistQueue() {
 // We try to persist messages every 20ms and every 1000msg
 func (storage *MsgStorage) periodicPersist() {
 	tick := time.NewTicker(20 * time.Millisecond)
+	defer tick.Stop()
 
-	go func() {
-		for range tick.C {
-			storage.writeCh <- struct{}{}
-		}
-	}()
-
-	for range storage.writeCh {
+	for {
 		select {
 		case <-storage.closeCh:
 			return
-		default:
+		case <-tick.C:
+			storage.persist()
+		case <-storage.writeCh:
 			storage.persist()
 		}
 	}
@@ -73,11 +112,15 @@ func (storage *MsgStorage) getQueueLen() int {
 }
 
 func (storage *MsgStorage) persist() {
+	storage.refLock.Lock()
+	defer storage.refLock.Unlock()
+
 	storage.persistLock.Lock()
 	add := storage.add
 	del := storage.del
 	update := storage.update
 	storage.cleanPersistQueue()
+	storageMetrics := storage.metrics
 	storage.persistLock.Unlock()
 
 	rmDel := make([]string, 0)
@@ -94,44 +137,91 @@ func (storage *MsgStorage) persist() {
 		delete(del, delKey)
 	}
 
-	batch := make([]*interfaces.Operation, 0, len(add)+len(update)+len(del))
+	bodySet := make(map[uint64]*amqp.Message)
+	bodyDel := make(map[uint64]struct{})
+
+	batch := make([]*interfaces.Operation, 0, 2*len(add)+len(update)+2*len(del))
 	for key, message := range add {
-		data, _ := message.Marshal(storage.protoVersion)
 		batch = append(
 			batch,
 			&interfaces.Operation{
 				Key:   key,
-				Value: data,
+				Value: makeRef(message),
 				Op:    interfaces.OpSet,
 			},
 		)
+		if storage.refs[message.ID] == 0 {
+			bodySet[message.ID] = message
+		}
+		storage.refs[message.ID]++
+	}
+
+	for key, message := range del {
+		batch = append(
+			batch,
+			&interfaces.Operation{
+				Key: key,
+				Op:  interfaces.OpDel,
+			},
+		)
+		if storage.refs[message.ID] > 1 {
+			storage.refs[message.ID]--
+			continue
+		}
+		delete(storage.refs, message.ID)
+		if _, ok := bodySet[message.ID]; ok {
+			delete(bodySet, message.ID)
+		} else {
+			bodyDel[message.ID] = struct{}{}
+		}
 	}
 
 	for key, message := range update {
-		data, _ := message.Marshal(storage.protoVersion)
+		// added reference is already written with current state of message
+		if _, ok := add[key]; ok || storage.refs[message.ID] == 0 {
+			continue
+		}
 		batch = append(
 			batch,
 			&interfaces.Operation{
 				Key:   key,
+				Value: makeRef(message),
+				Op:    interfaces.OpSet,
+			},
+		)
+	}
+
+	for id, message := range bodySet {
+		data, _ := message.Marshal(storage.protoVersion)
+		batch = append(
+			batch,
+			&interfaces.Operation{
+				Key:   makeBodyKey(id),
 				Value: data,
 				Op:    interfaces.OpSet,
 			},
 		)
 	}
 
-	for key := range del {
+	for id := range bodyDel {
 		batch = append(
 			batch,
 			&interfaces.Operation{
-				Key: key,
+				Key: makeBodyKey(id),
 				Op:  interfaces.OpDel,
 			},
 		)
 	}
 
+	start := time.Now()
 	if err := storage.db.ProcessBatch(batch); err != nil {
 		panic(err)
 	}
+	// storage is persisted periodically, so empty batches are not tracked
+	if len(batch) > 0 {
+		storageMetrics.PersistDuration.ObserveSince(start)
+		storageMetrics.PersistBatchSize.Observe(float64(len(batch)))
+	}
 
 	for _, message := range add {
 		if message.ConfirmMeta != nil && storage.confirmMode && message.ConfirmMeta.DeliveryTag > 0 {
@@ -141,6 +231,20 @@ func (storage *MsgStorage) persist() {
 	}
 }
 
+// SetMetrics set external metrics
+func (storage *MsgStorage) SetMetrics(m *MetricsState) {
+	storage.persistLock.Lock()
+	defer storage.persistLock.Unlock()
+	storage.metrics = m
+}
+
+// GetMetrics returns metrics
+func (storage *MsgStorage) GetMetrics() *MetricsState {
+	storage.persistLock.Lock()
+	defer storage.persistLock.Unlock()
+	return storage.metrics
+}
+
 // ReceiveConfirms set message storage in confirm mode and return channel for receive confirms
 func (storage *MsgStorage) ReceiveConfirms() chan *amqp.Message {
 	storage.confirmMode = true
@@ -178,71 +282,324 @@ func (storage *MsgStorage) Del(message *amqp.Message, queue string) error {
 
 // Iterate iterates over all messages
 func (storage *MsgStorage) Iterate(fn func(queue string, message *amqp.Message)) {
-	storage.db.Iterate(
+	storage.db.IterateByPrefix(
+		[]byte(refPrefix),
+		0,
 		func(key []byte, value []byte) {
-			queueName := getQueueFromKey(string(key))
-			message := &amqp.Message{}
-			message.Unmarshal(value, storage.protoVersion)
-			fn(queueName, message)
+			if message := storage.readMessage(value); message != nil {
+				fn(getQueueFromKey(string(key)), message)
+			}
+		},
+	)
+}
+
+// Snapshot is a copy of message references taken at one moment
+type Snapshot struct {
+	storage *MsgStorage
+	queues  []string
+	refs    [][]byte
+}
+
+// Snapshot persists pending operations and copies references of all messages while persisting is suspended,
+// so returned snapshot keeps consistent state of storage
+func (storage *MsgStorage) Snapshot() *Snapshot {
+	storage.persist()
+	storage.refLock.Lock()
+	defer storage.refLock.Unlock()
+
+	snapshot := &Snapshot{storage: storage}
+	storage.db.IterateByPrefix(
+		[]byte(refPrefix),
+		0,
+		func(key []byte, value []byte) {
+			snapshot.queues = append(snapshot.queues, getQueueFromKey(string(key)))
+			snapshot.refs = append(snapshot.refs, append([]byte(nil), value...))
 		},
 	)
+	return snapshot
+}
+
+// Iterate iterates over messages of snapshot until fn returns error, bodies are read from storage on iteration,
+// so messages deleted from storage after snapshot was taken are skipped
+func (snapshot *Snapshot) Iterate(fn func(queue string, message *amqp.Message) error) error {
+	for i, ref := range snapshot.refs {
+		message := snapshot.storage.readMessage(ref)
+		if message == nil {
+			continue
+		}
+		if err := fn(snapshot.queues[i], message); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // IterateByQueue iterates over queue and call fn on each message
 func (storage *MsgStorage) IterateByQueue(queue string, limit uint64, fn func(message *amqp.Message)) {
-	prefix := "msg." + queue + "."
+	prefix := refPrefix + queue + "."
 	storage.db.IterateByPrefix(
 		[]byte(prefix),
 		limit,
 		func(key []byte, value []byte) {
-			message := &amqp.Message{}
-			message.Unmarshal(value, storage.protoVersion)
-			fn(message)
+			if message := storage.readMessage(value); message != nil {
+				fn(message)
+			}
 		},
 	)
 }
 
 // IterateByQueueFromMsgID iterates over queue from specific msgId and call fn on each message
 func (storage *MsgStorage) IterateByQueueFromMsgID(queue string, msgID uint64, limit uint64, fn func(message *amqp.Message)) uint64 {
-	prefix := "msg." + queue + "."
+	prefix := refPrefix + queue + "."
 	from := makeKey(msgID, queue)
 	return storage.db.IterateByPrefixFrom(
 		[]byte(prefix),
 		[]byte(from),
 		limit,
 		func(key []byte, value []byte) {
+			if message := storage.readMessage(value); message != nil {
+				fn(message)
+			}
+		},
+	)
+}
+
+// readMessage returns message by stored reference
+// Reference of unknown size is a message stored inline by previous storage layout
+func (storage *MsgStorage) readMessage(ref []byte) *amqp.Message {
+	if !isRef(ref) {
+		return storage.unmarshalMessage(ref)
+	}
+	data, err := storage.db.Get(makeBodyKey(binary.BigEndian.Uint64(ref)))
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	message := storage.unmarshalMessage(data)
+	if message != nil {
+		readRef(ref, message)
+	}
+	return message
+}
+
+func (storage *MsgStorage) unmarshalMessage(data []byte) *amqp.Message {
+	message := &amqp.Message{}
+	if err := message.Unmarshal(data, storage.protoVersion); err != nil {
+		return nil
+	}
+	return message
+}
+
+// MigrateInlineMessages moves messages stored inline by previous storage layout
+// into reference counted bodies and returns count of migrated references
+// In dry-run mode storage is not changed
+func MigrateInlineMessages(db interfaces.DbStorage, protoVersion string, dryRun bool) (migrated uint64, err error) {
+	batch := make([]*interfaces.Operation, 0)
+	bodies := make(map[uint64]struct{})
+	db.IterateByPrefix(
+		[]byte(refPrefix),
+		0,
+		func(key []byte, value []byte) {
+			if len(value) == 8 {
+				return
+			}
+			id, ok := getIDFromKey(string(key))
+			if !ok {
+				return
+			}
 			message := &amqp.Message{}
-			message.Unmarshal(value, storage.protoVersion)
-			fn(message)
+			if err := message.Unmarshal(value, protoVersion); err != nil {
+				return
+			}
+			batch = append(batch, &interfaces.Operation{Key: string(key), Value: makeRef(message), Op: interfaces.OpSet})
+			migrated++
+			if _, ok := bodies[id]; ok {
+				return
+			}
+			bodies[id] = struct{}{}
+			if body, err := db.Get(makeBodyKey(id)); err == nil && len(body) != 0 {
+				return
+			}
+			batch = append(batch, &interfaces.Operation{Key: makeBodyKey(id), Value: value, Op: interfaces.OpSet})
 		},
 	)
+
+	if dryRun || len(batch) == 0 {
+		return migrated, nil
+	}
+	return migrated, db.ProcessBatch(batch)
+}
+
+// MigrateReferences rewrites references stored by previous storage layouts in current layout,
+// missing state of message is taken from its body. Time message was queued at is unknown,
+// so such messages are counted as queued at migration. Returns count of migrated references
+// In dry-run mode storage is not changed
+func MigrateReferences(db interfaces.DbStorage, protoVersion string, dryRun bool) (migrated uint64, err error) {
+	storage := &MsgStorage{db: db, protoVersion: protoVersion}
+	now := time.Now()
+	batch := make([]*interfaces.Operation, 0)
+	db.IterateByPrefix(
+		[]byte(refPrefix),
+		0,
+		func(key []byte, value []byte) {
+			if !isRef(value) || len(value) == refSize {
+				return
+			}
+			if message := storage.readMessage(value); message != nil {
+				if message.QueuedAt.IsZero() {
+					message.QueuedAt = now
+				}
+				batch = append(batch, &interfaces.Operation{Key: string(key), Value: makeRef(message), Op: interfaces.OpSet})
+				migrated++
+			}
+		},
+	)
+
+	if dryRun || len(batch) == 0 {
+		return migrated, nil
+	}
+	return migrated, db.ProcessBatch(batch)
 }
 
 // GetQueueLength returns queue length in message storage
 func (storage *MsgStorage) GetQueueLength(queue string) uint64 {
-	prefix := "msg." + queue + "."
+	prefix := refPrefix + queue + "."
 	return storage.db.KeysByPrefixCount([]byte(prefix))
 }
 
-// PurgeQueue delete messages
+// GetQueueBytes returns body size of queue messages from specific msgId
+// Sizes are read from references, so bodies are not loaded
+func (storage *MsgStorage) GetQueueBytes(queue string, msgID uint64) uint64 {
+	prefix := refPrefix + queue + "."
+	from := makeKey(msgID, queue)
+	var size uint64
+	storage.db.IterateByPrefixFrom(
+		[]byte(prefix),
+		[]byte(from),
+		0,
+		func(key []byte, value []byte) {
+			if len(value) == refSize {
+				size += binary.BigEndian.Uint64(value[20:])
+			} else if message := storage.readMessage(value); message != nil {
+				size += message.BodySize
+			}
+		},
+	)
+	return size
+}
+
+// PurgeQueue delete queue references and bodies of messages which are not referenced anymore
 func (storage *MsgStorage) PurgeQueue(queue string) {
-	prefix := []byte("msg." + queue + ".")
-	storage.db.DeleteByPrefix(prefix)
+	storage.refLock.Lock()
+	defer storage.refLock.Unlock()
+
+	prefix := refPrefix + queue + "."
+
+	// not persisted yet operations will not change references, just forget them
+	storage.persistLock.Lock()
+	for _, ops := range []map[string]*amqp.Message{storage.add, storage.update, storage.del} {
+		for key := range ops {
+			if strings.HasPrefix(key, prefix) {
+				delete(ops, key)
+			}
+		}
+	}
+	storage.persistLock.Unlock()
+
+	batch := make([]*interfaces.Operation, 0)
+	storage.db.IterateByPrefix(
+		[]byte(prefix),
+		0,
+		func(key []byte, value []byte) {
+			batch = append(batch, &interfaces.Operation{Key: string(key), Op: interfaces.OpDel})
+			id, ok := getIDFromKey(string(key))
+			if !ok {
+				return
+			}
+			if storage.refs[id] > 1 {
+				storage.refs[id]--
+				return
+			}
+			delete(storage.refs, id)
+			batch = append(batch, &interfaces.Operation{Key: makeBodyKey(id), Op: interfaces.OpDel})
+		},
+	)
+
+	if err := storage.db.ProcessBatch(batch); err != nil {
+		panic(err)
+	}
+}
+
+// GetRefCount returns count of queues referenced to message
+func (storage *MsgStorage) GetRefCount(id uint64) uint32 {
+	storage.refLock.Lock()
+	defer storage.refLock.Unlock()
+	return storage.refs[id]
 }
 
 // Close properly "stop" message storage
+// Persisting is stopped and confirms channel is closed, so its receiver could exit
 func (storage *MsgStorage) Close() error {
 	storage.closeCh <- true
+	close(storage.confirmSyncCh)
 	storage.persistLock.Lock()
 	defer storage.persistLock.Unlock()
 	return storage.db.Close()
 }
 
 func makeKey(id uint64, queue string) string {
-	return "msg." + queue + "." + strconv.FormatInt(int64(id), 10)
+	return refPrefix + queue + "." + strconv.FormatInt(int64(id), 10)
+}
+
+func makeBodyKey(id uint64) string {
+	return bodyPrefix + strconv.FormatInt(int64(id), 10)
+}
+
+// Reference layout is message ID, delivery count, time in nanoseconds message was queued at and body size
+// References of previous layouts contain only message ID, message ID with delivery count
+// or all of them except body size
+const (
+	refSize   = 28
+	refV3Size = 20
+	refV2Size = 12
+	refV1Size = 8
+)
+
+func makeRef(message *amqp.Message) []byte {
+	ref := make([]byte, refSize)
+	binary.BigEndian.PutUint64(ref, message.ID)
+	binary.BigEndian.PutUint32(ref[8:], message.DeliveryCount)
+	if !message.QueuedAt.IsZero() {
+		binary.BigEndian.PutUint64(ref[12:], uint64(message.QueuedAt.UnixNano()))
+	}
+	binary.BigEndian.PutUint64(ref[20:], message.BodySize)
+	return ref
+}
+
+func isRef(ref []byte) bool {
+	return len(ref) == refSize || len(ref) == refV3Size || len(ref) == refV2Size || len(ref) == refV1Size
+}
+
+// readRef sets state of message in queue stored in reference
+func readRef(ref []byte, message *amqp.Message) {
+	if len(ref) >= refV2Size {
+		message.DeliveryCount = binary.BigEndian.Uint32(ref[8:])
+	}
+	if len(ref) >= refV3Size {
+		if queuedAt := binary.BigEndian.Uint64(ref[12:]); queuedAt > 0 {
+			message.QueuedAt = time.Unix(0, int64(queuedAt))
+		}
+	}
 }
 
 func getQueueFromKey(key string) string {
-	parts := strings.Split(key, ".")
-	return parts[1]
+	key = strings.TrimPrefix(key, refPrefix)
+	return key[:strings.LastIndex(key, ".")]
+}
+
+func getIDFromKey(key string) (uint64, bool) {
+	id, err := strconv.ParseInt(key[strings.LastIndex(key, ".")+1:], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return uint64(id), true
 }
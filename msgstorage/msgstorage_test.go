@@ -0,0 +1,281 @@
+package msgstorage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/valinurovam/garagemq/amqp"
+	"github.com/valinurovam/garagemq/storage"
+)
+
+func init() {
+	// the only chance to disable badger logger
+	log.SetOutput(ioutil.Discard)
+}
+
+func getTestStorage(t *testing.T) (*MsgStorage, func()) {
+	dir, err := ioutil.TempDir("", "msgstorage_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgStorage := NewMsgStorage(storage.NewBadger(dir), amqp.ProtoRabbit)
+	return msgStorage, func() {
+		msgStorage.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func getTestMessage(id uint64) *amqp.Message {
+	message := &amqp.Message{
+		ID: id,
+		Header: &amqp.ContentHeader{
+			BodySize:     4,
+			ClassID:      amqp.ClassBasic,
+			PropertyList: &amqp.BasicPropertyList{},
+		},
+		RoutingKey: "test",
+	}
+	message.Append(&amqp.Frame{Type: byte(amqp.FrameBody), ChannelID: 1, Payload: []byte{'t', 'e', 's', 't'}})
+	return message
+}
+
+func countBodies(msgStorage *MsgStorage) uint64 {
+	return msgStorage.db.KeysByPrefixCount([]byte(bodyPrefix))
+}
+
+func TestMsgStorage_RefCounting(t *testing.T) {
+	msgStorage, clean := getTestStorage(t)
+	defer clean()
+
+	message := getTestMessage(1)
+	queues := []string{"q1", "q2", "q3"}
+	for _, queue := range queues {
+		msgStorage.Add(message, queue)
+	}
+	msgStorage.persist()
+
+	if cnt := msgStorage.GetRefCount(message.ID); cnt != 3 {
+		t.Fatalf("Expected 3 references, actual %d", cnt)
+	}
+	if cnt := countBodies(msgStorage); cnt != 1 {
+		t.Fatalf("Expected body stored once, actual %d", cnt)
+	}
+
+	for _, queue := range queues {
+		var found *amqp.Message
+		msgStorage.IterateByQueueFromMsgID(queue, 0, 0, func(message *amqp.Message) {
+			found = message
+		})
+		if found == nil || found.ID != message.ID || found.BodySize != message.BodySize {
+			t.Fatalf("Expected message in queue %s, actual %v", queue, found)
+		}
+	}
+
+	msgStorage.Del(message, "q1")
+	msgStorage.Del(message, "q2")
+	msgStorage.persist()
+
+	if cnt := msgStorage.GetRefCount(message.ID); cnt != 1 {
+		t.Fatalf("Expected 1 reference, actual %d", cnt)
+	}
+	if cnt := countBodies(msgStorage); cnt != 1 {
+		t.Fatalf("Expected body still stored, actual %d", cnt)
+	}
+
+	msgStorage.Del(message, "q3")
+	msgStorage.persist()
+
+	if cnt := msgStorage.GetRefCount(message.ID); cnt != 0 {
+		t.Fatalf("Expected no references, actual %d", cnt)
+	}
+	if cnt := countBodies(msgStorage); cnt != 0 {
+		t.Fatalf("Expected body deleted, actual %d", cnt)
+	}
+}
+
+func TestMsgStorage_AddDelSameBatch(t *testing.T) {
+	msgStorage, clean := getTestStorage(t)
+	defer clean()
+
+	message := getTestMessage(1)
+	msgStorage.Add(message, "q1")
+	msgStorage.Add(message, "q2")
+	msgStorage.Del(message, "q1")
+	msgStorage.persist()
+
+	if cnt := msgStorage.GetRefCount(message.ID); cnt != 1 {
+		t.Fatalf("Expected 1 reference, actual %d", cnt)
+	}
+	if cnt := msgStorage.GetQueueLength("q1"); cnt != 0 {
+		t.Fatalf("Expected empty q1, actual %d", cnt)
+	}
+	if cnt := msgStorage.GetQueueLength("q2"); cnt != 1 {
+		t.Fatalf("Expected 1 message in q2, actual %d", cnt)
+	}
+}
+
+func TestMsgStorage_UpdateDeliveryCount(t *testing.T) {
+	msgStorage, clean := getTestStorage(t)
+	defer clean()
+
+	message := getTestMessage(1)
+	msgStorage.Add(message, "q1")
+	msgStorage.Add(message, "q2")
+	msgStorage.persist()
+	body, _ := msgStorage.db.Get(makeBodyKey(message.ID))
+
+	// message requeued in q1 only
+	requeued := getTestMessage(1)
+	requeued.DeliveryCount = 1
+	msgStorage.Update(requeued, "q1")
+	msgStorage.persist()
+
+	for queue, expected := range map[string]uint32{"q1": 1, "q2": 0} {
+		var found *amqp.Message
+		msgStorage.IterateByQueue(queue, 0, func(message *amqp.Message) {
+			found = message
+		})
+		if found == nil || found.DeliveryCount != expected {
+			t.Fatalf("Expected delivery count %d in queue %s, actual %v", expected, queue, found)
+		}
+	}
+	if stored, _ := msgStorage.db.Get(makeBodyKey(message.ID)); !bytes.Equal(stored, body) {
+		t.Fatal("Expected body unchanged on update")
+	}
+}
+
+func TestMsgStorage_QueuedAt(t *testing.T) {
+	msgStorage, clean := getTestStorage(t)
+	defer clean()
+
+	message := getTestMessage(1)
+	message.QueuedAt = time.Now().Add(-time.Hour)
+	msgStorage.Add(message, "q1")
+	msgStorage.persist()
+
+	var found *amqp.Message
+	msgStorage.IterateByQueue("q1", 0, func(message *amqp.Message) {
+		found = message
+	})
+	if found == nil || !found.QueuedAt.Equal(message.QueuedAt) {
+		t.Fatalf("Expected message queued at %v, actual %v", message.QueuedAt, found)
+	}
+}
+
+func TestMsgStorage_GetQueueBytes(t *testing.T) {
+	msgStorage, clean := getTestStorage(t)
+	defer clean()
+
+	for id := uint64(1); id <= 3; id++ {
+		message := getTestMessage(id)
+		message.BodySize = id * 10
+		msgStorage.Add(message, "q1")
+	}
+	msgStorage.persist()
+
+	if bytes := msgStorage.GetQueueBytes("q1", 0); bytes != 60 {
+		t.Fatalf("Expected %d bytes in queue, actual %d", 60, bytes)
+	}
+	if bytes := msgStorage.GetQueueBytes("q1", 2); bytes != 50 {
+		t.Fatalf("Expected %d bytes from message 2, actual %d", 50, bytes)
+	}
+	if bytes := msgStorage.GetQueueBytes("q2", 0); bytes != 0 {
+		t.Fatalf("Expected empty queue, actual %d bytes", bytes)
+	}
+}
+
+func TestMsgStorage_PersistMetrics(t *testing.T) {
+	msgStorage, clean := getTestStorage(t)
+	defer clean()
+
+	message := getTestMessage(1)
+	msgStorage.Add(message, "q1")
+	msgStorage.Add(message, "q2")
+	msgStorage.persist()
+	msgStorage.persist()
+
+	// batch could be split by periodic persist, but two references and one body are written anyway
+	_, count, sum := msgStorage.GetMetrics().PersistBatchSize.Snapshot()
+	if count == 0 || sum != 3 {
+		t.Fatalf("Expected 3 operations persisted, actual %v in %d batches", sum, count)
+	}
+	if _, durations, _ := msgStorage.GetMetrics().PersistDuration.Snapshot(); durations != count {
+		t.Fatalf("Expected duration tracked for each of %d batches, actual %d", count, durations)
+	}
+}
+
+func TestMsgStorage_PurgeQueue(t *testing.T) {
+	msgStorage, clean := getTestStorage(t)
+	defer clean()
+
+	shared := getTestMessage(1)
+	own := getTestMessage(2)
+	msgStorage.Add(shared, "q1")
+	msgStorage.Add(shared, "q2")
+	msgStorage.Add(own, "q1")
+	msgStorage.persist()
+
+	msgStorage.PurgeQueue("q1")
+
+	if cnt := msgStorage.GetQueueLength("q1"); cnt != 0 {
+		t.Fatalf("Expected empty q1, actual %d", cnt)
+	}
+	if cnt := msgStorage.GetRefCount(shared.ID); cnt != 1 {
+		t.Fatalf("Expected 1 reference for shared message, actual %d", cnt)
+	}
+	if cnt := countBodies(msgStorage); cnt != 1 {
+		t.Fatalf("Expected only shared body stored, actual %d", cnt)
+	}
+}
+
+func TestMsgStorage_LoadRefs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msgstorage_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db := storage.NewBadger(dir)
+	msgStorage := NewMsgStorage(db, amqp.ProtoRabbit)
+	message := getTestMessage(1)
+	msgStorage.Add(message, "q1")
+	msgStorage.Add(message, "q2")
+	msgStorage.persist()
+	// stop persist loop, db will be closed by restored storage
+	msgStorage.closeCh <- true
+
+	restored := NewMsgStorage(db, amqp.ProtoRabbit)
+	defer restored.Close()
+	if cnt := restored.GetRefCount(message.ID); cnt != 2 {
+		t.Fatalf("Expected 2 references after restore, actual %d", cnt)
+	}
+}
+
+func TestMsgStorage_Close(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+	msgStorage := NewMsgStorage(storage.NewMemory(), amqp.ProtoRabbit)
+	confirmsDone := make(chan struct{})
+	go func() {
+		for range msgStorage.ReceiveConfirms() {
+		}
+		close(confirmsDone)
+	}()
+	msgStorage.Close()
+
+	select {
+	case <-confirmsDone:
+	case <-time.After(time.Second):
+		t.Fatal("Expected confirms channel closed")
+	}
+	for i := 0; runtime.NumGoroutine() > goroutines; i++ {
+		if i == 100 {
+			t.Fatalf("Expected %d goroutines after close, actual %d", goroutines, runtime.NumGoroutine())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,240 @@
+package policy
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/valinurovam/garagemq/amqp"
+)
+
+// Kinds of resources policy could be applied to
+const (
+	ApplyToQueues    = "queues"
+	ApplyToExchanges = "exchanges"
+	ApplyToAll       = "all"
+)
+
+// Keys of policy definition supported by garagemq
+const (
+	KeyMessageTTL           = "message-ttl"
+	KeyMaxLength            = "max-length"
+	KeyMaxLengthBytes       = "max-length-bytes"
+	KeyDeadLetterExchange   = "dead-letter-exchange"
+	KeyDeadLetterRoutingKey = "dead-letter-routing-key"
+	KeyAlternateExchange    = "alternate-exchange"
+	KeyQueueMode            = "queue-mode"
+)
+
+// Values of queue-mode key, lazy queue stores messages on disk at once and keeps only a few of them in memory
+const (
+	QueueModeDefault = "default"
+	QueueModeLazy    = "lazy"
+)
+
+var intKeys = map[string]bool{
+	KeyMessageTTL:     true,
+	KeyMaxLength:      true,
+	KeyMaxLengthBytes: true,
+}
+
+var stringKeys = map[string]bool{
+	KeyDeadLetterExchange:   true,
+	KeyDeadLetterRoutingKey: true,
+	KeyAlternateExchange:    true,
+}
+
+// Policy applies definition to queues and exchanges of vhost which names match pattern
+// Resource matched by several policies gets policy with the highest priority only
+type Policy struct {
+	Vhost      string
+	Name       string
+	Pattern    string
+	ApplyTo    string
+	Priority   int32
+	Definition *amqp.Table
+
+	pattern *regexp.Regexp
+}
+
+// NewPolicy returns validated policy with compiled pattern
+func NewPolicy(vhost string, name string, pattern string, applyTo string, priority int32, definition *amqp.Table) (*Policy, error) {
+	if name == "" {
+		return nil, fmt.Errorf("policy name is required")
+	}
+	if applyTo == "" {
+		applyTo = ApplyToAll
+	}
+	if definition == nil {
+		definition = &amqp.Table{}
+	}
+	p := &Policy{
+		Vhost:      vhost,
+		Name:       name,
+		Pattern:    pattern,
+		ApplyTo:    applyTo,
+		Priority:   priority,
+		Definition: definition,
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	if err := p.compile(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Policy) compile() (err error) {
+	p.pattern, err = regexp.Compile(p.Pattern)
+	return err
+}
+
+func (p *Policy) validate() error {
+	switch p.ApplyTo {
+	case ApplyToQueues, ApplyToExchanges, ApplyToAll:
+	default:
+		return fmt.Errorf("unknown apply-to '%s'", p.ApplyTo)
+	}
+	if len(*p.Definition) == 0 {
+		return fmt.Errorf("policy definition is empty")
+	}
+	for key, value := range *p.Definition {
+		switch {
+		case intKeys[key]:
+			if number, ok := IntValue(value); !ok || number < 0 {
+				return fmt.Errorf("policy key '%s' should be non-negative integer", key)
+			}
+		case stringKeys[key]:
+			if _, ok := StringValue(value); !ok {
+				return fmt.Errorf("policy key '%s' should be string", key)
+			}
+		case key == KeyQueueMode:
+			if mode, _ := StringValue(value); mode != QueueModeDefault && mode != QueueModeLazy {
+				return fmt.Errorf("policy key '%s' should be '%s' or '%s'", key, QueueModeDefault, QueueModeLazy)
+			}
+		default:
+			return fmt.Errorf("unsupported policy key '%s'", key)
+		}
+	}
+	return nil
+}
+
+// IsSupportedKey checks if definition key is supported by garagemq
+func IsSupportedKey(key string) bool {
+	return intKeys[key] || stringKeys[key] || key == KeyQueueMode
+}
+
+// Matches checks if policy is applied to resource (queues or exchanges) with given name
+func (p *Policy) Matches(resource string, name string) bool {
+	if p.ApplyTo != ApplyToAll && p.ApplyTo != resource {
+		return false
+	}
+	return p.pattern.MatchString(name)
+}
+
+// Get returns value of definition key
+func (p *Policy) Get(key string) (value interface{}, ok bool) {
+	value, ok = (*p.Definition)[key]
+	return
+}
+
+// Select returns policy with the highest priority matched resource with given name or nil
+// Policies with the same priority are ordered by name to make choice stable
+func Select(policies []*Policy, resource string, name string) *Policy {
+	var matched []*Policy
+	for _, p := range policies {
+		if p.Matches(resource, name) {
+			matched = append(matched, p)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].Priority != matched[j].Priority {
+			return matched[i].Priority > matched[j].Priority
+		}
+		return matched[i].Name < matched[j].Name
+	})
+	return matched[0]
+}
+
+// IntValue converts integer value of amqp table into int64
+func IntValue(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int8:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// StringValue converts string value of amqp table into string
+func StringValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	}
+	return "", false
+}
+
+// Marshal returns raw representation of policy to store into storage
+func (p *Policy) Marshal(protoVersion string) (data []byte, err error) {
+	buf := bytes.NewBuffer(make([]byte, 0))
+	for _, value := range []string{p.Vhost, p.Name, p.ApplyTo} {
+		if err = amqp.WriteShortstr(buf, value); err != nil {
+			return nil, err
+		}
+	}
+	if err = amqp.WriteLongstr(buf, []byte(p.Pattern)); err != nil {
+		return nil, err
+	}
+	if err = amqp.WriteLong(buf, uint32(p.Priority)); err != nil {
+		return nil, err
+	}
+	if err = amqp.WriteTable(buf, p.Definition, protoVersion); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal restore policy from storage
+func (p *Policy) Unmarshal(data []byte, protoVersion string) (err error) {
+	buf := bytes.NewReader(data)
+	for _, value := range []*string{&p.Vhost, &p.Name, &p.ApplyTo} {
+		if *value, err = amqp.ReadShortstr(buf); err != nil {
+			return err
+		}
+	}
+	var pattern []byte
+	if pattern, err = amqp.ReadLongstr(buf); err != nil {
+		return err
+	}
+	p.Pattern = string(pattern)
+	var priority uint32
+	if priority, err = amqp.ReadLong(buf); err != nil {
+		return err
+	}
+	p.Priority = int32(priority)
+	if p.Definition, err = amqp.ReadTable(buf, protoVersion); err != nil {
+		return err
+	}
+	return p.compile()
+}
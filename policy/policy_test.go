@@ -0,0 +1,87 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/valinurovam/garagemq/amqp"
+)
+
+func TestNewPolicy_Validate(t *testing.T) {
+	for _, definition := range []*amqp.Table{
+		{},
+		{KeyMaxLength: int64(-1)},
+		{KeyMaxLength: "10"},
+		{KeyAlternateExchange: int64(1)},
+		{KeyQueueMode: "eager"},
+		{"ha-mode": "all"},
+	} {
+		if _, err := NewPolicy("/", "test", ".*", ApplyToAll, 0, definition); err == nil {
+			t.Errorf("Expected error on definition %v", definition)
+		}
+	}
+	if _, err := NewPolicy("/", "test", ".*", "bindings", 0, &amqp.Table{KeyMaxLength: int64(1)}); err == nil {
+		t.Error("Expected error on unknown apply-to")
+	}
+	if _, err := NewPolicy("/", "test", "(", ApplyToAll, 0, &amqp.Table{KeyMaxLength: int64(1)}); err == nil {
+		t.Error("Expected error on bad pattern")
+	}
+
+	p, err := NewPolicy("/", "test", "^orders", "", 0, &amqp.Table{KeyMaxLength: int32(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ApplyTo != ApplyToAll {
+		t.Errorf("Expected default apply-to %s, actual %s", ApplyToAll, p.ApplyTo)
+	}
+	if _, err := NewPolicy("/", "test", ".*", ApplyToQueues, 0, &amqp.Table{KeyQueueMode: QueueModeLazy}); err != nil {
+		t.Errorf("Expected lazy queue mode supported, actual %v", err)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	low, _ := NewPolicy("/", "low", ".*", ApplyToAll, 0, &amqp.Table{KeyMaxLength: int64(1)})
+	high, _ := NewPolicy("/", "high", "^orders", ApplyToQueues, 1, &amqp.Table{KeyMaxLength: int64(2)})
+	other, _ := NewPolicy("/", "a-other", ".*", ApplyToAll, 0, &amqp.Table{KeyMaxLength: int64(3)})
+	policies := []*Policy{low, high, other}
+
+	if p := Select(policies, ApplyToQueues, "orders.new"); p != high {
+		t.Errorf("Expected policy with the highest priority, actual %v", p)
+	}
+	if p := Select(policies, ApplyToExchanges, "orders.new"); p != other {
+		t.Errorf("Expected policy with the first name on the same priority, actual %v", p)
+	}
+	if p := Select([]*Policy{high}, ApplyToExchanges, "orders"); p != nil {
+		t.Errorf("Expected no policy for exchange, actual %v", p)
+	}
+}
+
+func TestPolicy_Marshal(t *testing.T) {
+	for _, protoVersion := range []string{amqp.Proto091, amqp.ProtoRabbit} {
+		p, _ := NewPolicy("/", "test", "^orders\\.", ApplyToQueues, -1, &amqp.Table{
+			KeyMaxLength:          int64(10),
+			KeyDeadLetterExchange: "dlx",
+		})
+		data, err := p.Marshal(protoVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		restored := &Policy{}
+		if err := restored.Unmarshal(data, protoVersion); err != nil {
+			t.Fatal(err)
+		}
+		if restored.Vhost != p.Vhost || restored.Name != p.Name || restored.Pattern != p.Pattern ||
+			restored.ApplyTo != p.ApplyTo || restored.Priority != p.Priority {
+			t.Fatalf("Expected %+v, actual %+v", p, restored)
+		}
+		if value, _ := restored.Get(KeyMaxLength); !reflect.DeepEqual(value, int64(10)) {
+			t.Errorf("Expected max-length restored, actual %v", value)
+		}
+		if value, _ := restored.Get(KeyDeadLetterExchange); value == nil {
+			t.Error("Expected dead-letter-exchange restored")
+		}
+		if !restored.Matches(ApplyToQueues, "orders.new") {
+			t.Error("Expected restored pattern compiled")
+		}
+	}
+}
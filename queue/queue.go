@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/valinurovam/garagemq/amqp"
 	"github.com/valinurovam/garagemq/config"
@@ -30,6 +31,9 @@ type MetricsState struct {
 	ServerTotal   *metrics.TrackCounter
 	ServerDeliver *metrics.TrackCounter
 	ServerAck     *metrics.TrackCounter
+
+	// DeliverLatency is time messages spent in queue before they were popped for delivery
+	DeliverLatency *metrics.Histogram
 }
 
 // Queue is an implementation of the AMQP-queue entity
@@ -40,6 +44,7 @@ type Queue struct {
 	exclusive   bool
 	autoDelete  bool
 	durable     bool
+	arguments   *amqp.Table
 	cmrLock     sync.RWMutex
 	consumers   []interfaces.Consumer
 	consumeExcl bool
@@ -55,7 +60,14 @@ type Queue struct {
 	currentConsumer int
 	metrics         *MetricsState
 	autoDeleteQueue chan string
+	readyLock       sync.Mutex
 	queueLength     int64
+	queueBytes      int64
+	totals          *Totals
+	settingsLock    sync.RWMutex
+	settings        Settings
+	deadLetter      DeadLetterHandler
+	stopCh          chan struct{}
 
 	// lock for sync load swapped-messages from disk
 	loadSwapLock           sync.Mutex
@@ -88,6 +100,8 @@ func NewQueue(name string, connID uint64, exclusive bool, autoDelete bool, durab
 		autoDeleteQueue:        autoDeleteQueue,
 		swappedToDisk:          false,
 		wg:                     &sync.WaitGroup{},
+		settings:               DefaultSettings(),
+		stopCh:                 make(chan struct{}),
 		metrics: &MetricsState{
 			Ready:    metrics.NewTrackCounter(0, true),
 			Unacked:  metrics.NewTrackCounter(0, true),
@@ -102,6 +116,8 @@ func NewQueue(name string, connID uint64, exclusive bool, autoDelete bool, durab
 			ServerTotal:   metrics.NewTrackCounter(0, true),
 			ServerDeliver: metrics.NewTrackCounter(0, true),
 			ServerAck:     metrics.NewTrackCounter(0, true),
+
+			DeliverLatency: metrics.NewHistogram(metrics.LatencyBuckets),
 		},
 	}
 }
@@ -147,6 +163,21 @@ func (queue *Queue) Start() error {
 		}
 	}()
 
+	queue.wg.Add(1)
+	go func() {
+		defer queue.wg.Done()
+		ticker := time.NewTicker(expireInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-queue.stopCh:
+				return
+			case <-ticker.C:
+				queue.expireMessages()
+			}
+		}
+	}()
+
 	return nil
 }
 
@@ -159,6 +190,7 @@ func (queue *Queue) Stop() error {
 	queue.active = false
 	close(queue.maybeLoadFromStorageCh)
 	close(queue.call)
+	close(queue.stopCh)
 	queue.wg.Wait()
 	return nil
 }
@@ -170,15 +202,27 @@ func (queue *Queue) GetName() string {
 
 // Push append message into queue tail and put it into message storage
 // if queue is durable and message's persistent flag is true
+// Oldest messages are dropped if queue exceeds max length after that
 func (queue *Queue) Push(message *amqp.Message) {
+	if queue.push(message) {
+		queue.dropOverflow()
+	}
+}
+
+func (queue *Queue) push(message *amqp.Message) bool {
 	queue.actLock.Lock()
 	defer queue.actLock.Unlock()
 
 	if !queue.active {
-		return
+		return false
+	}
+
+	if message.QueuedAt.IsZero() {
+		message.QueuedAt = time.Now()
 	}
+	maxMessagesInRAM := queue.getMaxMessagesInRAM()
 
-	atomic.AddInt64(&queue.queueLength, 1)
+	queue.addReady(1, int64(message.BodySize))
 
 	queue.metrics.ServerTotal.Counter.Inc(1)
 	queue.metrics.ServerReady.Counter.Inc(1)
@@ -193,7 +237,7 @@ func (queue *Queue) Push(message *amqp.Message) {
 		queue.msgPStorage.Add(message, queue.name)
 		persisted = true
 	} else {
-		if queue.SafeQueue.Length() > queue.maxMessagesInRAM || queue.swappedToDisk {
+		if queue.SafeQueue.Length() > maxMessagesInRAM || queue.swappedToDisk {
 			queue.msgTStorage.Add(message, queue.name)
 			persisted = true
 		}
@@ -203,19 +247,20 @@ func (queue *Queue) Push(message *amqp.Message) {
 		}
 	}
 
-	if persisted && !queue.swappedToDisk && queue.SafeQueue.Length() > queue.maxMessagesInRAM {
+	if persisted && !queue.swappedToDisk && queue.SafeQueue.Length() > maxMessagesInRAM {
 		queue.swappedToDisk = true
 		queue.lastStoredMsgID = message.ID
 	}
 
 	queue.metrics.Incoming.Counter.Inc(1)
 
-	if queue.SafeQueue.Length() <= queue.maxMessagesInRAM && !queue.swappedToDisk {
+	if queue.SafeQueue.Length() <= maxMessagesInRAM && !queue.swappedToDisk {
 		queue.SafeQueue.Push(message)
 		queue.lastMemMsgID = message.ID
 	}
 
 	queue.callConsumers()
+	return true
 }
 
 // Pop returns message from queue head without QOS check
@@ -232,6 +277,8 @@ func (queue *Queue) PopQos(qosList []*qos.AmqpQos) *amqp.Message {
 	}
 	queue.actLock.RUnlock()
 
+	queue.expireMessages()
+
 	select {
 	case queue.maybeLoadFromStorageCh <- struct{}{}:
 	default:
@@ -253,13 +300,17 @@ func (queue *Queue) PopQos(qosList []*qos.AmqpQos) *amqp.Message {
 
 		if allowed {
 			queue.SafeQueue.DirtyPop()
-			atomic.AddInt64(&queue.queueLength, -1)
+			queue.addReady(-1, -int64(message.BodySize))
 		} else {
 			message = nil
 		}
 	}
 	queue.SafeQueue.Unlock()
 
+	if message != nil {
+		queue.metrics.DeliverLatency.ObserveSince(message.QueuedAt)
+	}
+
 	return message
 }
 
@@ -267,10 +318,11 @@ func (queue *Queue) mayBeLoadFromStorage() {
 	swappedToPersistent := true
 	swappedToTransient := true
 
+	maxMessagesInRAM := queue.getMaxMessagesInRAM()
 	currentLength := queue.SafeQueue.Length()
-	needle := queue.maxMessagesInRAM - currentLength
+	needle := maxMessagesInRAM - currentLength
 
-	if currentLength >= queue.maxMessagesInRAM/2 || needle <= 0 || !queue.swappedToDisk {
+	if currentLength >= maxMessagesInRAM/2 || needle <= 0 || !queue.swappedToDisk {
 		return
 	}
 
@@ -285,7 +337,7 @@ func (queue *Queue) mayBeLoadFromStorage() {
 	wg.Add(2)
 
 	go func() {
-		if currentLength < queue.maxMessagesInRAM/2 && queue.swappedToDisk {
+		if currentLength < maxMessagesInRAM/2 && queue.swappedToDisk {
 			iterated := queue.msgPStorage.IterateByQueueFromMsgID(queue.name, queue.lastStoredMsgID, needle, func(message *amqp.Message) {
 				lastIteratedMsgID = message.ID
 				pMessages = append(pMessages, message)
@@ -299,7 +351,7 @@ func (queue *Queue) mayBeLoadFromStorage() {
 	}()
 
 	go func() {
-		if currentLength < queue.maxMessagesInRAM/2 && queue.swappedToDisk {
+		if currentLength < maxMessagesInRAM/2 && queue.swappedToDisk {
 			iterated := queue.msgTStorage.IterateByQueueFromMsgID(queue.name, queue.lastStoredMsgID, needle, func(message *amqp.Message) {
 				lastIteratedMsgID = message.ID
 				tMessages = append(tMessages, message)
@@ -328,6 +380,9 @@ func (queue *Queue) mayBeLoadFromStorage() {
 		if message.ID == lastMemMsgID {
 			continue
 		}
+		if message.QueuedAt.IsZero() {
+			message.QueuedAt = time.Now()
+		}
 		queue.SafeQueue.Push(message)
 		queue.lastMemMsgID = message.ID
 		queue.lastStoredMsgID = message.ID
@@ -366,28 +421,37 @@ func (queue *Queue) mergeSortedMessageSlices(A, B []*amqp.Message) []*amqp.Messa
 }
 
 // LoadFromMsgStorage loads messages into queue from msgstorage
+// Body size of messages left on disk is taken from message references
 func (queue *Queue) LoadFromMsgStorage() {
-	iterated := queue.msgPStorage.IterateByQueueFromMsgID(queue.name, 0, queue.maxMessagesInRAM, func(message *amqp.Message) {
+	maxMessagesInRAM := queue.getMaxMessagesInRAM()
+	var bytes int64
+	iterated := queue.msgPStorage.IterateByQueueFromMsgID(queue.name, 0, maxMessagesInRAM, func(message *amqp.Message) {
+		if message.QueuedAt.IsZero() {
+			message.QueuedAt = time.Now()
+		}
 		queue.SafeQueue.Push(message)
+		bytes += int64(message.BodySize)
 
 		queue.lastStoredMsgID = message.ID
 		queue.lastMemMsgID = message.ID
 	})
 
-	if queue.SafeQueue.Length() >= queue.maxMessagesInRAM {
+	if queue.SafeQueue.Length() >= maxMessagesInRAM {
 		queue.swappedToDisk = true
 	}
 
-	if iterated >= queue.maxMessagesInRAM {
-		queue.queueLength = int64(queue.msgPStorage.GetQueueLength(queue.name))
-	} else {
-		queue.queueLength = int64(iterated)
+	length := int64(iterated)
+	if iterated >= maxMessagesInRAM {
+		length = int64(queue.msgPStorage.GetQueueLength(queue.name))
+		// messages left on disk should be counted too
+		bytes += int64(queue.msgPStorage.GetQueueBytes(queue.name, queue.lastStoredMsgID+1))
 	}
-	queue.metrics.ServerTotal.Counter.Inc(queue.queueLength)
-	queue.metrics.ServerReady.Counter.Inc(queue.queueLength)
+	queue.addReady(length, bytes)
+	queue.metrics.ServerTotal.Counter.Inc(length)
+	queue.metrics.ServerReady.Counter.Inc(length)
 
-	queue.metrics.Total.Counter.Inc(queue.queueLength)
-	queue.metrics.Ready.Counter.Inc(queue.queueLength)
+	queue.metrics.Total.Counter.Inc(length)
+	queue.metrics.Ready.Counter.Inc(length)
 }
 
 // AckMsg accept ack event for message
@@ -435,7 +499,7 @@ func (queue *Queue) Requeue(message *amqp.Message) {
 	queue.metrics.Unacked.Counter.Dec(1)
 	queue.metrics.ServerUnacked.Counter.Dec(1)
 
-	atomic.AddInt64(&queue.queueLength, 1)
+	queue.addReady(1, int64(message.BodySize))
 
 	queue.callConsumers()
 }
@@ -444,8 +508,8 @@ func (queue *Queue) Requeue(message *amqp.Message) {
 func (queue *Queue) Purge() (length uint64) {
 	queue.SafeQueue.Lock()
 	defer queue.SafeQueue.Unlock()
-	length = uint64(atomic.LoadInt64(&queue.queueLength))
 	queue.SafeQueue.DirtyPurge()
+	length = uint64(queue.resetReady())
 
 	if queue.durable {
 		queue.msgPStorage.PurgeQueue(queue.name)
@@ -455,7 +519,6 @@ func (queue *Queue) Purge() (length uint64) {
 
 	queue.metrics.ServerTotal.Counter.Dec(int64(length))
 	queue.metrics.ServerReady.Counter.Dec(int64(length))
-	atomic.StoreInt64(&queue.queueLength, 0)
 	return
 }
 
@@ -479,7 +542,7 @@ func (queue *Queue) Delete(ifUnused bool, ifEmpty bool) (uint64, error) {
 	}
 
 	queue.cancelConsumers()
-	length := uint64(atomic.LoadInt64(&queue.queueLength))
+	length := uint64(queue.resetReady())
 
 	if queue.durable {
 		queue.msgPStorage.PurgeQueue(queue.name)
@@ -565,6 +628,58 @@ func (queue *Queue) Length() uint64 {
 	return uint64(atomic.LoadInt64(&queue.queueLength))
 }
 
+// Bytes returns total body size of ready messages in queue
+func (queue *Queue) Bytes() uint64 {
+	return uint64(atomic.LoadInt64(&queue.queueBytes))
+}
+
+// Totals counts ready messages and their body size of several queues, like all queues of virtual host
+type Totals struct {
+	messages int64
+	bytes    int64
+}
+
+// Messages returns count of ready messages
+func (totals *Totals) Messages() uint64 {
+	return uint64(atomic.LoadInt64(&totals.messages))
+}
+
+// Bytes returns body size of ready messages
+func (totals *Totals) Bytes() uint64 {
+	return uint64(atomic.LoadInt64(&totals.bytes))
+}
+
+// SetTotals sets totals queue adds its ready messages into, it should be set before queue start
+func (queue *Queue) SetTotals(totals *Totals) {
+	queue.totals = totals
+}
+
+// addReady changes count and body size of ready messages of queue and its totals
+func (queue *Queue) addReady(messages int64, bytes int64) {
+	queue.readyLock.Lock()
+	defer queue.readyLock.Unlock()
+	atomic.AddInt64(&queue.queueLength, messages)
+	atomic.AddInt64(&queue.queueBytes, bytes)
+	if queue.totals != nil {
+		atomic.AddInt64(&queue.totals.messages, messages)
+		atomic.AddInt64(&queue.totals.bytes, bytes)
+	}
+}
+
+// resetReady zeroes count and body size of ready messages of queue and subtracts them from its totals
+// Both counters are swapped under the lock addReady uses, so concurrent changes are not lost in totals
+func (queue *Queue) resetReady() (messages int64) {
+	queue.readyLock.Lock()
+	defer queue.readyLock.Unlock()
+	messages = atomic.SwapInt64(&queue.queueLength, 0)
+	bytes := atomic.SwapInt64(&queue.queueBytes, 0)
+	if queue.totals != nil {
+		atomic.AddInt64(&queue.totals.messages, -messages)
+		atomic.AddInt64(&queue.totals.bytes, -bytes)
+	}
+	return messages
+}
+
 // ConsumersCount returns consumers count
 func (queue *Queue) ConsumersCount() int {
 	queue.cmrLock.RLock()
@@ -604,6 +719,14 @@ func (queue *Queue) Marshal(protoVersion string) (data []byte, err error) {
 	if err = amqp.WriteOctet(buf, autoDelete); err != nil {
 		return nil, err
 	}
+
+	arguments := queue.arguments
+	if arguments == nil {
+		arguments = &amqp.Table{}
+	}
+	if err = amqp.WriteTable(buf, arguments, protoVersion); err != nil {
+		return nil, err
+	}
 	return buf.Bytes(), nil
 }
 
@@ -621,9 +744,25 @@ func (queue *Queue) Unmarshal(data []byte, protoVersion string) (err error) {
 	}
 	queue.autoDelete = autoDelete > 0
 	queue.durable = true
+
+	// queues stored by previous layout have no arguments
+	if buf.Len() == 0 {
+		return
+	}
+	queue.arguments, err = amqp.ReadTable(buf, protoVersion)
 	return
 }
 
+// SetArguments set queue arguments declared by client
+func (queue *Queue) SetArguments(arguments *amqp.Table) {
+	queue.arguments = arguments
+}
+
+// GetArguments returns queue arguments
+func (queue *Queue) GetArguments() *amqp.Table {
+	return queue.arguments
+}
+
 // IsDurable returns is queue durable
 func (queue *Queue) IsDurable() bool {
 	return queue.durable
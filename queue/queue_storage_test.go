@@ -57,6 +57,16 @@ func (storage *MsgStorageMock) GetQueueLength(queue string) uint64 {
 	return uint64(len(storage.messages))
 }
 
+func (storage *MsgStorageMock) GetQueueBytes(queue string, msgID uint64) uint64 {
+	var size uint64
+	storage.IterateByQueueFromMsgID(queue, msgID, 0, func(message *amqp.Message) {
+		if message != nil {
+			size += message.BodySize
+		}
+	})
+	return size
+}
+
 func (storage *MsgStorageMock) IterateByQueueFromMsgID(queue string, msgID uint64, limit uint64, fn func(message *amqp.Message)) uint64 {
 	if storage.messages != nil {
 		var startPos int
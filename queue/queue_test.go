@@ -1,6 +1,7 @@
 package queue
 
 import (
+	"sync"
 	"testing"
 	"time"
 
@@ -259,6 +260,100 @@ func TestQueue_Purge(t *testing.T) {
 	}
 }
 
+func TestQueue_Bytes(t *testing.T) {
+	queue := NewQueue("test", 0, false, false, false, baseConfig, nil, nil, nil)
+	queue.Start()
+	for item := 0; item < 10; item++ {
+		queue.Push(&amqp.Message{ID: uint64(item + 1), BodySize: 10})
+	}
+	if queue.Bytes() != 100 {
+		t.Fatalf("Expected %d bytes, actual %d", 100, queue.Bytes())
+	}
+
+	message := queue.Pop()
+	if queue.Bytes() != 90 {
+		t.Fatalf("Expected %d bytes, actual %d", 90, queue.Bytes())
+	}
+
+	queue.Requeue(message)
+	if queue.Bytes() != 100 {
+		t.Fatalf("Expected %d bytes, actual %d", 100, queue.Bytes())
+	}
+
+	queue.Purge()
+	if queue.Bytes() != 0 {
+		t.Fatalf("Expected %d bytes, actual %d", 0, queue.Bytes())
+	}
+}
+
+func TestQueue_Totals(t *testing.T) {
+	totals := &Totals{}
+	queue1 := NewQueue("test1", 0, false, false, false, baseConfig, nil, nil, nil)
+	queue2 := NewQueue("test2", 0, false, false, false, baseConfig, nil, nil, nil)
+	queue1.SetTotals(totals)
+	queue2.SetTotals(totals)
+	queue1.Start()
+	queue2.Start()
+	for item := 0; item < 10; item++ {
+		queue1.Push(&amqp.Message{ID: uint64(item + 1), BodySize: 10})
+		queue2.Push(&amqp.Message{ID: uint64(item + 1), BodySize: 10})
+	}
+	if totals.Messages() != 20 || totals.Bytes() != 200 {
+		t.Fatalf("Expected %d messages and %d bytes, actual %d and %d", 20, 200, totals.Messages(), totals.Bytes())
+	}
+
+	message := queue1.Pop()
+	if totals.Messages() != 19 || totals.Bytes() != 190 {
+		t.Fatalf("Expected %d messages and %d bytes, actual %d and %d", 19, 190, totals.Messages(), totals.Bytes())
+	}
+
+	queue1.Requeue(message)
+	queue1.Purge()
+	if totals.Messages() != 10 || totals.Bytes() != 100 {
+		t.Fatalf("Expected %d messages and %d bytes, actual %d and %d", 10, 100, totals.Messages(), totals.Bytes())
+	}
+
+	if _, err := queue2.Delete(false, false); err != nil {
+		t.Fatal(err)
+	}
+	if totals.Messages() != 0 || totals.Bytes() != 0 {
+		t.Fatalf("Expected %d messages and %d bytes, actual %d and %d", 0, 0, totals.Messages(), totals.Bytes())
+	}
+}
+
+func TestQueue_Totals_ConcurrentPurge(t *testing.T) {
+	totals := &Totals{}
+	queue := NewQueue("test", 0, false, false, false, baseConfig, nil, nil, nil)
+	queue.SetTotals(totals)
+	queue.Start()
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 4; worker++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for item := 0; item < 1000; item++ {
+				queue.Push(&amqp.Message{ID: uint64(item + 1), BodySize: 10})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for item := 0; item < 100; item++ {
+				queue.Purge()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if totals.Messages() != queue.Length() || totals.Bytes() != queue.Bytes() {
+		t.Fatalf("Expected totals %d and %d bytes, actual %d and %d", queue.Length(), queue.Bytes(), totals.Messages(), totals.Bytes())
+	}
+	queue.Purge()
+	if totals.Messages() != 0 || totals.Bytes() != 0 {
+		t.Fatalf("Expected totals reset by purge, actual %d and %d bytes", totals.Messages(), totals.Bytes())
+	}
+}
+
 func TestQueue_AddConsumer(t *testing.T) {
 	queue := NewQueue("test", 0, false, false, false, baseConfig, nil, nil, nil)
 	if queue.AddConsumer(&ConsumerMock{}, false) == nil {
@@ -409,6 +504,29 @@ func TestQueue_Marshal(t *testing.T) {
 	}
 }
 
+func TestQueue_Marshal_Arguments(t *testing.T) {
+	queue := NewQueue("test", 0, false, false, false, baseConfig, nil, nil, nil)
+	queue.SetArguments(&amqp.Table{"x-message-ttl": int64(60000)})
+	marshaled, err := queue.Marshal(amqp.ProtoRabbit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uQueue := &Queue{}
+	if err = uQueue.Unmarshal(marshaled, amqp.ProtoRabbit); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := (*uQueue.GetArguments())["x-message-ttl"]; ttl != int64(60000) {
+		t.Fatalf("Expected x-message-ttl restored, actual %v", ttl)
+	}
+
+	// queue stored without arguments
+	uQueue = &Queue{}
+	if err = uQueue.Unmarshal([]byte{4, 't', 'e', 's', 't', 0}, amqp.ProtoRabbit); err != nil || uQueue.GetArguments() != nil {
+		t.Fatal("Expected queue without arguments")
+	}
+}
+
 // useless, for coverage only
 func TestQueue_Unmarshal_FailedEmpty(t *testing.T) {
 	queue := &Queue{}
@@ -683,7 +801,8 @@ func TestQueue_LoadFromMsgStorage_OverMaxMessages(t *testing.T) {
 		idx++
 		// persisted
 		messageP := &amqp.Message{
-			ID: idx,
+			ID:       idx,
+			BodySize: 3,
 			Header: &amqp.ContentHeader{
 				PropertyList: &amqp.BasicPropertyList{
 					DeliveryMode: &dMode,
@@ -706,6 +825,10 @@ func TestQueue_LoadFromMsgStorage_OverMaxMessages(t *testing.T) {
 	if queue.Length() != count {
 		t.Fatalf("Expected %d messages into the queue, actual %d", count, queue.Length())
 	}
+
+	if queue.Bytes() != count*3 {
+		t.Fatalf("Expected %d bytes into the queue, actual %d", count*3, queue.Bytes())
+	}
 }
 
 func TestQueue_AutoDelete(t *testing.T) {
@@ -0,0 +1,139 @@
+package queue
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/valinurovam/garagemq/amqp"
+)
+
+// expireInterval is how often expired messages are removed from queue head
+const expireInterval = time.Second
+
+// lazyMessagesInRAM is count of ready messages lazy queue keeps in memory for delivery
+const lazyMessagesInRAM = 128
+
+// Reasons of removing message from queue passed into dead-letter handler
+const (
+	ReasonRejected = "rejected"
+	ReasonExpired  = "expired"
+	ReasonMaxLen   = "maxlen"
+)
+
+// Settings are queue features set by queue arguments or policy
+type Settings struct {
+	// Policy is name of policy applied to queue
+	Policy string
+	// MessageTTL is time in milliseconds message could stay ready in queue, negative value means no TTL
+	MessageTTL int64
+	// MaxLength is max count of ready messages, negative value means no limit
+	MaxLength int64
+	// MaxLengthBytes is max body size of ready messages, negative value means no limit
+	MaxLengthBytes int64
+	// DeadLetter is set if expired, dropped and rejected messages are republished into DeadLetterExchange
+	DeadLetter         bool
+	DeadLetterExchange string
+	// DeadLetterRoutingKey replaces routing key of dead-lettered message if it is not empty
+	DeadLetterRoutingKey string
+	// Lazy is set if queue stores new messages on disk at once and keeps only lazyMessagesInRAM of them in memory
+	Lazy bool
+}
+
+// DefaultSettings returns settings of queue without any limits
+func DefaultSettings() Settings {
+	return Settings{MessageTTL: -1, MaxLength: -1, MaxLengthBytes: -1}
+}
+
+// DeadLetterHandler republishes message removed from queue for given reason
+type DeadLetterHandler func(queue *Queue, message *amqp.Message, reason string)
+
+// SetDeadLetterHandler sets handler of dead-lettered messages, it should be set before queue start
+func (queue *Queue) SetDeadLetterHandler(handler DeadLetterHandler) {
+	queue.deadLetter = handler
+}
+
+// SetSettings replaces queue settings, new TTL and max length are applied to queued messages at once
+func (queue *Queue) SetSettings(settings Settings) {
+	queue.settingsLock.Lock()
+	queue.settings = settings
+	queue.settingsLock.Unlock()
+
+	queue.expireMessages()
+	queue.dropOverflow()
+}
+
+// getMaxMessagesInRAM returns count of ready messages queue keeps in memory, others are swapped to disk
+func (queue *Queue) getMaxMessagesInRAM() uint64 {
+	if queue.GetSettings().Lazy && queue.maxMessagesInRAM > lazyMessagesInRAM {
+		return lazyMessagesInRAM
+	}
+	return queue.maxMessagesInRAM
+}
+
+// GetSettings returns current queue settings
+func (queue *Queue) GetSettings() Settings {
+	queue.settingsLock.RLock()
+	defer queue.settingsLock.RUnlock()
+	return queue.settings
+}
+
+// DeadLetter republishes message removed from queue if queue has dead-letter exchange
+func (queue *Queue) DeadLetter(message *amqp.Message, reason string) {
+	if queue.deadLetter != nil && queue.GetSettings().DeadLetter {
+		queue.deadLetter(queue, message, reason)
+	}
+}
+
+// expireMessages removes messages queued longer than message TTL from queue head
+// Like RabbitMQ does only head is checked, so expired messages behind not expired ones wait for their turn
+func (queue *Queue) expireMessages() {
+	ttl := queue.GetSettings().MessageTTL
+	if ttl < 0 {
+		return
+	}
+	deadline := time.Now().Add(-time.Duration(ttl) * time.Millisecond)
+	queue.removeHead(ReasonExpired, func(message *amqp.Message) bool {
+		return message.QueuedAt.Before(deadline)
+	})
+}
+
+// dropOverflow removes messages from queue head while queue exceeds max length
+func (queue *Queue) dropOverflow() {
+	settings := queue.GetSettings()
+	if settings.MaxLength < 0 && settings.MaxLengthBytes < 0 {
+		return
+	}
+	queue.removeHead(ReasonMaxLen, func(message *amqp.Message) bool {
+		return (settings.MaxLength >= 0 && atomic.LoadInt64(&queue.queueLength) > settings.MaxLength) ||
+			(settings.MaxLengthBytes >= 0 && atomic.LoadInt64(&queue.queueBytes) > settings.MaxLengthBytes)
+	})
+}
+
+// removeHead removes messages from queue head while check is passed
+// Removed messages are deleted from storage and dead-lettered
+func (queue *Queue) removeHead(reason string, check func(message *amqp.Message) bool) {
+	var removed []*amqp.Message
+	queue.SafeQueue.Lock()
+	for {
+		message := queue.SafeQueue.HeadItem()
+		if message == nil || !check(message) {
+			break
+		}
+		queue.SafeQueue.DirtyPop()
+		queue.addReady(-1, -int64(message.BodySize))
+		removed = append(removed, message)
+	}
+	queue.SafeQueue.Unlock()
+
+	for _, message := range removed {
+		if queue.durable && message.IsPersistent() {
+			queue.msgPStorage.Del(message, queue.name)
+		}
+		queue.metrics.Ready.Counter.Dec(1)
+		queue.metrics.Total.Counter.Dec(1)
+		queue.metrics.ServerReady.Counter.Dec(1)
+		queue.metrics.ServerTotal.Counter.Dec(1)
+
+		queue.DeadLetter(message, reason)
+	}
+}
@@ -0,0 +1,117 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/valinurovam/garagemq/amqp"
+)
+
+func TestQueue_SetSettings_MaxLength(t *testing.T) {
+	queue := NewQueue("test", 0, false, false, false, baseConfig, nil, nil, nil)
+	queue.Start()
+	defer queue.Stop()
+
+	var dropped []uint64
+	queue.SetDeadLetterHandler(func(qu *Queue, message *amqp.Message, reason string) {
+		if reason != ReasonMaxLen {
+			t.Errorf("Expected reason %s, actual %s", ReasonMaxLen, reason)
+		}
+		dropped = append(dropped, message.ID)
+	})
+	for item := 0; item < 5; item++ {
+		queue.Push(&amqp.Message{ID: uint64(item + 1), BodySize: 10})
+	}
+
+	settings := DefaultSettings()
+	settings.MaxLength = 3
+	settings.DeadLetter = true
+	queue.SetSettings(settings)
+	if queue.Length() != 3 {
+		t.Fatalf("Expected %d messages, actual %d", 3, queue.Length())
+	}
+	if len(dropped) != 2 || dropped[0] != 1 || dropped[1] != 2 {
+		t.Fatalf("Expected oldest messages dead-lettered, actual %v", dropped)
+	}
+
+	queue.Push(&amqp.Message{ID: 6, BodySize: 10})
+	if queue.Length() != 3 || queue.Pop().ID != 4 {
+		t.Fatal("Expected head dropped on push over max length")
+	}
+
+	settings.MaxLength = -1
+	settings.MaxLengthBytes = 10
+	queue.SetSettings(settings)
+	if queue.Length() != 1 || queue.Bytes() != 10 {
+		t.Fatalf("Expected queue fit max length bytes, actual %d messages %d bytes", queue.Length(), queue.Bytes())
+	}
+}
+
+func TestQueue_SetSettings_MessageTTL(t *testing.T) {
+	queue := NewQueue("test", 0, false, false, false, baseConfig, nil, nil, nil)
+	queue.Start()
+	defer queue.Stop()
+
+	expired := 0
+	queue.SetDeadLetterHandler(func(qu *Queue, message *amqp.Message, reason string) {
+		expired++
+	})
+	queue.Push(&amqp.Message{ID: 1, QueuedAt: time.Now().Add(-time.Minute)})
+	queue.Push(&amqp.Message{ID: 2})
+
+	settings := DefaultSettings()
+	settings.MessageTTL = 1000
+	queue.SetSettings(settings)
+	if queue.Length() != 1 {
+		t.Fatalf("Expected expired message removed, actual length %d", queue.Length())
+	}
+	if expired != 0 {
+		t.Fatal("Expected no dead-lettering without dead-letter exchange")
+	}
+
+	settings.MessageTTL = 0
+	queue.SetSettings(settings)
+	if queue.Length() != 0 {
+		t.Fatalf("Expected all messages expired, actual length %d", queue.Length())
+	}
+}
+
+func TestQueue_SetSettings_Lazy(t *testing.T) {
+	count := lazyMessagesInRAM * 4
+	queue := NewQueue("test", 0, false, false, true, baseConfig, NewStorageMock(count), NewStorageMock(0), nil)
+	queue.Start()
+	defer queue.Stop()
+
+	settings := DefaultSettings()
+	settings.Lazy = true
+	queue.SetSettings(settings)
+
+	var dMode byte = 2
+	for item := 1; item <= count; item++ {
+		queue.Push(&amqp.Message{
+			ID:     uint64(item),
+			Header: &amqp.ContentHeader{PropertyList: &amqp.BasicPropertyList{DeliveryMode: &dMode}},
+		})
+	}
+	if inRAM := queue.SafeQueue.Length(); inRAM > lazyMessagesInRAM+1 {
+		t.Fatalf("Expected at most %d messages in memory, actual %d", lazyMessagesInRAM+1, inRAM)
+	}
+
+	// messages swapped to disk are loaded by small batches when memory is freed
+	expected := uint64(1)
+	deadline := time.Now().Add(5 * time.Second)
+	for expected <= uint64(count) && time.Now().Before(deadline) {
+		message := queue.Pop()
+		if message == nil {
+			time.Sleep(time.Millisecond)
+			continue
+		}
+		if message.ID != expected {
+			t.Fatalf("Expected message %d, actual %d", expected, message.ID)
+		}
+		expected++
+	}
+	if expected != uint64(count)+1 {
+		t.Fatalf("Expected %d messages popped, actual %d", count, expected-1)
+	}
+}
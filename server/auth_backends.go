@@ -0,0 +1,125 @@
+package server
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/valinurovam/garagemq/auth"
+)
+
+// internalBackend authenticates users and checks their permissions from server storage
+type internalBackend struct {
+	srv *Server
+}
+
+func (backend *internalBackend) Authenticate(saslData auth.SaslData) (*auth.User, error) {
+	backend.srv.usersLock.RLock()
+	user, ok := backend.srv.users[saslData.Username]
+	backend.srv.usersLock.RUnlock()
+	if !ok || (!saslData.Trusted && !user.CheckPassword(saslData.Password)) {
+		return nil, auth.ErrRefused
+	}
+	return user, nil
+}
+
+func (backend *internalBackend) CheckVhost(user *auth.User, vhost string) bool {
+	return backend.srv.getPermission(user.Username, vhost) != nil
+}
+
+func (backend *internalBackend) CheckResource(user *auth.User, vhost string, resourceType string, resource string, access string) bool {
+	return backend.srv.checkPermission(user.Username, vhost, access, resource)
+}
+
+func (backend *internalBackend) CheckTopic(user *auth.User, vhost string, exchange string, routingKey string, access string) bool {
+	return backend.srv.checkTopicPermission(user.Username, vhost, exchange, access, routingKey)
+}
+
+// newInternalChain returns chain with internal backend only
+func (srv *Server) newInternalChain() *auth.Chain {
+	backend := &internalBackend{srv: srv}
+	chain := auth.NewChain()
+	chain.Add(backend, backend)
+	return chain
+}
+
+// initAuthBackends builds chain of authentication backends from config
+func (srv *Server) initAuthBackends() error {
+	cfg := srv.config.Auth
+	if len(cfg.Backends) == 0 {
+		srv.authChain = srv.newInternalChain()
+		return nil
+	}
+
+	// each backend is created once, even if it is used several times in chain
+	authenticators := make(map[string]auth.Authenticator)
+	authorizers := make(map[string]auth.Authorizer)
+	getBackend := func(name string) error {
+		if _, ok := authenticators[name]; ok {
+			return nil
+		}
+		switch name {
+		case auth.BackendInternal:
+			backend := &internalBackend{srv: srv}
+			authenticators[name], authorizers[name] = backend, backend
+		case auth.BackendHtpasswd:
+			backend, err := auth.NewHtpasswdBackend(cfg.Htpasswd.File)
+			if err != nil {
+				return err
+			}
+			authenticators[name] = backend
+		case auth.BackendHTTP:
+			backend, err := auth.NewHTTPBackend(cfg.HTTP.Method, cfg.HTTP.UserURL, cfg.HTTP.VhostURL, cfg.HTTP.ResourceURL, cfg.HTTP.TopicURL)
+			if err != nil {
+				return err
+			}
+			authenticators[name], authorizers[name] = backend, backend
+		case auth.BackendJWT:
+			backend, err := auth.NewJWTBackend(cfg.JWT.ResourceServerID, cfg.JWT.HMACKey, cfg.JWT.JWKSFile)
+			if err != nil {
+				return err
+			}
+			authenticators[name], authorizers[name] = backend, backend
+		default:
+			return fmt.Errorf("unknown auth backend '%s'", name)
+		}
+		return nil
+	}
+
+	chain := auth.NewChain()
+	for _, backend := range cfg.Backends {
+		authzName := backend.Authz
+		if authzName == "" {
+			authzName = backend.Authn
+		}
+		if err := getBackend(backend.Authn); err != nil {
+			return err
+		}
+		if err := getBackend(authzName); err != nil {
+			return err
+		}
+		authz, ok := authorizers[authzName]
+		if !ok {
+			return fmt.Errorf("auth backend '%s' does not support authorization", authzName)
+		}
+		chain.Add(authenticators[backend.Authn], authz)
+
+		log.WithFields(log.Fields{
+			"authn": backend.Authn,
+			"authz": authzName,
+		}).Info("Auth backend added")
+	}
+	srv.authChain = chain
+	return nil
+}
+
+// authenticate returns user and its authorizer, or nil if no backend accepts credentials
+func (srv *Server) authenticate(saslData auth.SaslData) (*auth.User, auth.Authorizer) {
+	user, authz, err := srv.authChain.Authenticate(saslData)
+	if err != nil {
+		if err != auth.ErrRefused {
+			log.WithError(err).WithField("user", saslData.Username).Warn("Error on authentication")
+		}
+		return nil, nil
+	}
+	return user, authz
+}
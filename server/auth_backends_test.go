@@ -0,0 +1,138 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	amqpclient "github.com/streadway/amqp"
+	"github.com/valinurovam/garagemq/amqp"
+	"github.com/valinurovam/garagemq/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestServer_AuthBackend_Htpasswd(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+
+	dir, _ := ioutil.TempDir("", "garagemq_htpasswd")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "users.htpasswd")
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	ioutil.WriteFile(path, []byte("guest:"+string(hash)+"\nstranger:"+string(hash)+"\n"), 0600)
+
+	sc.server.config.Auth = config.Auth{
+		Backends: []config.AuthBackend{{Authn: "htpasswd", Authz: "internal"}, {Authn: "internal"}},
+		Htpasswd: config.HtpasswdAuth{File: path},
+	}
+	if err := sc.server.initAuthBackends(); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := sc.dial(amqpclient.Config{SASL: []amqpclient.Authentication{&amqpclient.PlainAuth{Username: "guest", Password: "secret"}}})
+	if err != nil {
+		t.Fatalf("Expected htpasswd user connected, actual %v", err)
+	}
+	client.Close()
+
+	// fallback to internal backend
+	client, err = sc.dial(amqpclient.Config{SASL: []amqpclient.Authentication{&amqpclient.PlainAuth{Username: "test", Password: "guest"}}})
+	if err != nil {
+		t.Fatalf("Expected internal user connected, actual %v", err)
+	}
+	client.Close()
+
+	// user has no permissions in internal store
+	if _, err = sc.dial(amqpclient.Config{SASL: []amqpclient.Authentication{&amqpclient.PlainAuth{Username: "stranger", Password: "secret"}}}); err != amqpclient.ErrVhost {
+		t.Errorf("Expected vhost access refused, actual %v", err)
+	}
+	if _, err = sc.dial(amqpclient.Config{SASL: []amqpclient.Authentication{&amqpclient.PlainAuth{Username: "guest", Password: "wrong"}}}); err == nil {
+		t.Error("Expected authentication failed")
+	}
+}
+
+func TestServer_AuthBackend_HTTP(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+
+	stub := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		req.ParseForm()
+		allow := false
+		switch req.URL.Path {
+		case "/user":
+			allow = req.Form.Get("username") == "remote" && req.Form.Get("password") == "secret"
+		case "/vhost":
+			allow = req.Form.Get("vhost") == "/"
+		case "/resource":
+			allow = req.Form.Get("name") != "forbidden"
+		case "/topic":
+			allow = req.Form.Get("routing_key") == "allowed"
+		}
+		if allow {
+			resp.Write([]byte("allow"))
+		} else {
+			resp.Write([]byte("deny"))
+		}
+	}))
+	defer stub.Close()
+
+	sc.server.config.Auth = config.Auth{
+		Backends: []config.AuthBackend{{Authn: "http"}},
+		HTTP: config.HTTPAuth{
+			Method:      "POST",
+			UserURL:     stub.URL + "/user",
+			VhostURL:    stub.URL + "/vhost",
+			ResourceURL: stub.URL + "/resource",
+			TopicURL:    stub.URL + "/topic",
+		},
+	}
+	if err := sc.server.initAuthBackends(); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := sc.dial(amqpclient.Config{SASL: []amqpclient.Authentication{&amqpclient.PlainAuth{Username: "remote", Password: "secret"}}})
+	if err != nil {
+		t.Fatalf("Expected remote user connected, actual %v", err)
+	}
+	defer client.Close()
+	ch, _ := client.Channel()
+	if _, err := ch.QueueDeclare("allowed", false, false, false, false, emptyTable); err != nil {
+		t.Errorf("Expected queue declared, actual %v", err)
+	}
+	if err := ch.Publish("amq.topic", "allowed", false, false, amqpclient.Publishing{}); err != nil {
+		t.Errorf("Expected message published, actual %v", err)
+	}
+	_, err = ch.QueueDeclare("forbidden", false, false, false, false, emptyTable)
+	if err == nil || err.(*amqpclient.Error).Code != amqp.AccessRefused {
+		t.Errorf("Expected AccessRefused error, actual %v", err)
+	}
+
+	// internal users are not accepted without internal backend in chain
+	if _, err = sc.dial(amqpclient.Config{SASL: []amqpclient.Authentication{&amqpclient.PlainAuth{Username: "guest", Password: "guest"}}}); err == nil {
+		t.Error("Expected authentication failed")
+	}
+}
+
+func TestServer_InitAuthBackends_Failed(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+
+	sc.server.config.Auth = config.Auth{Backends: []config.AuthBackend{{Authn: "unknown"}}}
+	if err := sc.server.initAuthBackends(); err == nil {
+		t.Error("Expected error on unknown backend")
+	}
+
+	file, _ := ioutil.TempFile("", "garagemq_htpasswd")
+	file.Close()
+	defer os.Remove(file.Name())
+	sc.server.config.Auth = config.Auth{
+		Backends: []config.AuthBackend{{Authn: "htpasswd"}},
+		Htpasswd: config.HtpasswdAuth{File: file.Name()},
+	}
+	if err := sc.server.initAuthBackends(); err == nil {
+		t.Error("Expected error on htpasswd backend used for authorization")
+	}
+}
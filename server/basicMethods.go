@@ -1,8 +1,12 @@
 package server
 
 import (
+	"fmt"
+
 	"github.com/valinurovam/garagemq/amqp"
+	"github.com/valinurovam/garagemq/auth"
 	"github.com/valinurovam/garagemq/consumer"
+	"github.com/valinurovam/garagemq/exchange"
 	"github.com/valinurovam/garagemq/qos"
 	"github.com/valinurovam/garagemq/queue"
 )
@@ -54,9 +58,28 @@ func (channel *Channel) basicPublish(method *amqp.BasicPublish) (err *amqp.Error
 		return amqp.NewChannelError(amqp.NotImplemented, "Immediate = true", method.ClassIdentifier(), method.MethodIdentifier())
 	}
 
-	if _, err = channel.getExchangeWithError(method.Exchange, method); err != nil {
+	if err = channel.checkAccessWithError(auth.AccessWrite, auth.ResourceExchange, method.Exchange, method); err != nil {
+		return err
+	}
+
+	var ex *exchange.Exchange
+	if ex, err = channel.getExchangeWithError(method.Exchange, method); err != nil {
+		return err
+	}
+	if ex.IsInternal() {
+		return amqp.NewChannelError(
+			amqp.AccessRefused,
+			fmt.Sprintf("cannot publish to internal exchange '%s'", method.Exchange),
+			method.ClassIdentifier(),
+			method.MethodIdentifier(),
+		)
+	}
+	if err = channel.checkTopicAccessWithError(auth.AccessWrite, ex, method.RoutingKey, method); err != nil {
 		return err
 	}
+	if limitErr := channel.conn.GetVirtualHost().checkMessageLimit(); limitErr != nil {
+		return amqp.NewChannelError(amqp.PreconditionFailed, limitErr.Error(), method.ClassIdentifier(), method.MethodIdentifier())
+	}
 
 	channel.currentMessage = amqp.NewMessage(method)
 	if channel.confirmMode {
@@ -96,6 +119,9 @@ func (channel *Channel) basicCancel(method *amqp.BasicCancel) (err *amqp.Error)
 func (channel *Channel) basicGet(method *amqp.BasicGet) (err *amqp.Error) {
 	var qu *queue.Queue
 	var message *amqp.Message
+	if err = channel.checkAccessWithError(auth.AccessRead, auth.ResourceQueue, method.Queue, method); err != nil {
+		return err
+	}
 	if qu, err = channel.getQueueWithError(method.Queue, method); err != nil {
 		return err
 	}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"sort"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -11,6 +12,7 @@ import (
 	"github.com/sirupsen/logrus"
 	log "github.com/sirupsen/logrus"
 	"github.com/valinurovam/garagemq/amqp"
+	"github.com/valinurovam/garagemq/auth"
 	"github.com/valinurovam/garagemq/consumer"
 	"github.com/valinurovam/garagemq/exchange"
 	"github.com/valinurovam/garagemq/metrics"
@@ -27,6 +29,9 @@ const (
 	channelDelete
 )
 
+// exDefaultAlias is the name of default exchange in permissions patterns
+const exDefaultAlias = "amq.default"
+
 type ChannelMetricsState struct {
 	Publish     *metrics.TrackCounter
 	Confirm     *metrics.TrackCounter
@@ -49,6 +54,7 @@ type Channel struct {
 	outgoing           chan *amqp.Frame
 	logger             *log.Entry
 	status             int
+	acquired           bool
 	protoVersion       string
 	currentMessage     *amqp.Message
 	cmrLock            sync.RWMutex
@@ -70,9 +76,10 @@ type Channel struct {
 
 // UnackedMessage represents the unacknowledged message
 type UnackedMessage struct {
-	cTag  string
-	msg   *amqp.Message
-	queue string
+	cTag        string
+	msg         *amqp.Message
+	queue       string
+	deliveredAt time.Time
 }
 
 // NewChannel returns new instance of Channel
@@ -107,14 +114,29 @@ func NewChannel(id uint16, conn *Connection) *Channel {
 	return channel
 }
 
+// metricLabels returns labels of channel counters
+func (channel *Channel) metricLabels() []metrics.Label {
+	return []metrics.Label{
+		{Name: "connection", Value: strconv.FormatUint(channel.conn.id, 10)},
+		{Name: "channel", Value: strconv.FormatUint(uint64(channel.id), 10)},
+	}
+}
+
+// consumerLabels returns labels of consumer counters
+func (channel *Channel) consumerLabels(cmr *consumer.Consumer) []metrics.Label {
+	labels := []metrics.Label{{Name: "vhost", Value: channel.conn.vhostName}, {Name: "queue", Value: cmr.Queue}}
+	labels = append(labels, channel.metricLabels()...)
+	return append(labels, metrics.Label{Name: "consumer", Value: cmr.Tag()})
+}
+
 func (channel *Channel) initMetrics() {
 	channel.metrics = &ChannelMetricsState{
-		Publish:     metrics.AddCounter(fmt.Sprintf("channel.%d.%d.publish", channel.conn.id, channel.id)),
-		Confirm:     metrics.AddCounter(fmt.Sprintf("channel.%d.%d.confirm", channel.conn.id, channel.id)),
-		Deliver:     metrics.AddCounter(fmt.Sprintf("channel.%d.%d.deliver", channel.conn.id, channel.id)),
-		Get:         metrics.AddCounter(fmt.Sprintf("channel.%d.%d.get", channel.conn.id, channel.id)),
-		Acknowledge: metrics.AddCounter(fmt.Sprintf("channel.%d.%d.acknowledge", channel.conn.id, channel.id)),
-		Unacked:     metrics.AddCounter(fmt.Sprintf("channel.%d.%d.unacked", channel.conn.id, channel.id)),
+		Publish:     metrics.AddCounter("channel.publish", channel.metricLabels()...),
+		Confirm:     metrics.AddCounter("channel.confirm", channel.metricLabels()...),
+		Deliver:     metrics.AddCounter("channel.deliver", channel.metricLabels()...),
+		Get:         metrics.AddCounter("channel.get", channel.metricLabels()...),
+		Acknowledge: metrics.AddCounter("channel.acknowledge", channel.metricLabels()...),
+		Unacked:     metrics.AddGauge("channel.unacked", channel.metricLabels()...),
 	}
 }
 
@@ -154,14 +176,26 @@ func (channel *Channel) handleIncoming() {
 					channel.sendError(amqp.NewConnectionError(amqp.FrameError, err.Error(), 0, 0))
 				}
 
+				// @spec-note
+				// After sending channel.close any method except close or close-ok should be discarded
+				if channel.status == channelClosing && method.ClassIdentifier() != amqp.ClassChannel {
+					continue
+				}
+
 				if err := channel.handleMethod(method); err != nil {
 					channel.sendError(err)
 				}
 			case amqp.FrameHeader:
+				if channel.status == channelClosing {
+					continue
+				}
 				if err := channel.handleContentHeader(frame); err != nil {
 					channel.sendError(err)
 				}
 			case amqp.FrameBody:
+				if channel.status == channelClosing {
+					continue
+				}
 				if err := channel.handleContentBody(frame); err != nil {
 					channel.sendError(err)
 				}
@@ -260,7 +294,8 @@ func (channel *Channel) handleContentBody(bodyFrame *amqp.Frame) *amqp.Error {
 		return nil
 	}
 	ex.GetMetrics().MsgIn.Counter.Inc(1)
-	matchedQueues := ex.GetMatchedQueues(message)
+	ex.GetMetrics().BodySize.Observe(float64(message.BodySize))
+	matchedQueues := vhost.routeMessage(ex, message)
 
 	if len(matchedQueues) == 0 {
 		if message.Mandatory {
@@ -400,6 +435,10 @@ func (channel *Channel) addConsumer(method *amqp.BasicConsume) (cmr *consumer.Co
 	channel.cmrLock.Lock()
 	defer channel.cmrLock.Unlock()
 
+	if err = channel.checkAccessWithError(auth.AccessRead, auth.ResourceQueue, method.Queue, method); err != nil {
+		return nil, err
+	}
+
 	var qu *queue.Queue
 	if qu, err = channel.getQueueWithError(method.Queue, method); err != nil {
 		return nil, err
@@ -418,7 +457,11 @@ func (channel *Channel) addConsumer(method *amqp.BasicConsume) (cmr *consumer.Co
 		return nil, amqp.NewChannelError(amqp.NotAllowed, fmt.Sprintf("Consumer with tag '%s' already exists", cmr.Tag()), method.ClassIdentifier(), method.MethodIdentifier())
 	}
 
+	cmr.SetMetrics(&consumer.MetricsState{
+		AckLatency: metrics.AddHistogram("consumer.ack_latency_seconds", metrics.LatencyBuckets, channel.consumerLabels(cmr)...),
+	})
 	if quErr := qu.AddConsumer(cmr, method.Exclusive); quErr != nil {
+		metrics.RemoveCounters("consumer", channel.consumerLabels(cmr)...)
 		return nil, amqp.NewChannelError(amqp.AccessRefused, quErr.Error(), method.ClassIdentifier(), method.MethodIdentifier())
 	}
 	channel.consumers[cmr.Tag()] = cmr
@@ -432,6 +475,7 @@ func (channel *Channel) removeConsumer(cTag string) {
 	if cmr, ok := channel.consumers[cTag]; ok {
 		cmr.Stop()
 		delete(channel.consumers, cmr.Tag())
+		metrics.RemoveCounters("consumer", channel.consumerLabels(cmr)...)
 	}
 }
 
@@ -445,13 +489,23 @@ func (channel *Channel) close() {
 		}).Info("Consumer stopped")
 	}
 	channel.cmrLock.Unlock()
+	metrics.RemoveCounters("consumer", channel.metricLabels()...)
 	if channel.id > 0 {
 		channel.handleReject(0, true, true, &amqp.BasicNack{})
 	}
+	channel.release()
 	channel.status = channelClosed
 	channel.logger.Info("Channel closed")
 }
 
+// release returns opened channel back into channel limit of connection
+func (channel *Channel) release() {
+	if channel.acquired {
+		channel.conn.releaseChannel()
+		channel.acquired = false
+	}
+}
+
 func (channel *Channel) delete() {
 	channel.closeCh <- true
 	channel.status = channelDelete
@@ -491,9 +545,10 @@ func (channel *Channel) AddUnackedMessage(dTag uint64, cTag string, queue string
 	channel.ackLock.Lock()
 	defer channel.ackLock.Unlock()
 	channel.ackStore[dTag] = &UnackedMessage{
-		cTag:  cTag,
-		msg:   message,
-		queue: queue,
+		cTag:        cTag,
+		msg:         message,
+		queue:       queue,
+		deliveredAt: time.Now(),
 	}
 	channel.metrics.Unacked.Counter.Inc(1)
 }
@@ -533,6 +588,12 @@ func (channel *Channel) ackMsg(unackedMessage *UnackedMessage, deliveryTag uint6
 		channel.metrics.Unacked.Counter.Dec(1)
 	}
 
+	channel.cmrLock.RLock()
+	if cmr, ok := channel.consumers[unackedMessage.cTag]; ok {
+		cmr.GetMetrics().AckLatency.ObserveSince(unackedMessage.deliveredAt)
+	}
+	channel.cmrLock.RUnlock()
+
 	channel.decQosAndConsumerNext(unackedMessage)
 }
 
@@ -580,6 +641,7 @@ func (channel *Channel) rejectMsg(unackedMessage *UnackedMessage, deliveryTag ui
 			qu.Requeue(unackedMessage.msg)
 		} else {
 			qu.AckMsg(unackedMessage.msg)
+			qu.DeadLetter(unackedMessage.msg, queue.ReasonRejected)
 		}
 		channel.metrics.Unacked.Counter.Dec(1)
 	} else {
@@ -649,6 +711,39 @@ func (channel *Channel) checkQueueLockWithError(qu *queue.Queue, method amqp.Met
 	return nil
 }
 
+// checkAccessWithError checks if connection user has given access to vhost resource
+func (channel *Channel) checkAccessWithError(access string, resourceType string, resource string, method amqp.Method) *amqp.Error {
+	conn := channel.conn
+	user, authz := conn.getAuth()
+	if CheckResourceAccess(user, authz, conn.vhostName, resourceType, resource, access) {
+		return nil
+	}
+	return amqp.NewChannelError(
+		amqp.AccessRefused,
+		fmt.Sprintf("%s access to %s '%s' in vhost '%s' refused for user '%s'", access, resourceType, resource, conn.vhostName, conn.userName),
+		method.ClassIdentifier(),
+		method.MethodIdentifier(),
+	)
+}
+
+// checkTopicAccessWithError checks if connection user has given access to routing key of topic exchange
+func (channel *Channel) checkTopicAccessWithError(access string, ex *exchange.Exchange, routingKey string, method amqp.Method) *amqp.Error {
+	conn := channel.conn
+	if ex.ExType() != exchange.ExTypeTopic {
+		return nil
+	}
+	user, authz := conn.getAuth()
+	if authz.CheckTopic(user, conn.vhostName, ex.GetName(), routingKey, access) {
+		return nil
+	}
+	return amqp.NewChannelError(
+		amqp.AccessRefused,
+		fmt.Sprintf("%s access to topic '%s' in exchange '%s' in vhost '%s' refused for user '%s'", access, routingKey, ex.GetName(), conn.vhostName, conn.userName),
+		method.ClassIdentifier(),
+		method.MethodIdentifier(),
+	)
+}
+
 func (channel *Channel) isActive() bool {
 	return channel.active
 }
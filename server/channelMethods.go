@@ -26,6 +26,11 @@ func (channel *Channel) channelOpen(method *amqp.ChannelOpen) (err *amqp.Error)
 		return amqp.NewConnectionError(amqp.ChannelError, "channel already open", method.ClassIdentifier(), method.MethodIdentifier())
 	}
 
+	if err := channel.conn.acquireChannel(); err != nil {
+		return amqp.NewConnectionError(amqp.NotAllowed, err.Error(), method.ClassIdentifier(), method.MethodIdentifier())
+	}
+	channel.acquired = true
+
 	channel.SendMethod(&amqp.ChannelOpenOk{})
 	channel.status = channelOpen
 
@@ -40,6 +45,7 @@ func (channel *Channel) channelClose(method *amqp.ChannelClose) (err *amqp.Error
 }
 
 func (channel *Channel) channelCloseOk(method *amqp.ChannelCloseOk) (err *amqp.Error) {
+	channel.release()
 	channel.status = channelClosed
 	return nil
 }
@@ -4,9 +4,13 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"net"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -14,6 +18,7 @@ import (
 
 	log "github.com/sirupsen/logrus"
 	"github.com/valinurovam/garagemq/amqp"
+	"github.com/valinurovam/garagemq/auth"
 	"github.com/valinurovam/garagemq/metrics"
 	"github.com/valinurovam/garagemq/qos"
 )
@@ -51,7 +56,7 @@ type ConnMetricsState struct {
 type Connection struct {
 	id               uint64
 	server           *Server
-	netConn          *net.TCPConn
+	netConn          net.Conn
 	logger           *log.Entry
 	channelsLock     sync.RWMutex
 	channels         map[uint16]*Channel
@@ -61,6 +66,8 @@ type Connection struct {
 	maxFrameSize     uint32
 	statusLock       sync.RWMutex
 	status           int
+	vhostAcquired    bool
+	openChannels     int64
 	qos              *qos.AmqpQos
 	virtualHost      *VirtualHost
 	vhostName        string
@@ -68,6 +75,12 @@ type Connection struct {
 	srvMetrics       *SrvMetricsState
 	metrics          *ConnMetricsState
 	userName         string
+	authLock         sync.RWMutex
+	user             *auth.User
+	authz            auth.Authorizer
+	expireTimer      *time.Timer
+	mechanisms       []string
+	peerCertificates []*x509.Certificate
 
 	wg        *sync.WaitGroup
 	ctx       context.Context
@@ -81,7 +94,7 @@ type Connection struct {
 }
 
 // NewConnection returns new instance of amqp Connection
-func NewConnection(server *Server, netConn *net.TCPConn) (connection *Connection) {
+func NewConnection(server *Server, netConn net.Conn) (connection *Connection) {
 	connection = &Connection{
 		id:                atomic.AddUint64(&server.connSeq, 1),
 		server:            server,
@@ -107,10 +120,20 @@ func NewConnection(server *Server, netConn *net.TCPConn) (connection *Connection
 	return
 }
 
+// getSaslContext returns connection properties for SASL mechanisms
+func (conn *Connection) getSaslContext() *auth.SaslContext {
+	return &auth.SaslContext{PeerCertificates: conn.GetPeerCertificates()}
+}
+
+// metricLabel returns label of connection counters, channel counters have it too
+func (conn *Connection) metricLabel() metrics.Label {
+	return metrics.Label{Name: "connection", Value: strconv.FormatUint(conn.id, 10)}
+}
+
 func (conn *Connection) initMetrics() {
 	conn.metrics = &ConnMetricsState{
-		TrafficIn:  metrics.AddCounter(fmt.Sprintf("conn.%d.traffic_in", conn.id)),
-		TrafficOut: metrics.AddCounter(fmt.Sprintf("conn.%d.traffic_out", conn.id)),
+		TrafficIn:  metrics.AddCounter("connection.traffic_in", conn.metricLabel()),
+		TrafficOut: metrics.AddCounter("connection.traffic_out", conn.metricLabel()),
 	}
 }
 
@@ -124,8 +147,17 @@ func (conn *Connection) close() {
 	if conn.heartbeatTimer != nil {
 		conn.heartbeatTimer.Stop()
 	}
+	conn.authLock.Lock()
+	if conn.expireTimer != nil {
+		conn.expireTimer.Stop()
+	}
+	conn.authLock.Unlock()
 
 	conn.status = ConnClosed
+	if conn.vhostAcquired {
+		conn.virtualHost.releaseConnection()
+		conn.vhostAcquired = false
+	}
 	conn.statusLock.Unlock()
 
 	// @todo should we chech for errors here? And what should we do if error occur
@@ -151,6 +183,8 @@ func (conn *Connection) close() {
 	}
 	conn.channelsLock.Unlock()
 	conn.clearQueues()
+	metrics.RemoveCounters("connection", conn.metricLabel())
+	metrics.RemoveCounters("channel", conn.metricLabel())
 
 	conn.logger.WithFields(log.Fields{
 		"vhost": conn.vhostName,
@@ -158,7 +192,65 @@ func (conn *Connection) close() {
 	}).Info("Connection closed")
 	conn.server.removeConnection(conn.id)
 
-	conn.closeCh <- true
+	close(conn.closeCh)
+}
+
+// acquireVhost counts connection into connection limit of its virtual host
+// Counted connection is released on close, so it is done under status lock
+func (conn *Connection) acquireVhost() error {
+	conn.statusLock.Lock()
+	defer conn.statusLock.Unlock()
+	if conn.status == ConnClosed {
+		return errors.New("connection is closed")
+	}
+	if err := conn.virtualHost.acquireConnection(); err != nil {
+		return err
+	}
+	conn.vhostAcquired = true
+	return nil
+}
+
+// acquireChannel counts opened channel if channel limit of connection virtual host allows it
+func (conn *Connection) acquireChannel() error {
+	limit := conn.GetVirtualHost().GetLimits().MaxChannels
+	if count := atomic.AddInt64(&conn.openChannels, 1); limit > 0 && uint64(count) > limit {
+		atomic.AddInt64(&conn.openChannels, -1)
+		return fmt.Errorf("channel limit (%d) is reached for vhost '%s'", limit, conn.vhostName)
+	}
+	return nil
+}
+
+func (conn *Connection) releaseChannel() {
+	atomic.AddInt64(&conn.openChannels, -1)
+}
+
+// setUser sets authenticated user with its authorizer
+// Connection is closed when user credentials expire, unless they are updated before
+func (conn *Connection) setUser(user *auth.User, authz auth.Authorizer) {
+	conn.authLock.Lock()
+	defer conn.authLock.Unlock()
+	conn.user = user
+	conn.authz = authz
+
+	if conn.expireTimer != nil {
+		conn.expireTimer.Stop()
+		conn.expireTimer = nil
+	}
+	if expiresAt := user.ExpiresAt(); !expiresAt.IsZero() {
+		conn.expireTimer = time.AfterFunc(time.Until(expiresAt), func() {
+			conn.logger.Info("Connection credentials expired")
+			var wg sync.WaitGroup
+			wg.Add(1)
+			conn.safeClose(&wg, "credentials expired")
+		})
+	}
+}
+
+// getAuth returns authenticated user with its authorizer
+func (conn *Connection) getAuth() (*auth.User, auth.Authorizer) {
+	conn.authLock.RLock()
+	defer conn.authLock.RUnlock()
+	return conn.user, conn.authz
 }
 
 func (conn *Connection) getChannel(id uint16) *Channel {
@@ -168,7 +260,7 @@ func (conn *Connection) getChannel(id uint16) *Channel {
 	return channel
 }
 
-func (conn *Connection) safeClose(wg *sync.WaitGroup) {
+func (conn *Connection) safeClose(wg *sync.WaitGroup, reason string) {
 	defer wg.Done()
 
 	ch := conn.getChannel(0)
@@ -177,7 +269,7 @@ func (conn *Connection) safeClose(wg *sync.WaitGroup) {
 	}
 	ch.SendMethod(&amqp.ConnectionClose{
 		ReplyCode: amqp.ConnectionForced,
-		ReplyText: "Server shutdown",
+		ReplyText: reason,
 		ClassID:   0,
 		MethodID:  0,
 	})
@@ -207,7 +299,28 @@ func (conn *Connection) clearQueues() {
 	}
 }
 
+// handshake completes TLS handshake and keeps verified client certificates
+func (conn *Connection) handshake() error {
+	tlsConn, ok := conn.netConn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	tlsConn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	defer tlsConn.SetDeadline(time.Time{})
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	conn.peerCertificates = tlsConn.ConnectionState().PeerCertificates
+	return nil
+}
+
 func (conn *Connection) handleConnection() {
+	if err := conn.handshake(); err != nil {
+		conn.logger.WithError(err).Error("Error on TLS handshake")
+		conn.close()
+		return
+	}
+
 	buf := make([]byte, 8)
 	_, err := conn.netConn.Read(buf)
 	if err != nil {
@@ -423,6 +536,18 @@ func (conn *Connection) GetRemoteAddr() net.Addr {
 	return conn.netConn.RemoteAddr()
 }
 
+// IsTLS checks if connection is accepted by TLS listener
+func (conn *Connection) IsTLS() bool {
+	_, ok := conn.netConn.(*tls.Conn)
+	return ok
+}
+
+// GetPeerCertificates returns verified client certificates of TLS connection
+// Handshake is completed before AMQP protocol header is read, so certificates are known since connection.start
+func (conn *Connection) GetPeerCertificates() []*x509.Certificate {
+	return conn.peerCertificates
+}
+
 func (conn *Connection) GetChannels() map[uint16]*Channel {
 	return conn.channels
 }
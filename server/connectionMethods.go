@@ -1,8 +1,10 @@
 package server
 
 import (
+	"fmt"
 	"os"
 	"runtime"
+	"strings"
 
 	"github.com/valinurovam/garagemq/amqp"
 	"github.com/valinurovam/garagemq/auth"
@@ -20,6 +22,8 @@ func (channel *Channel) connectionRoute(method amqp.Method) *amqp.Error {
 		return channel.connectionClose(method)
 	case *amqp.ConnectionCloseOk:
 		return channel.connectionCloseOk(method)
+	case *amqp.ConnectionUpdateSecret:
+		return channel.connectionUpdateSecret(method)
 	}
 
 	return amqp.NewConnectionError(amqp.NotImplemented, "unable to route connection method", method.ClassIdentifier(), method.MethodIdentifier())
@@ -49,7 +53,14 @@ func (channel *Channel) connectionStart() {
 		serverProps["host"] = host
 	}
 
-	var method = amqp.ConnectionStart{VersionMajor: 0, VersionMinor: 9, ServerProperties: &serverProps, Mechanisms: []byte("PLAIN"), Locales: []byte("en_US")}
+	channel.conn.mechanisms = auth.AvailableMechanisms(channel.server.getMechanisms(), channel.conn.getSaslContext())
+	var method = amqp.ConnectionStart{
+		VersionMajor:     0,
+		VersionMinor:     9,
+		ServerProperties: &serverProps,
+		Mechanisms:       []byte(strings.Join(channel.conn.mechanisms, " ")),
+		Locales:          []byte("en_US"),
+	}
 	channel.SendMethod(&method)
 
 	channel.conn.status = ConnStart
@@ -58,20 +69,29 @@ func (channel *Channel) connectionStart() {
 func (channel *Channel) connectionStartOk(method *amqp.ConnectionStartOk) *amqp.Error {
 	channel.conn.status = ConnStartOK
 
+	var mechanism auth.Mechanism
+	for _, name := range channel.conn.mechanisms {
+		if name == method.Mechanism {
+			mechanism = auth.GetMechanism(name)
+		}
+	}
+	if mechanism == nil {
+		return amqp.NewConnectionError(amqp.CommandInvalid, "unknown authentication mechanism '"+method.Mechanism+"'", method.ClassIdentifier(), method.MethodIdentifier())
+	}
+
 	var saslData auth.SaslData
 	var err error
-	if saslData, err = auth.ParsePlain(method.Response); err != nil {
+	if saslData, err = mechanism.Parse(method.Response, channel.conn.getSaslContext()); err != nil {
+		channel.logger.WithError(err).Warn("Unable to parse SASL response")
 		return amqp.NewConnectionError(amqp.NotAllowed, "login failure", method.ClassIdentifier(), method.MethodIdentifier())
 	}
 
-	if method.Mechanism != auth.SaslPlain {
-		channel.conn.close()
-	}
-
-	if !channel.server.checkAuth(saslData) {
+	user, authz := channel.server.authenticate(saslData)
+	if user == nil {
 		return amqp.NewConnectionError(amqp.NotAllowed, "login failure", method.ClassIdentifier(), method.MethodIdentifier())
 	}
-	channel.conn.userName = saslData.Username
+	channel.conn.setUser(user, authz)
+	channel.conn.userName = user.Username
 	channel.conn.clientProperties = method.ClientProperties
 
 	// @todo Send HeartBeat 0 cause not supported yet
@@ -109,10 +129,21 @@ func (channel *Channel) connectionTuneOk(method *amqp.ConnectionTuneOk) *amqp.Er
 
 func (channel *Channel) connectionOpen(method *amqp.ConnectionOpen) *amqp.Error {
 	channel.conn.status = ConnOpen
-	var vhostFound bool
-	if channel.conn.virtualHost, vhostFound = channel.server.vhosts[method.VirtualHost]; !vhostFound {
+	if channel.conn.virtualHost = channel.server.getVhost(method.VirtualHost); channel.conn.virtualHost == nil {
 		return amqp.NewConnectionError(amqp.InvalidPath, "virtualHost '"+method.VirtualHost+"' does not exist", method.ClassIdentifier(), method.MethodIdentifier())
 	}
+	if user, authz := channel.conn.getAuth(); !authz.CheckVhost(user, method.VirtualHost) {
+		return amqp.NewConnectionError(
+			amqp.NotAllowed,
+			fmt.Sprintf("access to vhost '%s' refused for user '%s'", method.VirtualHost, channel.conn.userName),
+			method.ClassIdentifier(),
+			method.MethodIdentifier(),
+		)
+	}
+
+	if err := channel.conn.acquireVhost(); err != nil {
+		return amqp.NewConnectionError(amqp.NotAllowed, err.Error(), method.ClassIdentifier(), method.MethodIdentifier())
+	}
 
 	channel.conn.vhostName = method.VirtualHost
 
@@ -133,3 +164,22 @@ func (channel *Channel) connectionCloseOk(method *amqp.ConnectionCloseOk) *amqp.
 	go channel.conn.close()
 	return nil
 }
+
+// connectionUpdateSecret replaces expiring credentials of open connection, e.g. refreshed JWT
+// New secret should authenticate the same user with access to connection vhost
+func (channel *Channel) connectionUpdateSecret(method *amqp.ConnectionUpdateSecret) *amqp.Error {
+	conn := channel.conn
+	if conn.status != ConnOpenOK {
+		return amqp.NewConnectionError(amqp.CommandInvalid, "connection is not open", method.ClassIdentifier(), method.MethodIdentifier())
+	}
+
+	user, authz := channel.server.authenticate(auth.SaslData{Username: conn.userName, Password: string(method.NewSecret)})
+	if user == nil || user.Username != conn.userName || !authz.CheckVhost(user, conn.vhostName) {
+		return amqp.NewConnectionError(amqp.NotAllowed, "new secret is refused", method.ClassIdentifier(), method.MethodIdentifier())
+	}
+	conn.setUser(user, authz)
+
+	channel.logger.WithField("reason", method.Reason).Info("Connection secret updated")
+	channel.SendMethod(&amqp.ConnectionUpdateSecretOk{})
+	return nil
+}
@@ -0,0 +1,637 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/valinurovam/garagemq/amqp"
+	"github.com/valinurovam/garagemq/auth"
+	"github.com/valinurovam/garagemq/binding"
+	"github.com/valinurovam/garagemq/exchange"
+	"github.com/valinurovam/garagemq/policy"
+	"github.com/valinurovam/garagemq/queue"
+)
+
+// hashing algorithms of exported users
+// garagemq md5 and bcrypt hashes are not compatible with RabbitMQ ones, salted SHA hashes are the same
+const (
+	hashingMD5    = "garagemq_md5"
+	hashingBcrypt = "garagemq_bcrypt"
+	hashingSHA256 = "rabbit_password_hashing_sha256"
+	hashingSHA512 = "rabbit_password_hashing_sha512"
+)
+
+// Definitions represents broker topology in RabbitMQ definitions format
+type Definitions struct {
+	ProductName      string                       `json:"product_name,omitempty" yaml:"product_name,omitempty"`
+	Users            []*DefinitionUser            `json:"users" yaml:"users"`
+	Vhosts           []*DefinitionVhost           `json:"vhosts" yaml:"vhosts"`
+	Permissions      []*DefinitionPermission      `json:"permissions" yaml:"permissions"`
+	TopicPermissions []*DefinitionTopicPermission `json:"topic_permissions" yaml:"topic_permissions"`
+	Queues           []*DefinitionQueue           `json:"queues" yaml:"queues"`
+	Exchanges        []*DefinitionExchange        `json:"exchanges" yaml:"exchanges"`
+	Bindings         []*DefinitionBinding         `json:"bindings" yaml:"bindings"`
+	Policies         []*DefinitionPolicy          `json:"policies" yaml:"policies"`
+}
+
+type DefinitionUser struct {
+	Name             string `json:"name" yaml:"name"`
+	PasswordHash     string `json:"password_hash" yaml:"password_hash"`
+	HashingAlgorithm string `json:"hashing_algorithm" yaml:"hashing_algorithm"`
+	Tags             string `json:"tags" yaml:"tags"`
+}
+
+type DefinitionVhost struct {
+	Name string `json:"name" yaml:"name"`
+}
+
+type DefinitionPermission struct {
+	User      string `json:"user" yaml:"user"`
+	Vhost     string `json:"vhost" yaml:"vhost"`
+	Configure string `json:"configure" yaml:"configure"`
+	Write     string `json:"write" yaml:"write"`
+	Read      string `json:"read" yaml:"read"`
+}
+
+type DefinitionTopicPermission struct {
+	User     string `json:"user" yaml:"user"`
+	Vhost    string `json:"vhost" yaml:"vhost"`
+	Exchange string `json:"exchange" yaml:"exchange"`
+	Write    string `json:"write" yaml:"write"`
+	Read     string `json:"read" yaml:"read"`
+}
+
+type DefinitionQueue struct {
+	Name       string                 `json:"name" yaml:"name"`
+	Vhost      string                 `json:"vhost" yaml:"vhost"`
+	Durable    bool                   `json:"durable" yaml:"durable"`
+	AutoDelete bool                   `json:"auto_delete" yaml:"auto_delete"`
+	Arguments  map[string]interface{} `json:"arguments" yaml:"arguments"`
+}
+
+type DefinitionExchange struct {
+	Name       string                 `json:"name" yaml:"name"`
+	Vhost      string                 `json:"vhost" yaml:"vhost"`
+	Type       string                 `json:"type" yaml:"type"`
+	Durable    bool                   `json:"durable" yaml:"durable"`
+	AutoDelete bool                   `json:"auto_delete" yaml:"auto_delete"`
+	Internal   bool                   `json:"internal" yaml:"internal"`
+	Arguments  map[string]interface{} `json:"arguments" yaml:"arguments"`
+}
+
+type DefinitionBinding struct {
+	Source          string                 `json:"source" yaml:"source"`
+	Vhost           string                 `json:"vhost" yaml:"vhost"`
+	Destination     string                 `json:"destination" yaml:"destination"`
+	DestinationType string                 `json:"destination_type" yaml:"destination_type"`
+	RoutingKey      string                 `json:"routing_key" yaml:"routing_key"`
+	Arguments       map[string]interface{} `json:"arguments" yaml:"arguments"`
+}
+
+type DefinitionPolicy struct {
+	Vhost      string                 `json:"vhost" yaml:"vhost"`
+	Name       string                 `json:"name" yaml:"name"`
+	Pattern    string                 `json:"pattern" yaml:"pattern"`
+	ApplyTo    string                 `json:"apply-to" yaml:"apply-to"`
+	Definition map[string]interface{} `json:"definition" yaml:"definition"`
+	Priority   int32                  `json:"priority" yaml:"priority"`
+}
+
+// ExportDefinitions returns durable topology of all vhosts
+func (srv *Server) ExportDefinitions() *Definitions {
+	definitions := &Definitions{
+		ProductName:      "garagemq",
+		Users:            []*DefinitionUser{},
+		Vhosts:           []*DefinitionVhost{},
+		Permissions:      []*DefinitionPermission{},
+		TopicPermissions: []*DefinitionTopicPermission{},
+		Queues:           []*DefinitionQueue{},
+		Exchanges:        []*DefinitionExchange{},
+		Bindings:         []*DefinitionBinding{},
+		Policies:         []*DefinitionPolicy{},
+	}
+
+	for userName, user := range srv.GetUsers() {
+		definitions.Users = append(definitions.Users, &DefinitionUser{
+			Name:             userName,
+			PasswordHash:     user.PasswordHash,
+			HashingAlgorithm: definitionHashingAlgorithm(user.Algorithm),
+			Tags:             strings.Join(user.Tags, ","),
+		})
+	}
+
+	for _, perm := range srv.GetPermissions() {
+		definitions.Permissions = append(definitions.Permissions, &DefinitionPermission{
+			User:      perm.Username,
+			Vhost:     perm.Vhost,
+			Configure: perm.Configure,
+			Write:     perm.Write,
+			Read:      perm.Read,
+		})
+	}
+
+	for _, perm := range srv.GetTopicPermissions() {
+		definitions.TopicPermissions = append(definitions.TopicPermissions, &DefinitionTopicPermission{
+			User:     perm.Username,
+			Vhost:    perm.Vhost,
+			Exchange: perm.Exchange,
+			Write:    perm.Write,
+			Read:     perm.Read,
+		})
+	}
+
+	for _, p := range srv.GetPolicies() {
+		definitions.Policies = append(definitions.Policies, &DefinitionPolicy{
+			Vhost:      p.Vhost,
+			Name:       p.Name,
+			Pattern:    p.Pattern,
+			ApplyTo:    p.ApplyTo,
+			Definition: TableToJSON(p.Definition),
+			Priority:   p.Priority,
+		})
+	}
+
+	for vhostName, vhost := range srv.GetVhosts() {
+		definitions.Vhosts = append(definitions.Vhosts, &DefinitionVhost{Name: vhostName})
+
+		durableQueues := make(map[string]bool)
+		for _, qu := range vhost.GetQueues() {
+			if !qu.IsDurable() {
+				continue
+			}
+			durableQueues[qu.GetName()] = true
+			definitions.Queues = append(definitions.Queues, &DefinitionQueue{
+				Name:       qu.GetName(),
+				Vhost:      vhostName,
+				Durable:    true,
+				AutoDelete: qu.IsAutoDelete(),
+				Arguments:  TableToJSON(qu.GetArguments()),
+			})
+		}
+
+		for _, ex := range vhost.GetExchanges() {
+			if !ex.IsDurable() || ex.GetName() == "" {
+				continue
+			}
+			if !ex.IsSystem() {
+				definitions.Exchanges = append(definitions.Exchanges, &DefinitionExchange{
+					Name:       ex.GetName(),
+					Vhost:      vhostName,
+					Type:       ex.GetTypeAlias(),
+					Durable:    true,
+					AutoDelete: ex.IsAutoDelete(),
+					Internal:   ex.IsInternal(),
+					Arguments:  map[string]interface{}{},
+				})
+			}
+			for _, bind := range ex.GetBindings() {
+				if !durableQueues[bind.GetQueue()] {
+					continue
+				}
+				definitions.Bindings = append(definitions.Bindings, &DefinitionBinding{
+					Source:          ex.GetName(),
+					Vhost:           vhostName,
+					Destination:     bind.GetQueue(),
+					DestinationType: "queue",
+					RoutingKey:      bind.GetRoutingKey(),
+					Arguments:       TableToJSON(bind.Arguments),
+				})
+			}
+		}
+	}
+
+	sortDefinitions(definitions)
+	return definitions
+}
+
+// LoadDefinitionsFile reads definitions from JSON or YAML file
+func LoadDefinitionsFile(path string) (*Definitions, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	definitions := &Definitions{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, definitions)
+	default:
+		err = json.Unmarshal(data, definitions)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bad definitions file %s: %s", path, err.Error())
+	}
+	return definitions, nil
+}
+
+// loadDefinitions applies definitions file from config to guarantee baseline topology
+func (srv *Server) loadDefinitions() error {
+	if srv.config.Definitions == "" {
+		return nil
+	}
+	definitions, err := LoadDefinitionsFile(srv.config.Definitions)
+	if err != nil {
+		return err
+	}
+	warnings, err := srv.ImportDefinitions(definitions)
+	if err != nil {
+		return err
+	}
+	for _, warning := range warnings {
+		log.WithField("file", srv.config.Definitions).Warn(warning)
+	}
+	log.WithField("file", srv.config.Definitions).Info("Definitions loaded")
+	return nil
+}
+
+// ImportDefinitions declares missing vhosts, users, permissions, policies, exchanges, queues and bindings from definitions
+// All definitions are validated and only after that applied, so import is idempotent
+// Existing objects are kept as is, so users changed at runtime are not reset on every start
+// Definitions which are not supported by garagemq are skipped with warning
+// Like restore, import is administrative operation and is not restricted by vhost limits
+func (srv *Server) ImportDefinitions(definitions *Definitions) (warnings []string, err error) {
+	warnings = []string{}
+	vhosts := make(map[string]bool)
+	for vhostName := range srv.GetVhosts() {
+		vhosts[vhostName] = true
+	}
+	for _, vhost := range definitions.Vhosts {
+		if err := srv.ValidateVhostName(vhost.Name); err != nil {
+			return nil, err
+		}
+		vhosts[vhost.Name] = true
+	}
+
+	var users []*auth.User
+	userNames := make(map[string]bool)
+	for userName := range srv.GetUsers() {
+		userNames[userName] = true
+	}
+	for _, user := range definitions.Users {
+		if userNames[user.Name] {
+			continue
+		}
+		var algorithm string
+		switch user.HashingAlgorithm {
+		case hashingMD5:
+			algorithm = auth.HashMD5
+		case hashingBcrypt:
+			algorithm = auth.HashBcrypt
+		case hashingSHA256:
+			algorithm = auth.HashSHA256
+		case hashingSHA512:
+			algorithm = auth.HashSHA512
+		default:
+			warnings = append(warnings, fmt.Sprintf("user '%s' skipped: unsupported hashing algorithm '%s'", user.Name, user.HashingAlgorithm))
+			continue
+		}
+		users = append(users, &auth.User{
+			Username:     user.Name,
+			PasswordHash: user.PasswordHash,
+			Algorithm:    algorithm,
+			Tags:         parseDefinitionTags(user.Tags),
+		})
+		userNames[user.Name] = true
+	}
+
+	var permissions []*auth.Permission
+	for _, def := range definitions.Permissions {
+		if srv.getPermission(def.User, def.Vhost) != nil {
+			continue
+		}
+		if !vhosts[def.Vhost] {
+			return nil, fmt.Errorf("permission of user '%s' refers to unknown vhost '%s'", def.User, def.Vhost)
+		}
+		if !userNames[def.User] {
+			warnings = append(warnings, fmt.Sprintf("permission of user '%s' on vhost '%s' skipped: unknown user", def.User, def.Vhost))
+			continue
+		}
+		perm, err := auth.NewPermission(def.User, def.Vhost, def.Configure, def.Write, def.Read)
+		if err != nil {
+			return nil, fmt.Errorf("bad permission of user '%s' on vhost '%s': %s", def.User, def.Vhost, err.Error())
+		}
+		permissions = append(permissions, perm)
+	}
+
+	var topicPermissions []*auth.TopicPermission
+	existingTopicPerms := make(map[string]bool)
+	for _, perm := range srv.GetTopicPermissions() {
+		existingTopicPerms[perm.Username+"/"+perm.Vhost+"/"+perm.Exchange] = true
+	}
+	for _, def := range definitions.TopicPermissions {
+		if existingTopicPerms[def.User+"/"+def.Vhost+"/"+def.Exchange] {
+			continue
+		}
+		if !vhosts[def.Vhost] {
+			return nil, fmt.Errorf("topic permission of user '%s' refers to unknown vhost '%s'", def.User, def.Vhost)
+		}
+		if !userNames[def.User] {
+			warnings = append(warnings, fmt.Sprintf("topic permission of user '%s' on exchange '%s' skipped: unknown user", def.User, def.Exchange))
+			continue
+		}
+		perm, err := auth.NewTopicPermission(def.User, def.Vhost, def.Exchange, def.Write, def.Read)
+		if err != nil {
+			return nil, fmt.Errorf("bad topic permission of user '%s' on exchange '%s': %s", def.User, def.Exchange, err.Error())
+		}
+		topicPermissions = append(topicPermissions, perm)
+	}
+
+	var policies []*policy.Policy
+	existingPolicies := make(map[string]bool)
+	for _, p := range srv.GetPolicies() {
+		existingPolicies[p.Vhost+"/"+p.Name] = true
+	}
+policies:
+	for _, def := range definitions.Policies {
+		if existingPolicies[def.Vhost+"/"+def.Name] {
+			continue
+		}
+		if !vhosts[def.Vhost] {
+			return nil, fmt.Errorf("policy '%s' refers to unknown vhost '%s'", def.Name, def.Vhost)
+		}
+		for key := range def.Definition {
+			if !policy.IsSupportedKey(key) {
+				warnings = append(warnings, fmt.Sprintf("policy '%s' on vhost '%s' skipped: unsupported key '%s'", def.Name, def.Vhost, key))
+				continue policies
+			}
+		}
+		p, err := policy.NewPolicy(def.Vhost, def.Name, def.Pattern, def.ApplyTo, def.Priority, TableFromJSON(def.Definition))
+		if err != nil {
+			return nil, fmt.Errorf("bad policy '%s' on vhost '%s': %s", def.Name, def.Vhost, err.Error())
+		}
+		policies = append(policies, p)
+	}
+
+	var exchanges []*exchange.Exchange
+	exchangeVhosts := make(map[*exchange.Exchange]string)
+	exchangeTypes := make(map[string]string)
+	for _, def := range definitions.Exchanges {
+		if !vhosts[def.Vhost] {
+			return nil, fmt.Errorf("exchange '%s' refers to unknown vhost '%s'", def.Name, def.Vhost)
+		}
+		exType, err := exchange.GetExchangeTypeID(def.Type)
+		if err != nil {
+			return nil, err
+		}
+		ex := exchange.NewExchange(def.Name, exType, def.Durable, def.AutoDelete, def.Internal, false)
+		if current := srv.getDefinitionExchange(def.Vhost, def.Name); current != nil {
+			if current.IsSystem() {
+				continue
+			}
+			if err := current.EqualWithErr(ex); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if def.Name == "" || strings.HasPrefix(def.Name, "amq.") {
+			warnings = append(warnings, fmt.Sprintf("exchange '%s' skipped: reserved name", def.Name))
+			continue
+		}
+		exchanges = append(exchanges, ex)
+		exchangeVhosts[ex] = def.Vhost
+		exchangeTypes[def.Vhost+"/"+def.Name] = def.Type
+	}
+
+	var queues []*DefinitionQueue
+	queueNames := make(map[string]bool)
+	for _, def := range definitions.Queues {
+		if !vhosts[def.Vhost] {
+			return nil, fmt.Errorf("queue '%s' refers to unknown vhost '%s'", def.Name, def.Vhost)
+		}
+		if def.Name == "" {
+			return nil, fmt.Errorf("queue name is required")
+		}
+		if queueNames[def.Vhost+"/"+def.Name] {
+			continue
+		}
+		queueNames[def.Vhost+"/"+def.Name] = true
+		if current := srv.getDefinitionQueue(def.Vhost, def.Name); current != nil {
+			if current.IsDurable() != def.Durable || current.IsAutoDelete() != def.AutoDelete {
+				return nil, fmt.Errorf("queue '%s' already exists with other params", def.Name)
+			}
+			continue
+		}
+		queues = append(queues, def)
+	}
+
+	var bindings []*binding.Binding
+	bindingVhosts := make(map[*binding.Binding]string)
+	for _, def := range definitions.Bindings {
+		if def.DestinationType != "queue" {
+			warnings = append(warnings, fmt.Sprintf("binding '%s' -> '%s' skipped: only queue destination is supported", def.Source, def.Destination))
+			continue
+		}
+		if def.Source == "" {
+			continue
+		}
+		exType, ok := exchangeTypes[def.Vhost+"/"+def.Source]
+		if current := srv.getDefinitionExchange(def.Vhost, def.Source); current != nil {
+			exType, ok = current.GetTypeAlias(), true
+		}
+		if !ok {
+			return nil, fmt.Errorf("binding refers to unknown exchange '%s'", def.Source)
+		}
+		if !queueNames[def.Vhost+"/"+def.Destination] && srv.getDefinitionQueue(def.Vhost, def.Destination) == nil {
+			return nil, fmt.Errorf("binding refers to unknown queue '%s'", def.Destination)
+		}
+		bind, err := binding.NewBinding(def.Destination, def.Source, def.RoutingKey, TableFromJSON(def.Arguments), exType == "topic")
+		if err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, bind)
+		bindingVhosts[bind] = def.Vhost
+	}
+
+	for vhostName := range vhosts {
+		srv.addVhost(vhostName)
+	}
+	for _, user := range users {
+		if err := srv.AddUser(user); err != nil {
+			return nil, err
+		}
+	}
+	for _, perm := range permissions {
+		if err := srv.SetPermission(perm); err != nil {
+			return nil, err
+		}
+	}
+	for _, perm := range topicPermissions {
+		if err := srv.SetTopicPermission(perm); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range policies {
+		if err := srv.SetPolicy(p); err != nil {
+			return nil, err
+		}
+	}
+	for _, ex := range exchanges {
+		srv.GetVhost(exchangeVhosts[ex]).AppendExchange(ex)
+	}
+	for _, def := range queues {
+		vhost := srv.GetVhost(def.Vhost)
+		qu := vhost.NewQueue(def.Name, 0, false, def.AutoDelete, def.Durable, srv.config.Queue.ShardSize)
+		qu.SetArguments(TableFromJSON(def.Arguments))
+		qu.Start()
+		if err := vhost.AppendQueue(qu); err != nil {
+			return nil, err
+		}
+	}
+	for _, bind := range bindings {
+		vhost := srv.GetVhost(bindingVhosts[bind])
+		ex := vhost.GetExchange(bind.GetExchange())
+		ex.AppendBinding(bind)
+		if ex.IsDurable() && vhost.GetQueue(bind.GetQueue()).IsDurable() {
+			vhost.PersistBinding(bind)
+		}
+	}
+
+	return warnings, nil
+}
+
+// parseDefinitionTags splits comma separated user tags
+func parseDefinitionTags(tags string) []string {
+	var result []string
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// definitionHashingAlgorithm returns definitions name of password hashing algorithm
+func definitionHashingAlgorithm(algorithm string) string {
+	switch algorithm {
+	case auth.HashMD5:
+		return hashingMD5
+	case auth.HashSHA256:
+		return hashingSHA256
+	case auth.HashSHA512:
+		return hashingSHA512
+	}
+	return hashingBcrypt
+}
+
+func (srv *Server) getDefinitionExchange(vhostName string, name string) *exchange.Exchange {
+	if vhost := srv.GetVhost(vhostName); vhost != nil {
+		return vhost.GetExchange(name)
+	}
+	return nil
+}
+
+func (srv *Server) getDefinitionQueue(vhostName string, name string) *queue.Queue {
+	if vhost := srv.GetVhost(vhostName); vhost != nil {
+		return vhost.GetQueue(name)
+	}
+	return nil
+}
+
+func sortDefinitions(definitions *Definitions) {
+	sort.Slice(definitions.Users, func(i, j int) bool {
+		return definitions.Users[i].Name < definitions.Users[j].Name
+	})
+	sort.Slice(definitions.Vhosts, func(i, j int) bool {
+		return definitions.Vhosts[i].Name < definitions.Vhosts[j].Name
+	})
+	sort.Slice(definitions.Permissions, func(i, j int) bool {
+		a, b := definitions.Permissions[i], definitions.Permissions[j]
+		return a.Vhost+"/"+a.User < b.Vhost+"/"+b.User
+	})
+	sort.Slice(definitions.TopicPermissions, func(i, j int) bool {
+		a, b := definitions.TopicPermissions[i], definitions.TopicPermissions[j]
+		return a.Vhost+"/"+a.User+"/"+a.Exchange < b.Vhost+"/"+b.User+"/"+b.Exchange
+	})
+	sort.Slice(definitions.Queues, func(i, j int) bool {
+		a, b := definitions.Queues[i], definitions.Queues[j]
+		return a.Vhost+"/"+a.Name < b.Vhost+"/"+b.Name
+	})
+	sort.Slice(definitions.Exchanges, func(i, j int) bool {
+		a, b := definitions.Exchanges[i], definitions.Exchanges[j]
+		return a.Vhost+"/"+a.Name < b.Vhost+"/"+b.Name
+	})
+	sort.Slice(definitions.Bindings, func(i, j int) bool {
+		a, b := definitions.Bindings[i], definitions.Bindings[j]
+		return strings.Join([]string{a.Vhost, a.Source, a.Destination, a.RoutingKey}, "/") <
+			strings.Join([]string{b.Vhost, b.Source, b.Destination, b.RoutingKey}, "/")
+	})
+	sort.Slice(definitions.Policies, func(i, j int) bool {
+		a, b := definitions.Policies[i], definitions.Policies[j]
+		return a.Vhost+"/"+a.Name < b.Vhost+"/"+b.Name
+	})
+}
+
+// TableToJSON converts amqp table into value encodable into json
+func TableToJSON(table *amqp.Table) map[string]interface{} {
+	result := make(map[string]interface{})
+	if table == nil {
+		return result
+	}
+	for key, value := range *table {
+		result[key] = valueToJSON(value)
+	}
+	return result
+}
+
+func valueToJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case amqp.Table:
+		return TableToJSON(&v)
+	case *amqp.Table:
+		return TableToJSON(v)
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = valueToJSON(item)
+		}
+		return result
+	}
+	return value
+}
+
+// TableFromJSON converts decoded json object into amqp table
+// json numbers without fraction become integers, as RabbitMQ does for x-message-ttl and so on
+func TableFromJSON(data map[string]interface{}) *amqp.Table {
+	table := amqp.Table{}
+	for key, value := range data {
+		table[key] = valueFromJSON(value)
+	}
+	return &table
+}
+
+func valueFromJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < math.MaxInt64 {
+			return int64(v)
+		}
+	case int:
+		return int64(v)
+	case map[string]interface{}:
+		return *TableFromJSON(v)
+	case map[interface{}]interface{}:
+		// yaml decodes nested objects with interface keys
+		table := amqp.Table{}
+		for key, item := range v {
+			table[fmt.Sprint(key)] = valueFromJSON(item)
+		}
+		return table
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = valueFromJSON(item)
+		}
+		return result
+	}
+	return value
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	amqpclient "github.com/streadway/amqp"
+	"github.com/valinurovam/garagemq/amqp"
+	"github.com/valinurovam/garagemq/auth"
+	"github.com/valinurovam/garagemq/policy"
+)
+
+const testDefinitionsYAML = `
+vhosts:
+  - name: prod
+exchanges:
+  - name: dlx
+    vhost: prod
+    type: fanout
+    durable: true
+queues:
+  - name: orders
+    vhost: prod
+    durable: true
+    arguments:
+      x-message-ttl: 60000
+      x-dead-letter-exchange: dlx
+  - name: dead
+    vhost: prod
+    durable: true
+bindings:
+  - source: dlx
+    vhost: prod
+    destination: dead
+    destination_type: queue
+    routing_key: ""
+policies:
+  - vhost: prod
+    name: orders
+    pattern: ^orders$
+    apply-to: queues
+    definition:
+      max-length: 1000
+    priority: 1
+  - vhost: prod
+    name: ha
+    pattern: .*
+    definition:
+      ha-mode: all
+`
+
+func TestServer_LoadDefinitions(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+
+	dir, _ := ioutil.TempDir("", "definitions_test")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "definitions.yaml")
+	ioutil.WriteFile(path, []byte(testDefinitionsYAML), 0644)
+	sc.server.config.Definitions = path
+
+	// definitions should be applied idempotently on every start
+	for i := 0; i < 2; i++ {
+		if err := sc.server.loadDefinitions(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	vhost := sc.server.GetVhost("prod")
+	if vhost == nil {
+		t.Fatal("Expected vhost declared")
+	}
+	orders := vhost.GetQueue("orders")
+	if orders == nil || !orders.IsDurable() {
+		t.Fatal("Expected durable queue declared")
+	}
+	if ttl := (*orders.GetArguments())["x-message-ttl"]; ttl != int64(60000) {
+		t.Errorf("Expected queue arguments, actual %v", ttl)
+	}
+	ex := vhost.GetExchange("dlx")
+	if ex == nil {
+		t.Fatal("Expected exchange declared")
+	}
+	if len(ex.GetBindings()) != 1 {
+		t.Errorf("Expected 1 binding, actual %d", len(ex.GetBindings()))
+	}
+	if len(sc.server.storage.GetVhostBindings("prod")) != 1 {
+		t.Error("Expected binding persisted")
+	}
+	// policy with unsupported key is skipped
+	if policies := sc.server.GetPolicies(); len(policies) != 1 || policies[0].Name != "orders" {
+		t.Fatalf("Expected only supported policy imported, actual %v", policies)
+	}
+	if settings := orders.GetSettings(); settings.Policy != "orders" || settings.MaxLength != 1000 {
+		t.Errorf("Expected policy applied to queue, actual %+v", settings)
+	}
+
+	definitions := sc.server.ExportDefinitions()
+	if len(definitions.Policies) != 1 || definitions.Policies[0].ApplyTo != "queues" || definitions.Policies[0].Priority != 1 {
+		t.Errorf("Unexpected exported policies %v", definitions.Policies)
+	}
+}
+
+func TestServer_ImportDefinitions_Invalid(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+
+	definitions := &Definitions{
+		Queues: []*DefinitionQueue{{Name: "q1", Vhost: "/", Durable: true}},
+		Bindings: []*DefinitionBinding{
+			{Source: "unknown", Vhost: "/", Destination: "q1", DestinationType: "queue"},
+		},
+	}
+	if _, err := sc.server.ImportDefinitions(definitions); err == nil {
+		t.Fatal("Expected error on binding to unknown exchange")
+	}
+	if sc.server.GetVhost("/").GetQueue("q1") != nil {
+		t.Error("Expected nothing is declared from invalid definitions")
+	}
+}
+
+func TestServer_ExportDefinitions(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	ch, _ := sc.client.Channel()
+
+	ch.ExchangeDeclare("testEx", "topic", true, false, false, false, emptyTable)
+	ch.QueueDeclare("testQu", true, false, false, false, map[string]interface{}{"x-max-length": int32(10)})
+	ch.QueueBind("testQu", "key.*", "testEx", false, emptyTable)
+
+	data, _ := json.Marshal(sc.server.ExportDefinitions())
+	definitions := &Definitions{}
+	if err := json.Unmarshal(data, definitions); err != nil {
+		t.Fatal(err)
+	}
+	if len(definitions.Exchanges) != 1 || definitions.Exchanges[0].Type != "topic" {
+		t.Errorf("Unexpected exchanges %v", definitions.Exchanges)
+	}
+	if len(definitions.Queues) != 1 || definitions.Queues[0].Arguments["x-max-length"] != float64(10) {
+		t.Errorf("Unexpected queues %v", definitions.Queues)
+	}
+	if len(definitions.Bindings) != 1 || definitions.Bindings[0].RoutingKey != "key.*" {
+		t.Errorf("Unexpected bindings %v", definitions.Bindings)
+	}
+
+	definitions.Vhosts = append(definitions.Vhosts, &DefinitionVhost{Name: "copy"})
+	for _, item := range definitions.Exchanges {
+		item.Vhost = "copy"
+	}
+	for _, item := range definitions.Queues {
+		item.Vhost = "copy"
+	}
+	for _, item := range definitions.Bindings {
+		item.Vhost = "copy"
+	}
+	if _, err := sc.server.ImportDefinitions(definitions); err != nil {
+		t.Fatal(err)
+	}
+	ex := sc.server.GetVhost("copy").GetExchange("testEx")
+	if ex == nil || len(ex.GetMatchedQueues(&amqp.Message{Exchange: "testEx", RoutingKey: "key.a"})) != 1 {
+		t.Error("Expected topology imported into other vhost")
+	}
+}
+
+func TestServer_ImportDefinitions_RabbitUsers(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+
+	definitions := &Definitions{
+		Users: []*DefinitionUser{
+			// hash of "test12" from RabbitMQ documentation
+			{Name: "rabbit", PasswordHash: "kI3GCqW5JLMJa4iX1lo7X4D6XbYqlLgxIs30+P6tENUV2POR", HashingAlgorithm: "rabbit_password_hashing_sha256"},
+			{Name: "legacy", PasswordHash: "hash", HashingAlgorithm: "rabbit_password_hashing_md5"},
+		},
+		Permissions: []*DefinitionPermission{{User: "rabbit", Vhost: "/", Configure: ".*", Write: ".*", Read: ".*"}},
+	}
+	warnings, err := sc.server.ImportDefinitions(definitions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("Expected warning on unsupported algorithm, actual %v", warnings)
+	}
+
+	client, err := sc.dial(amqpclient.Config{SASL: []amqpclient.Authentication{&amqpclient.PlainAuth{Username: "rabbit", Password: "test12"}}})
+	if err != nil {
+		t.Fatalf("Expected imported user connected, actual %v", err)
+	}
+	client.Close()
+
+	for _, user := range sc.server.ExportDefinitions().Users {
+		if user.Name == "rabbit" && (user.HashingAlgorithm != "rabbit_password_hashing_sha256" || user.PasswordHash != definitions.Users[0].PasswordHash) {
+			t.Errorf("Expected user exported as is, actual %+v", user)
+		}
+	}
+}
+
+func TestServer_ImportDefinitions_KeepsExisting(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+
+	definitions := &Definitions{
+		Users: []*DefinitionUser{
+			// hash of "test12" from RabbitMQ documentation
+			{Name: "rabbit", PasswordHash: "kI3GCqW5JLMJa4iX1lo7X4D6XbYqlLgxIs30+P6tENUV2POR", HashingAlgorithm: "rabbit_password_hashing_sha256", Tags: "management"},
+		},
+		Permissions:      []*DefinitionPermission{{User: "rabbit", Vhost: "/", Configure: ".*", Write: ".*", Read: ".*"}},
+		TopicPermissions: []*DefinitionTopicPermission{{User: "rabbit", Vhost: "/", Exchange: "amq.topic", Write: ".*", Read: ".*"}},
+		Policies:         []*DefinitionPolicy{{Vhost: "/", Name: "limits", Pattern: ".*", Definition: map[string]interface{}{"max-length": 10}}},
+	}
+	if _, err := sc.server.ImportDefinitions(definitions); err != nil {
+		t.Fatal(err)
+	}
+
+	// change imported objects at runtime, next import should not reset them
+	user := *sc.server.GetUsers()["rabbit"]
+	user.Tags = []string{"administrator"}
+	if err := sc.server.AddUser(&user); err != nil {
+		t.Fatal(err)
+	}
+	perm, _ := auth.NewPermission("rabbit", "/", "^rabbit", "^rabbit", "^rabbit")
+	sc.server.SetPermission(perm)
+	topicPerm, _ := auth.NewTopicPermission("rabbit", "/", "amq.topic", "^rabbit", "^rabbit")
+	sc.server.SetTopicPermission(topicPerm)
+	p, _ := policy.NewPolicy("/", "limits", ".*", "", 0, &amqp.Table{"max-length": int32(20)})
+	sc.server.SetPolicy(p)
+
+	if _, err := sc.server.ImportDefinitions(definitions); err != nil {
+		t.Fatal(err)
+	}
+	if tags := sc.server.GetUsers()["rabbit"].Tags; len(tags) != 1 || tags[0] != "administrator" {
+		t.Errorf("Expected user tags kept, actual %v", tags)
+	}
+	if perm := sc.server.getPermission("rabbit", "/"); perm.Configure != "^rabbit" {
+		t.Errorf("Expected permission kept, actual %+v", perm)
+	}
+	if perms := sc.server.GetTopicPermissions(); len(perms) != 1 || perms[0].Write != "^rabbit" {
+		t.Errorf("Expected topic permission kept, actual %v", perms)
+	}
+	if policies := sc.server.GetPolicies(); len(policies) != 1 || (*policies[0].Definition)["max-length"] != int32(20) {
+		t.Errorf("Expected policy kept, actual %v", policies)
+	}
+}
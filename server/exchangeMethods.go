@@ -3,6 +3,7 @@ package server
 import (
 	"fmt"
 	"github.com/valinurovam/garagemq/amqp"
+	"github.com/valinurovam/garagemq/auth"
 	"github.com/valinurovam/garagemq/exchange"
 	"strings"
 )
@@ -53,6 +54,10 @@ func (channel *Channel) exchangeDeclare(method *amqp.ExchangeDeclare) *amqp.Erro
 		return nil
 	}
 
+	if err := channel.checkAccessWithError(auth.AccessConfigure, auth.ResourceExchange, method.Exchange, method); err != nil {
+		return err
+	}
+
 	if strings.HasPrefix(method.Exchange, "amq.") {
 		return amqp.NewChannelError(
 			amqp.AccessRefused,
@@ -71,6 +76,19 @@ func (channel *Channel) exchangeDeclare(method *amqp.ExchangeDeclare) *amqp.Erro
 		false,
 	)
 
+	if existingExchange == nil {
+		var err error
+		if existingExchange, err = channel.conn.GetVirtualHost().declareExchange(newExchange); err != nil {
+			return amqp.NewChannelError(
+				amqp.PreconditionFailed,
+				err.Error(),
+				method.ClassIdentifier(),
+				method.MethodIdentifier(),
+			)
+		}
+	}
+
+	// exchange could exist before or be declared concurrently
 	if existingExchange != nil {
 		if err := existingExchange.EqualWithErr(newExchange); err != nil {
 			return amqp.NewChannelError(
@@ -80,11 +98,8 @@ func (channel *Channel) exchangeDeclare(method *amqp.ExchangeDeclare) *amqp.Erro
 				method.MethodIdentifier(),
 			)
 		}
-		channel.SendMethod(&amqp.ExchangeDeclareOk{})
-		return nil
 	}
 
-	channel.conn.GetVirtualHost().AppendExchange(newExchange)
 	if !method.NoWait {
 		channel.SendMethod(&amqp.ExchangeDeclareOk{})
 	}
@@ -93,5 +108,39 @@ func (channel *Channel) exchangeDeclare(method *amqp.ExchangeDeclare) *amqp.Erro
 }
 
 func (channel *Channel) exchangeDelete(method *amqp.ExchangeDelete) *amqp.Error {
+	if err := channel.checkAccessWithError(auth.AccessConfigure, auth.ResourceExchange, method.Exchange, method); err != nil {
+		return err
+	}
+
+	err := channel.conn.GetVirtualHost().DeleteExchange(method.Exchange, method.IfUnused)
+	switch err {
+	case nil:
+	case ErrNotFound:
+		return amqp.NewChannelError(
+			amqp.NotFound,
+			fmt.Sprintf("exchange '%s' not found", method.Exchange),
+			method.ClassIdentifier(),
+			method.MethodIdentifier(),
+		)
+	case ErrAccessRefused:
+		return amqp.NewChannelError(
+			amqp.AccessRefused,
+			fmt.Sprintf("operation not permitted on system exchange '%s'", method.Exchange),
+			method.ClassIdentifier(),
+			method.MethodIdentifier(),
+		)
+	default:
+		return amqp.NewChannelError(
+			amqp.PreconditionFailed,
+			err.Error(),
+			method.ClassIdentifier(),
+			method.MethodIdentifier(),
+		)
+	}
+
+	if !method.NoWait {
+		channel.SendMethod(&amqp.ExchangeDeleteOk{})
+	}
+
 	return nil
 }
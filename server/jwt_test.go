@@ -0,0 +1,179 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	amqpclient "github.com/streadway/amqp"
+	"github.com/valinurovam/garagemq/amqp"
+	"github.com/valinurovam/garagemq/config"
+)
+
+const testJWTSecret = "secret"
+
+func signTestToken(subject string, expiresIn time.Duration, scope string) string {
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	payload, _ := json.Marshal(map[string]interface{}{
+		"sub":   subject,
+		"aud":   "garagemq",
+		"exp":   time.Now().Add(expiresIn).Unix(),
+		"scope": scope,
+	})
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(testJWTSecret))
+	mac.Write([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func getJWTServerClient(t *testing.T) *ServerClient {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	sc.server.config.Auth = config.Auth{
+		Backends: []config.AuthBackend{{Authn: "jwt"}, {Authn: "internal"}},
+		JWT:      config.JWTAuth{ResourceServerID: "garagemq", HMACKey: testJWTSecret},
+	}
+	if err := sc.server.initAuthBackends(); err != nil {
+		t.Fatal(err)
+	}
+	return sc
+}
+
+// rawClient speaks AMQP frames directly to test methods which are not supported by client library
+type rawClient struct {
+	conn net.Conn
+}
+
+func (client *rawClient) send(method amqp.Method) error {
+	buf := bytes.NewBuffer(nil)
+	if err := amqp.WriteMethod(buf, method, proto); err != nil {
+		return err
+	}
+	return amqp.WriteFrame(client.conn, &amqp.Frame{Type: byte(amqp.FrameMethod), Payload: buf.Bytes()})
+}
+
+func (client *rawClient) receive() (amqp.Method, error) {
+	client.conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		frame, err := amqp.ReadFrame(client.conn)
+		if err != nil {
+			return nil, err
+		}
+		if frame.Type == byte(amqp.FrameMethod) {
+			return amqp.ReadMethod(bytes.NewReader(frame.Payload), proto)
+		}
+	}
+}
+
+func (sc *ServerClient) dialRaw(t *testing.T, username string, password string) *rawClient {
+	toServer, _, fromClient, _, err := networkSim()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc.server.acceptConnection(fromClient)
+	client := &rawClient{conn: toServer}
+	toServer.Write(amqp.AmqpHeader)
+	client.receive()
+	client.send(&amqp.ConnectionStartOk{
+		ClientProperties: &amqp.Table{},
+		Mechanism:        "PLAIN",
+		Response:         []byte("\x00" + username + "\x00" + password),
+		Locale:           "en_US",
+	})
+	tune, _ := client.receive()
+	client.send(&amqp.ConnectionTuneOk{ChannelMax: tune.(*amqp.ConnectionTune).ChannelMax, FrameMax: tune.(*amqp.ConnectionTune).FrameMax})
+	client.send(&amqp.ConnectionOpen{VirtualHost: "/"})
+	if method, err := client.receive(); err != nil {
+		t.Fatal(err)
+	} else if _, ok := method.(*amqp.ConnectionOpenOk); !ok {
+		t.Fatalf("Expected connection open, actual %s", method.Name())
+	}
+	return client
+}
+
+func TestServer_JWT_Permissions(t *testing.T) {
+	sc := getJWTServerClient(t)
+	defer sc.clean()
+
+	token := signTestToken("jwtuser", time.Hour, "garagemq.configure:%2F/jwt.* garagemq.write:%2F/jwt.* garagemq.write:%2F/amq.topic/jwt.* garagemq.read:%2F/*")
+	client, err := sc.dial(amqpclient.Config{SASL: []amqpclient.Authentication{&amqpclient.PlainAuth{Password: token}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ch, _ := client.Channel()
+	if _, err := ch.QueueDeclare("jwt.queue", false, false, false, false, emptyTable); err != nil {
+		t.Errorf("Expected queue declared, actual %v", err)
+	}
+	if err := ch.QueueBind("jwt.queue", "jwt.key", "amq.topic", false, emptyTable); err != nil {
+		t.Errorf("Expected queue bound, actual %v", err)
+	}
+	_, err = ch.QueueDeclare("queue", false, false, false, false, emptyTable)
+	if err == nil || err.(*amqpclient.Error).Code != amqp.AccessRefused {
+		t.Errorf("Expected AccessRefused error, actual %v", err)
+	}
+
+	// internal users are still accepted by the next backend in chain
+	internalClient, err := sc.dial(amqpclient.Config{SASL: []amqpclient.Authentication{&amqpclient.PlainAuth{Username: "guest", Password: "guest"}}})
+	if err != nil {
+		t.Fatalf("Expected internal user connected, actual %v", err)
+	}
+	internalClient.Close()
+
+	if _, err := sc.dial(amqpclient.Config{SASL: []amqpclient.Authentication{&amqpclient.PlainAuth{Password: signTestToken("jwtuser", -time.Minute, "garagemq.read:*/*")}}}); err == nil {
+		t.Error("Expected expired token refused")
+	}
+	if _, err := sc.dial(amqpclient.Config{SASL: []amqpclient.Authentication{&amqpclient.PlainAuth{Password: signTestToken("jwtuser", time.Hour, "garagemq.read:other/*")}}}); err != amqpclient.ErrVhost {
+		t.Errorf("Expected vhost access refused, actual %v", err)
+	}
+}
+
+func TestServer_JWT_UpdateSecret(t *testing.T) {
+	sc := getJWTServerClient(t)
+	defer sc.clean()
+
+	client := sc.dialRaw(t, "", signTestToken("jwtuser", 2*time.Second, "garagemq.read:*/*"))
+	defer client.conn.Close()
+
+	client.send(&amqp.ConnectionUpdateSecret{NewSecret: []byte(signTestToken("jwtuser", time.Hour, "garagemq.read:*/*")), Reason: "refresh"})
+	if method, err := client.receive(); err != nil {
+		t.Fatal(err)
+	} else if _, ok := method.(*amqp.ConnectionUpdateSecretOk); !ok {
+		t.Fatalf("Expected secret updated, actual %s", method.Name())
+	}
+
+	// connection is not closed when the first token expires
+	time.Sleep(2500 * time.Millisecond)
+	client.send(&amqp.ConnectionUpdateSecret{NewSecret: []byte(signTestToken("other", time.Hour, "garagemq.read:*/*")), Reason: "refresh"})
+	method, err := client.receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if closeMethod, ok := method.(*amqp.ConnectionClose); !ok || closeMethod.ReplyCode != amqp.NotAllowed {
+		t.Errorf("Expected connection closed on token of other user, actual %s", method.Name())
+	}
+	client.send(&amqp.ConnectionCloseOk{})
+}
+
+func TestServer_JWT_Expiration(t *testing.T) {
+	sc := getJWTServerClient(t)
+	defer sc.clean()
+
+	client := sc.dialRaw(t, "", signTestToken("jwtuser", time.Second, "garagemq.read:*/*"))
+	defer client.conn.Close()
+	client.conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	frame, err := amqp.ReadFrame(client.conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	method, _ := amqp.ReadMethod(bytes.NewReader(frame.Payload), proto)
+	if closeMethod, ok := method.(*amqp.ConnectionClose); !ok || closeMethod.ReplyCode != amqp.ConnectionForced {
+		t.Errorf("Expected connection closed on token expiration, actual %s", method.Name())
+	}
+	client.send(&amqp.ConnectionCloseOk{})
+}
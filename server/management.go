@@ -0,0 +1,222 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/valinurovam/garagemq/amqp"
+	"github.com/valinurovam/garagemq/binding"
+	"github.com/valinurovam/garagemq/config"
+	"github.com/valinurovam/garagemq/exchange"
+	"github.com/valinurovam/garagemq/metrics"
+)
+
+// Errors returned by management operations
+var (
+	// ErrNotFound returned if requested vhost, exchange, queue or binding does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrAccessRefused returned on attempt to change system vhost or exchange or publish into internal exchange
+	ErrAccessRefused = errors.New("access refused")
+)
+
+// DeclareExchange creates exchange the same way as exchange.declare does
+// Already existing exchange is kept if it has the same properties
+func (vhost *VirtualHost) DeclareExchange(name string, exType string, durable bool, autoDelete bool, internal bool) error {
+	exTypeID, err := exchange.GetExchangeTypeID(exType)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return errors.New("exchange name is required")
+	}
+	if strings.HasPrefix(name, "amq.") {
+		return ErrAccessRefused
+	}
+
+	newExchange := exchange.NewExchange(name, exTypeID, durable, autoDelete, internal, false)
+	existingExchange, err := vhost.declareExchange(newExchange)
+	if err != nil {
+		return err
+	}
+	if existingExchange != nil {
+		return existingExchange.EqualWithErr(newExchange)
+	}
+	return nil
+}
+
+// DeleteExchange deletes exchange with all its bindings from virtual host and server storage
+// If ifUnused is set exchange is deleted only if it has no bindings
+func (vhost *VirtualHost) DeleteExchange(name string, ifUnused bool) error {
+	vhost.exLock.Lock()
+	defer vhost.exLock.Unlock()
+
+	ex := vhost.getExchange(name)
+	if ex == nil {
+		return ErrNotFound
+	}
+	if ex.IsSystem() {
+		return ErrAccessRefused
+	}
+
+	bindings := ex.GetBindings()
+	if ifUnused && len(bindings) > 0 {
+		return fmt.Errorf("exchange '%s' in use", name)
+	}
+
+	vhost.RemoveBindings(bindings)
+	if ex.IsDurable() {
+		vhost.srvStorage.DelExchange(vhost.name, ex)
+	}
+	delete(vhost.exchanges, name)
+	metrics.RemoveCounters("exchange", vhost.exchangeLabels(name)...)
+
+	vhost.logger.WithFields(log.Fields{
+		"name": name,
+	}).Info("Exchange deleted")
+	return nil
+}
+
+// DeclareQueue creates queue the same way as queue.declare does
+// Already existing queue is kept if it has the same properties
+func (vhost *VirtualHost) DeclareQueue(name string, durable bool, autoDelete bool, arguments *amqp.Table) error {
+	if name == "" {
+		return errors.New("queue name is required")
+	}
+	if arguments == nil {
+		arguments = &amqp.Table{}
+	}
+
+	newQueue := vhost.NewQueue(name, 0, false, autoDelete, durable, vhost.srvConfig.Queue.ShardSize)
+	newQueue.SetArguments(arguments)
+	existingQueue, err := vhost.declareQueue(newQueue)
+	if err != nil {
+		return err
+	}
+	if existingQueue != nil {
+		return existingQueue.EqualWithErr(newQueue)
+	}
+	return nil
+}
+
+// PurgeQueue removes all ready messages from queue and returns count of removed messages
+func (vhost *VirtualHost) PurgeQueue(name string) (uint64, error) {
+	qu := vhost.GetQueue(name)
+	if qu == nil {
+		return 0, ErrNotFound
+	}
+	return qu.Purge(), nil
+}
+
+// BindQueue binds queue to exchange the same way as queue.bind does
+func (vhost *VirtualHost) BindQueue(queueName string, exchangeName string, routingKey string, arguments *amqp.Table) error {
+	ex := vhost.GetExchange(exchangeName)
+	qu := vhost.GetQueue(queueName)
+	if ex == nil || qu == nil {
+		return ErrNotFound
+	}
+	if ex.GetName() == exDefaultName {
+		return ErrAccessRefused
+	}
+	if arguments == nil {
+		arguments = &amqp.Table{}
+	}
+
+	bind, err := binding.NewBinding(queueName, exchangeName, routingKey, arguments, ex.ExType() == exchange.ExTypeTopic)
+	if err != nil {
+		return err
+	}
+
+	ex.AppendBinding(bind)
+	if ex.IsDurable() && qu.IsDurable() {
+		vhost.PersistBinding(bind)
+	}
+	return nil
+}
+
+// UnbindQueue removes binding of queue to exchange the same way as queue.unbind does
+func (vhost *VirtualHost) UnbindQueue(queueName string, exchangeName string, routingKey string, arguments *amqp.Table) error {
+	ex := vhost.GetExchange(exchangeName)
+	if ex == nil || vhost.GetQueue(queueName) == nil {
+		return ErrNotFound
+	}
+	if ex.GetName() == exDefaultName {
+		return ErrAccessRefused
+	}
+	if arguments == nil {
+		arguments = &amqp.Table{}
+	}
+
+	bind, err := binding.NewBinding(queueName, exchangeName, routingKey, arguments, ex.ExType() == exchange.ExTypeTopic)
+	if err != nil {
+		return err
+	}
+
+	ex.RemoveBinding(bind)
+	vhost.RemoveBindings([]*binding.Binding{bind})
+	return nil
+}
+
+// ValidateVhostName checks if virtual host could be created with given name
+// Name should fit into AMQP short string and should not clash with message storage name of default vhost
+func (srv *Server) ValidateVhostName(name string) error {
+	if name == "" {
+		return errors.New("vhost name is required")
+	}
+	if len(name) > 255 {
+		return errors.New("vhost name is too long")
+	}
+	if name != srv.config.Vhost.DefaultPath && getVhostStorageName(name, srv.config.Vhost.DefaultPath) == defaultVhostStorageName {
+		return fmt.Errorf("vhost name '%s' is reserved", name)
+	}
+	return nil
+}
+
+// DeleteVhost closes all connections to virtual host, stops it and removes all its data
+// System virtual host could not be deleted
+func (srv *Server) DeleteVhost(name string) error {
+	srv.vhostsLock.Lock()
+	vhost := srv.vhosts[name]
+	if vhost == nil {
+		srv.vhostsLock.Unlock()
+		return ErrNotFound
+	}
+	if vhost.system {
+		srv.vhostsLock.Unlock()
+		return ErrAccessRefused
+	}
+	delete(srv.vhosts, name)
+	srv.vhostsLock.Unlock()
+
+	srv.closeConnections(func(conn *Connection) bool {
+		return conn.GetVirtualHost() == vhost
+	}, "Virtual host deleted")
+
+	vhost.Stop()
+	for _, entity := range []string{"queue", "exchange", "consumer", "msgstorage"} {
+		metrics.RemoveCounters(entity, metrics.Label{Name: "vhost", Value: name})
+	}
+	if err := srv.storage.DelVhost(name); err != nil {
+		return err
+	}
+	if err := srv.deleteVhostPermissions(name); err != nil {
+		return err
+	}
+
+	if srv.config.Db.Engine != config.DbEngineMemory {
+		storageName := getVhostStorageName(name, srv.config.Vhost.DefaultPath)
+		for _, isPersistent := range []bool{true, false} {
+			stPath := getStoragePath(srv.config.Db.DefaultPath, srv.config.Db.Engine, storageName, isPersistent)
+			if err := os.RemoveAll(stPath); err != nil {
+				return err
+			}
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"vhost": name,
+	}).Info("Vhost deleted")
+	return nil
+}
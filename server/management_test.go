@@ -0,0 +1,254 @@
+package server
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	amqpclient "github.com/streadway/amqp"
+	"github.com/valinurovam/garagemq/amqp"
+	"github.com/valinurovam/garagemq/auth"
+)
+
+func TestVirtualHost_DeclareDeleteExchange(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	vhost := sc.server.GetVhost("/")
+
+	if err := vhost.DeclareExchange("amq.test", "direct", true, false, false); err != ErrAccessRefused {
+		t.Errorf("Expected access refused on reserved name, actual %v", err)
+	}
+	if err := vhost.DeclareExchange("testEx", "unknown", true, false, false); err == nil {
+		t.Error("Expected error on unknown exchange type")
+	}
+	if err := vhost.DeclareExchange("testEx", "direct", true, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := vhost.DeclareExchange("testEx", "direct", false, false, false); err == nil {
+		t.Error("Expected error on redeclare with other properties")
+	}
+	vhost.DeclareQueue("testQu", true, false, nil)
+	if err := vhost.BindQueue("testQu", "testEx", "key", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := vhost.DeleteExchange("testEx", true); err == nil {
+		t.Error("Expected error on delete exchange in use")
+	}
+	if err := vhost.DeleteExchange("amq.direct", false); err != ErrAccessRefused {
+		t.Errorf("Expected access refused on delete system exchange, actual %v", err)
+	}
+	if err := vhost.DeleteExchange("testEx", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := vhost.DeleteExchange("testEx", false); err != ErrNotFound {
+		t.Errorf("Expected not found, actual %v", err)
+	}
+	if len(sc.server.storage.GetVhostExchanges("/")) != 0 {
+		t.Error("Expected exchange removed from storage")
+	}
+	if len(sc.server.storage.GetVhostBindings("/")) != 0 {
+		t.Error("Expected bindings removed from storage")
+	}
+}
+
+func TestVirtualHost_Declare_Concurrent(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	vhost := sc.server.GetVhost("/")
+
+	// declares with other properties must fail, instead of replacing declared queue or exchange
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	var quDeclared, exDeclared int
+	start := make(chan struct{})
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(durable bool) {
+			defer wg.Done()
+			<-start
+			quErr := vhost.DeclareQueue("testQu", durable, false, nil)
+			exErr := vhost.DeclareExchange("testEx", "direct", durable, false, false)
+			lock.Lock()
+			defer lock.Unlock()
+			if quErr == nil {
+				quDeclared++
+			}
+			if exErr == nil {
+				exDeclared++
+			}
+		}(i%2 == 0)
+	}
+	close(start)
+	wg.Wait()
+
+	if quDeclared != 10 {
+		t.Errorf("Expected only declares with properties of declared queue succeed, actual %d", quDeclared)
+	}
+	if exDeclared != 10 {
+		t.Errorf("Expected only declares with properties of declared exchange succeed, actual %d", exDeclared)
+	}
+}
+
+func TestVirtualHost_QueueBindPurge(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	vhost := sc.server.GetVhost("/")
+
+	if err := vhost.DeclareQueue("testQu", true, false, &amqp.Table{"x-max-length": int64(10)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := vhost.BindQueue("testQu", "amq.topic", "key.*", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := vhost.BindQueue("testQu", "", "key", nil); err != ErrAccessRefused {
+		t.Errorf("Expected access refused on bind to default exchange, actual %v", err)
+	}
+	if err := vhost.BindQueue("unknown", "amq.topic", "key", nil); err != ErrNotFound {
+		t.Errorf("Expected not found, actual %v", err)
+	}
+	if len(sc.server.storage.GetVhostBindings("/")) != 1 {
+		t.Error("Expected binding persisted")
+	}
+
+	ch, _ := sc.client.Channel()
+	for i := 0; i < 3; i++ {
+		ch.Publish("amq.topic", "key.a", false, false, amqpclient.Publishing{Body: []byte("test")})
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if length, err := vhost.PurgeQueue("testQu"); err != nil || length != 3 {
+		t.Errorf("Expected 3 messages purged, actual %d %v", length, err)
+	}
+	if _, err := vhost.PurgeQueue("unknown"); err != ErrNotFound {
+		t.Errorf("Expected not found, actual %v", err)
+	}
+
+	if err := vhost.UnbindQueue("testQu", "amq.topic", "key.*", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(vhost.GetExchange("amq.topic").GetBindings()) != 0 {
+		t.Error("Expected binding removed")
+	}
+	if len(sc.server.storage.GetVhostBindings("/")) != 0 {
+		t.Error("Expected binding removed from storage")
+	}
+}
+
+func Test_ExchangeDelete_Success(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	ch, _ := sc.client.Channel()
+
+	ch.ExchangeDeclare("testEx", "direct", true, false, false, false, emptyTable)
+	if err := ch.ExchangeDelete("testEx", false, false); err != nil {
+		t.Fatal(err)
+	}
+	if sc.server.GetVhost("/").GetExchange("testEx") != nil {
+		t.Error("Expected exchange deleted")
+	}
+}
+
+func Test_ExchangeDelete_Failed_NotFound(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	ch, _ := sc.client.Channel()
+
+	err := ch.ExchangeDelete("unknown", false, false)
+	if err == nil || err.(*amqpclient.Error).Code != amqp.NotFound {
+		t.Errorf("Expected NotFound error, actual %v", err)
+	}
+}
+
+func Test_ExchangeDelete_Failed_System(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	ch, _ := sc.client.Channel()
+
+	err := ch.ExchangeDelete("amq.direct", false, false)
+	if err == nil || err.(*amqpclient.Error).Code != amqp.AccessRefused {
+		t.Errorf("Expected AccessRefused error, actual %v", err)
+	}
+}
+
+func TestServer_DeleteVhost(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+
+	vhost, err := sc.server.AddVhost("tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vhost.DeclareQueue("testQu", true, false, nil)
+	vhost.DeclareExchange("testEx", "fanout", true, false, false)
+	vhost.BindQueue("testQu", "testEx", "", nil)
+	perm, _ := auth.NewPermission("guest", "tmp", auth.FullAccess, auth.FullAccess, auth.FullAccess)
+	sc.server.SetPermission(perm)
+
+	client, err := sc.dial(amqpclient.Config{Vhost: "tmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := client.NotifyClose(make(chan *amqpclient.Error, 1))
+
+	if err := sc.server.DeleteVhost("/"); err != ErrAccessRefused {
+		t.Errorf("Expected access refused on delete system vhost, actual %v", err)
+	}
+	if err := sc.server.DeleteVhost("tmp"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case closeErr := <-closed:
+		if closeErr == nil || closeErr.Code != amqp.ConnectionForced {
+			t.Errorf("Expected connection forced, actual %v", closeErr)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected connection to deleted vhost closed")
+	}
+
+	if sc.server.GetVhost("tmp") != nil {
+		t.Error("Expected vhost deleted")
+	}
+	if _, ok := sc.server.storage.GetVhosts()["tmp"]; ok {
+		t.Error("Expected vhost removed from storage")
+	}
+	if len(sc.server.storage.GetVhostQueues("tmp")) != 0 || len(sc.server.storage.GetVhostBindings("tmp")) != 0 {
+		t.Error("Expected vhost entities removed from storage")
+	}
+	if sc.server.getPermission("guest", "tmp") != nil || len(sc.server.storage.GetPermissions()) != len(sc.server.GetUsers()) {
+		t.Error("Expected vhost permissions removed")
+	}
+	if err := sc.server.DeleteVhost("tmp"); err != ErrNotFound {
+		t.Errorf("Expected not found, actual %v", err)
+	}
+}
+
+func TestServer_AddVhost(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+
+	for _, name := range []string{"", defaultVhostStorageName, strings.Repeat("a", 256)} {
+		if _, err := sc.server.AddVhost(name); err == nil {
+			t.Errorf("Expected error on vhost name '%s'", name)
+		}
+	}
+
+	vhost, err := sc.server.AddVhost("tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if existing, _ := sc.server.AddVhost("tmp"); existing != vhost {
+		t.Error("Expected existing vhost returned")
+	}
+	if _, ok := sc.server.storage.GetVhosts()["tmp"]; !ok {
+		t.Error("Expected vhost persisted")
+	}
+
+	vhosts := sc.server.GetVhosts()
+	delete(vhosts, "tmp")
+	if sc.server.GetVhost("tmp") == nil {
+		t.Error("Expected copy of vhosts returned")
+	}
+}
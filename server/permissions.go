@@ -0,0 +1,246 @@
+package server
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/valinurovam/garagemq/auth"
+)
+
+// initPermissions loads permissions from server storage
+// On the first start users from config get full access to default vhost
+func (srv *Server) initPermissions() error {
+	if srv.storage.IsFirstStart() {
+		if err := srv.grantFullAccess(); err != nil {
+			return err
+		}
+	}
+
+	srv.usersLock.Lock()
+	defer srv.usersLock.Unlock()
+	for _, perm := range srv.storage.GetPermissions() {
+		srv.setPermission(perm)
+	}
+	for _, perm := range srv.storage.GetTopicPermissions() {
+		srv.setTopicPermission(perm)
+	}
+	return nil
+}
+
+// grantFullAccess stores full permissions of each stored user on each stored vhost
+func (srv *Server) grantFullAccess() error {
+	for _, user := range srv.storage.GetUsers() {
+		for vhost := range srv.storage.GetVhosts() {
+			perm, _ := auth.NewPermission(user.Username, vhost, auth.FullAccess, auth.FullAccess, auth.FullAccess)
+			if err := srv.storage.AddPermission(perm); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (srv *Server) setPermission(perm *auth.Permission) {
+	if srv.permissions[perm.Username] == nil {
+		srv.permissions[perm.Username] = make(map[string]*auth.Permission)
+	}
+	srv.permissions[perm.Username][perm.Vhost] = perm
+}
+
+// GetPermissions returns permissions of all users
+func (srv *Server) GetPermissions() []*auth.Permission {
+	srv.usersLock.RLock()
+	defer srv.usersLock.RUnlock()
+	var permissions []*auth.Permission
+	for _, userPermissions := range srv.permissions {
+		for _, perm := range userPermissions {
+			permissions = append(permissions, perm)
+		}
+	}
+	return permissions
+}
+
+// SetPermission persists user permission on vhost or replace existing one
+func (srv *Server) SetPermission(perm *auth.Permission) error {
+	if srv.GetVhost(perm.Vhost) == nil {
+		return ErrNotFound
+	}
+
+	srv.usersLock.Lock()
+	defer srv.usersLock.Unlock()
+	if _, ok := srv.users[perm.Username]; !ok {
+		return ErrNotFound
+	}
+	if err := srv.storage.AddPermission(perm); err != nil {
+		return err
+	}
+	srv.setPermission(perm)
+
+	log.WithFields(log.Fields{
+		"user":      perm.Username,
+		"vhost":     perm.Vhost,
+		"configure": perm.Configure,
+		"write":     perm.Write,
+		"read":      perm.Read,
+	}).Info("Permission stored")
+	return nil
+}
+
+// DeletePermission removes user permission on vhost
+func (srv *Server) DeletePermission(userName string, vhost string) error {
+	srv.usersLock.Lock()
+	defer srv.usersLock.Unlock()
+	return srv.deletePermission(userName, vhost)
+}
+
+func (srv *Server) deletePermission(userName string, vhost string) error {
+	if _, ok := srv.permissions[userName][vhost]; !ok {
+		return ErrNotFound
+	}
+	if err := srv.storage.DelPermission(userName, vhost); err != nil {
+		return err
+	}
+	delete(srv.permissions[userName], vhost)
+	return nil
+}
+
+// deleteUserPermissions removes all permissions and topic permissions of user
+func (srv *Server) deleteUserPermissions(userName string) error {
+	for vhost := range srv.permissions[userName] {
+		if err := srv.deletePermission(userName, vhost); err != nil {
+			return err
+		}
+	}
+	for resource := range srv.topicPerms[userName] {
+		if err := srv.deleteTopicPermission(userName, resource.vhost, resource.exchange); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteVhostPermissions removes permissions and topic permissions of all users on vhost
+func (srv *Server) deleteVhostPermissions(vhost string) error {
+	srv.usersLock.Lock()
+	defer srv.usersLock.Unlock()
+	for userName := range srv.permissions {
+		if _, ok := srv.permissions[userName][vhost]; !ok {
+			continue
+		}
+		if err := srv.deletePermission(userName, vhost); err != nil {
+			return err
+		}
+	}
+	for userName := range srv.topicPerms {
+		for resource := range srv.topicPerms[userName] {
+			if resource.vhost != vhost {
+				continue
+			}
+			if err := srv.deleteTopicPermission(userName, vhost, resource.exchange); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// getPermission returns user permission on vhost or nil if user has no access
+func (srv *Server) getPermission(userName string, vhost string) *auth.Permission {
+	srv.usersLock.RLock()
+	defer srv.usersLock.RUnlock()
+	return srv.permissions[userName][vhost]
+}
+
+// checkPermission checks if user has given access to resource in vhost
+func (srv *Server) checkPermission(userName string, vhost string, access string, resource string) bool {
+	perm := srv.getPermission(userName, vhost)
+	return perm != nil && perm.Check(access, resource)
+}
+
+// CheckResourceAccess checks if user has given access to exchange or queue in vhost
+// Default exchange is checked by its alias, as for AMQP methods
+func CheckResourceAccess(user *auth.User, authz auth.Authorizer, vhost string, resourceType string, resource string, access string) bool {
+	if resourceType == auth.ResourceExchange && resource == exDefaultName {
+		resource = exDefaultAlias
+	}
+	return authz.CheckResource(user, vhost, resourceType, resource, access)
+}
+
+// topicResource identifies exchange which topic permission is applied to
+type topicResource struct {
+	vhost    string
+	exchange string
+}
+
+func (srv *Server) setTopicPermission(perm *auth.TopicPermission) {
+	if srv.topicPerms[perm.Username] == nil {
+		srv.topicPerms[perm.Username] = make(map[topicResource]*auth.TopicPermission)
+	}
+	srv.topicPerms[perm.Username][topicResource{perm.Vhost, perm.Exchange}] = perm
+}
+
+// GetTopicPermissions returns topic permissions of all users
+func (srv *Server) GetTopicPermissions() []*auth.TopicPermission {
+	srv.usersLock.RLock()
+	defer srv.usersLock.RUnlock()
+	var permissions []*auth.TopicPermission
+	for _, userPermissions := range srv.topicPerms {
+		for _, perm := range userPermissions {
+			permissions = append(permissions, perm)
+		}
+	}
+	return permissions
+}
+
+// SetTopicPermission persists user topic permission on vhost exchange or replace existing one
+// Exchange could not exist yet, permission is applied as soon as topic exchange is declared
+func (srv *Server) SetTopicPermission(perm *auth.TopicPermission) error {
+	if srv.GetVhost(perm.Vhost) == nil {
+		return ErrNotFound
+	}
+
+	srv.usersLock.Lock()
+	defer srv.usersLock.Unlock()
+	if _, ok := srv.users[perm.Username]; !ok {
+		return ErrNotFound
+	}
+	if err := srv.storage.AddTopicPermission(perm); err != nil {
+		return err
+	}
+	srv.setTopicPermission(perm)
+
+	log.WithFields(log.Fields{
+		"user":     perm.Username,
+		"vhost":    perm.Vhost,
+		"exchange": perm.Exchange,
+		"write":    perm.Write,
+		"read":     perm.Read,
+	}).Info("Topic permission stored")
+	return nil
+}
+
+// DeleteTopicPermission removes user topic permission on vhost exchange
+func (srv *Server) DeleteTopicPermission(userName string, vhost string, exchange string) error {
+	srv.usersLock.Lock()
+	defer srv.usersLock.Unlock()
+	return srv.deleteTopicPermission(userName, vhost, exchange)
+}
+
+func (srv *Server) deleteTopicPermission(userName string, vhost string, exchange string) error {
+	resource := topicResource{vhost, exchange}
+	if _, ok := srv.topicPerms[userName][resource]; !ok {
+		return ErrNotFound
+	}
+	if err := srv.storage.DelTopicPermission(userName, vhost, exchange); err != nil {
+		return err
+	}
+	delete(srv.topicPerms[userName], resource)
+	return nil
+}
+
+// checkTopicPermission checks if user has given access to routing key of topic exchange
+// Routing keys are not restricted if user has no topic permission on exchange
+func (srv *Server) checkTopicPermission(userName string, vhost string, exchange string, access string, routingKey string) bool {
+	srv.usersLock.RLock()
+	perm := srv.topicPerms[userName][topicResource{vhost, exchange}]
+	srv.usersLock.RUnlock()
+	return perm == nil || perm.Check(access, routingKey)
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"testing"
+
+	amqpclient "github.com/streadway/amqp"
+	"github.com/valinurovam/garagemq/amqp"
+	"github.com/valinurovam/garagemq/auth"
+)
+
+func TestServer_Permissions(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+
+	perm, _ := auth.NewPermission("guest", "unknown", auth.FullAccess, auth.FullAccess, auth.FullAccess)
+	if err := sc.server.SetPermission(perm); err != ErrNotFound {
+		t.Errorf("Expected not found on unknown vhost, actual %v", err)
+	}
+	perm, _ = auth.NewPermission("unknown", "/", auth.FullAccess, auth.FullAccess, auth.FullAccess)
+	if err := sc.server.SetPermission(perm); err != ErrNotFound {
+		t.Errorf("Expected not found on unknown user, actual %v", err)
+	}
+	if len(sc.server.GetPermissions()) != 2 {
+		t.Error("Expected config users have full access to default vhost")
+	}
+
+	if err := sc.server.DeletePermission("test", "/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.server.DeletePermission("test", "/"); err != ErrNotFound {
+		t.Errorf("Expected not found, actual %v", err)
+	}
+	if len(sc.server.storage.GetPermissions()) != 1 {
+		t.Error("Expected permission removed from storage")
+	}
+	if err := sc.server.DeleteUser("guest"); err != nil {
+		t.Fatal(err)
+	}
+	if len(sc.server.GetPermissions()) != 0 {
+		t.Error("Expected user permissions removed with user")
+	}
+}
+
+func TestServer_CheckResourceAccess(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+
+	if user, authz := sc.server.AuthorizeUser("test", "wrong"); user != nil || authz != nil {
+		t.Error("Expected wrong password refused")
+	}
+	user, authz := sc.server.AuthorizeUser("test", "guest")
+	if user == nil || authz == nil {
+		t.Fatal("Expected user authorized")
+	}
+
+	perm, _ := auth.NewPermission("test", "/", "^$", "^amq\\.default$", "^test-")
+	if err := sc.server.SetPermission(perm); err != nil {
+		t.Fatal(err)
+	}
+	if !CheckResourceAccess(user, authz, "/", auth.ResourceExchange, "", auth.AccessWrite) {
+		t.Error("Expected write access to default exchange by its alias")
+	}
+	if CheckResourceAccess(user, authz, "/", auth.ResourceQueue, "test-qu", auth.AccessConfigure) {
+		t.Error("Expected configure access refused")
+	}
+	if !CheckResourceAccess(user, authz, "/", auth.ResourceQueue, "test-qu", auth.AccessRead) {
+		t.Error("Expected read access to matched queue")
+	}
+	if CheckResourceAccess(user, authz, "other", auth.ResourceQueue, "test-qu", auth.AccessRead) {
+		t.Error("Expected access refused on vhost without permission")
+	}
+}
+
+func Test_ConnectionOpen_Failed_NoPermission(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	sc.server.DeletePermission("guest", "/")
+
+	_, err := sc.dial(amqpclient.Config{})
+	// client reports any connection close on connection.open as vhost access error
+	if err != amqpclient.ErrVhost {
+		t.Errorf("Expected vhost access error, actual %v", err)
+	}
+}
+
+func Test_ChannelMethods_Failed_AccessRefused(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	vhost := sc.server.GetVhost("/")
+	vhost.DeclareQueue("otherQu", false, false, nil)
+	vhost.DeclareExchange("otherEx", "direct", false, false, false)
+
+	perm, _ := auth.NewPermission("guest", "/", "^own", "^own|^amq\\.default$", "^own")
+	sc.server.SetPermission(perm)
+
+	ch, _ := sc.client.Channel()
+	if _, err := ch.QueueDeclare("ownQu", false, false, false, false, emptyTable); err != nil {
+		t.Fatal(err)
+	}
+	if err := ch.Publish("", "ownQu", false, false, amqpclient.Publishing{Body: []byte("test")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ch.Get("ownQu", true); err != nil {
+		t.Fatal(err)
+	}
+
+	refused := []func(ch *amqpclient.Channel) error{
+		func(ch *amqpclient.Channel) error {
+			_, err := ch.QueueDeclare("otherQu", false, false, false, false, emptyTable)
+			return err
+		},
+		func(ch *amqpclient.Channel) error {
+			return ch.ExchangeDeclare("otherEx", "direct", false, false, false, false, emptyTable)
+		},
+		func(ch *amqpclient.Channel) error {
+			return ch.ExchangeDelete("otherEx", false, false)
+		},
+		func(ch *amqpclient.Channel) error {
+			return ch.QueueBind("ownQu", "key", "amq.direct", false, emptyTable)
+		},
+		func(ch *amqpclient.Channel) error {
+			ch.Publish("otherEx", "key", false, false, amqpclient.Publishing{Body: []byte("test")})
+			_, err := ch.QueueDeclarePassive("ownQu", false, false, false, false, emptyTable)
+			return err
+		},
+		func(ch *amqpclient.Channel) error {
+			_, err := ch.Consume("otherQu", "", false, false, false, false, emptyTable)
+			return err
+		},
+		func(ch *amqpclient.Channel) error {
+			_, _, err := ch.Get("otherQu", true)
+			return err
+		},
+		func(ch *amqpclient.Channel) error {
+			_, err := ch.QueuePurge("otherQu", false)
+			return err
+		},
+		func(ch *amqpclient.Channel) error {
+			_, err := ch.QueueDelete("otherQu", false, false, false)
+			return err
+		},
+	}
+	for i, method := range refused {
+		ch, err := sc.client.Channel()
+		if err != nil {
+			t.Fatal(i, err)
+		}
+		err = method(ch)
+		if err == nil || err.(*amqpclient.Error).Code != amqp.AccessRefused {
+			t.Errorf("Expected AccessRefused error on method %d, actual %v", i, err)
+		}
+	}
+}
+
+func Test_TopicPermissions_Failed_AccessRefused(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	vhost := sc.server.GetVhost("/")
+	vhost.DeclareQueue("testQu", false, false, nil)
+
+	perm, _ := auth.NewTopicPermission("guest", "/", "amq.topic", "^devices\\.{username}\\.", "^devices\\.{username}\\.")
+	if err := sc.server.SetTopicPermission(perm); err != nil {
+		t.Fatal(err)
+	}
+
+	ch, _ := sc.client.Channel()
+	if err := ch.QueueBind("testQu", "devices.guest.*", "amq.topic", false, emptyTable); err != nil {
+		t.Fatal(err)
+	}
+	if err := ch.QueueBind("testQu", "devices.other", "amq.direct", false, emptyTable); err != nil {
+		t.Error("Expected routing keys of not topic exchange are not restricted", err)
+	}
+	ch.Publish("amq.topic", "devices.guest.temp", false, false, amqpclient.Publishing{Body: []byte("test")})
+	if _, _, err := ch.Get("testQu", true); err != nil {
+		t.Fatal(err)
+	}
+
+	ch, _ = sc.client.Channel()
+	err := ch.QueueBind("testQu", "devices.*.temp", "amq.topic", false, emptyTable)
+	if err == nil || err.(*amqpclient.Error).Code != amqp.AccessRefused {
+		t.Errorf("Expected AccessRefused error on bind, actual %v", err)
+	}
+
+	ch, _ = sc.client.Channel()
+	ch.Publish("amq.topic", "devices.other.temp", false, false, amqpclient.Publishing{Body: []byte("test")})
+	_, err = ch.QueueDeclarePassive("testQu", false, false, false, false, emptyTable)
+	if err == nil || err.(*amqpclient.Error).Code != amqp.AccessRefused {
+		t.Errorf("Expected AccessRefused error on publish, actual %v", err)
+	}
+
+	if err := sc.server.DeleteUser("guest"); err != nil {
+		t.Fatal(err)
+	}
+	if len(sc.server.GetTopicPermissions()) != 0 || len(sc.server.storage.GetTopicPermissions()) != 0 {
+		t.Error("Expected topic permissions removed with user")
+	}
+}
@@ -0,0 +1,340 @@
+package server
+
+import (
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/valinurovam/garagemq/amqp"
+	"github.com/valinurovam/garagemq/exchange"
+	"github.com/valinurovam/garagemq/policy"
+	"github.com/valinurovam/garagemq/queue"
+)
+
+// queueArgumentPrefix is prefix of queue arguments which override policy keys with the same name
+const queueArgumentPrefix = "x-"
+
+// initPolicies loads policies from server storage and applies them to queues and exchanges of virtual hosts
+func (srv *Server) initPolicies() {
+	for _, p := range srv.storage.GetPolicies() {
+		if vhost := srv.GetVhost(p.Vhost); vhost != nil {
+			vhost.setPolicy(p)
+		}
+	}
+	for _, vhost := range srv.GetVhosts() {
+		vhost.applyPolicies()
+	}
+}
+
+// GetPolicies returns policies of all virtual hosts ordered by vhost and name
+func (srv *Server) GetPolicies() []*policy.Policy {
+	var result []*policy.Policy
+	for _, vhost := range srv.GetVhosts() {
+		result = append(result, vhost.GetPolicies()...)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Vhost != result[j].Vhost {
+			return result[i].Vhost < result[j].Vhost
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// SetPolicy persists policy and replace existing one with the same name
+// Queues and exchanges of virtual host are re-evaluated at once
+func (srv *Server) SetPolicy(p *policy.Policy) error {
+	vhost := srv.GetVhost(p.Vhost)
+	if vhost == nil {
+		return ErrNotFound
+	}
+	if err := srv.storage.AddPolicy(p); err != nil {
+		return err
+	}
+	vhost.setPolicy(p)
+	vhost.applyPolicies()
+
+	log.WithFields(log.Fields{
+		"vhost":    p.Vhost,
+		"name":     p.Name,
+		"pattern":  p.Pattern,
+		"apply-to": p.ApplyTo,
+		"priority": p.Priority,
+	}).Info("Policy stored")
+	return nil
+}
+
+// DeletePolicy removes policy of virtual host, queues and exchanges it was applied to are re-evaluated
+func (srv *Server) DeletePolicy(vhostName string, name string) error {
+	vhost := srv.GetVhost(vhostName)
+	if vhost == nil {
+		return ErrNotFound
+	}
+
+	vhost.policyLock.Lock()
+	if _, ok := vhost.policies[name]; !ok {
+		vhost.policyLock.Unlock()
+		return ErrNotFound
+	}
+	if err := srv.storage.DelPolicy(vhostName, name); err != nil {
+		vhost.policyLock.Unlock()
+		return err
+	}
+	delete(vhost.policies, name)
+	vhost.policyLock.Unlock()
+
+	vhost.applyPolicies()
+
+	log.WithFields(log.Fields{
+		"vhost": vhostName,
+		"name":  name,
+	}).Info("Policy deleted")
+	return nil
+}
+
+// GetPolicies returns policies of virtual host ordered by name
+func (vhost *VirtualHost) GetPolicies() []*policy.Policy {
+	vhost.policyLock.RLock()
+	defer vhost.policyLock.RUnlock()
+	result := make([]*policy.Policy, 0, len(vhost.policies))
+	for _, p := range vhost.policies {
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+func (vhost *VirtualHost) setPolicy(p *policy.Policy) {
+	vhost.policyLock.Lock()
+	defer vhost.policyLock.Unlock()
+	vhost.policies[p.Name] = p
+}
+
+func (vhost *VirtualHost) selectPolicy(resource string, name string) *policy.Policy {
+	vhost.policyLock.RLock()
+	defer vhost.policyLock.RUnlock()
+	policies := make([]*policy.Policy, 0, len(vhost.policies))
+	for _, p := range vhost.policies {
+		policies = append(policies, p)
+	}
+	return policy.Select(policies, resource, name)
+}
+
+// applyPolicies re-evaluates settings of all queues and exchanges of virtual host
+func (vhost *VirtualHost) applyPolicies() {
+	vhost.quLock.RLock()
+	queues := make([]*queue.Queue, 0, len(vhost.queues))
+	for _, qu := range vhost.queues {
+		queues = append(queues, qu)
+	}
+	vhost.quLock.RUnlock()
+	for _, qu := range queues {
+		vhost.applyQueuePolicy(qu)
+	}
+
+	vhost.exLock.RLock()
+	exchanges := make([]*exchange.Exchange, 0, len(vhost.exchanges))
+	for _, ex := range vhost.exchanges {
+		exchanges = append(exchanges, ex)
+	}
+	vhost.exLock.RUnlock()
+	for _, ex := range exchanges {
+		vhost.applyExchangePolicy(ex)
+	}
+}
+
+// applyQueuePolicy sets queue settings from matched policy
+// Queue arguments like x-message-ttl take precedence over policy keys
+func (vhost *VirtualHost) applyQueuePolicy(qu *queue.Queue) {
+	settings := queue.DefaultSettings()
+	values := make(map[string]interface{})
+	if p := vhost.selectPolicy(policy.ApplyToQueues, qu.GetName()); p != nil {
+		settings.Policy = p.Name
+		for key, value := range *p.Definition {
+			values[key] = value
+		}
+	}
+	if arguments := qu.GetArguments(); arguments != nil {
+		for _, key := range []string{
+			policy.KeyMessageTTL,
+			policy.KeyMaxLength,
+			policy.KeyMaxLengthBytes,
+			policy.KeyDeadLetterExchange,
+			policy.KeyDeadLetterRoutingKey,
+			policy.KeyQueueMode,
+		} {
+			if value, ok := (*arguments)[queueArgumentPrefix+key]; ok {
+				values[key] = value
+			}
+		}
+	}
+
+	for key, target := range map[string]*int64{
+		policy.KeyMessageTTL:     &settings.MessageTTL,
+		policy.KeyMaxLength:      &settings.MaxLength,
+		policy.KeyMaxLengthBytes: &settings.MaxLengthBytes,
+	} {
+		if value, ok := policy.IntValue(values[key]); ok && value >= 0 {
+			*target = value
+		}
+	}
+	if value, ok := policy.StringValue(values[policy.KeyDeadLetterExchange]); ok {
+		settings.DeadLetter = true
+		settings.DeadLetterExchange = value
+	}
+	if value, ok := policy.StringValue(values[policy.KeyDeadLetterRoutingKey]); ok {
+		settings.DeadLetterRoutingKey = value
+	}
+	if value, ok := policy.StringValue(values[policy.KeyQueueMode]); ok {
+		settings.Lazy = value == policy.QueueModeLazy
+	}
+
+	qu.SetSettings(settings)
+}
+
+// applyExchangePolicy sets exchange settings from matched policy, system exchanges are skipped
+func (vhost *VirtualHost) applyExchangePolicy(ex *exchange.Exchange) {
+	if ex.IsSystem() {
+		return
+	}
+	settings := exchange.Settings{}
+	if p := vhost.selectPolicy(policy.ApplyToExchanges, ex.GetName()); p != nil {
+		settings.Policy = p.Name
+		if value, ok := p.Get(policy.KeyAlternateExchange); ok {
+			settings.AlternateExchange, _ = policy.StringValue(value)
+		}
+	}
+	ex.SetSettings(settings)
+}
+
+// routeMessage returns queues message is routed to by exchange
+// If exchange could not route message, it is routed by alternate exchanges until any queue is matched
+// Message keeps its original exchange, alternate exchange is used for matching bindings only
+func (vhost *VirtualHost) routeMessage(ex *exchange.Exchange, message *amqp.Message) map[string]bool {
+	matchedQueues := ex.GetMatchedQueues(message)
+	if len(matchedQueues) > 0 || ex.GetSettings().AlternateExchange == "" {
+		return matchedQueues
+	}
+
+	visited := map[string]bool{ex.GetName(): true}
+	routed := *message
+	for len(matchedQueues) == 0 {
+		alternateName := ex.GetSettings().AlternateExchange
+		if alternateName == "" || visited[alternateName] {
+			break
+		}
+		visited[alternateName] = true
+		if ex = vhost.GetExchange(alternateName); ex == nil {
+			break
+		}
+		ex.GetMetrics().MsgIn.Counter.Inc(1)
+		ex.GetMetrics().BodySize.Observe(float64(message.BodySize))
+		routed.Exchange = alternateName
+		matchedQueues = ex.GetMatchedQueues(&routed)
+	}
+	return matchedQueues
+}
+
+// deadLetter republishes message removed from queue into dead-letter exchange of queue
+// Message gets x-death header like RabbitMQ does, which is used to detect dead-letter cycles
+func (vhost *VirtualHost) deadLetter(qu *queue.Queue, message *amqp.Message, reason string) {
+	settings := qu.GetSettings()
+	ex := vhost.GetExchange(settings.DeadLetterExchange)
+	if ex == nil {
+		vhost.logger.WithFields(log.Fields{
+			"queue":    qu.GetName(),
+			"exchange": settings.DeadLetterExchange,
+		}).Warn("Dead-letter exchange not found, message dropped")
+		return
+	}
+
+	deadMessage := &amqp.Message{
+		BodySize:   message.BodySize,
+		Exchange:   settings.DeadLetterExchange,
+		RoutingKey: message.RoutingKey,
+		Body:       message.Body,
+	}
+	if settings.DeadLetterRoutingKey != "" {
+		deadMessage.RoutingKey = settings.DeadLetterRoutingKey
+	}
+	properties := *message.Header.PropertyList
+	headers := amqp.Table{}
+	if properties.Headers != nil {
+		for key, value := range *properties.Headers {
+			headers[key] = value
+		}
+	}
+	deaths := addDeath(headers["x-death"], amqp.Table{
+		"queue":        qu.GetName(),
+		"reason":       reason,
+		"exchange":     message.Exchange,
+		"routing-keys": []interface{}{message.RoutingKey},
+		"count":        int64(1),
+		"time":         time.Now(),
+	})
+	headers["x-death"] = deaths
+	properties.Headers = &headers
+	header := *message.Header
+	header.PropertyList = &properties
+	deadMessage.Header = &header
+
+	ex.GetMetrics().MsgIn.Counter.Inc(1)
+	ex.GetMetrics().BodySize.Observe(float64(deadMessage.BodySize))
+	for queueName := range vhost.routeMessage(ex, deadMessage) {
+		// message dead-lettered automatically into queue it has already died in makes a cycle
+		if reason != queue.ReasonRejected && hasDeath(deaths, queueName) {
+			continue
+		}
+		if target := vhost.GetQueue(queueName); target != nil {
+			target.Push(deadMessage)
+			ex.GetMetrics().MsgOut.Counter.Inc(1)
+		}
+	}
+}
+
+// addDeath puts death into the head of x-death list
+// Existing death with the same queue and reason is moved to the head with incremented count
+func addDeath(value interface{}, death amqp.Table) []interface{} {
+	deaths := []interface{}{death}
+	list, _ := value.([]interface{})
+	for _, item := range list {
+		existing, ok := deathTable(item)
+		if !ok {
+			continue
+		}
+		queueName, _ := policy.StringValue(existing["queue"])
+		reason, _ := policy.StringValue(existing["reason"])
+		if queueName == death["queue"] && reason == death["reason"] {
+			if count, ok := policy.IntValue(existing["count"]); ok {
+				death["count"] = count + 1
+			}
+			continue
+		}
+		deaths = append(deaths, existing)
+	}
+	return deaths
+}
+
+func hasDeath(deaths []interface{}, queueName string) bool {
+	for _, item := range deaths {
+		if death, ok := deathTable(item); ok {
+			if name, _ := policy.StringValue(death["queue"]); name == queueName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// deathTable handles both tables built by server and tables read from message storage
+func deathTable(item interface{}) (amqp.Table, bool) {
+	switch death := item.(type) {
+	case amqp.Table:
+		return death, true
+	case *amqp.Table:
+		return *death, true
+	}
+	return nil, false
+}
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	amqpclient "github.com/streadway/amqp"
+	"github.com/valinurovam/garagemq/amqp"
+	"github.com/valinurovam/garagemq/policy"
+)
+
+func newTestPolicy(t *testing.T, vhost string, name string, pattern string, applyTo string, definition amqp.Table) *policy.Policy {
+	p, err := policy.NewPolicy(vhost, name, pattern, applyTo, 0, &definition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestServer_Policies(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	vhost := sc.server.GetVhost("/")
+	vhost.DeclareQueue("orders.old", false, false, nil)
+
+	p := newTestPolicy(t, "unknown", "limit", "^orders", policy.ApplyToQueues, amqp.Table{policy.KeyMaxLength: int64(1)})
+	if err := sc.server.SetPolicy(p); err != ErrNotFound {
+		t.Errorf("Expected not found on unknown vhost, actual %v", err)
+	}
+
+	p.Vhost = "/"
+	if err := sc.server.SetPolicy(p); err != nil {
+		t.Fatal(err)
+	}
+	vhost.DeclareQueue("orders.new", false, false, nil)
+	vhost.DeclareQueue("other", false, false, nil)
+	for name, expected := range map[string]string{"orders.old": "limit", "orders.new": "limit", "other": ""} {
+		if actual := vhost.GetQueue(name).GetSettings().Policy; actual != expected {
+			t.Errorf("Expected policy '%s' on queue %s, actual '%s'", expected, name, actual)
+		}
+	}
+	if vhost.GetQueue("orders.old").GetSettings().MaxLength != 1 {
+		t.Error("Expected max length applied by policy")
+	}
+
+	// queue argument overrides policy
+	vhost.DeclareQueue("orders.args", false, false, &amqp.Table{"x-max-length": int32(5)})
+	if vhost.GetQueue("orders.args").GetSettings().MaxLength != 5 {
+		t.Error("Expected max length from queue argument")
+	}
+
+	if err := sc.server.SetPolicy(newTestPolicy(t, "/", "limit", "^other", policy.ApplyToQueues, amqp.Table{policy.KeyMaxLength: int64(1)})); err != nil {
+		t.Fatal(err)
+	}
+	if vhost.GetQueue("orders.old").GetSettings().Policy != "" || vhost.GetQueue("other").GetSettings().Policy != "limit" {
+		t.Error("Expected queues re-evaluated on policy change")
+	}
+
+	if err := sc.server.DeletePolicy("/", "limit"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.server.DeletePolicy("/", "limit"); err != ErrNotFound {
+		t.Errorf("Expected not found on deleted policy, actual %v", err)
+	}
+	if settings := vhost.GetQueue("other").GetSettings(); settings.Policy != "" || settings.MaxLength >= 0 {
+		t.Error("Expected queue settings cleared on policy delete")
+	}
+}
+
+func Test_Policies_QueueMode(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	vhost := sc.server.GetVhost("/")
+	vhost.DeclareQueue("lazy", false, false, nil)
+	vhost.DeclareQueue("lazy.default", false, false, &amqp.Table{"x-queue-mode": policy.QueueModeDefault})
+	sc.server.SetPolicy(newTestPolicy(t, "/", "lazy", "^lazy", policy.ApplyToQueues, amqp.Table{
+		policy.KeyQueueMode: policy.QueueModeLazy,
+	}))
+
+	if !vhost.GetQueue("lazy").GetSettings().Lazy {
+		t.Error("Expected lazy mode applied by policy")
+	}
+	if vhost.GetQueue("lazy.default").GetSettings().Lazy {
+		t.Error("Expected default mode from queue argument")
+	}
+}
+
+func TestServer_Policies_Storage(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+
+	// vhost names could contain dots and prefix each other
+	for _, name := range []string{"tenant", "tenant.a"} {
+		if _, err := sc.server.AddVhost(name); err != nil {
+			t.Fatal(err)
+		}
+		if err := sc.server.SetPolicy(newTestPolicy(t, name, "ttl", ".*", policy.ApplyToAll, amqp.Table{policy.KeyMessageTTL: int64(1000)})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(sc.server.storage.GetPolicies()) != 2 {
+		t.Fatal("Expected policies of both vhosts stored")
+	}
+
+	if err := sc.server.DeleteVhost("tenant"); err != nil {
+		t.Fatal(err)
+	}
+	stored := sc.server.storage.GetPolicies()
+	if len(stored) != 1 || stored[0].Vhost != "tenant.a" {
+		t.Fatalf("Expected only policy of deleted vhost removed, actual %v", stored)
+	}
+	if len(sc.server.GetPolicies()) != 1 {
+		t.Error("Expected policy of deleted vhost removed from server")
+	}
+}
+
+func Test_Policies_DeadLetter_MaxLength(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	vhost := sc.server.GetVhost("/")
+	vhost.DeclareExchange("dlx", "fanout", false, false, false)
+	vhost.DeclareQueue("dead", false, false, nil)
+	vhost.BindQueue("dead", "dlx", "", nil)
+	vhost.DeclareQueue("limited", false, false, nil)
+	sc.server.SetPolicy(newTestPolicy(t, "/", "dlx", "^limited$", policy.ApplyToQueues, amqp.Table{
+		policy.KeyMaxLength:          int64(1),
+		policy.KeyDeadLetterExchange: "dlx",
+	}))
+
+	ch, _ := sc.client.Channel()
+	ch.Publish("", "limited", false, false, amqpclient.Publishing{Body: []byte("first")})
+	ch.Publish("", "limited", false, false, amqpclient.Publishing{Body: []byte("second")})
+	time.Sleep(50 * time.Millisecond)
+
+	if length := vhost.GetQueue("limited").Length(); length != 1 {
+		t.Errorf("Expected %d messages in queue, actual %d", 1, length)
+	}
+	msg, ok, err := ch.Get("dead", true)
+	if err != nil || !ok {
+		t.Fatalf("Expected dropped message dead-lettered, %v", err)
+	}
+	if string(msg.Body) != "first" {
+		t.Errorf("Expected oldest message dead-lettered, actual %s", msg.Body)
+	}
+	if msg.Headers["x-death"] == nil {
+		t.Error("Expected x-death header on dead-lettered message")
+	}
+}
+
+func Test_Policies_DeadLetter_Reject(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	vhost := sc.server.GetVhost("/")
+	vhost.DeclareQueue("dead", false, false, nil)
+	vhost.DeclareQueue("work", false, false, &amqp.Table{
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": "dead",
+	})
+
+	ch, _ := sc.client.Channel()
+	ch.Publish("", "work", false, false, amqpclient.Publishing{Body: []byte("test")})
+	msg, ok, _ := ch.Get("work", false)
+	if !ok {
+		t.Fatal("Expected message in queue")
+	}
+	msg.Reject(false)
+	time.Sleep(50 * time.Millisecond)
+
+	if length := vhost.GetQueue("dead").Length(); length != 1 {
+		t.Errorf("Expected rejected message dead-lettered, actual length %d", length)
+	}
+	if length := vhost.GetQueue("work").Length(); length != 0 {
+		t.Errorf("Expected rejected message removed, actual length %d", length)
+	}
+}
+
+func Test_Policies_DeadLetter_Cycle(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	vhost := sc.server.GetVhost("/")
+	// expired messages are dead-lettered back into the same queue
+	vhost.DeclareQueue("cycle", false, false, &amqp.Table{
+		"x-dead-letter-exchange": "",
+		"x-message-ttl":          int32(0),
+	})
+	vhost.PublishMessage("", "cycle", nil, []byte("test"))
+	time.Sleep(50 * time.Millisecond)
+	vhost.GetQueue("cycle").SetSettings(vhost.GetQueue("cycle").GetSettings())
+
+	if length := vhost.GetQueue("cycle").Length(); length != 0 {
+		t.Errorf("Expected message dropped on dead-letter cycle, actual length %d", length)
+	}
+}
+
+func Test_Policies_AlternateExchange(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	vhost := sc.server.GetVhost("/")
+	vhost.DeclareExchange("main", "direct", false, false, false)
+	vhost.DeclareExchange("unrouted", "fanout", false, false, false)
+	vhost.DeclareQueue("unrouted", false, false, nil)
+	vhost.BindQueue("unrouted", "unrouted", "", nil)
+	sc.server.SetPolicy(newTestPolicy(t, "/", "ae", "^main$", policy.ApplyToExchanges, amqp.Table{
+		policy.KeyAlternateExchange: "unrouted",
+	}))
+	if vhost.GetExchange("main").GetSettings().Policy != "ae" {
+		t.Fatal("Expected policy applied to exchange")
+	}
+
+	ch, _ := sc.client.Channel()
+	ch.Publish("main", "nowhere", false, false, amqpclient.Publishing{Body: []byte("test")})
+	if routed, _ := vhost.PublishMessage("main", "nowhere", nil, []byte("test")); routed != 1 {
+		t.Errorf("Expected message routed by alternate exchange, actual %d", routed)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if length := vhost.GetQueue("unrouted").Length(); length != 2 {
+		t.Errorf("Expected %d messages in alternate exchange queue, actual %d", 2, length)
+	}
+}
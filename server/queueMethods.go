@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/valinurovam/garagemq/amqp"
+	"github.com/valinurovam/garagemq/auth"
 	"github.com/valinurovam/garagemq/binding"
 	"github.com/valinurovam/garagemq/exchange"
 	"github.com/valinurovam/garagemq/queue"
@@ -64,6 +65,10 @@ func (channel *Channel) queueDeclare(method *amqp.QueueDeclare) *amqp.Error {
 		return nil
 	}
 
+	if err := channel.checkAccessWithError(auth.AccessConfigure, auth.ResourceQueue, method.Queue, method); err != nil {
+		return err
+	}
+
 	newQueue := channel.conn.GetVirtualHost().NewQueue(
 		method.Queue,
 		channel.conn.id,
@@ -72,13 +77,11 @@ func (channel *Channel) queueDeclare(method *amqp.QueueDeclare) *amqp.Error {
 		method.Durable,
 		channel.server.config.Queue.ShardSize,
 	)
+	newQueue.SetArguments(method.Arguments)
 
-	if existingQueue != nil {
-		if exclusiveErr != nil {
-			return exclusiveErr
-		}
-
-		if err := existingQueue.EqualWithErr(newQueue); err != nil {
+	if existingQueue == nil {
+		var err error
+		if existingQueue, err = channel.conn.GetVirtualHost().declareQueue(newQueue); err != nil {
 			return amqp.NewChannelError(
 				amqp.PreconditionFailed,
 				err.Error(),
@@ -86,18 +89,23 @@ func (channel *Channel) queueDeclare(method *amqp.QueueDeclare) *amqp.Error {
 				method.MethodIdentifier(),
 			)
 		}
+		if existingQueue == nil {
+			channel.SendMethod(&amqp.QueueDeclareOk{
+				Queue:         method.Queue,
+				MessageCount:  0,
+				ConsumerCount: 0,
+			})
+			return nil
+		}
+		// queue was declared concurrently
+		exclusiveErr = channel.checkQueueLockWithError(existingQueue, method)
+	}
 
-		channel.SendMethod(&amqp.QueueDeclareOk{
-			Queue:         method.Queue,
-			MessageCount:  uint32(existingQueue.Length()),
-			ConsumerCount: uint32(existingQueue.ConsumersCount()),
-		})
-		return nil
+	if exclusiveErr != nil {
+		return exclusiveErr
 	}
 
-	newQueue.Start()
-	err := channel.conn.GetVirtualHost().AppendQueue(newQueue)
-	if err != nil {
+	if err := existingQueue.EqualWithErr(newQueue); err != nil {
 		return amqp.NewChannelError(
 			amqp.PreconditionFailed,
 			err.Error(),
@@ -105,10 +113,11 @@ func (channel *Channel) queueDeclare(method *amqp.QueueDeclare) *amqp.Error {
 			method.MethodIdentifier(),
 		)
 	}
+
 	channel.SendMethod(&amqp.QueueDeclareOk{
 		Queue:         method.Queue,
-		MessageCount:  0,
-		ConsumerCount: 0,
+		MessageCount:  uint32(existingQueue.Length()),
+		ConsumerCount: uint32(existingQueue.ConsumersCount()),
 	})
 
 	return nil
@@ -119,6 +128,13 @@ func (channel *Channel) queueBind(method *amqp.QueueBind) *amqp.Error {
 	var qu *queue.Queue
 	var err *amqp.Error
 
+	if err = channel.checkAccessWithError(auth.AccessWrite, auth.ResourceQueue, method.Queue, method); err != nil {
+		return err
+	}
+	if err = channel.checkAccessWithError(auth.AccessRead, auth.ResourceExchange, method.Exchange, method); err != nil {
+		return err
+	}
+
 	if ex, err = channel.getExchangeWithError(method.Exchange, method); err != nil {
 		return err
 	}
@@ -134,6 +150,10 @@ func (channel *Channel) queueBind(method *amqp.QueueBind) *amqp.Error {
 		)
 	}
 
+	if err = channel.checkTopicAccessWithError(auth.AccessRead, ex, method.RoutingKey, method); err != nil {
+		return err
+	}
+
 	if qu, err = channel.getQueueWithError(method.Queue, method); err != nil {
 		return err
 	}
@@ -174,6 +194,13 @@ func (channel *Channel) queueUnbind(method *amqp.QueueUnbind) *amqp.Error {
 	var qu *queue.Queue
 	var err *amqp.Error
 
+	if err = channel.checkAccessWithError(auth.AccessWrite, auth.ResourceQueue, method.Queue, method); err != nil {
+		return err
+	}
+	if err = channel.checkAccessWithError(auth.AccessRead, auth.ResourceExchange, method.Exchange, method); err != nil {
+		return err
+	}
+
 	if ex, err = channel.getExchangeWithError(method.Exchange, method); err != nil {
 		return err
 	}
@@ -208,6 +235,10 @@ func (channel *Channel) queuePurge(method *amqp.QueuePurge) *amqp.Error {
 	var qu *queue.Queue
 	var err *amqp.Error
 
+	if err = channel.checkAccessWithError(auth.AccessRead, auth.ResourceQueue, method.Queue, method); err != nil {
+		return err
+	}
+
 	if qu, err = channel.getQueueWithError(method.Queue, method); err != nil {
 		return err
 	}
@@ -227,6 +258,10 @@ func (channel *Channel) queueDelete(method *amqp.QueueDelete) *amqp.Error {
 	var qu *queue.Queue
 	var err *amqp.Error
 
+	if err = channel.checkAccessWithError(auth.AccessConfigure, auth.ResourceQueue, method.Queue, method); err != nil {
+		return err
+	}
+
 	if qu, err = channel.getQueueWithError(method.Queue, method); err != nil {
 		return err
 	}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/valinurovam/garagemq/config"
+	"github.com/valinurovam/garagemq/msgstorage"
+)
+
+// SchemaVersion is version of storage layout written by current server
+// Every change of stored layout must increment it and add migration into schemaMigrations
+const SchemaVersion = 6
+
+// schemaMigration upgrades storage layout from version-1 to version
+type schemaMigration struct {
+	version     uint32
+	description string
+	migrate     func(srv *Server, dryRun bool) error
+}
+
+var schemaMigrations = []schemaMigration{
+	{
+		version:     1,
+		description: "store message bodies once per vhost with reference counting",
+		migrate:     migrateInlineMessages,
+	},
+	{
+		version:     2,
+		description: "store queue arguments",
+		migrate:     migrateQueueArguments,
+	},
+	{
+		version:     3,
+		description: "store users from config",
+		migrate:     migrateConfigUsers,
+	},
+	{
+		version:     4,
+		description: "grant full access to existing users",
+		migrate:     migratePermissions,
+	},
+	{
+		version:     5,
+		description: "store delivery count, queued time and body size of message in queue references",
+		migrate:     migrateReferences,
+	},
+	{
+		version:     6,
+		description: "prefix vhost name with its length in queue, exchange and binding keys",
+		migrate:     migrateVhostKeys,
+	},
+}
+
+// MigrateSchema upgrades storage layout to current schema version
+// In dry-run mode only logs pending migrations and storage is not changed
+// Server must be stopped while migration is running.
+func MigrateSchema(cfg *config.Config, dryRun bool) error {
+	srv := &Server{
+		config:       cfg,
+		protoVersion: cfg.Proto,
+	}
+	srv.initServerStorage()
+	defer srv.storage.Close()
+
+	if srv.storage.IsFirstStart() {
+		log.Info("Storage is empty, nothing to migrate")
+		return nil
+	}
+	return srv.upgradeSchema(dryRun)
+}
+
+// upgradeSchema applies all migrations newer than stored schema version
+func (srv *Server) upgradeSchema(dryRun bool) error {
+	version := srv.storage.GetSchemaVersion()
+	if version > SchemaVersion {
+		return fmt.Errorf("storage schema version %d is newer than supported %d", version, SchemaVersion)
+	}
+
+	for _, migration := range schemaMigrations {
+		if migration.version <= version {
+			continue
+		}
+		log.WithFields(log.Fields{
+			"version": migration.version,
+			"dryRun":  dryRun,
+		}).Info("Migrate storage schema: " + migration.description)
+
+		if err := migration.migrate(srv, dryRun); err != nil {
+			return fmt.Errorf("migrate storage schema to version %d: %s", migration.version, err.Error())
+		}
+		if dryRun {
+			continue
+		}
+		if err := srv.storage.SetSchemaVersion(migration.version); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateInlineMessages moves messages stored inline in queue references into shared bodies
+func migrateInlineMessages(srv *Server, dryRun bool) error {
+	for vhost := range srv.storage.GetVhosts() {
+		db := srv.getStorageInstance(getVhostStorageName(vhost, srv.config.Vhost.DefaultPath), true)
+		migrated, err := msgstorage.MigrateInlineMessages(db, srv.protoVersion, dryRun)
+		db.Close()
+		if err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"vhost":    vhost,
+			"messages": migrated,
+			"dryRun":   dryRun,
+		}).Info("Inline messages migrated")
+	}
+	return nil
+}
+
+// migrateReferences rewrites queue references of messages in current layout
+func migrateReferences(srv *Server, dryRun bool) error {
+	for vhost := range srv.storage.GetVhosts() {
+		db := srv.getStorageInstance(getVhostStorageName(vhost, srv.config.Vhost.DefaultPath), true)
+		migrated, err := msgstorage.MigrateReferences(db, srv.protoVersion, dryRun)
+		db.Close()
+		if err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"vhost":      vhost,
+			"references": migrated,
+			"dryRun":     dryRun,
+		}).Info("Message references migrated")
+	}
+	return nil
+}
+
+// migrateVhostKeys rewrites keys of vhost entities, so vhost names could contain dots
+func migrateVhostKeys(srv *Server, dryRun bool) error {
+	migrated, err := srv.storage.MigrateVhostKeys(dryRun)
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"keys":   migrated,
+		"dryRun": dryRun,
+	}).Info("Vhost keys migrated")
+	return nil
+}
+
+// migrateQueueArguments rewrites stored queues with empty arguments
+// Keys of that version have no vhost name length, so queues are rewritten under their own keys
+func migrateQueueArguments(srv *Server, dryRun bool) error {
+	migrated, err := srv.storage.MigrateQueueArguments(dryRun)
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"queues": migrated,
+		"dryRun": dryRun,
+	}).Info("Queues migrated")
+	return nil
+}
+
+// migrateConfigUsers stores config users, since that version users are loaded from storage
+func migrateConfigUsers(srv *Server, dryRun bool) error {
+	if !dryRun {
+		if err := srv.storeConfigUsers(); err != nil {
+			return err
+		}
+	}
+	log.WithFields(log.Fields{
+		"users":  len(srv.config.Users),
+		"dryRun": dryRun,
+	}).Info("Users migrated")
+	return nil
+}
+
+// migratePermissions keeps access of existing users, before permissions each user could access any vhost
+func migratePermissions(srv *Server, dryRun bool) error {
+	if !dryRun {
+		if err := srv.grantFullAccess(); err != nil {
+			return err
+		}
+	}
+	log.WithFields(log.Fields{
+		"dryRun": dryRun,
+	}).Info("Permissions migrated")
+	return nil
+}
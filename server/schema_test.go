@@ -0,0 +1,209 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/valinurovam/garagemq/srvstorage"
+)
+
+func TestMigrateSchema_InlineMessages(t *testing.T) {
+	sc, _ := getNewSC(getPersistentTestConfig())
+	defer sc.clean()
+	ch, _ := sc.client.Channel()
+
+	qu, _ := ch.QueueDeclare(t.Name(), true, false, false, false, emptyTable)
+	if err := ch.Publish(
+		"",
+		qu.Name,
+		false, false,
+		amqp.Publishing{ContentType: "text/plain", Body: []byte("testMessage"), DeliveryMode: amqp.Persistent},
+	); err != nil {
+		t.Error(err)
+	}
+
+	// wait call persistStorage()
+	time.Sleep(100 * time.Millisecond)
+	sc.server.storage.UpdateLastStart()
+	sc.server.Stop()
+
+	// emulate storage written by server without schema version and reference counting
+	cfg := getPersistentTestConfig()
+	db := openStorage("badger", getStoragePath(cfg.srvConfig.Db.DefaultPath, "badger", defaultVhostStorageName, true))
+	var refKey string
+	var body []byte
+	db.Iterate(func(key []byte, value []byte) {
+		if bytes.HasPrefix(key, []byte("msg.")) {
+			refKey = string(key)
+		}
+		if bytes.HasPrefix(key, []byte("body.")) {
+			db.Del(string(key))
+			body = value
+		}
+	})
+	db.Set(refKey, body)
+	db.Close()
+
+	if err := MigrateSchema(&cfg.srvConfig, true); err != nil {
+		t.Fatal(err)
+	}
+	if ref := getStoredValue(cfg, defaultVhostStorageName, refKey); !bytes.Equal(ref, body) {
+		t.Fatal("Expected inline message untouched on dry run")
+	}
+
+	if err := MigrateSchema(&cfg.srvConfig, false); err != nil {
+		t.Fatal(err)
+	}
+	if ref := getStoredValue(cfg, defaultVhostStorageName, refKey); len(ref) < 8 || len(ref) >= len(body) ||
+		strconv.FormatUint(binary.BigEndian.Uint64(ref), 10) != refKey[strings.LastIndex(refKey, ".")+1:] {
+		t.Fatal("Expected inline message replaced by reference")
+	}
+	if version := getSchemaVersion(cfg); version != SchemaVersion {
+		t.Fatalf("Expected schema version %d, actual %d", SchemaVersion, version)
+	}
+
+	sc, _ = getNewSC(cfg)
+	ch, _ = sc.client.Channel()
+	msg, ok, errGet := ch.Get(t.Name(), true)
+	if errGet != nil {
+		t.Fatal(errGet)
+	}
+	if !ok || !bytes.Equal(msg.Body, []byte("testMessage")) {
+		t.Error("Persistent message not found after migration")
+	}
+}
+
+func TestMigrateSchema_References(t *testing.T) {
+	sc, _ := getNewSC(getPersistentTestConfig())
+	defer sc.clean()
+	ch, _ := sc.client.Channel()
+
+	qu, _ := ch.QueueDeclare(t.Name(), true, false, false, false, emptyTable)
+	ch.Publish("", qu.Name, false, false, amqp.Publishing{Body: []byte("testMessage"), DeliveryMode: amqp.Persistent})
+
+	time.Sleep(100 * time.Millisecond)
+	sc.server.storage.UpdateLastStart()
+	sc.server.Stop()
+
+	// emulate reference which contains only message ID
+	cfg := getPersistentTestConfig()
+	db := openStorage("badger", getStoragePath(cfg.srvConfig.Db.DefaultPath, "badger", defaultVhostStorageName, true))
+	var refKey string
+	var ref []byte
+	db.IterateByPrefix([]byte("msg."), 0, func(key []byte, value []byte) {
+		refKey = string(key)
+		ref = value
+	})
+	db.Set(refKey, ref[:8])
+	db.Close()
+	setSchemaVersion(cfg, 4)
+
+	if err := MigrateSchema(&cfg.srvConfig, false); err != nil {
+		t.Fatal(err)
+	}
+	migrated := getStoredValue(cfg, defaultVhostStorageName, refKey)
+	if len(migrated) != len(ref) || !bytes.Equal(migrated[:12], ref[:12]) {
+		t.Fatalf("Expected reference %v restored in current layout, actual %v", ref, migrated)
+	}
+	if binary.BigEndian.Uint64(migrated[12:]) == 0 {
+		t.Fatal("Expected message counted as queued at migration")
+	}
+}
+
+func TestMigrateSchema_VhostKeys(t *testing.T) {
+	sc, _ := getNewSC(getPersistentTestConfig())
+	defer sc.clean()
+	vhost, _ := sc.server.AddVhost("a.b")
+	vhost.DeclareQueue("qu", true, false, nil)
+	sc.server.storage.UpdateLastStart()
+	sc.server.Stop()
+
+	// emulate previous layout of keys without vhost name length
+	cfg := getPersistentTestConfig()
+	db := openStorage("badger", getStoragePath(cfg.srvConfig.Db.DefaultPath, "badger", serverStorageName, true))
+	value, _ := db.Get("vhost.queue.3.a.b.qu")
+	if value == nil {
+		t.Fatal("Expected queue stored with vhost name length")
+	}
+	db.Del("vhost.queue.3.a.b.qu")
+	db.Set("vhost.queue.a.b.qu", value)
+	db.Close()
+	setSchemaVersion(cfg, 5)
+
+	if err := MigrateSchema(&cfg.srvConfig, false); err != nil {
+		t.Fatal(err)
+	}
+	if getStoredValue(cfg, serverStorageName, "vhost.queue.a.b.qu") != nil {
+		t.Error("Expected key of previous layout removed")
+	}
+	if migrated := getStoredValue(cfg, serverStorageName, "vhost.queue.3.a.b.qu"); !bytes.Equal(migrated, value) {
+		t.Errorf("Expected queue %v stored with vhost name length, actual %v", value, migrated)
+	}
+}
+
+func TestMigrateSchema_QueueArguments(t *testing.T) {
+	sc, _ := getNewSC(getPersistentTestConfig())
+	defer sc.clean()
+	sc.server.GetVhost("/").DeclareQueue("qu", true, false, nil)
+	sc.server.storage.UpdateLastStart()
+	sc.server.Stop()
+
+	// emulate first layout of keys and queue stored without arguments
+	cfg := getPersistentTestConfig()
+	db := openStorage("badger", getStoragePath(cfg.srvConfig.Db.DefaultPath, "badger", serverStorageName, true))
+	value, _ := db.Get("vhost.queue.1./.qu")
+	if value == nil {
+		t.Fatal("Expected queue stored with vhost name length")
+	}
+	db.Del("vhost.queue.1./.qu")
+	db.Set("vhost.queue./.qu", value[:len("qu")+2])
+	db.Close()
+	setSchemaVersion(cfg, 1)
+
+	if err := MigrateSchema(&cfg.srvConfig, false); err != nil {
+		t.Fatal(err)
+	}
+	if migrated := getStoredValue(cfg, serverStorageName, "vhost.queue.1./.qu"); !bytes.Equal(migrated, value) {
+		t.Errorf("Expected queue %v stored with arguments, actual %v", value, migrated)
+	}
+}
+
+func TestMigrateSchema_FutureVersion(t *testing.T) {
+	defer (&ServerClient{}).clean()
+	cfg := getPersistentTestConfig()
+	stPath := getStoragePath(cfg.srvConfig.Db.DefaultPath, "badger", serverStorageName, true)
+	os.MkdirAll(stPath, 0777)
+	st := srvstorage.NewSrvStorage(openStorage("badger", stPath), cfg.srvConfig.Proto)
+	st.UpdateLastStart()
+	st.SetSchemaVersion(SchemaVersion + 1)
+	st.Close()
+
+	if err := MigrateSchema(&cfg.srvConfig, false); err == nil {
+		t.Error("Expected error on unknown schema version")
+	}
+}
+
+func getStoredValue(cfg TestConfig, name string, key string) []byte {
+	db := openStorage("badger", getStoragePath(cfg.srvConfig.Db.DefaultPath, "badger", name, true))
+	defer db.Close()
+	value, _ := db.Get(key)
+	return value
+}
+
+func setSchemaVersion(cfg TestConfig, version uint32) {
+	db := openStorage("badger", getStoragePath(cfg.srvConfig.Db.DefaultPath, "badger", serverStorageName, true))
+	defer db.Close()
+	srvstorage.NewSrvStorage(db, cfg.srvConfig.Proto).SetSchemaVersion(version)
+}
+
+func getSchemaVersion(cfg TestConfig) uint32 {
+	db := openStorage("badger", getStoragePath(cfg.srvConfig.Db.DefaultPath, "badger", serverStorageName, true))
+	defer db.Close()
+	return srvstorage.NewSrvStorage(db, cfg.srvConfig.Proto).GetSchemaVersion()
+}
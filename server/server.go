@@ -1,13 +1,12 @@
 package server
 
 import (
-	"crypto/md5"
-	"encoding/hex"
 	"fmt"
 	"net"
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
 
 	log "github.com/sirupsen/logrus"
@@ -51,11 +50,17 @@ type Server struct {
 	port         string
 	protoVersion string
 	listener     *net.TCPListener
+	tlsListener  *net.TCPListener
+	tlsConfig    atomic.Value
 	connSeq      uint64
 	connLock     sync.Mutex
 	connections  map[uint64]*Connection
 	config       *config.Config
-	users        map[string]string
+	usersLock    sync.RWMutex
+	users        map[string]*auth.User
+	permissions  map[string]map[string]*auth.Permission
+	topicPerms   map[string]map[topicResource]*auth.TopicPermission
+	authChain    *auth.Chain
 	vhostsLock   sync.Mutex
 	vhosts       map[string]*VirtualHost
 	status       ServerState
@@ -71,11 +76,14 @@ func NewServer(host string, port string, protoVersion string, config *config.Con
 		connections:  make(map[uint64]*Connection),
 		protoVersion: protoVersion,
 		config:       config,
-		users:        make(map[string]string),
+		users:        make(map[string]*auth.User),
+		permissions:  make(map[string]map[string]*auth.Permission),
+		topicPerms:   make(map[string]map[topicResource]*auth.TopicPermission),
 		vhosts:       make(map[string]*VirtualHost),
 		connSeq:      0,
 	}
 	server.initMetrics()
+	server.authChain = server.newInternalChain()
 
 	return
 }
@@ -88,9 +96,9 @@ func (srv *Server) initMetrics() {
 		Get:     metrics.AddCounter("server.get"),
 		Ack:     metrics.AddCounter("server.acknowledge"),
 
-		Ready:   metrics.AddCounter("server.ready"),
-		Unacked: metrics.AddCounter("server.unacked"),
-		Total:   metrics.AddCounter("server.total"),
+		Ready:   metrics.AddGauge("server.ready"),
+		Unacked: metrics.AddGauge("server.unacked"),
+		Total:   metrics.AddGauge("server.total"),
 
 		TrafficIn:  metrics.AddCounter("server.traffic_in"),
 		TrafficOut: metrics.AddCounter("server.traffic_out"),
@@ -106,13 +114,45 @@ func (srv *Server) Start() {
 	go srv.hookSignals()
 
 	srv.initServerStorage()
-	srv.initUsers()
 	if srv.storage.IsFirstStart() {
+		srv.checkOtherEngineStorage()
+		srv.storage.SetSchemaVersion(SchemaVersion)
 		srv.initDefaultVirtualHosts()
 	} else {
+		if err := srv.upgradeSchema(false); err != nil {
+			log.WithError(err).Error("Error on storage schema upgrade")
+			os.Exit(1)
+		}
 		srv.initVirtualHostsFromStorage()
 	}
+	if err := srv.initUsers(); err != nil {
+		log.WithError(err).Error("Error on init users")
+		os.Exit(1)
+	}
+	srv.warnDeprecatedHashing()
+	if err := srv.initPermissions(); err != nil {
+		log.WithError(err).Error("Error on init permissions")
+		os.Exit(1)
+	}
+	srv.initVhostLimits()
+	srv.initPolicies()
+	if err := srv.initAuthBackends(); err != nil {
+		log.WithError(err).Error("Error on init auth backends")
+		os.Exit(1)
+	}
+
+	if err := srv.loadDefinitions(); err != nil {
+		log.WithError(err).Error("Error on load definitions")
+		os.Exit(1)
+	}
 
+	if srv.config.TLS.Enabled {
+		if err := srv.ReloadTLS(); err != nil {
+			log.WithError(err).Error("Error on load TLS certificates")
+			os.Exit(1)
+		}
+		go srv.listenTLS()
+	}
 	go srv.listen()
 
 	srv.storage.UpdateLastStart()
@@ -128,12 +168,15 @@ func (srv *Server) Stop() {
 
 	// stop accept new connections
 	srv.listener.Close()
+	if srv.tlsListener != nil {
+		srv.tlsListener.Close()
+	}
 
 	var wg sync.WaitGroup
 	srv.connLock.Lock()
 	for _, conn := range srv.connections {
 		wg.Add(1)
-		go conn.safeClose(&wg)
+		go conn.safeClose(&wg, "Server shutdown")
 	}
 	srv.connLock.Unlock()
 	wg.Wait()
@@ -188,21 +231,24 @@ func (srv *Server) listen() {
 			"to":   conn.LocalAddr().String(),
 		}).Info("accepting connection")
 
-		conn.SetReadBuffer(srv.config.TCP.ReadBufSize)
-		conn.SetWriteBuffer(srv.config.TCP.WriteBufSize)
-		conn.SetNoDelay(srv.config.TCP.Nodelay)
-
+		srv.setSocketOptions(conn)
 		srv.acceptConnection(conn)
 	}
 }
 
+func (srv *Server) setSocketOptions(conn *net.TCPConn) {
+	conn.SetReadBuffer(srv.config.TCP.ReadBufSize)
+	conn.SetWriteBuffer(srv.config.TCP.WriteBufSize)
+	conn.SetNoDelay(srv.config.TCP.Nodelay)
+}
+
 func (srv *Server) stopWithError(err error, msg string) {
 	log.WithError(err).Error(msg)
 	srv.Stop()
 	os.Exit(1)
 }
 
-func (srv *Server) acceptConnection(conn *net.TCPConn) {
+func (srv *Server) acceptConnection(conn net.Conn) {
 	srv.connLock.Lock()
 	defer srv.connLock.Unlock()
 
@@ -218,29 +264,31 @@ func (srv *Server) removeConnection(connID uint64) {
 	delete(srv.connections, connID)
 }
 
-func (srv *Server) checkAuth(saslData auth.SaslData) bool {
-	for userName, passwordHash := range srv.users {
-		if userName != saslData.Username {
+// closeConnections safely closes connections matched by filter and waits until they are closed
+func (srv *Server) closeConnections(filter func(conn *Connection) bool, reason string) {
+	var wg sync.WaitGroup
+	srv.connLock.Lock()
+	for _, conn := range srv.connections {
+		if !filter(conn) {
 			continue
 		}
-
-		return auth.CheckPasswordHash(
-			saslData.Password,
-			passwordHash,
-			srv.config.Security.PasswordCheck == "md5",
-		)
+		wg.Add(1)
+		go conn.safeClose(&wg, reason)
 	}
-	return false
+	srv.connLock.Unlock()
+	wg.Wait()
 }
 
-func (srv *Server) initUsers() {
-	for _, user := range srv.config.Users {
-		srv.users[user.Username] = user.Password
+// getMechanisms returns SASL mechanisms enabled in config, PLAIN and AMQPLAIN by default
+func (srv *Server) getMechanisms() []string {
+	if len(srv.config.Security.Mechanisms) == 0 {
+		return []string{auth.SaslPlain, auth.SaslAMQPlain}
 	}
+	return srv.config.Security.Mechanisms
 }
 
 func (srv *Server) initServerStorage() {
-	srv.storage = srvstorage.NewSrvStorage(srv.getStorageInstance("server", true), srv.protoVersion)
+	srv.storage = srvstorage.NewSrvStorage(srv.getStorageInstance(serverStorageName, true), srv.protoVersion)
 }
 
 func (srv *Server) initDefaultVirtualHosts() {
@@ -249,8 +297,8 @@ func (srv *Server) initDefaultVirtualHosts() {
 	}).Info("Initialize default vhost")
 
 	log.Info("Initialize host message msgStorage")
-	msgStoragePersistent := msgstorage.NewMsgStorage(srv.getStorageInstance("vhost_default", true), srv.protoVersion)
-	msgStorageTransient := msgstorage.NewMsgStorage(srv.getStorageInstance("vhost_default", false), srv.protoVersion)
+	msgStoragePersistent := msgstorage.NewMsgStorage(srv.getStorageInstance(defaultVhostStorageName, true), srv.protoVersion)
+	msgStorageTransient := msgstorage.NewMsgStorage(srv.getStorageInstance(defaultVhostStorageName, false), srv.protoVersion)
 
 	srv.vhostsLock.Lock()
 	defer srv.vhostsLock.Unlock()
@@ -267,12 +315,7 @@ func (srv *Server) initVirtualHostsFromStorage() {
 			"vhost": srv.config.Vhost.DefaultPath,
 		}).Info("Initialize host message msgStorage")
 
-		var storageName string
-		if host == srv.config.Vhost.DefaultPath {
-			storageName = "vhost_default"
-		} else {
-			storageName = host
-		}
+		storageName := getVhostStorageName(host, srv.config.Vhost.DefaultPath)
 		msgStoragePersistent := msgstorage.NewMsgStorage(srv.getStorageInstance(storageName, true), srv.protoVersion)
 		msgStorageTransient := msgstorage.NewMsgStorage(srv.getStorageInstance(storageName, false), srv.protoVersion)
 		srv.vhosts[host] = NewVhost(host, system, msgStoragePersistent, msgStorageTransient, srv)
@@ -282,18 +325,41 @@ func (srv *Server) initVirtualHostsFromStorage() {
 	defer srv.vhostsLock.Unlock()
 }
 
-func (srv *Server) getStorageInstance(name string, isPersistent bool) interfaces.DbStorage {
-	// very ugly solution, but don't know how to deal with "/" vhost for example
-	// rabbitmq generate random uniq id for msgstore and touch .vhost file with vhost name into folder
+// addVhost creates new virtual host and persists it into server storage
+// If virtual host already exists it is returned as is
+func (srv *Server) addVhost(name string) *VirtualHost {
+	srv.vhostsLock.Lock()
+	defer srv.vhostsLock.Unlock()
+	if vhost, ok := srv.vhosts[name]; ok {
+		return vhost
+	}
+
+	log.WithFields(log.Fields{
+		"vhost": name,
+	}).Info("Initialize host message msgStorage")
 
-	h := md5.New()
-	h.Write([]byte(name))
-	name = hex.EncodeToString(h.Sum(nil))
+	storageName := getVhostStorageName(name, srv.config.Vhost.DefaultPath)
+	msgStoragePersistent := msgstorage.NewMsgStorage(srv.getStorageInstance(storageName, true), srv.protoVersion)
+	msgStorageTransient := msgstorage.NewMsgStorage(srv.getStorageInstance(storageName, false), srv.protoVersion)
+
+	vhost := NewVhost(name, false, msgStoragePersistent, msgStorageTransient, srv)
+	srv.vhosts[name] = vhost
+	srv.storage.AddVhost(name, false)
+	return vhost
+}
+
+func (srv *Server) getStorageInstance(name string, isPersistent bool) interfaces.DbStorage {
+	if srv.config.Db.Engine == config.DbEngineMemory {
+		log.WithFields(log.Fields{
+			"name":   name,
+			"engine": srv.config.Db.Engine,
+		}).Info("Open db storage")
+		return storage.NewMemory()
+	}
 
-	stPath := fmt.Sprintf("%s/%s/%s", srv.config.Db.DefaultPath, srv.config.Db.Engine, name)
+	stPath := getStoragePath(srv.config.Db.DefaultPath, srv.config.Db.Engine, name, isPersistent)
 
 	if !isPersistent {
-		stPath += ".transient"
 		if err := os.RemoveAll(stPath); err != nil {
 			panic(err)
 		}
@@ -309,15 +375,11 @@ func (srv *Server) getStorageInstance(name string, isPersistent bool) interfaces
 		"engine": srv.config.Db.Engine,
 	}).Info("Open db storage")
 
-	switch srv.config.Db.Engine {
-	case "badger":
-		return storage.NewBadger(stPath)
-	case "buntdb":
-		return storage.NewBuntDB(stPath)
-	default:
+	db := openStorage(srv.config.Db.Engine, stPath)
+	if db == nil {
 		srv.stopWithError(nil, fmt.Sprintf("Unknown db engine '%s'", srv.config.Db.Engine))
 	}
-	return nil
+	return db
 }
 
 func (srv *Server) onSignal(sig os.Signal) {
@@ -325,6 +387,8 @@ func (srv *Server) onSignal(sig os.Signal) {
 	case syscall.SIGTERM, syscall.SIGINT:
 		srv.Stop()
 		os.Exit(0)
+	case syscall.SIGHUP:
+		srv.reloadOnSignal()
 	}
 }
 
@@ -333,12 +397,20 @@ func (srv *Server) testOnSignal(sig os.Signal) {
 	switch sig {
 	case syscall.SIGTERM, syscall.SIGINT:
 		srv.Stop()
+	case syscall.SIGHUP:
+		srv.reloadOnSignal()
+	}
+}
+
+func (srv *Server) reloadOnSignal() {
+	if err := srv.ReloadTLS(); err != nil {
+		log.WithError(err).Error("Error on reload TLS certificates, current ones are kept")
 	}
 }
 
 func (srv *Server) hookSignals() {
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 	go func() {
 		for sig := range c {
 			log.Infof("Received [%d:%s] signal from OS", sig, sig.String())
@@ -362,8 +434,27 @@ func (srv *Server) GetVhost(name string) *VirtualHost {
 	return srv.getVhost(name)
 }
 
+// AddVhost creates new virtual host with its own message storages or returns existing one
+func (srv *Server) AddVhost(name string) (*VirtualHost, error) {
+	if err := srv.ValidateVhostName(name); err != nil {
+		return nil, err
+	}
+	return srv.addVhost(name), nil
+}
+
+func (srv *Server) GetConfig() *config.Config {
+	return srv.config
+}
+
+// GetVhosts returns copy of virtual hosts, they could be added and deleted at runtime
 func (srv *Server) GetVhosts() map[string]*VirtualHost {
-	return srv.vhosts
+	srv.vhostsLock.Lock()
+	defer srv.vhostsLock.Unlock()
+	vhosts := make(map[string]*VirtualHost, len(srv.vhosts))
+	for name, vhost := range srv.vhosts {
+		vhosts[name] = vhost
+	}
+	return vhosts
 }
 
 func (srv *Server) GetConnections() map[uint64]*Connection {
@@ -176,7 +176,7 @@ func Test_BasicPublish_Success(t *testing.T) {
 }
 
 func Test_BasicPublish_Persistent_Success(t *testing.T) {
-	sc, _ := getNewSC(getDefaultTestConfig())
+	sc, _ := getNewSC(getPersistentTestConfig())
 	defer sc.clean()
 	ch, _ := sc.client.Channel()
 
@@ -195,7 +195,7 @@ func Test_BasicPublish_Persistent_Success(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 	sc.server.Stop()
 
-	sc, _ = getNewSC(getDefaultTestConfig())
+	sc, _ = getNewSC(getPersistentTestConfig())
 	ch, _ = sc.client.Channel()
 
 	msg, ok, errGet := ch.Get(t.Name(), true)
@@ -554,6 +554,45 @@ func Test_BasicAck_Success(t *testing.T) {
 	}
 }
 
+func Test_BasicAck_Histograms(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	ch, _ := sc.client.Channel()
+
+	queue, _ := ch.QueueDeclare(t.Name(), false, false, false, false, emptyTable)
+
+	msgCount := 3
+	for i := 0; i < msgCount; i++ {
+		ch.Publish("", queue.Name, false, false, amqp.Publishing{ContentType: "text/plain", Body: []byte("test")})
+	}
+
+	cmr, err := ch.Consume(t.Name(), "tag", false, false, false, false, emptyTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < msgCount; i++ {
+		dlv := <-cmr
+		ch.Ack(dlv.DeliveryTag, false)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	vhost := sc.server.GetVhost("/")
+	if _, count, _ := vhost.GetQueue(t.Name()).GetMetrics().DeliverLatency.Snapshot(); count != uint64(msgCount) {
+		t.Errorf("Expected %d deliver latencies, actual %d", msgCount, count)
+	}
+	if _, count, sum := vhost.GetDefaultExchange().GetMetrics().BodySize.Snapshot(); count != uint64(msgCount) || sum != float64(4*msgCount) {
+		t.Errorf("Expected %d body sizes with sum %d, actual %d with sum %v", msgCount, 4*msgCount, count, sum)
+	}
+
+	channel := getServerChannel(sc, 1)
+	channel.cmrLock.RLock()
+	ackLatency := channel.consumers["tag"].GetMetrics().AckLatency
+	channel.cmrLock.RUnlock()
+	if _, count, _ := ackLatency.Snapshot(); count != uint64(msgCount) {
+		t.Errorf("Expected %d ack latencies, actual %d", msgCount, count)
+	}
+}
+
 func Test_BasicAckMultiple_Success(t *testing.T) {
 	sc, _ := getNewSC(getDefaultTestConfig())
 	defer sc.clean()
@@ -1,11 +1,31 @@
 package server
 
 import (
+	"bytes"
 	"testing"
 
+	amqpclient "github.com/streadway/amqp"
+	"github.com/valinurovam/garagemq/amqp"
 	"github.com/valinurovam/garagemq/config"
 )
 
+// amqPlainAuth encodes credentials as field table, client library sends them in wrong format
+type amqPlainAuth struct {
+	username string
+	password string
+}
+
+func (auth *amqPlainAuth) Mechanism() string {
+	return "AMQPLAIN"
+}
+
+func (auth *amqPlainAuth) Response() string {
+	buf := bytes.NewBuffer(make([]byte, 0))
+	amqp.WriteTable(buf, &amqp.Table{"LOGIN": auth.username, "PASSWORD": auth.password}, amqp.ProtoRabbit)
+	// response is table without length prefix
+	return string(buf.Bytes()[4:])
+}
+
 func Test_Connection_Success(t *testing.T) {
 	sc, err := getNewSC(getDefaultTestConfig())
 	defer sc.clean()
@@ -53,3 +73,34 @@ func Test_Connection_Failed_WhenWrongAuth_UnknownUser(t *testing.T) {
 		t.Error("Expected auth error")
 	}
 }
+
+func Test_Connection_AMQPlain_Success(t *testing.T) {
+	cfg := getDefaultTestConfig()
+	cfg.clientConfig.SASL = []amqpclient.Authentication{&amqPlainAuth{username: "guest", password: "guest"}}
+	sc, err := getNewSC(cfg)
+	defer sc.clean()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Connection_AMQPlain_Failed_WhenWrongAuth(t *testing.T) {
+	cfg := getDefaultTestConfig()
+	cfg.clientConfig.SASL = []amqpclient.Authentication{&amqPlainAuth{username: "guest", password: "guest?"}}
+	sc, err := getNewSC(cfg)
+	defer sc.clean()
+	if err == nil {
+		t.Error("Expected auth error")
+	}
+}
+
+func Test_Connection_Failed_MechanismDisabled(t *testing.T) {
+	cfg := getDefaultTestConfig()
+	cfg.srvConfig.Security.Mechanisms = []string{"PLAIN"}
+	cfg.clientConfig.SASL = []amqpclient.Authentication{&amqPlainAuth{username: "guest", password: "guest"}}
+	sc, err := getNewSC(cfg)
+	defer sc.clean()
+	if err == nil {
+		t.Error("Expected auth error on disabled mechanism")
+	}
+}
@@ -2,19 +2,21 @@ package server
 
 import (
 	"testing"
+	"time"
 
+	"github.com/streadway/amqp"
 	"github.com/valinurovam/garagemq/exchange"
 )
 
 func Test_ServerPersist_Queue_Success(t *testing.T) {
-	sc, _ := getNewSC(getDefaultTestConfig())
+	sc, _ := getNewSC(getPersistentTestConfig())
 	defer sc.clean()
 	ch, _ := sc.client.Channel()
 
 	ch.QueueDeclare(t.Name(), true, false, false, false, emptyTable)
 	sc.server.Stop()
 
-	sc, _ = getNewSC(getDefaultTestConfig())
+	sc, _ = getNewSC(getPersistentTestConfig())
 	ch, _ = sc.client.Channel()
 
 	if _, err := ch.QueueDeclarePassive(t.Name(), false, false, false, false, emptyTable); err != nil {
@@ -23,7 +25,7 @@ func Test_ServerPersist_Queue_Success(t *testing.T) {
 }
 
 func Test_ServerPersist_Exchange_Success(t *testing.T) {
-	sc, _ := getNewSC(getDefaultTestConfig())
+	sc, _ := getNewSC(getPersistentTestConfig())
 	defer sc.clean()
 	ch, _ := sc.client.Channel()
 
@@ -31,7 +33,7 @@ func Test_ServerPersist_Exchange_Success(t *testing.T) {
 	ch.ExchangeDeclare("testExTopic", "topic", true, false, false, false, emptyTable)
 	sc.server.Stop()
 
-	sc, _ = getNewSC(getDefaultTestConfig())
+	sc, _ = getNewSC(getPersistentTestConfig())
 	ch, _ = sc.client.Channel()
 
 	if err := ch.ExchangeDeclarePassive("testExDirect", "direct", true, false, false, false, emptyTable); err != nil {
@@ -50,3 +52,56 @@ func Test_ServerPersist_Exchange_Success(t *testing.T) {
 		t.Error("Expected topic exchange")
 	}
 }
+
+func Test_ServerPersist_DottedVhost_Success(t *testing.T) {
+	sc, _ := getNewSC(getPersistentTestConfig())
+	defer sc.clean()
+
+	for _, name := range []string{"a", "a.b"} {
+		vhost, err := sc.server.AddVhost(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vhost.DeclareExchange("ex."+name, "direct", true, false, false)
+		vhost.DeclareQueue("qu."+name, true, false, nil)
+		if err := vhost.BindQueue("qu."+name, "ex."+name, "key", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sc.server.Stop()
+
+	sc, _ = getNewSC(getPersistentTestConfig())
+	for _, name := range []string{"a", "a.b"} {
+		if _, ok := sc.server.storage.GetVhosts()[name]; !ok {
+			t.Fatalf("Expected vhost '%s' stored", name)
+		}
+		// test server starts with default vhost only, others are loaded from storage on add
+		vhost, _ := sc.server.AddVhost(name)
+		if len(vhost.GetQueues()) != 1 || vhost.GetQueue("qu."+name) == nil {
+			t.Errorf("Expected only own queue in vhost '%s' after server restart", name)
+		}
+		ex := vhost.GetExchange("ex." + name)
+		if ex == nil || len(ex.GetBindings()) != 1 {
+			t.Errorf("Expected exchange with binding in vhost '%s' after server restart", name)
+		}
+	}
+}
+
+func Test_ServerPersist_MessageTTL_Success(t *testing.T) {
+	sc, _ := getNewSC(getPersistentTestConfig())
+	defer sc.clean()
+	ch, _ := sc.client.Channel()
+
+	ch.QueueDeclare(t.Name(), true, false, false, false, amqp.Table{"x-message-ttl": int32(200)})
+	ch.Publish("", t.Name(), false, false, amqp.Publishing{Body: []byte("testMessage"), DeliveryMode: amqp.Persistent})
+	time.Sleep(100 * time.Millisecond)
+	sc.server.Stop()
+
+	// message keeps its age after restart, so it expires as if server was not restarted
+	time.Sleep(200 * time.Millisecond)
+	sc, _ = getNewSC(getPersistentTestConfig())
+	ch, _ = sc.client.Channel()
+	if _, ok, _ := ch.Get(t.Name(), true); ok {
+		t.Error("Expected message expired after server restart")
+	}
+}
@@ -61,6 +61,7 @@ func getDefaultTestConfig() TestConfig {
 				{
 					Username: "guest",
 					Password: "084e0343a0486ff05530df6c705c8bb4", // guest md5 hash
+					Tags:     []string{"administrator"},
 				},
 			},
 			TCP: config.TCPConfig{
@@ -74,7 +75,7 @@ func getDefaultTestConfig() TestConfig {
 			},
 			Db: config.Db{
 				DefaultPath: "db_test",
-				Engine:      "badger",
+				Engine:      "memory",
 			},
 			Vhost: config.Vhost{
 				DefaultPath: "/",
@@ -91,13 +92,21 @@ func getDefaultTestConfig() TestConfig {
 	}
 }
 
+// getPersistentTestConfig returns config with on-disk storage for tests which restart server
+func getPersistentTestConfig() TestConfig {
+	cfg := getDefaultTestConfig()
+	cfg.srvConfig.Db.Engine = "badger"
+	return cfg
+}
+
 func getNewSC(config TestConfig) (*ServerClient, error) {
 	metrics.NewTrackRegistry(15, time.Second, true)
 	sc := &ServerClient{}
 	sc.server = NewServer("localhost", "0", proto, &config.srvConfig)
 	sc.server.initServerStorage()
-	sc.server.initUsers()
 	sc.server.initDefaultVirtualHosts()
+	sc.server.initUsers()
+	sc.server.initPermissions()
 	sc.server.status = Running
 
 	// the only chance to disable badger logger
@@ -132,6 +141,19 @@ func getNewSC(config TestConfig) (*ServerClient, error) {
 	return sc, nil
 }
 
+// dial opens one more client connection to test server
+func (sc *ServerClient) dial(clientConfig amqpclient.Config) (*amqpclient.Connection, error) {
+	toServer, _, fromClient, _, err := networkSim()
+	if err != nil {
+		return nil, err
+	}
+	sc.server.acceptConnection(fromClient)
+	clientConfig.Dial = func(network, addr string) (net.Conn, error) {
+		return toServer, nil
+	}
+	return amqpclient.DialConfig("amqp://localhost:0", clientConfig)
+}
+
 func networkSim() (net.Conn, net.Conn, *net.TCPConn, *net.TCPConn, error) {
 	tcpAddr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:0")
 	listener, err := net.ListenTCP("tcp", tcpAddr)
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/valinurovam/garagemq/config"
+	"github.com/valinurovam/garagemq/interfaces"
+	"github.com/valinurovam/garagemq/srvstorage"
+	"github.com/valinurovam/garagemq/storage"
+)
+
+const serverStorageName = "server"
+const defaultVhostStorageName = "vhost_default"
+const migrateBatchSize = 1000
+
+// migrateTmpDir is directory in db path where storages are written while migration is running
+const migrateTmpDir = "migrate.tmp"
+
+// on-disk engines, which storage could be migrated between
+var diskEngines = []string{config.DbEngineBadger, config.DbEngineBuntDB, config.DbEngineSegmentLog}
+
+// getStoragePath returns path of named storage for given engine
+func getStoragePath(dbPath string, engine string, name string, isPersistent bool) string {
+	// very ugly solution, but don't know how to deal with "/" vhost for example
+	// rabbitmq generate random uniq id for msgstore and touch .vhost file with vhost name into folder
+	h := md5.New()
+	h.Write([]byte(name))
+	name = hex.EncodeToString(h.Sum(nil))
+
+	stPath := fmt.Sprintf("%s/%s/%s", dbPath, engine, name)
+	if !isPersistent {
+		stPath += ".transient"
+	}
+	return stPath
+}
+
+// getVhostStorageName returns name of message storage for virtual host
+func getVhostStorageName(vhost string, defaultVhost string) string {
+	if vhost == defaultVhost {
+		return defaultVhostStorageName
+	}
+	return vhost
+}
+
+// openStorage returns storage instance for on-disk engine or nil if engine is unknown
+func openStorage(engine string, stPath string) interfaces.DbStorage {
+	switch engine {
+	case config.DbEngineBadger:
+		return storage.NewBadger(stPath)
+	case config.DbEngineBuntDB:
+		return storage.NewBuntDB(stPath)
+	case config.DbEngineSegmentLog:
+		return storage.NewSegmentLog(stPath)
+	}
+	return nil
+}
+
+func isDiskEngine(engine string) bool {
+	for _, diskEngine := range diskEngines {
+		if engine == diskEngine {
+			return true
+		}
+	}
+	return false
+}
+
+func storageExists(stPath string) bool {
+	_, err := os.Stat(stPath)
+	return err == nil
+}
+
+// checkOtherEngineStorage warns if server starts with empty storage while another engine has data
+func (srv *Server) checkOtherEngineStorage() {
+	for _, engine := range diskEngines {
+		if engine == srv.config.Db.Engine {
+			continue
+		}
+		if storageExists(getStoragePath(srv.config.Db.DefaultPath, engine, serverStorageName, true)) {
+			log.WithFields(log.Fields{
+				"engine": srv.config.Db.Engine,
+				"found":  engine,
+			}).Warn("Storage is empty, but data for other engine found. Use migrate-storage command to move it")
+		}
+	}
+}
+
+// MigrateStorage copies server storage and persistent message storages of all virtual hosts
+// from one db engine to another. Server must be stopped while migration is running.
+func MigrateStorage(cfg *config.Config, from string, to string) error {
+	if !isDiskEngine(from) {
+		return fmt.Errorf("unknown source db engine '%s'", from)
+	}
+	if !isDiskEngine(to) {
+		return fmt.Errorf("unknown destination db engine '%s'", to)
+	}
+	if from == to {
+		return errors.New("source and destination db engines are the same")
+	}
+
+	srcPath := getStoragePath(cfg.Db.DefaultPath, from, serverStorageName, true)
+	if !storageExists(srcPath) {
+		return fmt.Errorf("no '%s' storage found in %s", from, filepath.Join(cfg.Db.DefaultPath, from))
+	}
+	if storageExists(getStoragePath(cfg.Db.DefaultPath, to, serverStorageName, true)) {
+		return fmt.Errorf("'%s' storage already exists in %s", to, filepath.Join(cfg.Db.DefaultPath, to))
+	}
+
+	// storages are written into temporary directory and moved into place only when all of them are copied,
+	// so failed migration leaves nothing behind and could be retried
+	tmpPath := filepath.Join(cfg.Db.DefaultPath, migrateTmpDir)
+	if err := os.RemoveAll(tmpPath); err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpPath)
+
+	src := openStorage(from, srcPath)
+	defer src.Close()
+	vhosts := srvstorage.NewSrvStorage(src, cfg.Proto).GetVhosts()
+
+	if err := migrateNamedStorage(src, tmpPath, to, serverStorageName); err != nil {
+		return err
+	}
+
+	var names []string
+	for vhost := range vhosts {
+		name := getVhostStorageName(vhost, cfg.Vhost.DefaultPath)
+		vhostPath := getStoragePath(cfg.Db.DefaultPath, from, name, true)
+		if !storageExists(vhostPath) {
+			continue
+		}
+		vhostSrc := openStorage(from, vhostPath)
+		err := migrateNamedStorage(vhostSrc, tmpPath, to, name)
+		vhostSrc.Close()
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+
+	// server storage is moved last, without it destination is not used by server and by next migration
+	for _, name := range append(names, serverStorageName) {
+		if err := moveStorage(getStoragePath(tmpPath, to, name, true), getStoragePath(cfg.Db.DefaultPath, to, name, true)); err != nil {
+			return fmt.Errorf("migrate storage '%s': %s", name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func migrateNamedStorage(src interfaces.DbStorage, dbPath string, to string, name string) error {
+	dstPath := getStoragePath(dbPath, to, name, true)
+	if err := os.MkdirAll(dstPath, 0777); err != nil {
+		return err
+	}
+	dst := openStorage(to, dstPath)
+	defer dst.Close()
+
+	count, err := copyStorage(src, dst)
+	if err != nil {
+		return fmt.Errorf("migrate storage '%s': %s", name, err.Error())
+	}
+
+	log.WithFields(log.Fields{
+		"storage": name,
+		"keys":    count,
+	}).Info("Storage migrated")
+	return nil
+}
+
+// moveStorage replaces storage in dstPath, which could be left by failed migration, by storage in srcPath
+func moveStorage(srcPath string, dstPath string) error {
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0777); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dstPath); err != nil {
+		return err
+	}
+	return os.Rename(srcPath, dstPath)
+}
+
+// copyStorage copies all keys from one storage into another by batches
+func copyStorage(src interfaces.DbStorage, dst interfaces.DbStorage) (count uint64, err error) {
+	batch := make([]*interfaces.Operation, 0, migrateBatchSize)
+	src.Iterate(func(key []byte, value []byte) {
+		if err != nil {
+			return
+		}
+		batch = append(batch, &interfaces.Operation{
+			Key:   string(key),
+			Value: append([]byte(nil), value...),
+			Op:    interfaces.OpSet,
+		})
+		if len(batch) == migrateBatchSize {
+			err = dst.ProcessBatch(batch)
+			count += uint64(len(batch))
+			batch = batch[:0]
+		}
+	})
+	if err != nil {
+		return count, err
+	}
+	if len(batch) > 0 {
+		err = dst.ProcessBatch(batch)
+		count += uint64(len(batch))
+	}
+	return count, err
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+func TestMigrateStorage(t *testing.T) {
+	sc, _ := getNewSC(getPersistentTestConfig())
+	defer sc.clean()
+	ch, _ := sc.client.Channel()
+
+	ch.ExchangeDeclare("testExDirect", "direct", true, false, false, false, emptyTable)
+	qu, _ := ch.QueueDeclare(t.Name(), true, false, false, false, emptyTable)
+	ch.QueueBind(qu.Name, "key", "testExDirect", false, emptyTable)
+	if err := ch.Publish(
+		"testExDirect",
+		"key",
+		false, false,
+		amqp.Publishing{ContentType: "text/plain", Body: []byte("testMessage"), DeliveryMode: amqp.Persistent},
+	); err != nil {
+		t.Error(err)
+	}
+
+	// wait call persistStorage()
+	time.Sleep(100 * time.Millisecond)
+	sc.server.Stop()
+
+	cfg := getPersistentTestConfig()
+	if err := MigrateStorage(&cfg.srvConfig, "badger", "segmentlog"); err != nil {
+		t.Fatal(err)
+	}
+	if err := MigrateStorage(&cfg.srvConfig, "badger", "segmentlog"); err == nil {
+		t.Error("Expected error on migration into existing storage")
+	}
+
+	cfg.srvConfig.Db.Engine = "segmentlog"
+	sc, _ = getNewSC(cfg)
+	ch, _ = sc.client.Channel()
+
+	if err := ch.ExchangeDeclarePassive("testExDirect", "direct", true, false, false, false, emptyTable); err != nil {
+		t.Error("Expected exchange exists after migration", err)
+	}
+	msg, ok, errGet := ch.Get(t.Name(), true)
+	if errGet != nil {
+		t.Fatal(errGet)
+	}
+	if !ok || !bytes.Equal(msg.Body, []byte("testMessage")) {
+		t.Error("Persistent message not found after migration")
+	}
+}
+
+func TestMigrateStorage_Retry(t *testing.T) {
+	sc, _ := getNewSC(getPersistentTestConfig())
+	defer sc.clean()
+	ch, _ := sc.client.Channel()
+	ch.QueueDeclare(t.Name(), true, false, false, false, emptyTable)
+	time.Sleep(100 * time.Millisecond)
+	sc.server.Stop()
+
+	// destination engine directory could not be created
+	cfg := getPersistentTestConfig()
+	dstRoot := filepath.Join(cfg.srvConfig.Db.DefaultPath, "segmentlog")
+	if err := ioutil.WriteFile(dstRoot, []byte{}, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := MigrateStorage(&cfg.srvConfig, "badger", "segmentlog"); err == nil {
+		t.Fatal("Expected error on migration into broken destination")
+	}
+	if storageExists(filepath.Join(cfg.srvConfig.Db.DefaultPath, migrateTmpDir)) {
+		t.Error("Expected temporary storage removed on failed migration")
+	}
+
+	os.Remove(dstRoot)
+	if err := MigrateStorage(&cfg.srvConfig, "badger", "segmentlog"); err != nil {
+		t.Fatal("Expected migration retried after failure", err)
+	}
+	if !storageExists(getStoragePath(cfg.srvConfig.Db.DefaultPath, "segmentlog", serverStorageName, true)) {
+		t.Error("Expected server storage migrated")
+	}
+}
+
+func TestMigrateStorage_WrongEngine(t *testing.T) {
+	cfg := getPersistentTestConfig()
+	if err := MigrateStorage(&cfg.srvConfig, "badger", "memory"); err == nil {
+		t.Error("Expected error on migration into memory engine")
+	}
+	if err := MigrateStorage(&cfg.srvConfig, "badger", "badger"); err == nil {
+		t.Error("Expected error on migration into same engine")
+	}
+}
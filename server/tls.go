@@ -0,0 +1,154 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/valinurovam/garagemq/config"
+)
+
+const defaultTLSPort = "5671"
+
+const tlsHandshakeTimeout = 10 * time.Second
+
+// Client certificate verification modes
+const (
+	clientAuthNone     = "none"
+	clientAuthOptional = "optional"
+	clientAuthRequired = "required"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// buildTLSConfig loads certificates from files and returns config for TLS listener
+func buildTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load certificate: %s", err.Error())
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if cfg.MinVersion != "" {
+		version, ok := tlsVersions[cfg.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS version '%s'", cfg.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if len(cfg.CipherSuites) > 0 {
+		suites := make(map[string]uint16)
+		for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+			suites[suite.Name] = suite.ID
+		}
+		for _, name := range cfg.CipherSuites {
+			id, ok := suites[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown cipher suite '%s'", name)
+			}
+			tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, id)
+		}
+	}
+
+	switch cfg.ClientAuth {
+	case "", clientAuthNone:
+		tlsConfig.ClientAuth = tls.NoClientCert
+	case clientAuthOptional:
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case clientAuthRequired:
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown client auth mode '%s'", cfg.ClientAuth)
+	}
+
+	if cfg.CAFile != "" {
+		caData, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load CA bundle: %s", err.Error())
+		}
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(caData) {
+			return nil, errors.New("no certificates found in CA bundle")
+		}
+	} else if tlsConfig.ClientAuth != tls.NoClientCert {
+		return nil, errors.New("CA bundle is required to verify client certificates")
+	}
+
+	return tlsConfig, nil
+}
+
+// ReloadTLS reloads certificates and settings of TLS listener, new settings apply to new connections
+// On error current settings are kept
+func (srv *Server) ReloadTLS() error {
+	if !srv.config.TLS.Enabled {
+		return nil
+	}
+	tlsConfig, err := buildTLSConfig(srv.config.TLS)
+	if err != nil {
+		return err
+	}
+	srv.tlsConfig.Store(tlsConfig)
+	log.Info("TLS certificates loaded")
+	return nil
+}
+
+// getTLSConfig returns config for new TLS connection, so reloaded certificates apply without listener restart
+func (srv *Server) getTLSConfig(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return srv.tlsConfig.Load().(*tls.Config), nil
+}
+
+func (srv *Server) listenTLS() {
+	port := srv.config.TLS.Port
+	if port == "" {
+		port = defaultTLSPort
+	}
+	address := srv.config.TLS.IP + ":" + port
+	tcpAddr, err := net.ResolveTCPAddr("tcp4", address)
+	if err == nil {
+		srv.tlsListener, err = net.ListenTCP("tcp", tcpAddr)
+	}
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"address": address,
+		}).Error("Error on TLS listener start")
+		os.Exit(1)
+	}
+
+	log.WithFields(log.Fields{
+		"address": address,
+	}).Info("TLS listener started")
+
+	baseConfig := &tls.Config{GetConfigForClient: srv.getTLSConfig}
+	for {
+		conn, err := srv.tlsListener.AcceptTCP()
+		if err != nil {
+			if srv.status != Running {
+				return
+			}
+			srv.stopWithError(err, "accepting TLS connection")
+		}
+		log.WithFields(log.Fields{
+			"from": conn.RemoteAddr().String(),
+			"to":   conn.LocalAddr().String(),
+		}).Info("accepting TLS connection")
+
+		srv.setSocketOptions(conn)
+		// handshake is done in connection goroutine
+		srv.acceptConnection(tls.Server(conn, baseConfig))
+	}
+}
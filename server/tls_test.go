@@ -0,0 +1,204 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	amqpclient "github.com/streadway/amqp"
+	"github.com/valinurovam/garagemq/auth"
+	"github.com/valinurovam/garagemq/config"
+)
+
+type externalAuth struct{}
+
+func (auth *externalAuth) Mechanism() string {
+	return "EXTERNAL"
+}
+
+func (auth *externalAuth) Response() string {
+	return ""
+}
+
+type testCertificate struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newTestCertificate(t *testing.T, template *x509.Certificate, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	parentCert, parentKey := template, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	return &testCertificate{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+	}
+}
+
+// writeTestCertificates writes CA and server certificates into dir and returns TLS config with them
+func writeTestCertificates(t *testing.T, dir string, ca *testCertificate, serverName string) config.TLSConfig {
+	server := newTestCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: serverName},
+		DNSNames:    []string{serverName},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+	cfg := config.TLSConfig{
+		Enabled:    true,
+		CertFile:   filepath.Join(dir, "server.crt"),
+		KeyFile:    filepath.Join(dir, "server.key"),
+		CAFile:     filepath.Join(dir, "ca.crt"),
+		MinVersion: "1.2",
+		ClientAuth: clientAuthRequired,
+	}
+	ioutil.WriteFile(cfg.CertFile, server.certPEM, 0600)
+	ioutil.WriteFile(cfg.KeyFile, server.keyPEM, 0600)
+	ioutil.WriteFile(cfg.CAFile, ca.certPEM, 0600)
+	return cfg
+}
+
+func newTestCA(t *testing.T) *testCertificate {
+	return newTestCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+}
+
+func TestBuildTLSConfig(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "garagemq_tls")
+	defer os.RemoveAll(dir)
+	cfg := writeTestCertificates(t, dir, newTestCA(t), "localhost")
+
+	tlsConfig, err := buildTLSConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig.MinVersion != tls.VersionTLS12 || tlsConfig.ClientAuth != tls.RequireAndVerifyClientCert || tlsConfig.ClientCAs == nil {
+		t.Error("Expected TLS config from settings")
+	}
+
+	cfg.CipherSuites = []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}
+	if tlsConfig, _ = buildTLSConfig(cfg); len(tlsConfig.CipherSuites) != 1 {
+		t.Error("Expected cipher suites from settings")
+	}
+
+	for _, change := range []func(cfg *config.TLSConfig){
+		func(cfg *config.TLSConfig) { cfg.MinVersion = "0.9" },
+		func(cfg *config.TLSConfig) { cfg.CipherSuites = []string{"unknown"} },
+		func(cfg *config.TLSConfig) { cfg.ClientAuth = "unknown" },
+		func(cfg *config.TLSConfig) { cfg.CAFile = "" },
+		func(cfg *config.TLSConfig) { cfg.KeyFile = cfg.CAFile },
+	} {
+		badCfg := cfg
+		change(&badCfg)
+		if _, err := buildTLSConfig(badCfg); err == nil {
+			t.Errorf("Expected error on bad settings %+v", badCfg)
+		}
+	}
+}
+
+func Test_TLSConnection_External_Success(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	dir, _ := ioutil.TempDir("", "garagemq_tls")
+	defer os.RemoveAll(dir)
+
+	ca := newTestCA(t)
+	sc.server.config.TLS = writeTestCertificates(t, dir, ca, "localhost")
+	sc.server.config.Security.Mechanisms = []string{auth.SaslExternal, auth.SaslPlain}
+	if err := sc.server.ReloadTLS(); err != nil {
+		t.Fatal(err)
+	}
+	client := newTestCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "guest"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+	clientCert, _ := tls.X509KeyPair(client.certPEM, client.keyPEM)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	toServer, _, fromClient, _, err := networkSim()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc.server.acceptConnection(tls.Server(fromClient, &tls.Config{GetConfigForClient: sc.server.getTLSConfig}))
+	conn, err := amqpclient.DialConfig("amqps://localhost:0", amqpclient.Config{
+		SASL:            []amqpclient.Authentication{&externalAuth{}},
+		TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{clientCert}},
+		Dial: func(network, addr string) (net.Conn, error) {
+			return toServer, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	serverConn := sc.server.connections[sc.server.connSeq]
+	if !serverConn.IsTLS() || serverConn.GetUsername() != "guest" {
+		t.Error("Expected TLS connection of certificate user")
+	}
+	if certs := serverConn.GetPeerCertificates(); len(certs) == 0 || certs[0].Subject.CommonName != "guest" {
+		t.Error("Expected peer certificate on connection")
+	}
+}
+
+func TestServer_ReloadTLS(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	dir, _ := ioutil.TempDir("", "garagemq_tls")
+	defer os.RemoveAll(dir)
+
+	ca := newTestCA(t)
+	sc.server.config.TLS = writeTestCertificates(t, dir, ca, "localhost")
+	if err := sc.server.ReloadTLS(); err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestCertificates(t, dir, ca, "example.com")
+	sc.server.testOnSignal(syscall.SIGHUP)
+	tlsConfig, _ := sc.server.getTLSConfig(nil)
+	cert, _ := x509.ParseCertificate(tlsConfig.Certificates[0].Certificate[0])
+	if cert.Subject.CommonName != "example.com" {
+		t.Error("Expected certificate reloaded on SIGHUP")
+	}
+
+	ioutil.WriteFile(sc.server.config.TLS.CertFile, []byte("broken"), 0600)
+	if err := sc.server.ReloadTLS(); err == nil {
+		t.Error("Expected error on broken certificate")
+	}
+	if current, _ := sc.server.getTLSConfig(nil); current != tlsConfig {
+		t.Error("Expected current certificate kept on reload error")
+	}
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/valinurovam/garagemq/auth"
+)
+
+// initUsers loads users from server storage
+// Users from config only seed storage on the first start
+func (srv *Server) initUsers() error {
+	if srv.storage.IsFirstStart() {
+		if err := srv.storeConfigUsers(); err != nil {
+			return err
+		}
+	}
+
+	srv.usersLock.Lock()
+	defer srv.usersLock.Unlock()
+	for _, user := range srv.storage.GetUsers() {
+		srv.users[user.Username] = user
+	}
+	return nil
+}
+
+// storeConfigUsers stores users from config into server storage
+func (srv *Server) storeConfigUsers() error {
+	for _, user := range srv.config.Users {
+		algorithm := user.Algorithm
+		if algorithm == "" {
+			algorithm = srv.config.Security.PasswordCheck
+		}
+		if err := auth.ValidateAlgorithm(algorithm); err != nil {
+			return err
+		}
+		err := srv.storage.AddUser(&auth.User{
+			Username:     user.Username,
+			PasswordHash: user.Password,
+			Algorithm:    algorithm,
+			Tags:         user.Tags,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// warnDeprecatedHashing warns about unsalted MD5 password hashes which are deprecated
+func (srv *Server) warnDeprecatedHashing() {
+	if srv.config.Security.PasswordCheck == auth.HashMD5 {
+		log.Warn("Unsalted MD5 password hashing is deprecated, set security.passwordCheck to sha256, sha512 or bcrypt")
+	}
+	var userNames []string
+	for userName, user := range srv.GetUsers() {
+		if user.Algorithm == auth.HashMD5 {
+			userNames = append(userNames, userName)
+		}
+	}
+	if len(userNames) > 0 {
+		sort.Strings(userNames)
+		log.WithField("users", userNames).Warn("Users have deprecated unsalted MD5 password hashes, reset their passwords")
+	}
+}
+
+// GetUsers returns copy of users with password hashes
+func (srv *Server) GetUsers() map[string]*auth.User {
+	srv.usersLock.RLock()
+	defer srv.usersLock.RUnlock()
+	users := make(map[string]*auth.User, len(srv.users))
+	for userName, user := range srv.users {
+		users[userName] = &auth.User{
+			Username:     user.Username,
+			PasswordHash: user.PasswordHash,
+			Algorithm:    user.Algorithm,
+			Tags:         append([]string{}, user.Tags...),
+		}
+	}
+	return users
+}
+
+// AddUser persists user or replace existing one
+func (srv *Server) AddUser(user *auth.User) error {
+	srv.usersLock.Lock()
+	defer srv.usersLock.Unlock()
+	if err := srv.storage.AddUser(user); err != nil {
+		return err
+	}
+	srv.users[user.Username] = user
+
+	log.WithFields(log.Fields{
+		"user": user.Username,
+		"tags": user.Tags,
+	}).Info("User stored")
+	return nil
+}
+
+// DeleteUser removes user and closes all its connections
+func (srv *Server) DeleteUser(userName string) error {
+	srv.usersLock.Lock()
+	if _, ok := srv.users[userName]; !ok {
+		srv.usersLock.Unlock()
+		return ErrNotFound
+	}
+	if err := srv.storage.DelUser(userName); err != nil {
+		srv.usersLock.Unlock()
+		return err
+	}
+	delete(srv.users, userName)
+	if err := srv.deleteUserPermissions(userName); err != nil {
+		srv.usersLock.Unlock()
+		return err
+	}
+	srv.usersLock.Unlock()
+
+	srv.closeConnections(func(conn *Connection) bool {
+		return conn.GetUsername() == userName
+	}, "User deleted")
+
+	log.WithFields(log.Fields{
+		"user": userName,
+	}).Info("User deleted")
+	return nil
+}
+
+// AuthenticateUser returns user if one of auth backends accepts password, otherwise nil
+func (srv *Server) AuthenticateUser(userName string, password string) *auth.User {
+	user, _ := srv.AuthorizeUser(userName, password)
+	return user
+}
+
+// AuthorizeUser returns user and authorizer of auth backend which accepts password, otherwise nil
+// Authorizer checks user access to vhosts and resources, like it does for AMQP connections
+func (srv *Server) AuthorizeUser(userName string, password string) (*auth.User, auth.Authorizer) {
+	return srv.authenticate(auth.SaslData{Username: userName, Password: password})
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"os"
+	"testing"
+
+	"github.com/valinurovam/garagemq/auth"
+	"github.com/valinurovam/garagemq/srvstorage"
+)
+
+func TestServer_AuthenticateUser(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+
+	user := sc.server.AuthenticateUser("guest", "guest")
+	if user == nil {
+		t.Fatal("Expected user authenticated")
+	}
+	if !user.HasTag(auth.TagAdministrator) {
+		t.Error("Expected user tags from config")
+	}
+	if sc.server.AuthenticateUser("guest", "wrong") != nil {
+		t.Error("Expected nil on wrong password")
+	}
+	if sc.server.AuthenticateUser("unknown", "guest") != nil {
+		t.Error("Expected nil on unknown user")
+	}
+
+	users := sc.server.GetUsers()
+	users["guest"].Tags[0] = auth.TagManagement
+	if !sc.server.AuthenticateUser("guest", "guest").HasTag(auth.TagAdministrator) {
+		t.Error("Expected GetUsers returns copy of users")
+	}
+}
+
+func TestServer_UsersPersist(t *testing.T) {
+	sc, _ := getNewSC(getPersistentTestConfig())
+	defer sc.clean()
+	sc.server.storage.UpdateLastStart()
+
+	hash, _ := auth.HashPassword("secret", auth.HashMD5)
+	user := &auth.User{Username: "new", PasswordHash: hash, Algorithm: auth.HashMD5, Tags: []string{auth.TagManagement}}
+	if err := sc.server.AddUser(user); err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.server.DeleteUser("test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.server.DeleteUser("unknown"); err != ErrNotFound {
+		t.Errorf("Expected not found, actual %v", err)
+	}
+	sc.server.Stop()
+
+	// config users seed only the first start
+	sc, _ = getNewSC(getPersistentTestConfig())
+	restored := sc.server.AuthenticateUser("new", "secret")
+	if restored == nil || !restored.HasTag(auth.TagManagement) {
+		t.Error("Expected user restored after server restart")
+	}
+	if _, ok := sc.server.GetUsers()["test"]; ok {
+		t.Error("Expected deleted user is not restored from config")
+	}
+}
+
+func TestMigrateSchema_ConfigUsers(t *testing.T) {
+	defer (&ServerClient{}).clean()
+	cfg := getPersistentTestConfig()
+	stPath := getStoragePath(cfg.srvConfig.Db.DefaultPath, "badger", serverStorageName, true)
+	os.MkdirAll(stPath, 0777)
+	st := srvstorage.NewSrvStorage(openStorage("badger", stPath), cfg.srvConfig.Proto)
+	st.UpdateLastStart()
+	st.SetSchemaVersion(2)
+	st.Close()
+
+	if err := MigrateSchema(&cfg.srvConfig, false); err != nil {
+		t.Fatal(err)
+	}
+
+	st = srvstorage.NewSrvStorage(openStorage("badger", stPath), cfg.srvConfig.Proto)
+	defer st.Close()
+	if users := st.GetUsers(); len(users) != len(cfg.srvConfig.Users) {
+		t.Errorf("Expected config users stored on upgrade, actual %d", len(users))
+	}
+}
@@ -1,8 +1,6 @@
 package server
 
 import (
-	"errors"
-	"fmt"
 	"sync"
 
 	log "github.com/sirupsen/logrus"
@@ -10,8 +8,10 @@ import (
 	"github.com/valinurovam/garagemq/binding"
 	"github.com/valinurovam/garagemq/config"
 	"github.com/valinurovam/garagemq/exchange"
+	"github.com/valinurovam/garagemq/limits"
 	"github.com/valinurovam/garagemq/metrics"
 	"github.com/valinurovam/garagemq/msgstorage"
+	"github.com/valinurovam/garagemq/policy"
 	"github.com/valinurovam/garagemq/queue"
 	"github.com/valinurovam/garagemq/srvstorage"
 )
@@ -27,6 +27,7 @@ type VirtualHost struct {
 	exchanges       map[string]*exchange.Exchange
 	quLock          sync.RWMutex
 	queues          map[string]*queue.Queue
+	queueTotals     queue.Totals
 	msgStorageP     *msgstorage.MsgStorage
 	msgStorageT     *msgstorage.MsgStorage
 	srv             *Server
@@ -34,6 +35,11 @@ type VirtualHost struct {
 	srvConfig       *config.Config
 	logger          *log.Entry
 	autoDeleteQueue chan string
+	limitsLock      sync.RWMutex
+	limits          limits.VhostLimits
+	connections     int64
+	policyLock      sync.RWMutex
+	policies        map[string]*policy.Policy
 }
 
 // NewVhost returns instance of VirtualHost
@@ -55,12 +61,14 @@ func NewVhost(name string, system bool, msgStoragePersistent *msgstorage.MsgStor
 		srvConfig:       srv.config,
 		srv:             srv,
 		autoDeleteQueue: make(chan string, 1),
+		policies:        make(map[string]*policy.Policy),
 	}
 
 	vhost.logger = log.WithFields(log.Fields{
 		"vhost": name,
 	})
 
+	vhost.initStorageMetrics()
 	vhost.initSystemExchanges()
 	vhost.loadExchanges()
 	vhost.loadQueues()
@@ -180,13 +188,38 @@ func (vhost *VirtualHost) GetExchanges() map[string]*exchange.Exchange {
 
 // GetDefaultExchange returns default exchange
 func (vhost *VirtualHost) GetDefaultExchange() *exchange.Exchange {
-	return vhost.exchanges[exDefaultName]
+	return vhost.GetExchange(exDefaultName)
 }
 
 // AppendExchange append new exchange and persist if it is durable
 func (vhost *VirtualHost) AppendExchange(ex *exchange.Exchange) {
+	vhost.applyExchangePolicy(ex)
+
+	vhost.exLock.Lock()
+	defer vhost.exLock.Unlock()
+	vhost.appendExchange(ex)
+}
+
+// declareExchange appends new exchange if exchange with the same name does not exist and exchange limit allows it,
+// otherwise existing exchange is returned
+// Lookup, limit check and append are done under one lock, so concurrent declares could not replace
+// each other or exceed the limit
+func (vhost *VirtualHost) declareExchange(ex *exchange.Exchange) (*exchange.Exchange, error) {
+	vhost.applyExchangePolicy(ex)
+
 	vhost.exLock.Lock()
 	defer vhost.exLock.Unlock()
+	if existingExchange := vhost.getExchange(ex.GetName()); existingExchange != nil {
+		return existingExchange, nil
+	}
+	if err := vhost.checkExchangeLimit(); err != nil {
+		return nil, err
+	}
+	vhost.appendExchange(ex)
+	return nil, nil
+}
+
+func (vhost *VirtualHost) appendExchange(ex *exchange.Exchange) {
 	exTypeAlias, _ := exchange.GetExchangeTypeAlias(ex.ExType())
 	vhost.logger.WithFields(log.Fields{
 		"name": ex.GetName(),
@@ -199,16 +232,38 @@ func (vhost *VirtualHost) AppendExchange(ex *exchange.Exchange) {
 	}
 
 	ex.SetMetrics(&exchange.MetricsState{
-		MsgIn:  metrics.AddCounter(fmt.Sprintf("exchange.%s.%s.msg_in", vhost.name, ex.GetName())),
-		MsgOut: metrics.AddCounter(fmt.Sprintf("exchange.%s.%s.msg_out", vhost.name, ex.GetName())),
+		MsgIn:  metrics.AddCounter("exchange.msg_in", vhost.exchangeLabels(ex.GetName())...),
+		MsgOut: metrics.AddCounter("exchange.msg_out", vhost.exchangeLabels(ex.GetName())...),
+
+		BodySize: metrics.AddHistogram("exchange.body_size_bytes", metrics.SizeBuckets, vhost.exchangeLabels(ex.GetName())...),
 	})
+}
+
+func (vhost *VirtualHost) initStorageMetrics() {
+	storages := map[string]*msgstorage.MsgStorage{"persistent": vhost.msgStorageP, "transient": vhost.msgStorageT}
+	for kind, storage := range storages {
+		labels := []metrics.Label{{Name: "vhost", Value: vhost.name}, {Name: "storage", Value: kind}}
+		storage.SetMetrics(&msgstorage.MetricsState{
+			PersistDuration:  metrics.AddHistogram("msgstorage.persist_duration_seconds", metrics.LatencyBuckets, labels...),
+			PersistBatchSize: metrics.AddHistogram("msgstorage.persist_batch_size", metrics.CountBuckets, labels...),
+		})
+	}
+}
 
+// exchangeLabels returns labels of exchange counters
+func (vhost *VirtualHost) exchangeLabels(name string) []metrics.Label {
+	return []metrics.Label{{Name: "vhost", Value: vhost.name}, {Name: "exchange", Value: name}}
+}
+
+// queueLabels returns labels of queue counters
+func (vhost *VirtualHost) queueLabels(name string) []metrics.Label {
+	return []metrics.Label{{Name: "vhost", Value: vhost.name}, {Name: "queue", Value: name}}
 }
 
 // NewQueue returns new instance of queue by params
 // we can't use just queue.NewQueue, cause we need to set msgStorage to queue
 func (vhost *VirtualHost) NewQueue(name string, connID uint64, exclusive bool, autoDelete bool, durable bool, shardSize int) *queue.Queue {
-	return queue.NewQueue(
+	qu := queue.NewQueue(
 		name,
 		connID,
 		exclusive,
@@ -219,13 +274,41 @@ func (vhost *VirtualHost) NewQueue(name string, connID uint64, exclusive bool, a
 		vhost.msgStorageT,
 		vhost.autoDeleteQueue,
 	)
+	qu.SetDeadLetterHandler(vhost.deadLetter)
+	qu.SetTotals(&vhost.queueTotals)
+	return qu
 }
 
 // AppendQueue append new queue and persist if it is durable and
 // bindings into default exchange
 func (vhost *VirtualHost) AppendQueue(qu *queue.Queue) error {
+	vhost.applyQueuePolicy(qu)
+
+	vhost.quLock.Lock()
+	defer vhost.quLock.Unlock()
+	return vhost.appendQueue(qu)
+}
+
+// declareQueue starts and appends new queue if queue with the same name does not exist and queue limit allows it,
+// otherwise existing queue is returned
+// Lookup, limit check and append are done under one lock, so concurrent declares could not replace
+// each other or exceed the limit
+func (vhost *VirtualHost) declareQueue(qu *queue.Queue) (*queue.Queue, error) {
+	vhost.applyQueuePolicy(qu)
+
 	vhost.quLock.Lock()
 	defer vhost.quLock.Unlock()
+	if existingQueue := vhost.getQueue(qu.GetName()); existingQueue != nil {
+		return existingQueue, nil
+	}
+	if err := vhost.checkQueueLimit(); err != nil {
+		return nil, err
+	}
+	qu.Start()
+	return nil, vhost.appendQueue(qu)
+}
+
+func (vhost *VirtualHost) appendQueue(qu *queue.Queue) error {
 	vhost.logger.WithFields(log.Fields{
 		"queueName": qu.GetName(),
 	}).Info("Append queue")
@@ -251,19 +334,21 @@ func (vhost *VirtualHost) AppendQueue(qu *queue.Queue) error {
 	}
 
 	qu.SetMetrics(&queue.MetricsState{
-		Ready:    metrics.AddCounter(fmt.Sprintf("queue.%s.%s.ready", vhost.name, qu.GetName())),
-		Unacked:  metrics.AddCounter(fmt.Sprintf("queue.%s.%s.unacked", vhost.name, qu.GetName())),
-		Total:    metrics.AddCounter(fmt.Sprintf("queue.%s.%s.total", vhost.name, qu.GetName())),
-		Incoming: metrics.AddCounter(fmt.Sprintf("queue.%s.%s.incoming", vhost.name, qu.GetName())),
-		Deliver:  metrics.AddCounter(fmt.Sprintf("queue.%s.%s.deliver", vhost.name, qu.GetName())),
-		Get:      metrics.AddCounter(fmt.Sprintf("queue.%s.%s.get", vhost.name, qu.GetName())),
-		Ack:      metrics.AddCounter(fmt.Sprintf("queue.%s.%s.ack", vhost.name, qu.GetName())),
+		Ready:    metrics.AddGauge("queue.ready", vhost.queueLabels(qu.GetName())...),
+		Unacked:  metrics.AddGauge("queue.unacked", vhost.queueLabels(qu.GetName())...),
+		Total:    metrics.AddGauge("queue.total", vhost.queueLabels(qu.GetName())...),
+		Incoming: metrics.AddCounter("queue.incoming", vhost.queueLabels(qu.GetName())...),
+		Deliver:  metrics.AddCounter("queue.deliver", vhost.queueLabels(qu.GetName())...),
+		Get:      metrics.AddCounter("queue.get", vhost.queueLabels(qu.GetName())...),
+		Ack:      metrics.AddCounter("queue.ack", vhost.queueLabels(qu.GetName())...),
 
 		ServerReady:   vhost.srv.metrics.Ready,
 		ServerUnacked: vhost.srv.metrics.Unacked,
 		ServerTotal:   vhost.srv.metrics.Total,
 		ServerDeliver: vhost.srv.metrics.Deliver,
 		ServerAck:     vhost.srv.metrics.Ack,
+
+		DeliverLatency: metrics.AddHistogram("queue.deliver_latency_seconds", metrics.LatencyBuckets, vhost.queueLabels(qu.GetName())...),
 	})
 
 	return nil
@@ -288,9 +373,9 @@ func (vhost *VirtualHost) loadQueues() {
 		return
 	}
 	for _, q := range queues {
-		vhost.AppendQueue(
-			vhost.NewQueue(q.GetName(), 0, false, q.IsAutoDelete(), q.IsDurable(), vhost.srvConfig.Queue.ShardSize),
-		)
+		qu := vhost.NewQueue(q.GetName(), 0, false, q.IsAutoDelete(), q.IsDurable(), vhost.srvConfig.Queue.ShardSize)
+		qu.SetArguments(q.GetArguments())
+		vhost.AppendQueue(qu)
 	}
 }
 
@@ -339,7 +424,7 @@ func (vhost *VirtualHost) DeleteQueue(queueName string, ifUnused bool, ifEmpty b
 
 	qu := vhost.getQueue(queueName)
 	if qu == nil {
-		return 0, errors.New("not found")
+		return 0, ErrNotFound
 	}
 
 	var length, err = qu.Delete(ifUnused, ifEmpty)
@@ -355,6 +440,9 @@ func (vhost *VirtualHost) DeleteQueue(queueName string, ifUnused bool, ifEmpty b
 	}
 	vhost.srvStorage.DelQueue(vhost.name, qu)
 	delete(vhost.queues, queueName)
+	for _, entity := range []string{"queue", "consumer"} {
+		metrics.RemoveCounters(entity, vhost.queueLabels(queueName)...)
+	}
 
 	return length, nil
 }
@@ -375,6 +463,7 @@ func (vhost *VirtualHost) Stop() error {
 	}
 
 	vhost.msgStorageP.Close()
+	vhost.msgStorageT.Close()
 	vhost.logger.Info("Storage closed")
 	close(vhost.autoDeleteQueue)
 	return nil
@@ -0,0 +1,300 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/valinurovam/garagemq/amqp"
+	"github.com/valinurovam/garagemq/binding"
+	"github.com/valinurovam/garagemq/exchange"
+	"github.com/valinurovam/garagemq/msgstorage"
+	"github.com/valinurovam/garagemq/queue"
+)
+
+// Backup archive is gzip compressed stream of
+// header: magic shortstr, format version long, proto version shortstr, vhost name shortstr
+// records: kind octet and record data, stream ends by record with kind backupEnd
+const backupMagic = "garagemq-vhost-backup"
+const backupFormatVersion = 1
+
+const (
+	backupEnd byte = iota
+	backupExchange
+	backupQueue
+	backupBinding
+	backupMessage
+)
+
+// BackupVhost writes snapshot of virtual host definitions and persistent messages into writer
+func (srv *Server) BackupVhost(name string, writer io.Writer) error {
+	vhost := srv.getVhost(name)
+	if vhost == nil {
+		return fmt.Errorf("vhost '%s' not found", name)
+	}
+
+	// definitions and message references are copied under locks, so they are consistent,
+	// and written after locks are released, so slow reader does not block the vhost
+	vhost.exLock.RLock()
+	vhost.quLock.RLock()
+	definitions, err := vhost.backupDefinitions()
+	snapshot := vhost.msgStorageP.Snapshot()
+	vhost.quLock.RUnlock()
+	vhost.exLock.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(writer)
+	if err := writeBackupHeader(gz, srv.protoVersion, name); err != nil {
+		return err
+	}
+	if _, err := gz.Write(definitions); err != nil {
+		return err
+	}
+	if err := vhost.backupMessages(gz, snapshot); err != nil {
+		return err
+	}
+
+	if err := amqp.WriteOctet(gz, backupEnd); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func writeBackupHeader(writer io.Writer, protoVersion string, vhost string) (err error) {
+	if err = amqp.WriteShortstr(writer, backupMagic); err != nil {
+		return err
+	}
+	if err = amqp.WriteLong(writer, backupFormatVersion); err != nil {
+		return err
+	}
+	if err = amqp.WriteShortstr(writer, protoVersion); err != nil {
+		return err
+	}
+	return amqp.WriteShortstr(writer, vhost)
+}
+
+func writeBackupRecord(writer io.Writer, kind byte, data []byte) (err error) {
+	if err = amqp.WriteOctet(writer, kind); err != nil {
+		return err
+	}
+	return amqp.WriteLongstr(writer, data)
+}
+
+// backupDefinitions returns records of exchanges, queues and bindings
+func (vhost *VirtualHost) backupDefinitions() ([]byte, error) {
+	writer := &bytes.Buffer{}
+	protoVersion := vhost.srv.protoVersion
+	for _, ex := range vhost.srvStorage.GetVhostExchanges(vhost.name) {
+		data, err := ex.Marshal(protoVersion)
+		if err != nil {
+			return nil, err
+		}
+		if err = writeBackupRecord(writer, backupExchange, data); err != nil {
+			return nil, err
+		}
+	}
+	for _, qu := range vhost.srvStorage.GetVhostQueues(vhost.name) {
+		data, err := qu.Marshal(protoVersion)
+		if err != nil {
+			return nil, err
+		}
+		if err = writeBackupRecord(writer, backupQueue, data); err != nil {
+			return nil, err
+		}
+	}
+	for _, bind := range vhost.srvStorage.GetVhostBindings(vhost.name) {
+		data, err := bind.Marshal(protoVersion)
+		if err != nil {
+			return nil, err
+		}
+		if err = writeBackupRecord(writer, backupBinding, data); err != nil {
+			return nil, err
+		}
+	}
+	return writer.Bytes(), nil
+}
+
+func (vhost *VirtualHost) backupMessages(writer io.Writer, snapshot *msgstorage.Snapshot) error {
+	return snapshot.Iterate(func(queueName string, message *amqp.Message) error {
+		data, err := message.Marshal(vhost.srv.protoVersion)
+		if err != nil {
+			return err
+		}
+		if err = amqp.WriteOctet(writer, backupMessage); err != nil {
+			return err
+		}
+		if err = amqp.WriteShortstr(writer, queueName); err != nil {
+			return err
+		}
+		return amqp.WriteLongstr(writer, data)
+	})
+}
+
+// RestoreVhost recreates virtual host from backup archive
+// Virtual host is created if not exists, already existing exchanges and queues are kept
+// and messages are appended into queues. If name is empty vhost name from archive is used
+func (srv *Server) RestoreVhost(name string, reader io.Reader) error {
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	backupName, err := readBackupHeader(gz, srv.protoVersion)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = backupName
+	}
+	if err := srv.ValidateVhostName(name); err != nil {
+		return err
+	}
+
+	vhost := srv.addVhost(name)
+	restored := make(map[byte]int)
+	// message routed into several queues stored once per queue and should get the same new ID
+	messages := make(map[uint64]*amqp.Message)
+
+	for {
+		kind, err := amqp.ReadOctet(gz)
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case backupEnd:
+			vhost.logger.WithFields(log.Fields{
+				"exchanges": restored[backupExchange],
+				"queues":    restored[backupQueue],
+				"bindings":  restored[backupBinding],
+				"messages":  restored[backupMessage],
+			}).Info("Vhost restored from backup")
+			return nil
+		case backupExchange:
+			err = vhost.restoreExchange(gz)
+		case backupQueue:
+			err = vhost.restoreQueue(gz)
+		case backupBinding:
+			err = vhost.restoreBinding(gz)
+		case backupMessage:
+			err = vhost.restoreMessage(gz, messages)
+		default:
+			err = fmt.Errorf("unknown backup record %d", kind)
+		}
+		if err != nil {
+			return err
+		}
+		restored[kind]++
+	}
+}
+
+func readBackupHeader(reader io.Reader, protoVersion string) (vhost string, err error) {
+	magic, err := amqp.ReadShortstr(reader)
+	if err != nil || magic != backupMagic {
+		return "", errors.New("not a vhost backup")
+	}
+	version, err := amqp.ReadLong(reader)
+	if err != nil {
+		return "", err
+	}
+	if version != backupFormatVersion {
+		return "", fmt.Errorf("unsupported backup format version %d", version)
+	}
+	backupProto, err := amqp.ReadShortstr(reader)
+	if err != nil {
+		return "", err
+	}
+	if backupProto != protoVersion {
+		return "", fmt.Errorf("backup protocol '%s' differs from server protocol '%s'", backupProto, protoVersion)
+	}
+	return amqp.ReadShortstr(reader)
+}
+
+func (vhost *VirtualHost) restoreExchange(reader io.Reader) error {
+	data, err := amqp.ReadLongstr(reader)
+	if err != nil {
+		return err
+	}
+	ex := &exchange.Exchange{}
+	if err = ex.Unmarshal(data); err != nil {
+		return err
+	}
+	if current := vhost.GetExchange(ex.GetName()); current != nil {
+		if current.ExType() != ex.ExType() {
+			return fmt.Errorf("exchange '%s' already exists with other type", ex.GetName())
+		}
+		return nil
+	}
+	vhost.AppendExchange(ex)
+	return nil
+}
+
+func (vhost *VirtualHost) restoreQueue(reader io.Reader) error {
+	data, err := amqp.ReadLongstr(reader)
+	if err != nil {
+		return err
+	}
+	qu := &queue.Queue{}
+	if err = qu.Unmarshal(data, vhost.srv.protoVersion); err != nil {
+		return err
+	}
+	if vhost.GetQueue(qu.GetName()) != nil {
+		return nil
+	}
+	newQueue := vhost.NewQueue(qu.GetName(), 0, false, qu.IsAutoDelete(), true, vhost.srvConfig.Queue.ShardSize)
+	newQueue.SetArguments(qu.GetArguments())
+	newQueue.Start()
+	return vhost.AppendQueue(newQueue)
+}
+
+func (vhost *VirtualHost) restoreBinding(reader io.Reader) error {
+	data, err := amqp.ReadLongstr(reader)
+	if err != nil {
+		return err
+	}
+	bind := &binding.Binding{}
+	if err = bind.Unmarshal(data, vhost.srv.protoVersion); err != nil {
+		return err
+	}
+	ex := vhost.GetExchange(bind.Exchange)
+	if ex == nil || vhost.GetQueue(bind.Queue) == nil {
+		return fmt.Errorf("binding '%s' refers to unknown exchange or queue", bind.GetName())
+	}
+	ex.AppendBinding(bind)
+	vhost.PersistBinding(bind)
+	return nil
+}
+
+func (vhost *VirtualHost) restoreMessage(reader io.Reader, messages map[uint64]*amqp.Message) error {
+	queueName, err := amqp.ReadShortstr(reader)
+	if err != nil {
+		return err
+	}
+	data, err := amqp.ReadLongstr(reader)
+	if err != nil {
+		return err
+	}
+	message := &amqp.Message{}
+	if err = message.Unmarshal(data, vhost.srv.protoVersion); err != nil {
+		return err
+	}
+	if restored, ok := messages[message.ID]; ok {
+		message = restored
+	} else {
+		messages[message.ID] = message
+		// new ID will be generated by queue, backup IDs could clash with IDs of this server
+		message.ID = 0
+	}
+
+	qu := vhost.GetQueue(queueName)
+	if qu == nil {
+		return fmt.Errorf("message refers to unknown queue '%s'", queueName)
+	}
+	qu.Push(message)
+	return nil
+}
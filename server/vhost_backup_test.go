@@ -0,0 +1,135 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	amqp2 "github.com/valinurovam/garagemq/amqp"
+)
+
+func TestServer_BackupRestoreVhost(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	ch, _ := sc.client.Channel()
+
+	ch.ExchangeDeclare("testExFanout", "fanout", true, false, false, false, emptyTable)
+	for _, name := range []string{"q1", "q2"} {
+		ch.QueueDeclare(name, true, false, false, false, emptyTable)
+		ch.QueueBind(name, "", "testExFanout", false, emptyTable)
+	}
+	ch.QueueDeclare("transient", false, false, false, false, emptyTable)
+
+	for i := 0; i < 3; i++ {
+		ch.Publish("testExFanout", "", false, false, amqp.Publishing{Body: []byte("persistent"), DeliveryMode: amqp.Persistent})
+	}
+	ch.Publish("", "q1", false, false, amqp.Publishing{Body: []byte("transient")})
+	time.Sleep(100 * time.Millisecond)
+
+	backup := bytes.NewBuffer(nil)
+	if err := sc.server.BackupVhost("/", backup); err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.server.BackupVhost("unknown", bytes.NewBuffer(nil)); err == nil {
+		t.Error("Expected error on backup of unknown vhost")
+	}
+
+	if err := sc.server.RestoreVhost("restored", backup); err != nil {
+		t.Fatal(err)
+	}
+
+	vhost := sc.server.GetVhost("restored")
+	if vhost == nil {
+		t.Fatal("Expected restored vhost")
+	}
+	if _, ok := sc.server.storage.GetVhosts()["restored"]; !ok {
+		t.Error("Expected restored vhost persisted")
+	}
+	if vhost.GetQueue("transient") != nil {
+		t.Error("Expected not durable queue is not restored")
+	}
+	ex := vhost.GetExchange("testExFanout")
+	if ex == nil {
+		t.Fatal("Expected restored exchange")
+	}
+	if len(ex.GetMatchedQueues(&amqp2.Message{Exchange: "testExFanout"})) != 2 {
+		t.Error("Expected restored bindings")
+	}
+
+	for _, name := range []string{"q1", "q2"} {
+		qu := vhost.GetQueue(name)
+		if qu == nil {
+			t.Fatalf("Expected restored queue %s", name)
+		}
+		if qu.Length() != 3 {
+			t.Errorf("Expected 3 persistent messages in %s, actual %d", name, qu.Length())
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	message := vhost.GetQueue("q1").Pop()
+	if message == nil || string(message.Body[0].Payload) != "persistent" {
+		t.Fatal("Expected restored message")
+	}
+	if cnt := vhost.msgStorageP.GetRefCount(message.ID); cnt != 2 {
+		t.Errorf("Expected message shared by queues, actual references %d", cnt)
+	}
+}
+
+func TestServer_BackupVhost_SlowReader(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	vhost := sc.server.GetVhost("/")
+	persistent := byte(2)
+	properties := &amqp2.BasicPropertyList{DeliveryMode: &persistent}
+	vhost.DeclareQueue("q1", true, false, nil)
+	vhost.PublishMessage("", "q1", properties, []byte("persistent"))
+
+	// backup stream is not read until vhost is changed
+	reader, writer := io.Pipe()
+	backupErr := make(chan error, 1)
+	go func() {
+		backupErr <- sc.server.BackupVhost("/", writer)
+		writer.Close()
+	}()
+
+	declared := make(chan struct{})
+	go func() {
+		vhost.DeclareQueue("q2", true, false, nil)
+		vhost.PublishMessage("", "q2", properties, []byte("persistent"))
+		// persists pending messages under storage lock
+		vhost.msgStorageP.Snapshot()
+		close(declared)
+	}()
+	select {
+	case <-declared:
+	case <-time.After(time.Second):
+		t.Fatal("Expected vhost is not blocked by backup reader")
+	}
+
+	backup, _ := ioutil.ReadAll(reader)
+	if err := <-backupErr; err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.server.RestoreVhost("restored", bytes.NewReader(backup)); err != nil {
+		t.Fatal(err)
+	}
+	if qu := sc.server.GetVhost("restored").GetQueue("q1"); qu == nil || qu.Length() != 1 {
+		t.Error("Expected message of snapshot restored")
+	}
+}
+
+func TestServer_RestoreVhost_Broken(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+
+	if err := sc.server.RestoreVhost("restored", bytes.NewBufferString("garbage")); err == nil {
+		t.Error("Expected error on broken archive")
+	}
+	if sc.server.GetVhost("restored") != nil {
+		t.Error("Expected vhost is not created from broken archive")
+	}
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/valinurovam/garagemq/limits"
+)
+
+// initVhostLimits loads limits of virtual hosts from server storage
+func (srv *Server) initVhostLimits() {
+	for _, vhostLimits := range srv.storage.GetVhostLimits() {
+		if vhost := srv.GetVhost(vhostLimits.Vhost); vhost != nil {
+			vhost.setLimits(*vhostLimits)
+		}
+	}
+}
+
+// GetVhostLimits returns limits of virtual hosts which have any limit set
+func (srv *Server) GetVhostLimits() []*limits.VhostLimits {
+	var result []*limits.VhostLimits
+	for _, vhost := range srv.GetVhosts() {
+		if vhostLimits := vhost.GetLimits(); !vhostLimits.IsEmpty() {
+			result = append(result, &vhostLimits)
+		}
+	}
+	return result
+}
+
+// SetVhostLimits persists limits of virtual host and replace existing ones
+// Limits without any limit set clear limits of virtual host
+// Already allocated resources are kept, new limits are checked on next allocation
+func (srv *Server) SetVhostLimits(vhostLimits *limits.VhostLimits) error {
+	vhost := srv.GetVhost(vhostLimits.Vhost)
+	if vhost == nil {
+		return ErrNotFound
+	}
+
+	vhost.limitsLock.Lock()
+	defer vhost.limitsLock.Unlock()
+	if vhostLimits.IsEmpty() {
+		if !vhost.limits.IsEmpty() {
+			if err := srv.storage.DelVhostLimits(vhost.name); err != nil {
+				return err
+			}
+		}
+	} else if err := srv.storage.AddVhostLimits(vhostLimits); err != nil {
+		return err
+	}
+	vhost.limits = *vhostLimits
+
+	log.WithFields(log.Fields{
+		"vhost":           vhostLimits.Vhost,
+		"max-connections": vhostLimits.MaxConnections,
+		"max-channels":    vhostLimits.MaxChannels,
+		"max-queues":      vhostLimits.MaxQueues,
+		"max-exchanges":   vhostLimits.MaxExchanges,
+		"max-messages":    vhostLimits.MaxMessages,
+		"max-bytes":       vhostLimits.MaxBytes,
+	}).Info("Vhost limits stored")
+	return nil
+}
+
+// ClearVhostLimits removes all limits of virtual host
+func (srv *Server) ClearVhostLimits(name string) error {
+	return srv.SetVhostLimits(&limits.VhostLimits{Vhost: name})
+}
+
+// GetLimits returns limits of virtual host
+func (vhost *VirtualHost) GetLimits() limits.VhostLimits {
+	vhost.limitsLock.RLock()
+	defer vhost.limitsLock.RUnlock()
+	return vhost.limits
+}
+
+func (vhost *VirtualHost) setLimits(vhostLimits limits.VhostLimits) {
+	vhost.limitsLock.Lock()
+	defer vhost.limitsLock.Unlock()
+	vhost.limits = vhostLimits
+}
+
+// acquireConnection counts new connection to virtual host if connection limit allows it
+func (vhost *VirtualHost) acquireConnection() error {
+	limit := vhost.GetLimits().MaxConnections
+	if count := atomic.AddInt64(&vhost.connections, 1); limit > 0 && uint64(count) > limit {
+		atomic.AddInt64(&vhost.connections, -1)
+		return fmt.Errorf("connection limit (%d) is reached for vhost '%s'", limit, vhost.name)
+	}
+	return nil
+}
+
+func (vhost *VirtualHost) releaseConnection() {
+	atomic.AddInt64(&vhost.connections, -1)
+}
+
+// checkQueueLimit checks if one more queue could be declared in virtual host
+// Caller must hold quLock, so queue is appended before other declare is checked
+func (vhost *VirtualHost) checkQueueLimit() error {
+	limit := vhost.GetLimits().MaxQueues
+	if limit == 0 {
+		return nil
+	}
+	if uint64(len(vhost.queues)) >= limit {
+		return fmt.Errorf("queue limit (%d) is reached for vhost '%s'", limit, vhost.name)
+	}
+	return nil
+}
+
+// checkExchangeLimit checks if one more exchange could be declared in virtual host
+// System exchanges are not counted. Caller must hold exLock, so exchange is appended before other declare is checked
+func (vhost *VirtualHost) checkExchangeLimit() error {
+	limit := vhost.GetLimits().MaxExchanges
+	if limit == 0 {
+		return nil
+	}
+	var count uint64
+	for _, ex := range vhost.exchanges {
+		if !ex.IsSystem() {
+			count++
+		}
+	}
+	if count >= limit {
+		return fmt.Errorf("exchange limit (%d) is reached for vhost '%s'", limit, vhost.name)
+	}
+	return nil
+}
+
+// checkMessageLimit checks if messages could be published into virtual host
+// Publishing is refused while ready messages of all vhost queues reach message or byte limit
+// Queues add their ready messages into vhost totals, so queues are not iterated on each publish
+func (vhost *VirtualHost) checkMessageLimit() error {
+	vhostLimits := vhost.GetLimits()
+	if vhostLimits.MaxMessages == 0 && vhostLimits.MaxBytes == 0 {
+		return nil
+	}
+	messages, bytes := vhost.queueTotals.Messages(), vhost.queueTotals.Bytes()
+	if vhostLimits.MaxMessages > 0 && messages >= vhostLimits.MaxMessages {
+		return fmt.Errorf("message limit (%d) is reached for vhost '%s'", vhostLimits.MaxMessages, vhost.name)
+	}
+	if vhostLimits.MaxBytes > 0 && bytes >= vhostLimits.MaxBytes {
+		return fmt.Errorf("byte limit (%d) is reached for vhost '%s'", vhostLimits.MaxBytes, vhost.name)
+	}
+	return nil
+}
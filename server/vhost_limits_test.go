@@ -0,0 +1,231 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	amqpclient "github.com/streadway/amqp"
+	"github.com/valinurovam/garagemq/amqp"
+	"github.com/valinurovam/garagemq/limits"
+)
+
+func TestServer_VhostLimits(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+
+	if err := sc.server.SetVhostLimits(&limits.VhostLimits{Vhost: "unknown", MaxQueues: 1}); err != ErrNotFound {
+		t.Errorf("Expected not found on unknown vhost, actual %v", err)
+	}
+
+	if _, err := sc.server.AddVhost("tenant"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/", "tenant"} {
+		if err := sc.server.SetVhostLimits(&limits.VhostLimits{Vhost: name, MaxQueues: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(sc.server.GetVhostLimits()) != 2 || len(sc.server.storage.GetVhostLimits()) != 2 {
+		t.Fatal("Expected limits of both vhosts stored")
+	}
+
+	if err := sc.server.ClearVhostLimits("/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.server.ClearVhostLimits("/"); err != nil {
+		t.Errorf("Expected clear of empty limits succeed, actual %v", err)
+	}
+	if sc.server.GetVhost("/").GetLimits().MaxQueues != 0 {
+		t.Error("Expected limits of default vhost cleared")
+	}
+
+	if err := sc.server.DeleteVhost("tenant"); err != nil {
+		t.Fatal(err)
+	}
+	if len(sc.server.GetVhostLimits()) != 0 || len(sc.server.storage.GetVhostLimits()) != 0 {
+		t.Error("Expected limits removed with vhost")
+	}
+}
+
+func Test_VhostLimits_Connections(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	// test server client and exclusive client are already connected
+	sc.server.SetVhostLimits(&limits.VhostLimits{Vhost: "/", MaxConnections: 2})
+
+	// client reports any connection close on connection.open as vhost access error
+	if _, err := sc.dial(amqpclient.Config{}); err != amqpclient.ErrVhost {
+		t.Fatalf("Expected connection refused by limit, actual %v", err)
+	}
+
+	sc.client.Close()
+	var err error
+	for i := 0; i < 10; i++ {
+		var client *amqpclient.Connection
+		if client, err = sc.dial(amqpclient.Config{}); err == nil {
+			client.Close()
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err != nil {
+		t.Errorf("Expected connection allowed after other one closed, actual %v", err)
+	}
+}
+
+func Test_VhostLimits_Channels(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	sc.server.SetVhostLimits(&limits.VhostLimits{Vhost: "/", MaxChannels: 1})
+
+	ch, err := sc.client.Channel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch.Close()
+	if ch, err = sc.client.Channel(); err != nil {
+		t.Fatalf("Expected channel allowed after other one closed, actual %v", err)
+	}
+	// channel closed by server error is released too
+	ch.QueueDeclare("", false, false, false, false, emptyTable)
+	if ch, err = sc.client.Channel(); err != nil {
+		t.Fatalf("Expected channel allowed after other one closed by error, actual %v", err)
+	}
+
+	closed := sc.client.NotifyClose(make(chan *amqpclient.Error, 1))
+	if _, err := sc.client.Channel(); err == nil {
+		t.Fatal("Expected channel refused by limit")
+	}
+	select {
+	case closeErr := <-closed:
+		if closeErr == nil || closeErr.Code != amqp.NotAllowed {
+			t.Errorf("Expected not allowed, actual %v", closeErr)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected connection closed")
+	}
+}
+
+func Test_VhostLimits_Queues(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	vhost := sc.server.GetVhost("/")
+	sc.server.SetVhostLimits(&limits.VhostLimits{Vhost: "/", MaxQueues: 1})
+
+	ch, _ := sc.client.Channel()
+	if _, err := ch.QueueDeclare("testQu", false, false, false, false, emptyTable); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ch.QueueDeclare("testQu", false, false, false, false, emptyTable); err != nil {
+		t.Fatalf("Expected existing queue declared, actual %v", err)
+	}
+	if err := vhost.DeclareQueue("otherQu", false, false, nil); err == nil {
+		t.Error("Expected queue refused by limit")
+	}
+
+	_, err := ch.QueueDeclare("otherQu", false, false, false, false, emptyTable)
+	if amqpErr, ok := err.(*amqpclient.Error); !ok || amqpErr.Code != amqp.PreconditionFailed {
+		t.Errorf("Expected precondition failed, actual %v", err)
+	}
+	if vhost.GetQueue("otherQu") != nil {
+		t.Error("Expected queue not created")
+	}
+}
+
+func Test_VhostLimits_Exchanges(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	vhost := sc.server.GetVhost("/")
+	sc.server.SetVhostLimits(&limits.VhostLimits{Vhost: "/", MaxExchanges: 1})
+
+	ch, _ := sc.client.Channel()
+	if err := ch.ExchangeDeclare("testEx", "direct", false, false, false, false, emptyTable); err != nil {
+		t.Fatal(err)
+	}
+	if err := vhost.DeclareExchange("otherEx", "direct", false, false, false); err == nil {
+		t.Error("Expected exchange refused by limit")
+	}
+
+	err := ch.ExchangeDeclare("otherEx", "direct", false, false, false, false, emptyTable)
+	if amqpErr, ok := err.(*amqpclient.Error); !ok || amqpErr.Code != amqp.PreconditionFailed {
+		t.Errorf("Expected precondition failed, actual %v", err)
+	}
+	if vhost.GetExchange("otherEx") != nil {
+		t.Error("Expected exchange not created")
+	}
+}
+
+func Test_VhostLimits_Concurrent(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	vhost := sc.server.GetVhost("/")
+	sc.server.SetVhostLimits(&limits.VhostLimits{Vhost: "/", MaxQueues: 5, MaxExchanges: 5})
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			vhost.DeclareQueue(fmt.Sprintf("testQu%d", i), false, false, nil)
+			vhost.DeclareExchange(fmt.Sprintf("testEx%d", i), "direct", false, false, false)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	if count := len(vhost.GetQueues()); count != 5 {
+		t.Errorf("Expected %d queues, actual %d", 5, count)
+	}
+	var count int
+	for _, ex := range vhost.GetExchanges() {
+		if !ex.IsSystem() {
+			count++
+		}
+	}
+	if count != 5 {
+		t.Errorf("Expected %d exchanges, actual %d", 5, count)
+	}
+}
+
+func Test_VhostLimits_Messages(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	vhost := sc.server.GetVhost("/")
+	vhost.DeclareQueue("testQu", false, false, nil)
+	sc.server.SetVhostLimits(&limits.VhostLimits{Vhost: "/", MaxMessages: 2, MaxBytes: 8})
+
+	if _, err := vhost.PublishMessage("", "testQu", nil, []byte("test")); err != nil {
+		t.Fatal(err)
+	}
+
+	ch, _ := sc.client.Channel()
+	closed := ch.NotifyClose(make(chan *amqpclient.Error, 1))
+	for i := 0; i < 2; i++ {
+		ch.Publish("", "testQu", false, false, amqpclient.Publishing{Body: []byte("test")})
+	}
+	select {
+	case closeErr := <-closed:
+		if closeErr == nil || closeErr.Code != amqp.PreconditionFailed {
+			t.Errorf("Expected precondition failed, actual %v", closeErr)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected publish refused by limit")
+	}
+	if length := vhost.GetQueue("testQu").Length(); length != 2 {
+		t.Errorf("Expected %d messages in queue, actual %d", 2, length)
+	}
+
+	sc.server.SetVhostLimits(&limits.VhostLimits{Vhost: "/", MaxBytes: 8})
+	if _, err := vhost.PublishMessage("", "testQu", nil, []byte("test")); err == nil {
+		t.Error("Expected publish refused by byte limit")
+	}
+
+	vhost.PurgeQueue("testQu")
+	if _, err := vhost.PublishMessage("", "testQu", nil, []byte("test")); err != nil {
+		t.Errorf("Expected publish allowed after purge, actual %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/valinurovam/garagemq/amqp"
+	"github.com/valinurovam/garagemq/qos"
+)
+
+// frameOverhead is size of frame type, channel, size and frame-end fields
+const frameOverhead = 8
+
+// maxGetMessages limits count of messages fetched by one request, so whole queue is not buffered at once
+const maxGetMessages = 1000
+
+// PublishMessage routes message into queues the same way as basic.publish does
+// Returns count of queues message was routed to, internal exchanges refuse publishing
+func (vhost *VirtualHost) PublishMessage(exchangeName string, routingKey string, properties *amqp.BasicPropertyList, body []byte) (int, error) {
+	ex := vhost.GetExchange(exchangeName)
+	if ex == nil {
+		return 0, ErrNotFound
+	}
+	if ex.IsInternal() {
+		return 0, ErrAccessRefused
+	}
+	if properties == nil {
+		properties = &amqp.BasicPropertyList{}
+	}
+	if err := vhost.checkMessageLimit(); err != nil {
+		return 0, err
+	}
+
+	message := amqp.NewMessage(&amqp.BasicPublish{Exchange: exchangeName, RoutingKey: routingKey})
+	message.Header = &amqp.ContentHeader{
+		ClassID:      amqp.ClassBasic,
+		BodySize:     uint64(len(body)),
+		PropertyList: properties,
+	}
+	// body frames are sent to consumers as is, so they should fit into negotiated frame size
+	frameSize := int(vhost.srvConfig.Connection.FrameMaxSize) - frameOverhead
+	for len(body) > 0 {
+		size := frameSize
+		if len(body) < size {
+			size = len(body)
+		}
+		message.Append(&amqp.Frame{Type: byte(amqp.FrameBody), Payload: body[:size]})
+		body = body[size:]
+	}
+
+	ex.GetMetrics().MsgIn.Counter.Inc(1)
+	ex.GetMetrics().BodySize.Observe(float64(message.BodySize))
+	routed := 0
+	for queueName := range vhost.routeMessage(ex, message) {
+		qu := vhost.GetQueue(queueName)
+		if qu == nil {
+			continue
+		}
+		qu.Push(message)
+		ex.GetMetrics().MsgOut.Counter.Inc(1)
+		routed++
+	}
+	if routed > 0 {
+		vhost.srv.GetMetrics().Publish.Counter.Inc(1)
+	}
+
+	return routed, nil
+}
+
+// GetMessages pops up to count messages from queue head the same way as basic.get does
+// Count should be positive and it is capped by maxGetMessages
+// If requeue is set messages are returned into queue head in the same order,
+// otherwise they are acknowledged and removed from queue
+func (vhost *VirtualHost) GetMessages(queueName string, count int, requeue bool) ([]*amqp.Message, error) {
+	if count <= 0 {
+		return nil, errors.New("count should be positive")
+	}
+	if count > maxGetMessages {
+		count = maxGetMessages
+	}
+	qu := vhost.GetQueue(queueName)
+	if qu == nil {
+		return nil, ErrNotFound
+	}
+
+	var messages []*amqp.Message
+	for len(messages) < count {
+		message := qu.PopQos([]*qos.AmqpQos{})
+		if message == nil {
+			break
+		}
+		messages = append(messages, message)
+
+		vhost.srv.GetMetrics().Get.Counter.Inc(1)
+		qu.GetMetrics().Get.Counter.Inc(1)
+		qu.GetMetrics().Ready.Counter.Dec(1)
+		qu.GetMetrics().ServerReady.Counter.Dec(1)
+		qu.GetMetrics().Unacked.Counter.Inc(1)
+		qu.GetMetrics().ServerUnacked.Counter.Inc(1)
+	}
+
+	if requeue {
+		for i := len(messages) - 1; i >= 0; i-- {
+			qu.Requeue(messages[i])
+		}
+	} else {
+		for _, message := range messages {
+			qu.AckMsg(message)
+		}
+	}
+
+	return messages, nil
+}
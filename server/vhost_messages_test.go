@@ -0,0 +1,100 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	amqpclient "github.com/streadway/amqp"
+	"github.com/valinurovam/garagemq/amqp"
+)
+
+func TestVirtualHost_PublishGetMessages(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	vhost := sc.server.GetVhost("/")
+	vhost.DeclareQueue("testQu", true, false, nil)
+
+	if _, err := vhost.PublishMessage("unknown", "testQu", nil, []byte("test")); err != ErrNotFound {
+		t.Errorf("Expected not found, actual %v", err)
+	}
+	if routed, _ := vhost.PublishMessage("", "unknown", nil, []byte("test")); routed != 0 {
+		t.Error("Expected message is not routed")
+	}
+
+	// body larger than frame size should be split
+	large := bytes.Repeat([]byte("a"), int(sc.server.config.Connection.FrameMaxSize)*2)
+	deliveryMode := byte(2)
+	contentType := "text/plain"
+	properties := &amqp.BasicPropertyList{DeliveryMode: &deliveryMode, ContentType: &contentType}
+	for _, body := range [][]byte{[]byte("first"), large} {
+		if routed, err := vhost.PublishMessage("", "testQu", properties, body); err != nil || routed != 1 {
+			t.Fatalf("Expected message routed, actual %d %v", routed, err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	qu := vhost.GetQueue("testQu")
+	messages, err := vhost.GetMessages("testQu", 10, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || qu.Length() != 2 {
+		t.Fatalf("Expected 2 messages peeked and requeued, actual %d %d", len(messages), qu.Length())
+	}
+	if string(messages[0].Body[0].Payload) != "first" || *messages[0].Header.PropertyList.ContentType != contentType {
+		t.Error("Expected messages in queue order with properties")
+	}
+	for _, frame := range messages[1].Body {
+		if len(frame.Payload)+frameOverhead > int(sc.server.config.Connection.FrameMaxSize) {
+			t.Error("Expected body split into frames")
+		}
+	}
+
+	messages, _ = vhost.GetMessages("testQu", 1, false)
+	if len(messages) != 1 || string(messages[0].Body[0].Payload) != "first" || qu.Length() != 1 {
+		t.Error("Expected first message consumed")
+	}
+	if _, err := vhost.GetMessages("unknown", 1, false); err != ErrNotFound {
+		t.Errorf("Expected not found, actual %v", err)
+	}
+	if _, err := vhost.GetMessages("testQu", 0, true); err == nil {
+		t.Error("Expected error on not positive count")
+	}
+}
+
+func TestVirtualHost_GetMessages_Capped(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	vhost := sc.server.GetVhost("/")
+	vhost.DeclareQueue("testQu", false, false, nil)
+	for i := 0; i < maxGetMessages+10; i++ {
+		vhost.PublishMessage("", "testQu", nil, []byte("test"))
+	}
+
+	messages, err := vhost.GetMessages("testQu", maxGetMessages*10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != maxGetMessages || vhost.GetQueue("testQu").Length() != 10 {
+		t.Errorf("Expected %d messages fetched, actual %d", maxGetMessages, len(messages))
+	}
+}
+
+func TestVirtualHost_PublishMessage_Internal(t *testing.T) {
+	sc, _ := getNewSC(getDefaultTestConfig())
+	defer sc.clean()
+	vhost := sc.server.GetVhost("/")
+	vhost.DeclareExchange("testEx", "fanout", false, false, true)
+
+	if _, err := vhost.PublishMessage("testEx", "", nil, []byte("test")); err != ErrAccessRefused {
+		t.Errorf("Expected access refused on internal exchange, actual %v", err)
+	}
+
+	ch, _ := sc.client.Channel()
+	ch.Publish("testEx", "", false, false, amqpclient.Publishing{Body: []byte("test")})
+	_, err := ch.QueueDeclarePassive("unknown", false, false, false, false, emptyTable)
+	if amqpErr, ok := err.(*amqpclient.Error); !ok || amqpErr.Code != amqp.AccessRefused {
+		t.Errorf("Expected access refused on publish into internal exchange, actual %v", err)
+	}
+}
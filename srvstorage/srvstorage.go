@@ -7,9 +7,12 @@ import (
 	"strings"
 	"time"
 
+	"github.com/valinurovam/garagemq/auth"
 	"github.com/valinurovam/garagemq/binding"
 	"github.com/valinurovam/garagemq/exchange"
 	"github.com/valinurovam/garagemq/interfaces"
+	"github.com/valinurovam/garagemq/limits"
+	"github.com/valinurovam/garagemq/policy"
 	"github.com/valinurovam/garagemq/queue"
 )
 
@@ -17,6 +20,12 @@ const queuePrefix = "vhost.queue"
 const exchangePrefix = "vhost.exchange"
 const bindingPrefix = "vhost.binding"
 const vhostPrefix = "server.vhost"
+const userPrefix = "server.user"
+const permissionPrefix = "server.permission"
+const topicPermissionPrefix = "server.topic_permission"
+const limitsPrefix = "server.limits"
+const policyPrefix = "server.policy"
+const schemaVersionKey = "schemaVersion"
 
 // SrvStorage implements storage for store all durable server entities
 type SrvStorage struct {
@@ -51,6 +60,23 @@ func (storage *SrvStorage) UpdateLastStart() error {
 	return storage.db.Set("lastStartTime", buf.Bytes())
 }
 
+// GetSchemaVersion returns version of storage layout
+// Storages created before versioning was introduced have version 0
+func (storage *SrvStorage) GetSchemaVersion() uint32 {
+	data, _ := storage.db.Get(schemaVersionKey)
+	if len(data) != 4 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(data)
+}
+
+// SetSchemaVersion stores version of storage layout
+func (storage *SrvStorage) SetSchemaVersion(version uint32) error {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, version)
+	return storage.db.Set(schemaVersionKey, data)
+}
+
 // AddVhost add vhost into storage
 func (storage *SrvStorage) AddVhost(vhost string, system bool) error {
 	key := fmt.Sprintf("%s.%s", vhostPrefix, vhost)
@@ -69,7 +95,7 @@ func (storage *SrvStorage) GetVhosts() map[string]bool {
 			if !bytes.HasPrefix(key, []byte(vhostPrefix)) {
 				return
 			}
-			vhost := getVhostFromKey(string(key))
+			vhost := strings.TrimPrefix(string(key), vhostPrefix+".")
 			system := bytes.Equal(value, []byte{1})
 			vhosts[vhost] = system
 		},
@@ -78,9 +104,214 @@ func (storage *SrvStorage) GetVhosts() map[string]bool {
 	return vhosts
 }
 
+// DelVhost remove vhost with all its queues, exchanges, bindings, limits and policies from storage
+func (storage *SrvStorage) DelVhost(vhost string) error {
+	batch := []*interfaces.Operation{
+		{Key: fmt.Sprintf("%s.%s", vhostPrefix, vhost), Op: interfaces.OpDel},
+		{Key: fmt.Sprintf("%s.%s", limitsPrefix, vhost), Op: interfaces.OpDel},
+	}
+	vhostPolicyPrefix := []byte(policyVhostPrefix(vhost))
+	storage.db.Iterate(
+		func(key []byte, value []byte) {
+			if bytes.HasPrefix(key, vhostPolicyPrefix) {
+				batch = append(batch, &interfaces.Operation{Key: string(key), Op: interfaces.OpDel})
+				return
+			}
+			for _, prefix := range []string{queuePrefix, exchangePrefix, bindingPrefix} {
+				if bytes.HasPrefix(key, []byte(entityVhostPrefix(prefix, vhost))) {
+					batch = append(batch, &interfaces.Operation{Key: string(key), Op: interfaces.OpDel})
+					return
+				}
+			}
+		},
+	)
+
+	return storage.db.ProcessBatch(batch)
+}
+
+// AddUser add user into storage or replace existing one
+func (storage *SrvStorage) AddUser(user *auth.User) error {
+	key := fmt.Sprintf("%s.%s", userPrefix, user.Username)
+	data, err := user.Marshal()
+	if err != nil {
+		return err
+	}
+	return storage.db.Set(key, data)
+}
+
+// DelUser remove user from storage
+func (storage *SrvStorage) DelUser(userName string) error {
+	key := fmt.Sprintf("%s.%s", userPrefix, userName)
+	return storage.db.Del(key)
+}
+
+// GetUsers returns stored users
+func (storage *SrvStorage) GetUsers() []*auth.User {
+	var users []*auth.User
+	storage.db.Iterate(
+		func(key []byte, value []byte) {
+			if !bytes.HasPrefix(key, []byte(userPrefix+".")) {
+				return
+			}
+			user := &auth.User{}
+			user.Unmarshal(value)
+			users = append(users, user)
+		},
+	)
+
+	return users
+}
+
+// AddPermission add user permission on vhost into storage or replace existing one
+func (storage *SrvStorage) AddPermission(perm *auth.Permission) error {
+	data, err := perm.Marshal()
+	if err != nil {
+		return err
+	}
+	return storage.db.Set(getPermissionKey(perm.Username, perm.Vhost), data)
+}
+
+// DelPermission remove user permission on vhost from storage
+func (storage *SrvStorage) DelPermission(userName string, vhost string) error {
+	return storage.db.Del(getPermissionKey(userName, vhost))
+}
+
+// GetPermissions returns stored permissions
+func (storage *SrvStorage) GetPermissions() []*auth.Permission {
+	var permissions []*auth.Permission
+	storage.db.Iterate(
+		func(key []byte, value []byte) {
+			if !bytes.HasPrefix(key, []byte(permissionPrefix+".")) {
+				return
+			}
+			perm := &auth.Permission{}
+			if err := perm.Unmarshal(value); err != nil {
+				return
+			}
+			permissions = append(permissions, perm)
+		},
+	)
+
+	return permissions
+}
+
+// getPermissionKey returns key of permission, user name length keeps key unique for names with dots
+func getPermissionKey(userName string, vhost string) string {
+	return fmt.Sprintf("%s.%d.%s.%s", permissionPrefix, len(userName), userName, vhost)
+}
+
+// AddTopicPermission add user topic permission on vhost exchange into storage or replace existing one
+func (storage *SrvStorage) AddTopicPermission(perm *auth.TopicPermission) error {
+	data, err := perm.Marshal()
+	if err != nil {
+		return err
+	}
+	return storage.db.Set(getTopicPermissionKey(perm.Username, perm.Vhost, perm.Exchange), data)
+}
+
+// DelTopicPermission remove user topic permission on vhost exchange from storage
+func (storage *SrvStorage) DelTopicPermission(userName string, vhost string, exchange string) error {
+	return storage.db.Del(getTopicPermissionKey(userName, vhost, exchange))
+}
+
+// GetTopicPermissions returns stored topic permissions
+func (storage *SrvStorage) GetTopicPermissions() []*auth.TopicPermission {
+	var permissions []*auth.TopicPermission
+	storage.db.Iterate(
+		func(key []byte, value []byte) {
+			if !bytes.HasPrefix(key, []byte(topicPermissionPrefix+".")) {
+				return
+			}
+			perm := &auth.TopicPermission{}
+			if err := perm.Unmarshal(value); err != nil {
+				return
+			}
+			permissions = append(permissions, perm)
+		},
+	)
+
+	return permissions
+}
+
+// getTopicPermissionKey returns key of topic permission, name lengths keep key unique for names with dots
+func getTopicPermissionKey(userName string, vhost string, exchange string) string {
+	return fmt.Sprintf("%s.%d.%s.%d.%s.%s", topicPermissionPrefix, len(userName), userName, len(vhost), vhost, exchange)
+}
+
+// AddVhostLimits add vhost limits into storage or replace existing ones
+func (storage *SrvStorage) AddVhostLimits(vhostLimits *limits.VhostLimits) error {
+	data, err := vhostLimits.Marshal()
+	if err != nil {
+		return err
+	}
+	return storage.db.Set(fmt.Sprintf("%s.%s", limitsPrefix, vhostLimits.Vhost), data)
+}
+
+// DelVhostLimits remove vhost limits from storage
+func (storage *SrvStorage) DelVhostLimits(vhost string) error {
+	return storage.db.Del(fmt.Sprintf("%s.%s", limitsPrefix, vhost))
+}
+
+// GetVhostLimits returns stored limits of vhosts
+func (storage *SrvStorage) GetVhostLimits() []*limits.VhostLimits {
+	var result []*limits.VhostLimits
+	storage.db.Iterate(
+		func(key []byte, value []byte) {
+			if !bytes.HasPrefix(key, []byte(limitsPrefix+".")) {
+				return
+			}
+			vhostLimits := &limits.VhostLimits{}
+			if err := vhostLimits.Unmarshal(value); err != nil {
+				return
+			}
+			result = append(result, vhostLimits)
+		},
+	)
+
+	return result
+}
+
+// vhost name could contain dots, so its length is a part of policy key
+func policyVhostPrefix(vhost string) string {
+	return fmt.Sprintf("%s.%d.%s.", policyPrefix, len(vhost), vhost)
+}
+
+// AddPolicy add policy into storage or replace existing one
+func (storage *SrvStorage) AddPolicy(p *policy.Policy) error {
+	data, err := p.Marshal(storage.protoVersion)
+	if err != nil {
+		return err
+	}
+	return storage.db.Set(policyVhostPrefix(p.Vhost)+p.Name, data)
+}
+
+// DelPolicy remove policy from storage
+func (storage *SrvStorage) DelPolicy(vhost string, name string) error {
+	return storage.db.Del(policyVhostPrefix(vhost) + name)
+}
+
+// GetPolicies returns stored policies of all vhosts
+func (storage *SrvStorage) GetPolicies() []*policy.Policy {
+	var result []*policy.Policy
+	storage.db.Iterate(
+		func(key []byte, value []byte) {
+			if !bytes.HasPrefix(key, []byte(policyPrefix+".")) {
+				return
+			}
+			p := &policy.Policy{}
+			if err := p.Unmarshal(value, storage.protoVersion); err != nil {
+				return
+			}
+			result = append(result, p)
+		},
+	)
+
+	return result
+}
+
 // AddBinding add binding into storage
 func (storage *SrvStorage) AddBinding(vhost string, bind *binding.Binding) error {
-	key := fmt.Sprintf("%s.%s.%s", bindingPrefix, vhost, bind.GetName())
+	key := entityVhostPrefix(bindingPrefix, vhost) + bind.GetName()
 	data, err := bind.Marshal(storage.protoVersion)
 	if err != nil {
 		return err
@@ -90,13 +321,13 @@ func (storage *SrvStorage) AddBinding(vhost string, bind *binding.Binding) error
 
 // DelBinding remove binding from storage
 func (storage *SrvStorage) DelBinding(vhost string, bind *binding.Binding) error {
-	key := fmt.Sprintf("%s.%s.%s", bindingPrefix, vhost, bind.GetName())
+	key := entityVhostPrefix(bindingPrefix, vhost) + bind.GetName()
 	return storage.db.Del(key)
 }
 
 // AddExchange add exchange into storage
 func (storage *SrvStorage) AddExchange(vhost string, ex *exchange.Exchange) error {
-	key := fmt.Sprintf("%s.%s.%s", exchangePrefix, vhost, ex.GetName())
+	key := entityVhostPrefix(exchangePrefix, vhost) + ex.GetName()
 	data, err := ex.Marshal(storage.protoVersion)
 	if err != nil {
 		return err
@@ -106,13 +337,13 @@ func (storage *SrvStorage) AddExchange(vhost string, ex *exchange.Exchange) erro
 
 // DelExchange remove exchange from storage
 func (storage *SrvStorage) DelExchange(vhost string, ex *exchange.Exchange) error {
-	key := fmt.Sprintf("%s.%s.%s", exchangePrefix, vhost, ex.GetName())
+	key := entityVhostPrefix(exchangePrefix, vhost) + ex.GetName()
 	return storage.db.Del(key)
 }
 
 // AddQueue add queue into storage
 func (storage *SrvStorage) AddQueue(vhost string, queue *queue.Queue) error {
-	key := fmt.Sprintf("%s.%s.%s", queuePrefix, vhost, queue.GetName())
+	key := entityVhostPrefix(queuePrefix, vhost) + queue.GetName()
 	data, err := queue.Marshal(storage.protoVersion)
 	if err != nil {
 		return err
@@ -122,7 +353,7 @@ func (storage *SrvStorage) AddQueue(vhost string, queue *queue.Queue) error {
 
 // DelQueue remove queue from storage
 func (storage *SrvStorage) DelQueue(vhost string, queue *queue.Queue) error {
-	key := fmt.Sprintf("%s.%s.%s", queuePrefix, vhost, queue.GetName())
+	key := entityVhostPrefix(queuePrefix, vhost) + queue.GetName()
 	return storage.db.Del(key)
 }
 
@@ -131,7 +362,7 @@ func (storage *SrvStorage) GetVhostQueues(vhost string) []*queue.Queue {
 	var queues []*queue.Queue
 	storage.db.Iterate(
 		func(key []byte, value []byte) {
-			if !bytes.HasPrefix(key, []byte(queuePrefix)) || getVhostFromKey(string(key)) != vhost {
+			if !bytes.HasPrefix(key, []byte(entityVhostPrefix(queuePrefix, vhost))) {
 				return
 			}
 			q := &queue.Queue{}
@@ -148,7 +379,7 @@ func (storage *SrvStorage) GetVhostExchanges(vhost string) []*exchange.Exchange
 	var exchanges []*exchange.Exchange
 	storage.db.Iterate(
 		func(key []byte, value []byte) {
-			if !bytes.HasPrefix(key, []byte(exchangePrefix)) || getVhostFromKey(string(key)) != vhost {
+			if !bytes.HasPrefix(key, []byte(entityVhostPrefix(exchangePrefix, vhost))) {
 				return
 			}
 			ex := &exchange.Exchange{}
@@ -165,7 +396,7 @@ func (storage *SrvStorage) GetVhostBindings(vhost string) []*binding.Binding {
 	var bindings []*binding.Binding
 	storage.db.Iterate(
 		func(key []byte, value []byte) {
-			if !bytes.HasPrefix(key, []byte(bindingPrefix)) || getVhostFromKey(string(key)) != vhost {
+			if !bytes.HasPrefix(key, []byte(entityVhostPrefix(bindingPrefix, vhost))) {
 				return
 			}
 			bind := &binding.Binding{}
@@ -177,9 +408,81 @@ func (storage *SrvStorage) GetVhostBindings(vhost string) []*binding.Binding {
 	return bindings
 }
 
-func getVhostFromKey(key string) string {
-	parts := strings.Split(key, ".")
-	return parts[2]
+// entityVhostPrefix returns key prefix of queues, exchanges or bindings of vhost
+// Vhost name is prefixed with its length, so names could contain dots
+func entityVhostPrefix(prefix string, vhost string) string {
+	return fmt.Sprintf("%s.%d.%s.", prefix, len(vhost), vhost)
+}
+
+// MigrateVhostKeys rewrites queue, exchange and binding keys of previous layout "<prefix>.<vhost>.<name>"
+// into length-prefixed one. Vhost is matched against stored vhosts, so the longest name wins for names with dots
+// In dry-run mode only counts keys to migrate
+func (storage *SrvStorage) MigrateVhostKeys(dryRun bool) (migrated int, err error) {
+	vhosts := storage.GetVhosts()
+	var batch []*interfaces.Operation
+	storage.db.Iterate(
+		func(key []byte, value []byte) {
+			for _, prefix := range []string{queuePrefix, exchangePrefix, bindingPrefix} {
+				if !bytes.HasPrefix(key, []byte(prefix+".")) {
+					continue
+				}
+				rest := string(key[len(prefix)+1:])
+				vhost := ""
+				for name := range vhosts {
+					if strings.HasPrefix(rest, name+".") && len(name) > len(vhost) {
+						vhost = name
+					}
+				}
+				if vhost == "" {
+					return
+				}
+				batch = append(
+					batch,
+					&interfaces.Operation{Key: string(key), Op: interfaces.OpDel},
+					&interfaces.Operation{
+						Key:   entityVhostPrefix(prefix, vhost) + rest[len(vhost)+1:],
+						Value: append([]byte(nil), value...),
+						Op:    interfaces.OpSet,
+					},
+				)
+				migrated++
+				return
+			}
+		},
+	)
+	if dryRun || len(batch) == 0 {
+		return migrated, nil
+	}
+	return migrated, storage.db.ProcessBatch(batch)
+}
+
+// MigrateQueueArguments rewrites stored queues in current format, queues stored without arguments get empty ones
+// Queues are rewritten under the same keys, so migration does not depend on layout of keys
+func (storage *SrvStorage) MigrateQueueArguments(dryRun bool) (migrated int, err error) {
+	var batch []*interfaces.Operation
+	storage.db.IterateByPrefix(
+		[]byte(queuePrefix+"."),
+		0,
+		func(key []byte, value []byte) {
+			if err != nil {
+				return
+			}
+			q := &queue.Queue{}
+			if err = q.Unmarshal(value, storage.protoVersion); err != nil {
+				return
+			}
+			var data []byte
+			if data, err = q.Marshal(storage.protoVersion); err != nil {
+				return
+			}
+			batch = append(batch, &interfaces.Operation{Key: string(key), Value: data, Op: interfaces.OpSet})
+			migrated++
+		},
+	)
+	if err != nil || dryRun || len(batch) == 0 {
+		return migrated, err
+	}
+	return migrated, storage.db.ProcessBatch(batch)
 }
 
 // Close properly close storage database
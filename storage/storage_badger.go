@@ -151,7 +151,7 @@ func (storage *Badger) KeysByPrefixCount(prefix []byte) uint64 {
 }
 
 // Iterate iterates over keys with prefix
-func (storage *Badger) DeleteByPrefix(prefix []byte) {
+func (storage *Badger) DeleteByPrefix(prefix []byte) error {
 	deleteKeys := func(keysForDelete [][]byte) error {
 		if err := storage.db.Update(func(txn *badger.Txn) error {
 			for _, key := range keysForDelete {
@@ -197,8 +197,11 @@ func (storage *Badger) DeleteByPrefix(prefix []byte) {
 	})
 
 	for _, keys := range keysForDeleteBunches {
-		deleteKeys(keys)
+		if err := deleteKeys(keys); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 // Iterate iterates over keys with prefix
@@ -112,8 +112,8 @@ func (storage *BuntDB) IterateByPrefixFrom(prefix []byte, from []byte, limit uin
 	return 0
 }
 
-func (storage *BuntDB) DeleteByPrefix(prefix []byte) {
-
+func (storage *BuntDB) DeleteByPrefix(prefix []byte) error {
+	return nil
 }
 
 func (storage *BuntDB) KeysByPrefixCount(prefix []byte) uint64 {
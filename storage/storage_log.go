@@ -0,0 +1,794 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/btree"
+	"github.com/valinurovam/garagemq/interfaces"
+)
+
+const (
+	logSegmentMaxSize     = 64 << 20 // 64Mb
+	logCompactRatio       = 0.5
+	logCompactInterval    = time.Minute
+	logIterateBatchSize   = 1000
+	logRecordHeaderSize   = 13
+	logSegmentExt         = ".seg"
+	logIndexExt           = ".idx"
+	logIndexDir           = "index"
+	logCheckpointFileName = "checkpoint"
+)
+
+// record flags
+const (
+	logOpSet      byte = 1
+	logOpDel      byte = 2
+	logOpMask     byte = 0x0f
+	logFlagBatch  byte = 0x80 // next record belongs to the same batch
+	logIndexMagic      = "GMQI"
+)
+
+// ErrKeyNotFound returns when requested key does not exist
+var ErrKeyNotFound = errors.New("key not found")
+
+var errLogCorrupted = errors.New("corrupted record")
+
+// SegmentLog implements append-only segmented log storage
+//
+// All operations appended into the active segment file, old values and deleted keys
+// remain in segments until compaction rewrites live records of mostly dead segments.
+// Key locations stored in memory ordered index, which is written on close into
+// index files, one file for each group of keys with the same prefix up to the last dot
+// (for messages it means one file per queue), so that next start does not need to replay all segments
+type SegmentLog struct {
+	dir      string
+	lock     sync.RWMutex
+	index    *btree.BTree
+	segments map[uint32]*logSegment
+	active   *logSegment
+	closeCh  chan struct{}
+	closed   bool
+}
+
+type logSegment struct {
+	id   uint32
+	file *os.File
+	size int64
+	live int64
+}
+
+type logEntry struct {
+	key    string
+	seg    uint32
+	offset int64
+	valLen uint32
+}
+
+func (e *logEntry) Less(than btree.Item, ctx interface{}) bool {
+	return e.key < than.(*logEntry).key
+}
+
+func (e *logEntry) size() int64 {
+	return int64(logRecordHeaderSize + len(e.key) + int(e.valLen))
+}
+
+type logRecord struct {
+	flags byte
+	key   string
+	value []byte
+}
+
+// NewSegmentLog returns new instance of segment log storage
+func NewSegmentLog(storageDir string) *SegmentLog {
+	storage := &SegmentLog{
+		dir:      storageDir,
+		index:    btree.New(32, nil),
+		segments: make(map[uint32]*logSegment),
+		closeCh:  make(chan struct{}),
+	}
+
+	if err := os.MkdirAll(filepath.Join(storageDir, logIndexDir), 0777); err != nil {
+		panic(err)
+	}
+	if err := storage.open(); err != nil {
+		panic(err)
+	}
+
+	go storage.runStorageGC()
+
+	return storage
+}
+
+func (storage *SegmentLog) open() error {
+	files, err := ioutil.ReadDir(storage.dir)
+	if err != nil {
+		return err
+	}
+
+	var ids []uint32
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != logSegmentExt {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(file.Name(), logSegmentExt), 10, 32)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, uint32(id))
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		file, err := os.OpenFile(storage.segmentPath(id), os.O_RDWR, 0666)
+		if err != nil {
+			return err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		storage.segments[id] = &logSegment{id: id, file: file, size: info.Size()}
+	}
+
+	fromSeg, fromOffset, loaded := storage.loadCheckpoint()
+	if !loaded {
+		storage.index = btree.New(32, nil)
+		for _, seg := range storage.segments {
+			seg.live = 0
+		}
+		fromSeg, fromOffset = 0, 0
+	}
+
+	for i, id := range ids {
+		if id < fromSeg {
+			continue
+		}
+		offset := int64(0)
+		if id == fromSeg {
+			offset = fromOffset
+		}
+		if err := storage.replaySegment(storage.segments[id], offset, i == len(ids)-1); err != nil {
+			return fmt.Errorf("segment %d: %s", id, err.Error())
+		}
+	}
+
+	// index files are valid only till the next write, so we drop checkpoint
+	// and in case of crash all segments will be replayed
+	if err := os.Remove(storage.checkpointPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if len(ids) == 0 {
+		return storage.rotate()
+	}
+	storage.active = storage.segments[ids[len(ids)-1]]
+	return nil
+}
+
+// replaySegment apply segment records from offset into index
+// Broken tail of the last segment (not fully written batch) will be truncated
+func (storage *SegmentLog) replaySegment(seg *logSegment, offset int64, last bool) error {
+	reader := bufio.NewReaderSize(io.NewSectionReader(seg.file, offset, seg.size-offset), 1<<20)
+	var batch []*logEntry
+	var batchOps []byte
+	pos := offset
+	committed := offset
+	for {
+		record, size, err := readLogRecord(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if !last {
+				return err
+			}
+			break
+		}
+
+		batch = append(batch, &logEntry{key: record.key, seg: seg.id, offset: pos, valLen: uint32(len(record.value))})
+		batchOps = append(batchOps, record.flags&logOpMask)
+		pos += size
+
+		if record.flags&logFlagBatch != 0 {
+			continue
+		}
+
+		for i, entry := range batch {
+			storage.applyEntry(entry, batchOps[i])
+		}
+		batch = batch[:0]
+		batchOps = batchOps[:0]
+		committed = pos
+	}
+
+	if committed < seg.size {
+		if !last {
+			return errLogCorrupted
+		}
+		if err := seg.file.Truncate(committed); err != nil {
+			return err
+		}
+		seg.size = committed
+	}
+	return nil
+}
+
+// applyEntry put record location into index and update segments live size
+func (storage *SegmentLog) applyEntry(entry *logEntry, op byte) {
+	var old btree.Item
+	if op == logOpSet {
+		old = storage.index.ReplaceOrInsert(entry)
+		storage.segments[entry.seg].live += entry.size()
+	} else {
+		old = storage.index.Delete(entry)
+	}
+
+	if old != nil {
+		oldEntry := old.(*logEntry)
+		if oldSeg, ok := storage.segments[oldEntry.seg]; ok {
+			oldSeg.live -= oldEntry.size()
+		}
+	}
+}
+
+func readLogRecord(reader io.Reader) (record *logRecord, size int64, err error) {
+	header := make([]byte, logRecordHeaderSize)
+	if _, err = io.ReadFull(reader, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, 0, errLogCorrupted
+		}
+		return nil, 0, err
+	}
+	keyLen := binary.BigEndian.Uint32(header[5:9])
+	valLen := binary.BigEndian.Uint32(header[9:13])
+	if keyLen > logSegmentMaxSize || valLen > 1<<31 {
+		return nil, 0, errLogCorrupted
+	}
+
+	data := make([]byte, keyLen+valLen)
+	if _, err = io.ReadFull(reader, data); err != nil {
+		return nil, 0, errLogCorrupted
+	}
+
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	if crc.Sum32() != binary.BigEndian.Uint32(header[0:4]) {
+		return nil, 0, errLogCorrupted
+	}
+
+	record = &logRecord{
+		flags: header[4],
+		key:   string(data[:keyLen]),
+		value: data[keyLen:],
+	}
+	return record, int64(logRecordHeaderSize) + int64(len(data)), nil
+}
+
+func writeLogRecord(buf *bytes.Buffer, record *logRecord) int64 {
+	header := make([]byte, logRecordHeaderSize)
+	header[4] = record.flags
+	binary.BigEndian.PutUint32(header[5:9], uint32(len(record.key)))
+	binary.BigEndian.PutUint32(header[9:13], uint32(len(record.value)))
+
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write([]byte(record.key))
+	crc.Write(record.value)
+	binary.BigEndian.PutUint32(header[0:4], crc.Sum32())
+
+	buf.Write(header)
+	buf.WriteString(record.key)
+	buf.Write(record.value)
+	return int64(logRecordHeaderSize + len(record.key) + len(record.value))
+}
+
+// appendRecords write records as one batch into active segment and update index
+// should be called under write lock
+func (storage *SegmentLog) appendRecords(records []*logRecord) error {
+	if storage.closed {
+		return errors.New("storage closed")
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	if storage.active.size >= logSegmentMaxSize {
+		if err := storage.rotate(); err != nil {
+			return err
+		}
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0))
+	entries := make([]*logEntry, len(records))
+	offset := storage.active.size
+	for i, record := range records {
+		if i < len(records)-1 {
+			record.flags |= logFlagBatch
+		}
+		entries[i] = &logEntry{key: record.key, seg: storage.active.id, offset: offset, valLen: uint32(len(record.value))}
+		offset += writeLogRecord(buf, record)
+	}
+
+	if _, err := storage.active.file.WriteAt(buf.Bytes(), storage.active.size); err != nil {
+		return err
+	}
+	if err := storage.active.file.Sync(); err != nil {
+		return err
+	}
+	storage.active.size = offset
+
+	for i, entry := range entries {
+		storage.applyEntry(entry, records[i].flags&logOpMask)
+	}
+	return nil
+}
+
+// rotate create new active segment
+func (storage *SegmentLog) rotate() error {
+	var id uint32 = 1
+	if storage.active != nil {
+		id = storage.active.id + 1
+		if err := storage.active.file.Sync(); err != nil {
+			return err
+		}
+	}
+	file, err := os.OpenFile(storage.segmentPath(id), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	seg := &logSegment{id: id, file: file}
+	storage.segments[id] = seg
+	storage.active = seg
+	return nil
+}
+
+func (storage *SegmentLog) readValue(entry *logEntry) ([]byte, error) {
+	seg, ok := storage.segments[entry.seg]
+	if !ok {
+		return nil, errLogCorrupted
+	}
+	value := make([]byte, entry.valLen)
+	_, err := seg.file.ReadAt(value, entry.offset+int64(logRecordHeaderSize)+int64(len(entry.key)))
+	return value, err
+}
+
+// ProcessBatch process batch of operations
+func (storage *SegmentLog) ProcessBatch(batch []*interfaces.Operation) (err error) {
+	records := make([]*logRecord, 0, len(batch))
+	for _, op := range batch {
+		if op.Op == interfaces.OpSet {
+			records = append(records, &logRecord{flags: logOpSet, key: op.Key, value: op.Value})
+		}
+		if op.Op == interfaces.OpDel {
+			records = append(records, &logRecord{flags: logOpDel, key: op.Key})
+		}
+	}
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	return storage.appendRecords(records)
+}
+
+// Set adds a key-value pair to the database
+func (storage *SegmentLog) Set(key string, value []byte) (err error) {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	return storage.appendRecords([]*logRecord{{flags: logOpSet, key: key, value: value}})
+}
+
+// Del deletes a key
+func (storage *SegmentLog) Del(key string) (err error) {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	return storage.appendRecords([]*logRecord{{flags: logOpDel, key: key}})
+}
+
+// Get returns value by key
+func (storage *SegmentLog) Get(key string) (value []byte, err error) {
+	storage.lock.RLock()
+	defer storage.lock.RUnlock()
+	item := storage.index.Get(&logEntry{key: key})
+	if item == nil {
+		return nil, ErrKeyNotFound
+	}
+	return storage.readValue(item.(*logEntry))
+}
+
+// Iterate iterates over all keys
+func (storage *SegmentLog) Iterate(fn func(key []byte, value []byte)) {
+	storage.IterateByPrefix([]byte{}, 0, fn)
+}
+
+// IterateByPrefix iterates over keys with prefix
+func (storage *SegmentLog) IterateByPrefix(prefix []byte, limit uint64, fn func(key []byte, value []byte)) uint64 {
+	return storage.IterateByPrefixFrom(prefix, prefix, limit, fn)
+}
+
+// IterateByPrefixFrom iterates over keys with prefix starting from given key
+func (storage *SegmentLog) IterateByPrefixFrom(prefix []byte, from []byte, limit uint64, fn func(key []byte, value []byte)) uint64 {
+	var iterated uint64
+	next := string(from)
+	for {
+		batchSize := uint64(logIterateBatchSize)
+		if limit > 0 && limit-iterated < batchSize {
+			batchSize = limit - iterated
+		}
+		keys, values, done := storage.readByPrefixFrom(string(prefix), next, batchSize)
+		for i := range keys {
+			fn(keys[i], values[i])
+		}
+		iterated += uint64(len(keys))
+		if done || (limit > 0 && iterated >= limit) {
+			return iterated
+		}
+		// the least key greater than the last iterated one
+		next = string(keys[len(keys)-1]) + "\x00"
+	}
+}
+
+// readByPrefixFrom reads up to count values with prefix starting from given key
+// Values are read in bounded batches under lock and fn called without it, so fn can use storage itself
+// done is false if there could be more keys with prefix
+func (storage *SegmentLog) readByPrefixFrom(prefix string, from string, count uint64) (keys [][]byte, values [][]byte, done bool) {
+	storage.lock.RLock()
+	defer storage.lock.RUnlock()
+
+	done = true
+	storage.index.AscendGreaterOrEqual(&logEntry{key: from}, func(item btree.Item) bool {
+		entry := item.(*logEntry)
+		if !strings.HasPrefix(entry.key, prefix) {
+			return false
+		}
+		if uint64(len(keys)) >= count {
+			done = false
+			return false
+		}
+		value, err := storage.readValue(entry)
+		if err != nil {
+			return false
+		}
+		keys = append(keys, []byte(entry.key))
+		values = append(values, value)
+		return true
+	})
+	return keys, values, done
+}
+
+// KeysByPrefixCount returns count of keys with prefix
+func (storage *SegmentLog) KeysByPrefixCount(prefix []byte) uint64 {
+	return uint64(len(storage.keysByPrefix(prefix)))
+}
+
+// DeleteByPrefix deletes all keys with prefix
+func (storage *SegmentLog) DeleteByPrefix(prefix []byte) error {
+	keys := storage.keysByPrefix(prefix)
+	records := make([]*logRecord, 0, len(keys))
+	for _, key := range keys {
+		records = append(records, &logRecord{flags: logOpDel, key: key})
+	}
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	return storage.appendRecords(records)
+}
+
+func (storage *SegmentLog) keysByPrefix(prefix []byte) []string {
+	storage.lock.RLock()
+	defer storage.lock.RUnlock()
+
+	var keys []string
+	storage.index.AscendGreaterOrEqual(&logEntry{key: string(prefix)}, func(item btree.Item) bool {
+		entry := item.(*logEntry)
+		if !strings.HasPrefix(entry.key, string(prefix)) {
+			return false
+		}
+		keys = append(keys, entry.key)
+		return true
+	})
+	return keys
+}
+
+// Compact rewrites live records of segments where dead records ratio is above the threshold
+// into the active segment and removes such segments
+func (storage *SegmentLog) Compact() error {
+	storage.lock.RLock()
+	var ids []uint32
+	for id := range storage.segments {
+		ids = append(ids, id)
+	}
+	storage.lock.RUnlock()
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		if err := storage.compactSegment(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (storage *SegmentLog) compactSegment(id uint32) error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	seg, ok := storage.segments[id]
+	if storage.closed || !ok || seg == storage.active {
+		return nil
+	}
+	if seg.size > 0 && float64(seg.size-seg.live)/float64(seg.size) < logCompactRatio {
+		return nil
+	}
+
+	hasLower := false
+	for otherID := range storage.segments {
+		if otherID < id {
+			hasLower = true
+			break
+		}
+	}
+
+	reader := bufio.NewReaderSize(io.NewSectionReader(seg.file, 0, seg.size), 1<<20)
+	var records []*logRecord
+	var pos int64
+	for pos < seg.size {
+		record, size, err := readLogRecord(reader)
+		if err != nil {
+			return err
+		}
+		offset := pos
+		pos += size
+		record.flags &= logOpMask
+
+		item := storage.index.Get(&logEntry{key: record.key})
+		if record.flags == logOpSet {
+			// copy only actual value for key
+			if item == nil || item.(*logEntry).seg != id || item.(*logEntry).offset != offset {
+				continue
+			}
+		} else if item != nil || !hasLower {
+			// tombstone is needed only while older segments may contain value for deleted key
+			continue
+		}
+
+		records = append(records, record)
+	}
+
+	// copied records are written as one batch, so segment will be removed only after all of them are synced
+	if err := storage.appendRecords(records); err != nil {
+		return err
+	}
+	delete(storage.segments, id)
+	seg.file.Close()
+	return os.Remove(storage.segmentPath(id))
+}
+
+// Close properly closes log storage and store index files
+func (storage *SegmentLog) Close() error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	if storage.closed {
+		return nil
+	}
+	storage.closed = true
+	close(storage.closeCh)
+
+	if err := storage.active.file.Sync(); err != nil {
+		return err
+	}
+	saveErr := storage.saveCheckpoint()
+	for _, seg := range storage.segments {
+		seg.file.Close()
+	}
+	return saveErr
+}
+
+// saveCheckpoint writes index files and checkpoint with active segment position
+func (storage *SegmentLog) saveCheckpoint() error {
+	indexDir := filepath.Join(storage.dir, logIndexDir)
+	oldFiles, err := ioutil.ReadDir(indexDir)
+	if err != nil {
+		return err
+	}
+	for _, file := range oldFiles {
+		if err := os.Remove(filepath.Join(indexDir, file.Name())); err != nil {
+			return err
+		}
+	}
+
+	groups := make(map[string]*bytes.Buffer)
+	storage.index.Ascend(func(item btree.Item) bool {
+		entry := item.(*logEntry)
+		group := getLogKeyGroup(entry.key)
+		buf, ok := groups[group]
+		if !ok {
+			buf = bytes.NewBuffer(make([]byte, 0))
+			buf.WriteString(logIndexMagic)
+			writeLogBytes(buf, []byte(group))
+			groups[group] = buf
+		}
+		writeLogBytes(buf, []byte(entry.key))
+		binary.Write(buf, binary.BigEndian, entry.seg)
+		binary.Write(buf, binary.BigEndian, entry.offset)
+		binary.Write(buf, binary.BigEndian, entry.valLen)
+		return true
+	})
+
+	for group, buf := range groups {
+		if err := writeFileSync(storage.indexPath(group), buf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0))
+	buf.WriteString(logIndexMagic)
+	binary.Write(buf, binary.BigEndian, storage.active.id)
+	binary.Write(buf, binary.BigEndian, storage.active.size)
+	binary.Write(buf, binary.BigEndian, uint32(len(storage.segments)))
+	for id, seg := range storage.segments {
+		binary.Write(buf, binary.BigEndian, id)
+		binary.Write(buf, binary.BigEndian, seg.live)
+	}
+
+	tmpPath := storage.checkpointPath() + ".tmp"
+	if err := writeFileSync(tmpPath, buf.Bytes()); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, storage.checkpointPath())
+}
+
+// loadCheckpoint load index files if checkpoint exists
+// Returns segment position from which log should be replayed
+func (storage *SegmentLog) loadCheckpoint() (seg uint32, offset int64, ok bool) {
+	data, err := ioutil.ReadFile(storage.checkpointPath())
+	if err != nil || !bytes.HasPrefix(data, []byte(logIndexMagic)) {
+		return 0, 0, false
+	}
+	reader := bytes.NewReader(data[len(logIndexMagic):])
+	var count uint32
+	if binary.Read(reader, binary.BigEndian, &seg) != nil ||
+		binary.Read(reader, binary.BigEndian, &offset) != nil ||
+		binary.Read(reader, binary.BigEndian, &count) != nil {
+		return 0, 0, false
+	}
+	if active, exists := storage.segments[seg]; !exists || active.size < offset {
+		return 0, 0, false
+	}
+	for i := uint32(0); i < count; i++ {
+		var id uint32
+		var live int64
+		if binary.Read(reader, binary.BigEndian, &id) != nil || binary.Read(reader, binary.BigEndian, &live) != nil {
+			return 0, 0, false
+		}
+		if s, exists := storage.segments[id]; exists {
+			s.live = live
+		}
+	}
+
+	files, err := ioutil.ReadDir(filepath.Join(storage.dir, logIndexDir))
+	if err != nil {
+		return 0, 0, false
+	}
+	for _, file := range files {
+		if filepath.Ext(file.Name()) != logIndexExt {
+			continue
+		}
+		if err := storage.loadIndexFile(filepath.Join(storage.dir, logIndexDir, file.Name())); err != nil {
+			return 0, 0, false
+		}
+	}
+	return seg, offset, true
+}
+
+func (storage *SegmentLog) loadIndexFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(data, []byte(logIndexMagic)) {
+		return errLogCorrupted
+	}
+	reader := bytes.NewReader(data[len(logIndexMagic):])
+	if _, err := readLogBytes(reader); err != nil {
+		return err
+	}
+	for reader.Len() > 0 {
+		key, err := readLogBytes(reader)
+		if err != nil {
+			return err
+		}
+		entry := &logEntry{key: string(key)}
+		if binary.Read(reader, binary.BigEndian, &entry.seg) != nil ||
+			binary.Read(reader, binary.BigEndian, &entry.offset) != nil ||
+			binary.Read(reader, binary.BigEndian, &entry.valLen) != nil {
+			return errLogCorrupted
+		}
+		if _, ok := storage.segments[entry.seg]; !ok {
+			return errLogCorrupted
+		}
+		storage.index.ReplaceOrInsert(entry)
+	}
+	return nil
+}
+
+func writeLogBytes(buf *bytes.Buffer, data []byte) {
+	binary.Write(buf, binary.BigEndian, uint32(len(data)))
+	buf.Write(data)
+}
+
+func readLogBytes(reader *bytes.Reader) ([]byte, error) {
+	var length uint32
+	if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	if int(length) > reader.Len() {
+		return nil, errLogCorrupted
+	}
+	data := make([]byte, length)
+	_, err := io.ReadFull(reader, data)
+	return data, err
+}
+
+func writeFileSync(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// getLogKeyGroup returns key prefix up to the last dot, keys from one group share one index file
+func getLogKeyGroup(key string) string {
+	return key[:strings.LastIndex(key, ".")+1]
+}
+
+func (storage *SegmentLog) segmentPath(id uint32) string {
+	return filepath.Join(storage.dir, fmt.Sprintf("%010d%s", id, logSegmentExt))
+}
+
+func (storage *SegmentLog) indexPath(group string) string {
+	h := md5.New()
+	h.Write([]byte(group))
+	return filepath.Join(storage.dir, logIndexDir, hex.EncodeToString(h.Sum(nil))+logIndexExt)
+}
+
+func (storage *SegmentLog) checkpointPath() string {
+	return filepath.Join(storage.dir, logCheckpointFileName)
+}
+
+func (storage *SegmentLog) runStorageGC() {
+	timer := time.NewTicker(logCompactInterval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-storage.closeCh:
+			return
+		case <-timer.C:
+			if err := storage.Compact(); err != nil {
+				log.WithError(err).WithField("dir", storage.dir).Error("Segment log compaction failed")
+			}
+		}
+	}
+}
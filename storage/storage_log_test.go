@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/valinurovam/garagemq/interfaces"
+)
+
+func getTestLogDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "segmentlog_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func fillTestLog(storage *SegmentLog, queue string, count int) {
+	batch := make([]*interfaces.Operation, 0, count)
+	for i := 0; i < count; i++ {
+		batch = append(batch, &interfaces.Operation{
+			Key:   fmt.Sprintf("msg.%s.%03d", queue, i),
+			Value: []byte(fmt.Sprintf("value_%d", i)),
+			Op:    interfaces.OpSet,
+		})
+	}
+	storage.ProcessBatch(batch)
+}
+
+func TestSegmentLog_SetGetDel(t *testing.T) {
+	dir := getTestLogDir(t)
+	defer os.RemoveAll(dir)
+	storage := NewSegmentLog(dir)
+	defer storage.Close()
+
+	if err := storage.Set("key", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	value, err := storage.Get("key")
+	if err != nil || string(value) != "value" {
+		t.Fatalf("Expected value, actual %s, %v", value, err)
+	}
+
+	storage.Set("key", []byte("value2"))
+	if value, _ = storage.Get("key"); string(value) != "value2" {
+		t.Fatalf("Expected value2, actual %s", value)
+	}
+
+	storage.Del("key")
+	if _, err = storage.Get("key"); err != ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound, actual %v", err)
+	}
+}
+
+func TestSegmentLog_Prefix(t *testing.T) {
+	dir := getTestLogDir(t)
+	defer os.RemoveAll(dir)
+	storage := NewSegmentLog(dir)
+	defer storage.Close()
+
+	fillTestLog(storage, "q1", 10)
+	fillTestLog(storage, "q2", 5)
+
+	if cnt := storage.KeysByPrefixCount([]byte("msg.q1.")); cnt != 10 {
+		t.Fatalf("Expected 10 keys, actual %d", cnt)
+	}
+
+	var keys []string
+	iterated := storage.IterateByPrefixFrom([]byte("msg.q1."), []byte("msg.q1.005"), 3, func(key []byte, value []byte) {
+		keys = append(keys, string(key))
+	})
+	if iterated != 3 || keys[0] != "msg.q1.005" || keys[2] != "msg.q1.007" {
+		t.Fatalf("Unexpected iteration result %d %v", iterated, keys)
+	}
+
+	storage.DeleteByPrefix([]byte("msg.q1."))
+	if cnt := storage.KeysByPrefixCount([]byte("msg.q1.")); cnt != 0 {
+		t.Fatalf("Expected 0 keys after delete, actual %d", cnt)
+	}
+	if cnt := storage.KeysByPrefixCount([]byte("msg.")); cnt != 5 {
+		t.Fatalf("Expected 5 keys, actual %d", cnt)
+	}
+}
+
+func TestSegmentLog_IterateBatches(t *testing.T) {
+	dir := getTestLogDir(t)
+	defer os.RemoveAll(dir)
+	storage := NewSegmentLog(dir)
+	defer storage.Close()
+
+	count := 2*logIterateBatchSize + 500
+	fillTestLog(storage, "q1", count)
+	fillTestLog(storage, "q2", 5)
+
+	keys := make(map[string]struct{})
+	// callback could change storage between batches
+	iterated := storage.IterateByPrefix([]byte("msg.q1."), 0, func(key []byte, value []byte) {
+		keys[string(key)] = struct{}{}
+		storage.Del(string(key))
+	})
+	if iterated != uint64(count) || len(keys) != count {
+		t.Fatalf("Expected %d keys iterated once, actual %d of %d", count, len(keys), iterated)
+	}
+
+	fillTestLog(storage, "q1", count)
+	limit := uint64(logIterateBatchSize + 10)
+	if iterated := storage.IterateByPrefix([]byte("msg.q1."), limit, func(key []byte, value []byte) {}); iterated != limit {
+		t.Fatalf("Expected %d keys iterated, actual %d", limit, iterated)
+	}
+}
+
+func TestSegmentLog_DeleteByPrefix_Error(t *testing.T) {
+	dir := getTestLogDir(t)
+	defer os.RemoveAll(dir)
+	storage := NewSegmentLog(dir)
+	fillTestLog(storage, "q1", 10)
+	storage.Close()
+
+	if err := storage.DeleteByPrefix([]byte("msg.q1.")); err == nil {
+		t.Fatal("Expected error on delete from closed storage")
+	}
+}
+
+func TestSegmentLog_Reopen(t *testing.T) {
+	for _, clean := range []bool{true, false} {
+		dir := getTestLogDir(t)
+		storage := NewSegmentLog(dir)
+		fillTestLog(storage, "q1", 10)
+		storage.Del("msg.q1.003")
+		storage.Set("msg.q1.004", []byte("updated"))
+
+		if clean {
+			storage.Close()
+		} else {
+			// emulate crash - close files without checkpoint
+			storage.closed = true
+			close(storage.closeCh)
+			for _, seg := range storage.segments {
+				seg.file.Close()
+			}
+		}
+
+		storage = NewSegmentLog(dir)
+		if cnt := storage.KeysByPrefixCount([]byte("msg.q1.")); cnt != 9 {
+			t.Fatalf("Expected 9 keys after reopen, actual %d", cnt)
+		}
+		if value, _ := storage.Get("msg.q1.004"); string(value) != "updated" {
+			t.Fatalf("Expected updated value after reopen, actual %s", value)
+		}
+		storage.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSegmentLog_TruncateBrokenTail(t *testing.T) {
+	dir := getTestLogDir(t)
+	defer os.RemoveAll(dir)
+	storage := NewSegmentLog(dir)
+	fillTestLog(storage, "q1", 3)
+	size := storage.active.size
+	path := storage.segmentPath(storage.active.id)
+	storage.closed = true
+	close(storage.closeCh)
+	storage.active.file.Close()
+
+	// emulate not fully written batch
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0666)
+	file.Write([]byte{1, 2, 3, 4, 5, 6, 7})
+	file.Close()
+
+	storage = NewSegmentLog(dir)
+	defer storage.Close()
+	if storage.active.size != size {
+		t.Fatalf("Expected truncated segment size %d, actual %d", size, storage.active.size)
+	}
+	if cnt := storage.KeysByPrefixCount([]byte("msg.q1.")); cnt != 3 {
+		t.Fatalf("Expected 3 keys, actual %d", cnt)
+	}
+}
+
+func TestSegmentLog_Compact(t *testing.T) {
+	dir := getTestLogDir(t)
+	defer os.RemoveAll(dir)
+	storage := NewSegmentLog(dir)
+
+	fillTestLog(storage, "q1", 10)
+	oldSegID := storage.active.id
+	storage.rotate()
+	for i := 0; i < 9; i++ {
+		storage.Del(fmt.Sprintf("msg.q1.%03d", i))
+	}
+
+	if err := storage.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := storage.segments[oldSegID]; ok {
+		t.Fatal("Expected compacted segment removed")
+	}
+	if value, _ := storage.Get("msg.q1.009"); string(value) != "value_9" {
+		t.Fatalf("Expected live value moved, actual %s", value)
+	}
+	storage.Close()
+
+	storage = NewSegmentLog(dir)
+	defer storage.Close()
+	if cnt := storage.KeysByPrefixCount([]byte("msg.q1.")); cnt != 1 {
+		t.Fatalf("Expected 1 key after compaction and reopen, actual %d", cnt)
+	}
+}
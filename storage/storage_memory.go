@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/tidwall/btree"
+	"github.com/valinurovam/garagemq/interfaces"
+)
+
+// Memory implements in-memory storage with ordered keys
+// Nothing is stored on disk, so all data is lost after close
+type Memory struct {
+	lock sync.RWMutex
+	db   *btree.BTree
+}
+
+type memoryItem struct {
+	key   string
+	value []byte
+}
+
+func (item *memoryItem) Less(than btree.Item, ctx interface{}) bool {
+	return item.key < than.(*memoryItem).key
+}
+
+// NewMemory returns new instance of in-memory storage
+func NewMemory() *Memory {
+	return &Memory{
+		db: btree.New(32, nil),
+	}
+}
+
+// ProcessBatch process batch of operations
+func (storage *Memory) ProcessBatch(batch []*interfaces.Operation) (err error) {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	for _, op := range batch {
+		if op.Op == interfaces.OpSet {
+			storage.set(op.Key, op.Value)
+		}
+		if op.Op == interfaces.OpDel {
+			storage.db.Delete(&memoryItem{key: op.Key})
+		}
+	}
+	return nil
+}
+
+// Close releases stored data
+func (storage *Memory) Close() error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	storage.db = btree.New(32, nil)
+	return nil
+}
+
+// Set adds a key-value pair to the database
+func (storage *Memory) Set(key string, value []byte) (err error) {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	storage.set(key, value)
+	return nil
+}
+
+func (storage *Memory) set(key string, value []byte) {
+	stored := make([]byte, len(value))
+	copy(stored, value)
+	storage.db.ReplaceOrInsert(&memoryItem{key: key, value: stored})
+}
+
+// Del deletes a key
+func (storage *Memory) Del(key string) (err error) {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	storage.db.Delete(&memoryItem{key: key})
+	return nil
+}
+
+// Get returns value by key
+func (storage *Memory) Get(key string) (value []byte, err error) {
+	storage.lock.RLock()
+	defer storage.lock.RUnlock()
+	item := storage.db.Get(&memoryItem{key: key})
+	if item == nil {
+		return nil, ErrKeyNotFound
+	}
+	stored := item.(*memoryItem).value
+	value = make([]byte, len(stored))
+	copy(value, stored)
+	return value, nil
+}
+
+// Iterate iterates over all keys
+func (storage *Memory) Iterate(fn func(key []byte, value []byte)) {
+	storage.IterateByPrefix([]byte{}, 0, fn)
+}
+
+// IterateByPrefix iterates over keys with prefix
+func (storage *Memory) IterateByPrefix(prefix []byte, limit uint64, fn func(key []byte, value []byte)) uint64 {
+	return storage.IterateByPrefixFrom(prefix, prefix, limit, fn)
+}
+
+// IterateByPrefixFrom iterates over keys with prefix starting from given key
+func (storage *Memory) IterateByPrefixFrom(prefix []byte, from []byte, limit uint64, fn func(key []byte, value []byte)) uint64 {
+	items := storage.itemsByPrefixFrom(prefix, from, limit)
+	for _, item := range items {
+		value := make([]byte, len(item.value))
+		copy(value, item.value)
+		fn([]byte(item.key), value)
+	}
+	return uint64(len(items))
+}
+
+// KeysByPrefixCount returns count of keys with prefix
+func (storage *Memory) KeysByPrefixCount(prefix []byte) uint64 {
+	return uint64(len(storage.itemsByPrefixFrom(prefix, prefix, 0)))
+}
+
+// DeleteByPrefix deletes all keys with prefix
+func (storage *Memory) DeleteByPrefix(prefix []byte) error {
+	items := storage.itemsByPrefixFrom(prefix, prefix, 0)
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	for _, item := range items {
+		storage.db.Delete(item)
+	}
+	return nil
+}
+
+// itemsByPrefixFrom collect items under lock, so callbacks can use storage itself
+func (storage *Memory) itemsByPrefixFrom(prefix []byte, from []byte, limit uint64) []*memoryItem {
+	storage.lock.RLock()
+	defer storage.lock.RUnlock()
+
+	var items []*memoryItem
+	storage.db.AscendGreaterOrEqual(&memoryItem{key: string(from)}, func(i btree.Item) bool {
+		item := i.(*memoryItem)
+		if !strings.HasPrefix(item.key, string(prefix)) || (limit > 0 && uint64(len(items)) >= limit) {
+			return false
+		}
+		items = append(items, item)
+		return true
+	})
+	return items
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/valinurovam/garagemq/interfaces"
+)
+
+func TestMemory_SetGetDel(t *testing.T) {
+	storage := NewMemory()
+	defer storage.Close()
+
+	value := []byte("value")
+	storage.Set("key", value)
+	value[0] = 'V'
+	if stored, err := storage.Get("key"); err != nil || string(stored) != "value" {
+		t.Fatalf("Expected value, actual %s, %v", stored, err)
+	}
+
+	storage.Del("key")
+	if _, err := storage.Get("key"); err != ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound, actual %v", err)
+	}
+}
+
+func TestMemory_Prefix(t *testing.T) {
+	storage := NewMemory()
+	defer storage.Close()
+
+	batch := make([]*interfaces.Operation, 0)
+	for i := 0; i < 10; i++ {
+		batch = append(batch, &interfaces.Operation{Key: fmt.Sprintf("msg.q1.%03d", i), Value: []byte("v"), Op: interfaces.OpSet})
+	}
+	batch = append(batch, &interfaces.Operation{Key: "msg.q2.000", Value: []byte("v"), Op: interfaces.OpSet})
+	storage.ProcessBatch(batch)
+
+	if cnt := storage.KeysByPrefixCount([]byte("msg.q1.")); cnt != 10 {
+		t.Fatalf("Expected 10 keys, actual %d", cnt)
+	}
+
+	var keys []string
+	iterated := storage.IterateByPrefixFrom([]byte("msg.q1."), []byte("msg.q1.005"), 3, func(key []byte, value []byte) {
+		keys = append(keys, string(key))
+		// callback is able to modify storage
+		storage.Del(string(key))
+	})
+	if iterated != 3 || keys[0] != "msg.q1.005" || keys[2] != "msg.q1.007" {
+		t.Fatalf("Unexpected iteration result %d %v", iterated, keys)
+	}
+
+	storage.DeleteByPrefix([]byte("msg.q1."))
+	if cnt := storage.KeysByPrefixCount([]byte("msg.")); cnt != 1 {
+		t.Fatalf("Expected 1 key, actual %d", cnt)
+	}
+}